@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/powerpixel/pipelinefox/config"
+	"github.com/powerpixel/pipelinefox/runner/common"
+	"github.com/powerpixel/pipelinefox/secrets"
+	"github.com/powerpixel/pipelinefox/shell"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+// cacheDir is the directory, relative to the project, where data is cached
+// between runs unless configured otherwise.
+const cacheDir = ".pipelinefox/cache"
+
+var (
+	profile      string
+	concurrency  int
+	cachePath    string
+	pullPolicy   string
+	offline      bool
+	dockerSocket bool
+	shellName    string
+	varFiles     []string
+)
+
+var variableNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Print the configuration in effect",
+	Long: "Print the configuration in effect once merged from, by increasing precedence, " +
+		"~/.config/pipelinefox/config.yml, the .pipelinefox.yml of the project, the selected profile of both, " +
+		"PIPELINEFOX_* environment variables and flags.",
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		settings, err := loadConfig(cmd)
+		if err != nil {
+			return err
+		}
+		content, err := yaml.Marshal(settings)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(content)
+		return err
+	},
+}
+
+// loadConfig returns the configuration of the project in scanPath. The
+// files of the user and of the project are merged, then the profile they
+// declare selected through --profile or PIPELINEFOX_PROFILE, then the
+// environment and finally the flags given to cmd.
+func loadConfig(cmd *cobra.Command) (config.Config, error) {
+	userPath, err := config.UserPath()
+	if err != nil {
+		return config.Config{}, err
+	}
+
+	selected := profile
+	if !cmd.Flags().Changed("profile") {
+		selected = os.Getenv(config.ProfileEnv)
+	}
+
+	settings, err := config.Load(selected, userPath, config.ProjectPath(scanPath))
+	if err != nil {
+		return config.Config{}, err
+	}
+
+	env, err := config.FromEnv(os.LookupEnv)
+	if err != nil {
+		return config.Config{}, err
+	}
+	settings = settings.Merge(env)
+
+	var flags config.Config
+	if f := cmd.Flags().Lookup("executor"); f != nil && f.Changed {
+		flags.Executor = executor
+	}
+	if f := cmd.Flags().Lookup("concurrency"); f != nil && f.Changed {
+		flags.Concurrency = concurrency
+	}
+	if f := cmd.Flags().Lookup("cache-dir"); f != nil && f.Changed {
+		flags.CacheDir, err = filepath.Abs(cachePath)
+		if err != nil {
+			return config.Config{}, err
+		}
+	}
+	if f := cmd.Flags().Lookup("pull-policy"); f != nil && f.Changed {
+		flags.PullPolicy = pullPolicy
+	}
+	if f := cmd.Flags().Lookup("shell"); f != nil && f.Changed {
+		flags.Shell = shellName
+	}
+	settings = settings.Merge(flags)
+	// Merging only turns boolean settings on, --offline=false and
+	// --docker-socket=false turning them off.
+	if f := cmd.Flags().Lookup("offline"); f != nil && f.Changed {
+		settings.Offline = offline
+	}
+	if f := cmd.Flags().Lookup("docker-socket"); f != nil && f.Changed {
+		settings.Docker.HostSocket = dockerSocket
+	}
+
+	if settings.Executor == "" {
+		settings.Executor = dockerExecutor
+	}
+	if settings.CacheDir == "" {
+		settings.CacheDir = filepath.Join(scanPath, cacheDir)
+	}
+	return settings, nil
+}
+
+// loadShells reads the templates of the custom shells of the configuration,
+// and checks the shell it selects exists.
+func loadShells(settings config.Config) (shell.Shells, error) {
+	shells := make(shell.Shells, len(settings.Shells))
+	for name, custom := range settings.Shells {
+		content, err := os.ReadFile(custom.Template)
+		if err != nil {
+			return nil, fmt.Errorf("could not read the template of shell %s: %w", name, err)
+		}
+		if shells[name], err = shell.NewShell(name, string(content), custom.Command, custom.Extension); err != nil {
+			return nil, err
+		}
+	}
+	if settings.Shell != "" {
+		if _, err := shells.Lookup(settings.Shell); err != nil {
+			return nil, err
+		}
+	}
+	return shells, nil
+}
+
+// loadSecrets reads the secrets of the configuration, along with the file
+// variables of the configuration and of --var-file. Missing secrets files
+// and values which cannot be masked are reported on stderr.
+func loadSecrets(ctx context.Context, settings config.Config) ([]common.Secret, error) {
+	for _, path := range settings.Secrets.Files {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Warning: secrets file %s does not exist, its variables are not given to jobs\n", path)
+		}
+	}
+
+	loaded, err := secrets.Load(ctx, secrets.Sources{
+		Files:         settings.Secrets.Files,
+		Env:           settings.Secrets.Env,
+		Commands:      settings.Secrets.Commands,
+		FileVariables: settings.Secrets.FileVariables,
+	}, os.Environ())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range secrets.Unmaskable(loaded) {
+		fmt.Fprintf(os.Stderr, "Warning: secret %s cannot be masked, values need a single line of 8 characters or more\n", name)
+	}
+
+	// File variables of the configuration, then of the flags, replace the
+	// secrets of the same name.
+	files := maps.Clone(settings.VariableFiles)
+	if files == nil {
+		files = make(map[string]string)
+	}
+	for _, entry := range varFiles {
+		name, path, found := strings.Cut(entry, "=")
+		if !found || !variableNameRegexp.MatchString(name) || path == "" {
+			return nil, fmt.Errorf("invalid --var-file %s, expected KEY=path", entry)
+		}
+		files[name] = path
+	}
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		content, err := os.ReadFile(files[name])
+		if err != nil {
+			return nil, fmt.Errorf("could not read file variable %s: %w", name, err)
+		}
+		loaded = slices.DeleteFunc(loaded, func(secret common.Secret) bool {
+			return secret.Name == name
+		})
+		loaded = append(loaded, common.Secret{Name: name, Value: string(content), File: true})
+	}
+	return loaded, nil
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "Profile of the configuration files to apply, PIPELINEFOX_PROFILE by default.")
+	rootCmd.AddCommand(configCmd)
+}
@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/powerpixel/pipelinefox/runner/common"
+	"github.com/powerpixel/pipelinefox/shell"
+)
+
+const timestampFormat = "2006-01-02T15:04:05.000Z"
+
+// consoleOptions tunes how job logs are printed.
+type consoleOptions struct {
+	// Timestamps prefixes every log line with the time it was written.
+	Timestamps bool
+	// ExpandSections prints the content of collapsed sections.
+	ExpandSections bool
+	// JobNames prefixes every log line with the name of its job, for the
+	// lines of jobs run concurrently to be told apart.
+	JobNames bool
+}
+
+// consolePrinter renders pipeline events as plain text.
+type consolePrinter struct {
+	stdout, stderr io.Writer
+	options        consoleOptions
+	pulls          map[string]*imagePull
+	sections       map[string][]*foldedSection
+}
+
+// imagePull is the progress of an image pull being printed.
+type imagePull struct {
+	progress *common.PullProgress
+	// printed is the last tenth of the download printed.
+	printed int
+}
+
+// foldedSection is a section of a job log being printed.
+type foldedSection struct {
+	marker shell.SectionMarker
+	hidden int
+}
+
+func newConsolePrinter(stdout, stderr io.Writer, options consoleOptions) common.Subscriber {
+	p := &consolePrinter{
+		stdout:   stdout,
+		stderr:   stderr,
+		options:  options,
+		pulls:    make(map[string]*imagePull),
+		sections: make(map[string][]*foldedSection),
+	}
+	return p.handle
+}
+
+func (p *consolePrinter) handle(event common.Event) {
+	switch e := event.(type) {
+	case common.PipelineStarted:
+		fmt.Fprintf(p.stdout, "Running pipeline with %d jobs in %d stages\n", e.Jobs, len(e.Stages))
+	case common.StageStarted:
+		fmt.Fprintf(p.stdout, "Running stage %s\n", e.Stage)
+	case common.ImagePulling:
+		p.printImagePulling(e)
+	case common.JobStarted:
+		fmt.Fprintf(p.stdout, "Running job %s\n", e.Job)
+	case common.LogLine:
+		p.printLogLine(e)
+	case common.JobFinished:
+		p.printJobFinished(e.Result)
+	case common.ArtifactUploaded:
+		fmt.Fprintf(p.stdout, "Uploaded artifact %s of job %s (%d bytes)\n", e.Path, e.Job, e.Size)
+	case common.Warning:
+		fmt.Fprintf(p.stderr, "Warning (%s): %s\n", e.Job, e.Message)
+	case common.PipelineFinished:
+		printSummary(p.stdout, e.Result)
+	}
+}
+
+// printImagePulling prints the start of a pull, then its progress every
+// tenth of the download and finally its outcome.
+func (p *consolePrinter) printImagePulling(event common.ImagePulling) {
+	pull, found := p.pulls[event.Image]
+	if !found {
+		pull = &imagePull{progress: common.NewPullProgress()}
+		p.pulls[event.Image] = pull
+		fmt.Fprintf(p.stdout, "Pulling image %s...\n", event.Image)
+	}
+	if pull.progress.Status != "" {
+		return
+	}
+
+	pull.progress.Update(event)
+	if status := pull.progress.Status; status != "" {
+		fmt.Fprintf(p.stdout, "Pulled image %s: %s\n", event.Image, status)
+		return
+	}
+
+	tenth := pull.progress.Percent() / 10
+	if tenth <= pull.printed {
+		return
+	}
+	pull.printed = tenth
+	_, size := pull.progress.Bytes()
+	done, layers := pull.progress.Layers()
+	fmt.Fprintf(p.stdout, "Pulling image %s: %d%% of %.1f MB (%d/%d layers)\n",
+		event.Image, tenth*10, float64(size)/1e6, done, layers)
+}
+
+func (p *consolePrinter) printJobFinished(result common.JobResult) {
+	switch result.Status {
+	case common.JobStatusSuccess:
+		if result.Reason != "" {
+			fmt.Fprintf(p.stdout, "Job %s succeeded in %s: %s\n", result.Name, result.Duration().Round(time.Millisecond), result.Reason)
+			return
+		}
+		fmt.Fprintf(p.stdout, "Job %s succeeded in %s\n", result.Name, result.Duration().Round(time.Millisecond))
+	case common.JobStatusSkipped, common.JobStatusCanceled:
+		fmt.Fprintf(p.stdout, "Job %s %s: %s\n", result.Name, result.Status, result.Reason)
+	default:
+		fmt.Fprintf(p.stdout, "Job %s %s in %s: %s\n", result.Name, result.Status, result.Duration().Round(time.Millisecond), result.Reason)
+	}
+}
+
+// printLogLine prints a job log line, rendering section markers as headers
+// and hiding the content of collapsed sections.
+func (p *consolePrinter) printLogLine(line common.LogLine) {
+	w := p.stdout
+	if line.Stream == common.Stderr {
+		w = p.stderr
+	}
+
+	marker, before, isMarker := shell.ParseSectionMarker(line.Line)
+	if before != "" || !isMarker {
+		p.printFolded(w, line, before)
+	}
+	if !isMarker {
+		return
+	}
+
+	sections := p.sections[line.Job]
+	if marker.Start {
+		if folding := p.foldingSection(line.Job, len(sections)); folding != nil {
+			folding.hidden++
+		} else {
+			fmt.Fprintln(w, p.prefix(line)+marker.Header)
+		}
+		p.sections[line.Job] = append(sections, &foldedSection{marker: marker})
+		return
+	}
+
+	for i := len(sections) - 1; i >= 0; i-- {
+		if sections[i].marker.Name != marker.Name {
+			continue
+		}
+		section := sections[i]
+		p.sections[line.Job] = sections[:i]
+		if section.hidden > 0 && p.foldingSection(line.Job, i) == nil {
+			fmt.Fprintf(w, "%s  %d lines folded, took %s\n", p.prefix(line), section.hidden, marker.Time.Sub(section.marker.Time))
+		}
+		return
+	}
+}
+
+func (p *consolePrinter) printFolded(w io.Writer, line common.LogLine, text string) {
+	if folding := p.foldingSection(line.Job, len(p.sections[line.Job])); folding != nil {
+		folding.hidden++
+		return
+	}
+	fmt.Fprintln(w, p.prefix(line)+text)
+}
+
+// foldingSection returns the outermost collapsed section among the depth
+// first open sections of job, nil when their content is printed.
+func (p *consolePrinter) foldingSection(job string, depth int) *foldedSection {
+	if p.options.ExpandSections {
+		return nil
+	}
+	for _, section := range p.sections[job][:depth] {
+		if section.marker.Collapsed {
+			return section
+		}
+	}
+	return nil
+}
+
+// prefix returns what precedes the text of a log line.
+func (p *consolePrinter) prefix(line common.LogLine) string {
+	prefix := ""
+	if p.options.Timestamps {
+		prefix = line.Time.UTC().Format(timestampFormat) + " "
+	}
+	if p.options.JobNames {
+		prefix += "[" + line.Job + "] "
+	}
+	return prefix
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	parserCommon "github.com/powerpixel/pipelinefox/parser/common"
+	"github.com/powerpixel/pipelinefox/runner/common"
+)
+
+// defaultBranch is the branch pipelines are simulated to be the default one
+// of, CI_DEFAULT_BRANCH being given otherwise.
+const defaultBranch = "main"
+
+var refSlugRegexp = regexp.MustCompile(`[^a-z0-9]+`)
+
+// ruleContext returns the context rules are evaluated in: a push pipeline of
+// the branch checked out in path, with the configured variables as the CI/CD
+// variables of a project. Variables given as KEY=VALUE in overrides take
+// precedence.
+func ruleContext(path string, configured map[string]string, overrides []string) (parserCommon.RuleContext, error) {
+	variables := map[string]string{
+		"CI":                 "true",
+		"GITLAB_CI":          "true",
+		"CI_PIPELINE_SOURCE": "push",
+		"CI_DEFAULT_BRANCH":  defaultBranch,
+	}
+
+	if branch, sha := gitHead(path); branch != "" {
+		variables["CI_COMMIT_BRANCH"] = branch
+		variables["CI_COMMIT_REF_NAME"] = branch
+		variables["CI_COMMIT_REF_SLUG"] = refSlug(branch)
+	} else if sha != "" {
+		variables["CI_COMMIT_SHA"] = sha
+	}
+	maps.Copy(variables, configured)
+
+	for _, override := range overrides {
+		key, value, found := strings.Cut(override, "=")
+		if !found || key == "" {
+			return parserCommon.RuleContext{}, fmt.Errorf("invalid variable %q, expected KEY=VALUE", override)
+		}
+		variables[key] = value
+	}
+
+	workspace := common.DirWorkspace(path)
+	return parserCommon.RuleContext{
+		Variables: variables,
+		Exists: func(pattern string) bool {
+			paths, err := workspace.Glob(context.Background(), pattern)
+			return err == nil && len(paths) > 0
+		},
+	}, nil
+}
+
+// gitHead returns the branch checked out in the git repository holding
+// path, or the commit when the head is detached. Both are empty outside of
+// a repository.
+func gitHead(path string) (branch, sha string) {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return "", ""
+	}
+
+	for {
+		content, err := os.ReadFile(filepath.Join(dir, ".git", "HEAD"))
+		if err == nil {
+			head := strings.TrimSpace(string(content))
+			if ref, found := strings.CutPrefix(head, "ref: refs/heads/"); found {
+				return ref, ""
+			}
+			return "", head
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", ""
+		}
+		dir = parent
+	}
+}
+
+// refSlug returns the ref as GitLab's CI_COMMIT_REF_SLUG: lowercased, with
+// anything but letters and digits replaced by dashes, at most 63 bytes long.
+func refSlug(ref string) string {
+	slug := refSlugRegexp.ReplaceAllString(strings.ToLower(ref), "-")
+	if len(slug) > 63 {
+		slug = slug[:63]
+	}
+	return strings.Trim(slug, "-")
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/powerpixel/pipelinefox/config"
+	"github.com/powerpixel/pipelinefox/runner/common"
+)
+
+var (
+	keepOnFailure bool
+	debugShell    bool
+	step          string
+)
+
+// checkDebugFlags fails when the debugging flags cannot apply to the run.
+func checkDebugFlags(settings config.Config) error {
+	if (keepOnFailure || debugShell) && settings.Executor != dockerExecutor {
+		return fmt.Errorf("--keep-on-failure and --debug-shell need the docker executor")
+	}
+	if debugShell && ui == tuiUI {
+		return fmt.Errorf("--debug-shell needs the text ui")
+	}
+	switch step {
+	case "", common.StepEvery, common.StepBreakpoints:
+	default:
+		return fmt.Errorf("--step: %w: got %s", common.UnknownStepModeErr, step)
+	}
+	if step != "" && ui == tuiUI {
+		return fmt.Errorf("--step needs the text ui")
+	}
+	return nil
+}
+
+var (
+	terminalOnce sync.Once
+	terminal     *common.Terminal
+	terminalErr  error
+)
+
+// debugTerminal returns the terminal debugging happens on, shared by the
+// debug shells and the steps of jobs for them not to compete for its input.
+func debugTerminal() (*common.Terminal, error) {
+	terminalOnce.Do(func() {
+		terminal, terminalErr = common.NewTerminal(os.Stdin, os.Stdout)
+	})
+	return terminal, terminalErr
+}
+
+// keptContainers collects the containers of the failed jobs kept for
+// debugging.
+type keptContainers struct {
+	mu   sync.Mutex
+	kept []common.ContainerKept
+}
+
+func (k *keptContainers) handle(event common.Event) {
+	if kept, ok := event.(common.ContainerKept); ok {
+		k.mu.Lock()
+		defer k.mu.Unlock()
+		k.kept = append(k.kept, kept)
+	}
+}
+
+// print writes how to open a shell in the kept containers and remove them.
+func (k *keptContainers) print(w io.Writer) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if len(k.kept) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w, "Containers of failed jobs kept for debugging:")
+	for _, kept := range k.kept {
+		fmt.Fprintf(w, "  %s: %s\n", kept.Job, kept.Shell)
+		for _, command := range kept.Cleanup {
+			fmt.Fprintf(w, "    remove with: %s\n", command)
+		}
+	}
+}
+
+// newStepper returns the stepper of the --step mode.
+func newStepper() (*common.Stepper, error) {
+	t, err := debugTerminal()
+	if err != nil {
+		return nil, fmt.Errorf("--step: %w", err)
+	}
+	return common.NewStepper(step, t)
+}
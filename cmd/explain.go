@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	parserCommon "github.com/powerpixel/pipelinefox/parser/common"
+	"github.com/powerpixel/pipelinefox/parser/gitlab"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml/goyaml.v3"
+)
+
+var explainVariables []string
+
+var explainCmd = &cobra.Command{
+	Use:   "explain <job>",
+	Short: "Print a job once fully resolved, with where each of its keys comes from",
+	Long: "Print the job of the CI descriptor found in the execution path once local includes, anchors, extends, " +
+		"default and !reference tags are applied, each key inherited from elsewhere being commented with its origin. " +
+		"Rules are evaluated for a push pipeline of the checked out branch, and the variables of the job are listed " +
+		"along with where their value comes from.",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, _, err := readCIFile(nil)
+		if err != nil {
+			return err
+		}
+
+		resolver, err := gitlab.NewResolver(scanPath, path)
+		if err != nil {
+			return err
+		}
+		job, err := resolver.Resolve(args[0])
+		if err != nil {
+			return err
+		}
+		for _, warning := range job.Warnings {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+		}
+
+		predefined, err := ruleContext(scanPath, nil, nil)
+		if err != nil {
+			return err
+		}
+		context, err := ruleContext(scanPath, nil, explainVariables)
+		if err != nil {
+			return err
+		}
+		outcome, err := job.Job.WithVariables(yamlVariables(job)).EvaluateRules(context)
+		if err != nil {
+			return err
+		}
+
+		return writeExplanation(os.Stdout, job, outcome, predefined.Variables, explainVariables)
+	},
+}
+
+// explainedVariable is a variable of the job once every source is applied.
+type explainedVariable struct {
+	name   string
+	value  string
+	source string
+}
+
+func yamlVariables(job *gitlab.ResolvedJob) map[string]string {
+	variables := make(map[string]string, len(job.Variables))
+	for _, variable := range job.Variables {
+		variables[variable.Name] = variable.Value
+	}
+	return variables
+}
+
+func writeExplanation(w io.Writer, job *gitlab.ResolvedJob, outcome parserCommon.RulesOutcome, predefined map[string]string, overrides []string) error {
+	fmt.Fprintf(w, "# Job %s, written at %s\n", job.Name, job.Position)
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(job.Node); err != nil {
+		return err
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w)
+	switch {
+	case len(job.Job.GetRules()) == 0:
+		fmt.Fprintf(w, "Rules: none, the job runs %s\n", outcome.When)
+	case outcome.Skipped() && outcome.Rule < 0:
+		fmt.Fprintln(w, "Rules: none applies, the job is not added to the pipeline")
+	case outcome.Skipped():
+		fmt.Fprintf(w, "Rules: rule %d applies, the job is not added to the pipeline\n", outcome.Rule+1)
+	default:
+		fmt.Fprintf(w, "Rules: rule %d applies, the job runs %s\n", outcome.Rule+1, outcome.When)
+	}
+
+	// Sources are applied from the lowest precedence to the highest, as
+	// GitLab does.
+	variables := make(map[string]explainedVariable)
+	for name, value := range predefined {
+		variables[name] = explainedVariable{name, value, "predefined"}
+	}
+	for _, variable := range job.Variables {
+		variables[variable.Name] = explainedVariable{variable.Name, variable.Value, variableSource(job.Name, variable.Origin)}
+	}
+	for name, value := range outcome.Variables {
+		variables[name] = explainedVariable{name, value, fmt.Sprintf("rule %d", outcome.Rule+1)}
+	}
+	for _, override := range overrides {
+		name, value, _ := strings.Cut(override, "=")
+		variables[name] = explainedVariable{name, value, "--var"}
+	}
+
+	sorted := slices.SortedFunc(maps.Values(variables), func(a, b explainedVariable) int {
+		return cmp.Compare(a.name, b.name)
+	})
+
+	fmt.Fprintln(w, "\nVariables:")
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tVALUE\tSOURCE")
+	for _, variable := range sorted {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", variable.name, variable.value, variable.source)
+	}
+	return tw.Flush()
+}
+
+// variableSource describes where a variable of the descriptor is declared.
+func variableSource(job string, origin gitlab.Origin) string {
+	switch origin.Template {
+	case "variables":
+		return "global, " + origin.Position.String()
+	case job:
+		return "job, " + origin.Position.String()
+	default:
+		return fmt.Sprintf("template %s, %s", origin.Template, origin.Position)
+	}
+}
+
+func init() {
+	explainCmd.Flags().StringArrayVar(&explainVariables, "var", nil, "Variable given to rules as KEY=VALUE, e.g. CI_PIPELINE_SOURCE=merge_request_event. Can be repeated.")
+	rootCmd.AddCommand(explainCmd)
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/powerpixel/pipelinefox/graph"
+	"github.com/powerpixel/pipelinefox/parser/gitlab"
+	"github.com/spf13/cobra"
+)
+
+var (
+	graphFormat    string
+	graphVariables []string
+)
+
+var graphCmd = &cobra.Command{
+	Use:   "graph [file]",
+	Short: "Render the pipeline as a graph of stages and jobs",
+	Long: "Render the pipeline of the CI descriptor, the one found in the execution path when no file is given, " +
+		"as stages and jobs linked by their needs (plain arrows) and dependencies (dashed arrows). " +
+		"Rules are evaluated for a push pipeline of the checked out branch as when running the pipeline, jobs they leave out being marked as skipped.",
+	Args:          cobra.MaximumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, content, err := readCIFile(args)
+		if err != nil {
+			return err
+		}
+
+		ciParser := gitlab.NewGitlabPipelineParser().WithProject(scanPath, path)
+		pipeline, err := ciParser.ParsePipelineDescriptor(content)
+		if err != nil {
+			return fmt.Errorf("could not parse %s: %w", displayPath(path), err)
+		}
+
+		settings, err := loadConfig(cmd)
+		if err != nil {
+			return err
+		}
+		context, err := ruleContext(scanPath, settings.Variables, graphVariables)
+		if err != nil {
+			return err
+		}
+		g, err := graph.New(*pipeline, context)
+		if err != nil {
+			return err
+		}
+		return graph.Write(os.Stdout, graphFormat, g)
+	},
+}
+
+func init() {
+	graphCmd.Flags().StringVar(&graphFormat, "format", graph.MermaidFormat, "Format of the graph, either mermaid, dot or ascii.")
+	graphCmd.Flags().StringArrayVar(&graphVariables, "var", nil, "Variable given to rules as KEY=VALUE, e.g. CI_PIPELINE_SOURCE=merge_request_event. Can be repeated.")
+	rootCmd.AddCommand(graphCmd)
+}
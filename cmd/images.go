@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/powerpixel/pipelinefox/config"
+	parserCommon "github.com/powerpixel/pipelinefox/parser/common"
+	"github.com/powerpixel/pipelinefox/parser/gitlab"
+	"github.com/powerpixel/pipelinefox/runner/common"
+	"github.com/powerpixel/pipelinefox/runner/docker"
+	"github.com/spf13/cobra"
+)
+
+var imagesCmd = &cobra.Command{
+	Use:   "images",
+	Short: "Manage the images pipelines run in",
+}
+
+var imagesPullCmd = &cobra.Command{
+	Use:   "pull [file]",
+	Short: "Pull every image the pipeline needs",
+	Long: "Pull the images the jobs of the CI descriptor, the one found in the execution path when no file is given, " +
+		"and their services run in, once the overrides, rewrite rules and mirrors of the configuration are applied, " +
+		"so that the pipeline can then run with --offline.",
+	Args:          cobra.MaximumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, content, err := readCIFile(args)
+		if err != nil {
+			return err
+		}
+		ciParser := gitlab.NewGitlabPipelineParser().WithProject(scanPath, path)
+		pipeline, err := ciParser.ParsePipelineDescriptor(content)
+		if err != nil {
+			return fmt.Errorf("could not parse %s: %w", displayPath(path), err)
+		}
+
+		settings, err := loadConfig(cmd)
+		if err != nil {
+			return err
+		}
+		if settings.Offline {
+			return fmt.Errorf("images cannot be pulled in offline mode")
+		}
+		jobSecrets, err := loadSecrets(cmd.Context(), settings)
+		if err != nil {
+			return err
+		}
+
+		options := common.RunnerOptions{
+			Events:    common.NewEventBus(),
+			Variables: settings.Variables,
+			Secrets:   jobSecrets,
+		}
+		unsubscribe := options.Events.Subscribe(newConsolePrinter(os.Stdout, os.Stderr, consoleOptions{}))
+		defer unsubscribe()
+
+		store, err := newImageStore(settings, options)
+		if err != nil {
+			return err
+		}
+
+		ctx, _, stop := notifyInterrupt(cmd.Context())
+		defer stop()
+		images := store.Images(*pipeline)
+		if err := store.Pull(ctx, images); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stdout, "Pulled %d images\n", len(images))
+		return nil
+	},
+}
+
+// checkOfflineImages fails when images the pipeline needs are missing
+// locally, listing them.
+func checkOfflineImages(ctx context.Context, settings config.Config, options common.RunnerOptions, pipeline parserCommon.PipelineDescriptor) error {
+	store, err := newImageStore(settings, options)
+	if err != nil {
+		return err
+	}
+	missing, err := store.Missing(ctx, store.Images(pipeline))
+	if err != nil {
+		return err
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(os.Stderr, "Images missing locally, which cannot be pulled in offline mode:")
+	for _, image := range missing {
+		fmt.Fprintf(os.Stderr, "  %s (job %s)\n", image.Name, image.Job.GetName())
+	}
+	return fmt.Errorf("%d images are missing, run pipelinefox images pull once online", len(missing))
+}
+
+func newImageStore(settings config.Config, options common.RunnerOptions) (docker.ImageStore, error) {
+	dockerOptions, err := newDockerOptions(settings, options)
+	if err != nil {
+		return nil, err
+	}
+	return docker.NewImageStore(dockerOptions)
+}
+
+func init() {
+	imagesCmd.AddCommand(imagesPullCmd)
+	rootCmd.AddCommand(imagesCmd)
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/powerpixel/pipelinefox/cmd/detector"
+	parserCommon "github.com/powerpixel/pipelinefox/parser/common"
+	"github.com/powerpixel/pipelinefox/parser/gitlab"
+	"github.com/powerpixel/pipelinefox/report"
+	"github.com/spf13/cobra"
+)
+
+const (
+	textLintFormat  = "text"
+	sarifLintFormat = "sarif"
+)
+
+var lintFormat string
+
+var lintCmd = &cobra.Command{
+	Use:   "lint [file]",
+	Short: "Check the CI descriptor and report its problems",
+	Long: "Check the CI descriptor, the one found in the execution path when no file is given, " +
+		"against the GitLab CI JSON schema and report every problem found with its location. Exits with status 1 when errors are found.",
+	Args:          cobra.MaximumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if lintFormat != textLintFormat && lintFormat != sarifLintFormat {
+			return fmt.Errorf("unknown format %s, expected text or sarif", lintFormat)
+		}
+
+		path, content, err := readCIFile(args)
+		if err != nil {
+			return err
+		}
+		schema, err := loadSchema()
+		if err != nil {
+			return err
+		}
+		diagnostics := gitlab.Check(displayPath(path), content, schema)
+
+		if lintFormat == sarifLintFormat {
+			err = report.WriteSARIF(os.Stdout, diagnostics)
+		} else {
+			printDiagnostics(os.Stdout, diagnostics)
+		}
+		if err != nil {
+			return err
+		}
+
+		if diagnostics.HasErrors() {
+			os.Exit(1)
+		}
+		return nil
+	},
+}
+
+// readCIFile reads the CI file given as first argument, the one found in the
+// execution path when there is none.
+func readCIFile(args []string) (string, []byte, error) {
+	path := ""
+	if len(args) > 0 {
+		path = args[0]
+	} else {
+		file, err := detector.CheckGitlabCi(scanPath)
+		if err != nil {
+			return "", nil, err
+		}
+		if file == nil {
+			return "", nil, fmt.Errorf("no CI file was found in %s", scanPath)
+		}
+		file.Close()
+		path = file.Name()
+	}
+
+	content, err := os.ReadFile(path)
+	return path, content, err
+}
+
+// loadSchema returns the schema given with --schema, nil to use the embedded
+// one.
+func loadSchema() (*gitlab.Schema, error) {
+	if schemaPath == "" {
+		return nil, nil
+	}
+	content, err := os.ReadFile(schemaPath)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := gitlab.LoadSchema(content)
+	if err != nil {
+		return nil, fmt.Errorf("could not load %s: %w", schemaPath, err)
+	}
+	return schema, nil
+}
+
+// displayPath returns path relative to the execution path when it is inside
+// of it, so that diagnostics stay short and portable.
+func displayPath(path string) string {
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	root, err := filepath.Abs(scanPath)
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(root, absolute); err == nil && filepath.IsLocal(rel) {
+		return filepath.ToSlash(rel)
+	}
+	return path
+}
+
+// printDiagnostics writes one line per diagnostic, followed by their count.
+func printDiagnostics(w io.Writer, diagnostics parserCommon.Diagnostics) {
+	errors, warnings := 0, 0
+	for _, diagnostic := range diagnostics {
+		fmt.Fprintln(w, diagnostic)
+		switch diagnostic.Severity {
+		case parserCommon.SeverityError:
+			errors++
+		case parserCommon.SeverityWarning:
+			warnings++
+		}
+	}
+
+	if len(diagnostics) == 0 {
+		fmt.Fprintln(w, "No problem found")
+		return
+	}
+	fmt.Fprintf(w, "%d errors, %d warnings\n", errors, warnings)
+}
+
+func init() {
+	lintCmd.Flags().StringVar(&lintFormat, "format", textLintFormat, "Format of the diagnostics, either text or sarif.")
+	rootCmd.AddCommand(lintCmd)
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/powerpixel/pipelinefox/runner/common"
+	"github.com/powerpixel/pipelinefox/runs"
+	"github.com/spf13/cobra"
+)
+
+var logOptions struct {
+	follow bool
+	stream string
+}
+
+var logsCmd = &cobra.Command{
+	Use:   "logs [run-id] [job]",
+	Short: "Print the logs of a past run",
+	Long: "Print the logs persisted by a past run, the latest one when no run id is given. " +
+		"A single argument is read as a run id if such a run exists, as a job of the latest run otherwise.",
+	Args:          cobra.MaximumNArgs(2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		stream := common.Stream(logOptions.stream)
+		switch stream {
+		case "", common.Stdout, common.Stderr:
+		default:
+			return fmt.Errorf("unknown stream %s, expected stdout or stderr", stream)
+		}
+
+		store := runs.NewStore(scanPath)
+		id, job, err := resolveLogArgs(store, args)
+		if err != nil {
+			return err
+		}
+
+		ctx, _, stop := notifyInterrupt(cmd.Context())
+		defer stop()
+
+		return store.WriteLogs(ctx, os.Stdout, id, runs.LogOptions{
+			Job:    job,
+			Stream: stream,
+			Follow: logOptions.follow,
+		})
+	},
+}
+
+// resolveLogArgs returns the run and the job designated by the arguments of
+// the logs command.
+func resolveLogArgs(store runs.Store, args []string) (id, job string, err error) {
+	if len(args) == 2 {
+		return args[0], args[1], nil
+	}
+
+	if len(args) == 1 {
+		_, err := store.Get(args[0])
+		if err == nil {
+			return args[0], "", nil
+		}
+		if !errors.Is(err, runs.RunNotFoundErr) {
+			return "", "", err
+		}
+		job = args[0]
+	}
+
+	latest, err := store.Latest()
+	if err != nil {
+		return "", "", err
+	}
+	return latest.ID, job, nil
+}
+
+func init() {
+	logsCmd.Flags().BoolVarP(&logOptions.follow, "follow", "f", false, "Keep on printing the output of running jobs until they finish.")
+	logsCmd.Flags().StringVar(&logOptions.stream, "stream", "", "Only print the given stream, either stdout or stderr.")
+	rootCmd.AddCommand(logsCmd)
+}
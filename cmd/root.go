@@ -1,81 +1,341 @@
-package cmd
-
-import (
-	"bytes"
-	"fmt"
-	"os"
-
-	"github.com/powerpixel/pipelinefox/cmd/detector"
-	"github.com/powerpixel/pipelinefox/parser/gitlab"
-	"github.com/powerpixel/pipelinefox/runner/docker"
-	"github.com/spf13/cobra"
-)
-
-var scanPath string
-
-var rootCmd = &cobra.Command{
-	Use:   "pipelinefox",
-	Short: "PipelineFox is a local CI runner to locally test pipelines",
-	Long:  "PipelineFox is a local CI runner to locally test pipelines. It aims to be compatible with multiple CI formats.",
-	Run: func(cmd *cobra.Command, args []string) {
-		file, err := detector.CheckGitlabCi(scanPath)
-		if err != nil {
-			panic(err)
-		}
-
-		if file == nil {
-			fmt.Printf("No CI file was found in %v :( \n", scanPath)
-			return
-		}
-
-		fmt.Printf("Found CI file : %v\n", file.Name())
-
-		ciParser := gitlab.NewGitlabPipelineParser()
-
-		buf := new(bytes.Buffer)
-		buf.ReadFrom(file)
-		pipeline, err := ciParser.ParsePipelineDescriptor(buf.Bytes())
-
-		if err != nil {
-			panic(err)
-		}
-
-		runner, err := docker.NewDockerPipelineRunner()
-
-		if err != nil {
-			fmt.Printf("encountered unexpected error when trying to create a pipeline runner : %s", err.Error())
-			os.Exit(1)
-		}
-
-		err = runner.RunPipeline(os.Stdout, os.Stderr, *pipeline)
-
-		if err != nil {
-			fmt.Printf("encountered unexpected error when running pipeline : %s", err.Error())
-			os.Exit(1)
-		}
-	},
-}
-
-func init() {
-	cobra.OnInitialize(initConfig)
-	rootCmd.PersistentFlags().StringVar(&scanPath, "path", "", "Path for execution context. Pipelinefox will look for CI declarations here.")
-}
-
-func initConfig() {
-	if scanPath == "" {
-		var err error
-		scanPath, err = os.Getwd()
-		if err != nil {
-			panic(err)
-		}
-	}
-
-	fmt.Printf("Running Pipelinefox in directory %s \n", scanPath)
-}
-
-func Execute() {
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintf(os.Stderr, "Oops. An error occured while executing Pipelinefox '%s'\n", err)
-		os.Exit(1)
-	}
-}
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/powerpixel/pipelinefox/cmd/detector"
+	"github.com/powerpixel/pipelinefox/config"
+	"github.com/powerpixel/pipelinefox/jobcache"
+	"github.com/powerpixel/pipelinefox/parser/gitlab"
+	"github.com/powerpixel/pipelinefox/report"
+	"github.com/powerpixel/pipelinefox/runner/common"
+	"github.com/powerpixel/pipelinefox/runner/docker"
+	"github.com/powerpixel/pipelinefox/runner/interp"
+	"github.com/powerpixel/pipelinefox/runs"
+	"github.com/spf13/cobra"
+)
+
+const (
+	dockerExecutor = "docker"
+	interpExecutor = "interp"
+)
+
+// artifactsDir is the directory of a run holding the files collected from
+// its jobs.
+const artifactsDir = "artifacts"
+
+var (
+	scanPath   string
+	schemaPath string
+	executor   string
+	timeout    time.Duration
+	ui         string
+	output     string
+	console    consoleOptions
+	noJobCache bool
+)
+
+var rootCmd = &cobra.Command{
+	Use:   "pipelinefox",
+	Short: "PipelineFox is a local CI runner to locally test pipelines",
+	Long:  "PipelineFox is a local CI runner to locally test pipelines. It aims to be compatible with multiple CI formats.",
+	Run: func(cmd *cobra.Command, args []string) {
+		// Machine readable reports own stdout, everything else goes to stderr.
+		out := os.Stdout
+		switch output {
+		case report.TextFormat:
+		case report.JSONFormat, report.JUnitFormat:
+			out = os.Stderr
+		default:
+			fmt.Fprintf(os.Stderr, "unknown output format %s, expected text, json or junit\n", output)
+			os.Exit(1)
+		}
+
+		fmt.Fprintf(out, "Running Pipelinefox in directory %s \n", scanPath)
+
+		settings, err := loadConfig(cmd)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if err := checkDebugFlags(settings); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		jobSecrets, err := loadSecrets(cmd.Context(), settings)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		shells, err := loadShells(settings)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		file, err := detector.CheckGitlabCi(scanPath)
+		if err != nil {
+			panic(err)
+		}
+
+		if file == nil {
+			fmt.Fprintf(out, "No CI file was found in %v :( \n", scanPath)
+			return
+		}
+
+		fmt.Fprintf(out, "Found CI file : %v\n", file.Name())
+
+		buf := new(bytes.Buffer)
+		buf.ReadFrom(file)
+
+		schema, err := loadSchema()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		// Problems are reported with their location before the parser, which
+		// stops at the first one, is given the descriptor.
+		if diagnostics := gitlab.Check(displayPath(file.Name()), buf.Bytes(), schema); len(diagnostics) > 0 {
+			printDiagnostics(os.Stderr, diagnostics)
+			if diagnostics.HasErrors() {
+				os.Exit(1)
+			}
+		}
+
+		ciParser := gitlab.NewGitlabPipelineParser().WithProject(scanPath, file.Name())
+		pipeline, err := ciParser.ParsePipelineDescriptor(buf.Bytes())
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "encountered unexpected error when parsing %s : %s\n", file.Name(), err.Error())
+			os.Exit(1)
+		}
+
+		selected, restored, err := selectJobs(out, *pipeline)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		pipeline = &selected
+
+		rules, err := ruleContext(scanPath, settings.Variables, nil)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		options := common.RunnerOptions{
+			Events:      common.NewEventBus(),
+			Controller:  common.NewJobController(),
+			Variables:   settings.Variables,
+			Secrets:     jobSecrets,
+			Concurrency: settings.Concurrency,
+			Restored:    restored,
+			Shell:       settings.Shell,
+			Shells:      shells,
+			Rules:       &rules,
+		}
+		if step != "" {
+			if options.Step, err = newStepper(); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+		// Stepped jobs may run other commands than their script, their
+		// results are not to be reused.
+		if !noJobCache && step == "" {
+			project, err := filepath.Abs(scanPath)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			options.JobCache = jobcache.New(settings.CacheDir, project, settings.JobCache.Inputs)
+		}
+
+		recorder, err := runs.NewStore(scanPath).Create(scanPath, settings.Executor)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not record the run, its logs will not be persisted : %s\n", err.Error())
+		} else {
+			unsubscribe := options.Events.Subscribe(recorder.Handle)
+			defer unsubscribe()
+			options.LogDir = recorder.Dir()
+			options.ArtifactDir = filepath.Join(recorder.Dir(), artifactsDir)
+			fmt.Fprintf(out, "Recording run %s in %s\n", recorder.ID(), recorder.Dir())
+		}
+
+		var kept keptContainers
+		unsubscribe := options.Events.Subscribe(kept.handle)
+		defer unsubscribe()
+
+		runner, err := newPipelineRunner(settings, options)
+
+		if err != nil {
+			fmt.Fprintf(out, "encountered unexpected error when trying to create a pipeline runner : %s", err.Error())
+			os.Exit(1)
+		}
+
+		ctx, interrupt, stop := notifyInterrupt(cmd.Context())
+		defer stop()
+
+		if settings.Offline && settings.Executor == dockerExecutor {
+			if err := checkOfflineImages(ctx, settings, options, *pipeline); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		// The report is written even when the pipeline could not run to its
+		// end, from the results of the jobs which did.
+		var result common.PipelineResult
+		var runErr error
+		switch ui {
+		case textUI:
+			console.JobNames = settings.Concurrency > 1
+			result, runErr = runWithConsole(ctx, out, runner, options, *pipeline, console)
+		case tuiUI:
+			result, runErr = runWithTUI(ctx, out, runner, options, *pipeline, interrupt)
+		default:
+			fmt.Fprintf(out, "encountered unexpected error when running pipeline : unknown ui %s\n", ui)
+			os.Exit(1)
+		}
+
+		if runErr != nil {
+			fmt.Fprintf(out, "encountered unexpected error when running pipeline : %s\n", runErr.Error())
+		}
+
+		runID, reportDir := "", ""
+		if recorder != nil {
+			runID, reportDir = recorder.ID(), recorder.Dir()
+		}
+		if err := reportTests(out, result, reportDir); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not write the test report : %s\n", err.Error())
+		}
+
+		if err := report.Write(os.Stdout, output, runID, result); err != nil {
+			fmt.Fprintf(os.Stderr, "encountered unexpected error when writing the pipeline report : %s\n", err.Error())
+			os.Exit(1)
+		}
+		kept.print(out)
+
+		if recorder != nil && recorder.Err() != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not save the metadata of run %s : %s\n", recorder.ID(), recorder.Err().Error())
+		}
+
+		if runErr != nil || !result.Succeeded() {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	cobra.OnInitialize(initConfig)
+	rootCmd.PersistentFlags().StringVar(&scanPath, "path", "", "Path for execution context. Pipelinefox will look for CI declarations here.")
+	rootCmd.PersistentFlags().StringVar(&schemaPath, "schema", "", "GitLab CI JSON schema file to validate the CI file against, instead of the one embedded in pipelinefox.")
+	rootCmd.Flags().DurationVar(&timeout, "timeout", 0, "Maximum duration of the whole pipeline, e.g. 30m. No limit when 0.")
+	rootCmd.Flags().StringVar(&ui, "ui", textUI, "User interface, either text or tui (live board of the jobs).")
+	rootCmd.Flags().BoolVar(&console.Timestamps, "timestamps", false, "Prefix every job log line with the time it was written.")
+	rootCmd.Flags().BoolVar(&console.ExpandSections, "expand-sections", false, "Print the content of collapsed log sections.")
+	rootCmd.Flags().StringVar(&output, "output", report.TextFormat, "Format of the pipeline report written to stdout once over, either text, json or junit (one test case per job). Progress is written to stderr with json and junit.")
+	rootCmd.Flags().StringVar(&executor, "executor", dockerExecutor, "Executor used to run jobs, either docker or interp (in-process shell, no container isolation).")
+	rootCmd.Flags().IntVar(&concurrency, "concurrency", 1, "Maximum number of jobs of a stage run at once.")
+	rootCmd.Flags().StringVar(&cachePath, "cache-dir", "", "Directory where data is cached between runs, .pipelinefox/cache of the project by default.")
+	rootCmd.Flags().StringArrayVar(&varFiles, "var-file", nil, "File given to jobs as a file variable, as KEY=path, the variable holding the path of a copy of the file. Can be repeated.")
+	rootCmd.Flags().StringVar(&pullPolicy, "pull-policy", "", "When images are pulled, either always, if-not-present (default) or never.")
+	rootCmd.Flags().BoolVar(&noJobCache, "no-job-cache", false, "Run every job, rather than restoring the ones unchanged since they last succeeded from the job cache.")
+	rootCmd.Flags().BoolVar(&offline, "offline", false, "Refuse to pull images, listing the ones missing locally before running anything.")
+	rootCmd.Flags().BoolVar(&keepOnFailure, "keep-on-failure", false, "Keep the containers and services of failed jobs, printing how to open a shell in them and remove them.")
+	rootCmd.Flags().BoolVar(&debugShell, "debug-shell", false, "Open an interactive shell in the container of failed jobs, with their environment and working directory, removing it once the shell exits.")
+	rootCmd.Flags().StringVar(&step, "step", "", "Pause before the commands of job scripts, showing them with their variables expanded to run, skip or edit them, or open a shell first: before every command (every, the default without value), or after the # pipelinefox:break comments only (--step=break). Disables the job cache.")
+	rootCmd.Flags().Lookup("step").NoOptDefVal = common.StepEvery
+	rootCmd.Flags().StringVar(&shellName, "shell", "", "Shell the scripts of jobs are written for, either sh, bash, pwsh or a custom shell of the configuration, unless they select one with the PIPELINEFOX_SHELL variable. Detected in the image of jobs by default, bash being preferred.")
+	rootCmd.Flags().BoolVar(&dockerSocket, "docker-socket", false, "Give jobs the docker socket of the host instead of starting their docker:dind services. Jobs can then control every container and gain root access to the host; the images and volumes they create are left on the host, to be pruned by the user.")
+}
+
+func newPipelineRunner(settings config.Config, options common.RunnerOptions) (common.PipelineRunner, error) {
+	switch settings.Executor {
+	case dockerExecutor:
+		dockerOptions, err := newDockerOptions(settings, options)
+		if err != nil {
+			return nil, err
+		}
+		dockerOptions.KeepOnFailure = keepOnFailure
+		if debugShell {
+			if dockerOptions.DebugShell, err = debugTerminal(); err != nil {
+				return nil, err
+			}
+		}
+		return docker.NewDockerPipelineRunner(dockerOptions)
+	case interpExecutor:
+		return interp.NewInterpPipelineRunner(interp.Options{RunnerOptions: options})
+	default:
+		return nil, fmt.Errorf("unknown executor %s", settings.Executor)
+	}
+}
+
+// newDockerOptions returns the options of the docker runner configured by
+// settings.
+func newDockerOptions(settings config.Config, options common.RunnerOptions) (docker.Options, error) {
+	rewrites := make([]docker.RewriteRule, 0, len(settings.Images.Rewrites))
+	for _, rule := range settings.Images.Rewrites {
+		rewrite, err := docker.ParseRewriteRule(rule)
+		if err != nil {
+			return docker.Options{}, err
+		}
+		rewrites = append(rewrites, rewrite)
+	}
+
+	return docker.Options{
+		RunnerOptions:  options,
+		DefaultImage:   settings.Images.Default,
+		ImageOverrides: settings.Images.Overrides,
+		Mirrors:        settings.Images.Mirrors,
+		Rewrites:       rewrites,
+		PullPolicy:     settings.PullPolicy,
+		Offline:        settings.Offline,
+		HostSocket:     settings.Docker.HostSocket,
+		Container: docker.ContainerOptions{
+			CPUs:       string(settings.Docker.CPUs),
+			Memory:     string(settings.Docker.Memory),
+			MemorySwap: string(settings.Docker.MemorySwap),
+			ShmSize:    string(settings.Docker.ShmSize),
+			Ulimits:    settings.Docker.Ulimits,
+			CapAdd:     settings.Docker.CapAdd,
+			CapDrop:    settings.Docker.CapDrop,
+			Privileged: settings.Docker.Privileged,
+			ReadOnly:   settings.Docker.ReadOnly,
+			Tmpfs:      settings.Docker.Tmpfs,
+			ExtraHosts: settings.Docker.ExtraHosts,
+			DNS:        settings.Docker.DNS,
+			DNSSearch:  settings.Docker.DNSSearch,
+			User:       settings.Docker.User,
+		},
+	}, nil
+}
+
+func initConfig() {
+	if scanPath == "" {
+		var err error
+		scanPath, err = os.Getwd()
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+func Execute() {
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "Oops. An error occured while executing Pipelinefox '%s'\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/powerpixel/pipelinefox/runs"
+	"github.com/spf13/cobra"
+)
+
+var runsCmd = &cobra.Command{
+	Use:   "runs",
+	Short: "Inspect the past runs of the pipeline",
+}
+
+var runsListCmd = &cobra.Command{
+	Use:           "list",
+	Short:         "List the past runs, the most recent first",
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		list, err := runs.NewStore(scanPath).List()
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			fmt.Println("No run was recorded yet")
+			return nil
+		}
+		printRuns(os.Stdout, list)
+		return nil
+	},
+}
+
+// printRuns writes one line per run with its outcome.
+func printRuns(w io.Writer, list []runs.Run) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTATUS\tSTARTED\tDURATION\tJOBS\tEXECUTOR")
+	for _, run := range list {
+		duration := "-"
+		if !run.FinishedAt.IsZero() {
+			duration = run.Duration().Round(time.Millisecond).String()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\n",
+			run.ID,
+			run.Status,
+			run.StartedAt.Local().Format(time.DateTime),
+			duration,
+			len(run.Jobs),
+			run.Executor,
+		)
+	}
+	tw.Flush()
+}
+
+func init() {
+	runsCmd.AddCommand(runsListCmd)
+	rootCmd.AddCommand(runsCmd)
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	parserCommon "github.com/powerpixel/pipelinefox/parser/common"
+	"github.com/powerpixel/pipelinefox/runner/common"
+	"github.com/powerpixel/pipelinefox/runs"
+)
+
+var (
+	selection    parserCommon.Selection
+	reuseResults bool
+)
+
+// selectJobs restricts pipeline to the jobs selected by the flags. The jobs
+// they need but are left out have their result reused from the last run they
+// succeeded in when asked to, and are only reported otherwise. Their dotenv
+// variables and the artifacts:paths files stored by that run are passed on.
+func selectJobs(out io.Writer, pipeline parserCommon.PipelineDescriptor) (parserCommon.PipelineDescriptor, []common.JobResult, error) {
+	selected, missing, err := pipeline.Select(selection)
+	if err != nil || len(missing) == 0 {
+		return selected, nil, err
+	}
+
+	if !reuseResults {
+		fmt.Fprintf(out, "Jobs needed by the selected ones are not run: %s. Use --with-needs to run them or --reuse-results to reuse the result of their last successful run.\n", strings.Join(missing, ", "))
+		return selected, nil, nil
+	}
+
+	store := runs.NewStore(scanPath)
+	var restored []common.JobResult
+	for _, name := range missing {
+		run, job, err := store.LatestSuccess(name)
+		if err != nil {
+			fmt.Fprintf(out, "Warning: %s is needed but its result cannot be reused : %s\n", name, err.Error())
+			continue
+		}
+		if err := restoreArtifactFiles(&job, filepath.Join(store.Dir(run.ID), artifactsDir)); err != nil {
+			fmt.Fprintf(out, "Warning: %s is needed but its result cannot be reused : %s\n", name, err.Error())
+			continue
+		}
+		job.Reason = "result reused from run " + run.ID
+		restored = append(restored, job)
+		fmt.Fprintf(out, "Reusing the result of %s from run %s\n", name, run.ID)
+	}
+	return selected, restored, nil
+}
+
+// restoreArtifactFiles points the artifacts:paths files of job to their
+// copies in dir, the artifact directory of the run it comes from, failing
+// when one is missing.
+func restoreArtifactFiles(job *common.JobResult, dir string) error {
+	for path := range job.ArtifactFiles {
+		stored := common.ArtifactPath(dir, job.Name, path)
+		if _, err := os.Stat(stored); err != nil {
+			return fmt.Errorf("artifact %s is not stored anymore: %w", path, err)
+		}
+		job.ArtifactFiles[path] = stored
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.Flags().StringArrayVar(&selection.Jobs, "job", nil, "Job to run, or a pattern matching the jobs to run such as 'test:*'. Can be repeated.")
+	rootCmd.Flags().StringArrayVar(&selection.Stages, "stage", nil, "Stage whose jobs are run. Can be repeated.")
+	rootCmd.Flags().StringVar(&selection.From, "from", "", "First stage to run, the previous ones being left out.")
+	rootCmd.Flags().StringVar(&selection.Until, "until", "", "Last stage to run, the next ones being left out.")
+	rootCmd.Flags().BoolVar(&selection.Needs, "with-needs", false, "Also run the jobs the selected ones need, through needs, dependencies or previous stages.")
+	rootCmd.Flags().BoolVar(&selection.Downstream, "downstream", false, "Also run the jobs needing the selected ones.")
+	rootCmd.Flags().BoolVar(&reuseResults, "reuse-results", false, "Reuse the result of the jobs the selected ones need from the last run they succeeded in, instead of leaving them out. "+
+		"Their dotenv variables and artifacts:paths files are passed on as if they had run.")
+}
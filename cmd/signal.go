@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/powerpixel/pipelinefox/runner/common"
+)
+
+// notifyInterrupt returns a context canceled on the first SIGINT or SIGTERM,
+// letting runners stop jobs gracefully and run their after_script. A second
+// signal requests a forced stop: graceful steps are skipped and containers are
+// removed right away. Calling interrupt has the same effect as a signal, for
+// terminals in raw mode where Ctrl-C is read as a key.
+func notifyInterrupt(parent context.Context) (ctx context.Context, interrupt func(), stop context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	kill, forceKill := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case <-signals:
+			fmt.Fprintln(os.Stderr, "Interrupted, stopping jobs gracefully. Press Ctrl-C again to force stop.")
+			cancel()
+		case <-ctx.Done():
+			return
+		}
+
+		select {
+		case <-signals:
+			fmt.Fprintln(os.Stderr, "Forcing stop, removing containers.")
+			forceKill()
+		case <-kill.Done():
+		}
+	}()
+
+	interrupt = func() {
+		select {
+		case signals <- os.Interrupt:
+		default:
+		}
+	}
+
+	return common.WithKill(ctx, kill), interrupt, func() {
+		signal.Stop(signals)
+		cancel()
+		forceKill()
+	}
+}
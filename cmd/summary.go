@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/powerpixel/pipelinefox/runner/common"
+)
+
+// printSummary writes one line per job of the pipeline with its outcome.
+func printSummary(w io.Writer, result common.PipelineResult) {
+	fmt.Fprintf(w, "\nPipeline %s in %s\n", result.Status, result.Duration().Round(time.Millisecond))
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, job := range result.Jobs {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\n",
+			job.Stage,
+			job.Name,
+			job.Status,
+			job.Duration().Round(time.Millisecond),
+			job.Reason,
+		)
+	}
+	tw.Flush()
+}
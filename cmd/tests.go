@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/powerpixel/pipelinefox/junit"
+	"github.com/powerpixel/pipelinefox/runner/common"
+)
+
+const (
+	reportFile    = "report.xml"
+	maxMessageLen = 100
+)
+
+// reportTests merges the JUnit reports collected from the jobs into a
+// report.xml file in dir and prints a summary of the tests, listing the
+// failed ones like GitLab's test widget. Nothing is done when no job
+// collected a report.
+func reportTests(w io.Writer, result common.PipelineResult, dir string) error {
+	var reports []junit.TestSuites
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	for _, job := range result.Jobs {
+		for _, path := range job.JUnitReports {
+			report, err := junit.ParseFile(path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning (%s): %s\n", job.Name, err)
+				continue
+			}
+			reports = append(reports, report)
+
+			for _, testCase := range report.FailedCases() {
+				name := testCase.Name
+				if testCase.Classname != "" {
+					name = testCase.Classname + "." + name
+				}
+				fmt.Fprintf(tw, "  %s\t%s\t%s\n", job.Name, name, firstLine(testCase.Message(), maxMessageLen))
+			}
+		}
+	}
+
+	if len(reports) == 0 {
+		return nil
+	}
+
+	merged := junit.Merge("pipelinefox", reports...)
+	fmt.Fprintf(w, "\nTest summary: %d tests, %d failed, %d errors, %d skipped in %s\n",
+		merged.Tests,
+		merged.Failures,
+		merged.Errors,
+		merged.Skipped,
+		time.Duration(merged.Time*float64(time.Second)).Round(time.Millisecond),
+	)
+	if merged.Failures+merged.Errors > 0 {
+		fmt.Fprintln(w, "Failed tests:")
+		tw.Flush()
+	}
+
+	if dir == "" {
+		return nil
+	}
+
+	path := filepath.Join(dir, reportFile)
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := merged.Write(file); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Merged test report written to %s\n", path)
+	return nil
+}
+
+// firstLine returns the first line of s, cut to max characters.
+func firstLine(s string, max int) string {
+	s, _, _ = strings.Cut(strings.TrimSpace(s), "\n")
+	if runes := []rune(s); len(runes) > max {
+		return string(runes[:max-1]) + "…"
+	}
+	return s
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"os"
+
+	parserCommon "github.com/powerpixel/pipelinefox/parser/common"
+	"github.com/powerpixel/pipelinefox/runner/common"
+	"github.com/powerpixel/pipelinefox/ui/tui"
+)
+
+const (
+	textUI = "text"
+	tuiUI  = "tui"
+)
+
+// runWithConsole runs the pipeline, printing its progress and job output as
+// plain text to out, job errors going to stderr.
+func runWithConsole(ctx context.Context, out io.Writer, runner common.PipelineRunner, options common.RunnerOptions, pipeline parserCommon.PipelineDescriptor, console consoleOptions) (common.PipelineResult, error) {
+	unsubscribe := options.Events.Subscribe(newConsolePrinter(out, os.Stderr, console))
+	defer unsubscribe()
+
+	// Job output is rendered from the log events published on the bus.
+	return runner.RunPipeline(ctx, io.Discard, io.Discard, pipeline)
+}
+
+// runWithTUI runs the pipeline behind the terminal UI, then prints the summary
+// of the last run of every job to out once the user quits.
+func runWithTUI(ctx context.Context, out io.Writer, runner common.PipelineRunner, options common.RunnerOptions, pipeline parserCommon.PipelineDescriptor, interrupt func()) (common.PipelineResult, error) {
+	if !tui.Supported(os.Stdin, os.Stdout) {
+		return common.PipelineResult{}, tui.NotATerminalErr
+	}
+
+	board := tui.New(tui.Options{
+		Pipeline:   pipeline,
+		Runner:     runner,
+		Controller: options.Controller,
+		Interrupt:  interrupt,
+		In:         os.Stdin,
+		Out:        os.Stdout,
+	})
+	unsubscribe := options.Events.Subscribe(board.Handle)
+	defer unsubscribe()
+
+	done := make(chan struct{})
+	var runErr error
+	go func() {
+		defer close(done)
+		_, runErr = runner.RunPipeline(ctx, io.Discard, io.Discard, pipeline)
+	}()
+
+	result, err := board.Run(ctx, done)
+	<-done
+	if err != nil {
+		return result, err
+	}
+
+	printSummary(out, result)
+	return result, runErr
+}
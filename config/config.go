@@ -0,0 +1,436 @@
+package config
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// FileName is the name of the configuration file of a project, committed
+// at its root.
+const FileName = ".pipelinefox.yml"
+
+// Environment variables overriding the configuration files.
+const (
+	ExecutorEnv    = "PIPELINEFOX_EXECUTOR"
+	ProfileEnv     = "PIPELINEFOX_PROFILE"
+	ConcurrencyEnv = "PIPELINEFOX_CONCURRENCY"
+	CacheDirEnv    = "PIPELINEFOX_CACHE_DIR"
+	PullPolicyEnv  = "PIPELINEFOX_PULL_POLICY"
+	OfflineEnv     = "PIPELINEFOX_OFFLINE"
+	// ShellEnv sets the default shell of jobs. It is not named after the
+	// PIPELINEFOX_SHELL variable of jobs, which selects the shell of a single
+	// job over the configuration.
+	ShellEnv = "PIPELINEFOX_DEFAULT_SHELL"
+)
+
+var UnknownProfileErr = errors.New("unknown profile")
+var InvalidConfigErr = errors.New("invalid configuration")
+
+// Config holds the settings of pipelinefox. Its zero value keeps the
+// defaults of every setting.
+type Config struct {
+	// Executor runs the jobs, docker or interp.
+	Executor string `json:"executor,omitempty"`
+	// Images configures the images jobs run in.
+	Images Images `json:"images,omitempty"`
+	// Variables are given to every job, taking precedence over the ones of
+	// the CI file.
+	Variables map[string]string `json:"variables,omitempty"`
+	// Secrets tells where the secrets given to every job are read from.
+	Secrets Secrets `json:"secrets,omitempty"`
+	// VariableFiles holds files given to every job as file variables, keyed
+	// by the name of the variable holding their path in the job.
+	VariableFiles map[string]string `json:"variable_files,omitempty"`
+	// Concurrency is the maximum number of jobs of a stage run at once.
+	Concurrency int `json:"concurrency,omitempty"`
+	// CacheDir is the directory where pipelinefox caches data between runs.
+	CacheDir string `json:"cache_dir,omitempty"`
+	// PullPolicy tells when images are pulled: always, if-not-present or
+	// never.
+	PullPolicy string `json:"pull_policy,omitempty"`
+	// JobCache configures the cache of job results.
+	JobCache JobCache `json:"job_cache,omitempty"`
+	// Offline refuses to pull images, the ones jobs need having to be
+	// present locally.
+	Offline bool `json:"offline,omitempty"`
+	// Docker configures the docker executor.
+	Docker Docker `json:"docker,omitempty"`
+	// Shell is the shell the scripts of jobs are written for, sh, bash,
+	// pwsh or one of Shells, unless they select one. It is detected in the
+	// image of jobs when empty.
+	Shell string `json:"shell,omitempty"`
+	// Shells declares custom shells, keyed by name.
+	Shells map[string]Shell `json:"shells,omitempty"`
+}
+
+// Shell is a custom shell, whose scripts are written by a template.
+type Shell struct {
+	// Template is the path of the text/template writing the scripts, see
+	// shell.NewShell.
+	Template string `json:"template"`
+	// Command runs the scripts, their path being appended, such as
+	// [zsh, -e].
+	Command []string `json:"command"`
+	// Extension is the one of the script files, .sh when empty.
+	Extension string `json:"extension,omitempty"`
+}
+
+// Docker configures the docker executor.
+type Docker struct {
+	// HostSocket gives jobs the docker socket of the host, instead of
+	// starting their docker:dind services. Jobs can then control every
+	// container and gain root access to the host.
+	HostSocket bool `json:"host_socket,omitempty"`
+	// CPUs is the number of CPUs of the containers of jobs, such as 1.5, or
+	// of millicores, such as 500m.
+	CPUs Quantity `json:"cpus,omitempty"`
+	// Memory is the memory limit of the containers of jobs, such as 512m or
+	// 1Gi.
+	Memory Quantity `json:"memory,omitempty"`
+	// MemorySwap is the limit of memory and swap together, -1 for an
+	// unlimited swap.
+	MemorySwap Quantity `json:"memory_swap,omitempty"`
+	// ShmSize is the size of /dev/shm.
+	ShmSize Quantity `json:"shm_size,omitempty"`
+	// Ulimits are written as docker run --ulimit does, such as
+	// nofile=1024:2048.
+	Ulimits []string `json:"ulimits,omitempty"`
+	CapAdd  []string `json:"cap_add,omitempty"`
+	CapDrop []string `json:"cap_drop,omitempty"`
+	// Privileged runs jobs with every capability and device of the host.
+	Privileged bool `json:"privileged,omitempty"`
+	// ReadOnly mounts the root filesystem of the containers read-only.
+	ReadOnly bool `json:"read_only,omitempty"`
+	// Tmpfs holds tmpfs mounts, keyed by path, their value holding their
+	// options such as rw,size=64m.
+	Tmpfs map[string]string `json:"tmpfs,omitempty"`
+	// ExtraHosts are added to /etc/hosts, as host:ip.
+	ExtraHosts []string `json:"extra_hosts,omitempty"`
+	DNS        []string `json:"dns,omitempty"`
+	DNSSearch  []string `json:"dns_search,omitempty"`
+	// User runs the scripts of jobs, as user, uid or uid:gid.
+	User string `json:"user,omitempty"`
+}
+
+// Quantity is an amount written either as a number or as a string, such as
+// 2 or 512m.
+type Quantity string
+
+func (q *Quantity) UnmarshalJSON(content []byte) error {
+	var number json.Number
+	if err := json.Unmarshal(content, &number); err == nil {
+		*q = Quantity(number)
+		return nil
+	}
+	var value string
+	if err := json.Unmarshal(content, &value); err != nil {
+		return fmt.Errorf("%w: expected a number or a string, got %s", InvalidConfigErr, content)
+	}
+	*q = Quantity(value)
+	return nil
+}
+
+// Images configures the images jobs run in.
+type Images struct {
+	// Default is the image of the jobs declaring none.
+	Default string `json:"default,omitempty"`
+	// Overrides replaces images, keyed by the image replaced.
+	Overrides map[string]string `json:"overrides,omitempty"`
+	// Mirrors holds the registries images are pulled from instead of the
+	// ones keyed, e.g. docker.io to mirror.example.com/dockerhub.
+	Mirrors map[string]string `json:"mirrors,omitempty"`
+	// Rewrites are rules replacing images, written as pattern -> replacement
+	// where a * of the pattern matches any text, such as
+	// docker.io/* -> mirror.local:5000/*. The first rule matching applies.
+	Rewrites []string `json:"rewrites,omitempty"`
+}
+
+// JobCache configures the cache restoring the jobs which did not change
+// since they last succeeded.
+type JobCache struct {
+	// Inputs holds the patterns of the files of the project jobs depend on,
+	// keyed by job name, such as **/*.go. The changes patterns of the rules
+	// of a job apply otherwise, and every file of the project when there are
+	// none.
+	Inputs map[string][]string `json:"inputs,omitempty"`
+}
+
+// Secrets tells where secrets are read from, their values being kept out of
+// the configuration so that they are not committed.
+type Secrets struct {
+	// Files are dotenv files of KEY=value lines.
+	Files []string `json:"files,omitempty"`
+	// Env holds the names of the environment variables passed to jobs, or
+	// patterns matching them such as AWS_*.
+	Env []string `json:"env,omitempty"`
+	// Commands are shell commands printing the value of the secret they are
+	// keyed by, such as `pass show deploy/token`.
+	Commands map[string]string `json:"commands,omitempty"`
+	// FileVariables holds the names of the secrets given to jobs as a file,
+	// the variable holding its path.
+	FileVariables []string `json:"file_variables,omitempty"`
+}
+
+// File is the content of a configuration file: settings along with named
+// profiles, applied on top of them when selected.
+type File struct {
+	Config
+	Profiles map[string]Config `json:"profiles,omitempty"`
+}
+
+// Merge returns c overridden by other: the settings other sets replace the
+// ones of c, maps being merged key by key and lists added.
+func (c Config) Merge(other Config) Config {
+	if other.Executor != "" {
+		c.Executor = other.Executor
+	}
+	if other.Images.Default != "" {
+		c.Images.Default = other.Images.Default
+	}
+	c.Images.Overrides = mergeMaps(c.Images.Overrides, other.Images.Overrides)
+	c.Images.Mirrors = mergeMaps(c.Images.Mirrors, other.Images.Mirrors)
+	c.Images.Rewrites = mergeLists(c.Images.Rewrites, other.Images.Rewrites)
+	c.Variables = mergeMaps(c.Variables, other.Variables)
+	c.Secrets.Files = mergeLists(c.Secrets.Files, other.Secrets.Files)
+	c.Secrets.Env = mergeLists(c.Secrets.Env, other.Secrets.Env)
+	c.Secrets.Commands = mergeMaps(c.Secrets.Commands, other.Secrets.Commands)
+	c.Secrets.FileVariables = mergeLists(c.Secrets.FileVariables, other.Secrets.FileVariables)
+	c.VariableFiles = mergeMaps(c.VariableFiles, other.VariableFiles)
+	c.JobCache.Inputs = mergeMaps(c.JobCache.Inputs, other.JobCache.Inputs)
+	if other.Concurrency != 0 {
+		c.Concurrency = other.Concurrency
+	}
+	if other.CacheDir != "" {
+		c.CacheDir = other.CacheDir
+	}
+	if other.PullPolicy != "" {
+		c.PullPolicy = other.PullPolicy
+	}
+	c.Offline = c.Offline || other.Offline
+	c.Docker = c.Docker.merge(other.Docker)
+	if other.Shell != "" {
+		c.Shell = other.Shell
+	}
+	c.Shells = mergeMaps(c.Shells, other.Shells)
+	return c
+}
+
+func (d Docker) merge(other Docker) Docker {
+	d.HostSocket = d.HostSocket || other.HostSocket
+	d.CPUs = cmp.Or(other.CPUs, d.CPUs)
+	d.Memory = cmp.Or(other.Memory, d.Memory)
+	d.MemorySwap = cmp.Or(other.MemorySwap, d.MemorySwap)
+	d.ShmSize = cmp.Or(other.ShmSize, d.ShmSize)
+	d.Ulimits = mergeLists(d.Ulimits, other.Ulimits)
+	d.CapAdd = mergeLists(d.CapAdd, other.CapAdd)
+	d.CapDrop = mergeLists(d.CapDrop, other.CapDrop)
+	d.Privileged = d.Privileged || other.Privileged
+	d.ReadOnly = d.ReadOnly || other.ReadOnly
+	d.Tmpfs = mergeMaps(d.Tmpfs, other.Tmpfs)
+	d.ExtraHosts = mergeLists(d.ExtraHosts, other.ExtraHosts)
+	d.DNS = mergeLists(d.DNS, other.DNS)
+	d.DNSSearch = mergeLists(d.DNSSearch, other.DNSSearch)
+	d.User = cmp.Or(other.User, d.User)
+	return d
+}
+
+func mergeLists(base, additions []string) []string {
+	for _, item := range additions {
+		if !slices.Contains(base, item) {
+			base = append(slices.Clip(base), item)
+		}
+	}
+	return base
+}
+
+func mergeMaps[V any](base, overrides map[string]V) map[string]V {
+	if len(overrides) == 0 {
+		return base
+	}
+	merged := maps.Clone(base)
+	if merged == nil {
+		merged = make(map[string]V, len(overrides))
+	}
+	maps.Copy(merged, overrides)
+	return merged
+}
+
+// UserPath returns the path of the configuration file of the user,
+// config.yml in the pipelinefox directory of XDG_CONFIG_HOME or ~/.config.
+func UserPath() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "pipelinefox", "config.yml"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "pipelinefox", "config.yml"), nil
+}
+
+// ProjectPath returns the path of the configuration file of the project in
+// dir.
+func ProjectPath(dir string) string {
+	return filepath.Join(dir, FileName)
+}
+
+// ReadFile reads the configuration file at path, a missing file being
+// empty. Relative paths of the file are resolved against its directory.
+func ReadFile(path string) (File, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return File{}, nil
+	}
+	if err != nil {
+		return File{}, err
+	}
+
+	var file File
+	if err := yaml.UnmarshalStrict(content, &file); err != nil {
+		return File{}, fmt.Errorf("%w %s: %w", InvalidConfigErr, path, err)
+	}
+
+	dir := filepath.Dir(path)
+	file.Config = file.resolve(dir)
+	for name, profile := range file.Profiles {
+		file.Profiles[name] = profile.resolve(dir)
+	}
+	return file, file.validate(path)
+}
+
+func (c Config) resolve(dir string) Config {
+	c.Secrets.Files = slices.Clone(c.Secrets.Files)
+	for i, path := range c.Secrets.Files {
+		c.Secrets.Files[i] = resolvePath(dir, path)
+	}
+	if len(c.VariableFiles) > 0 {
+		files := make(map[string]string, len(c.VariableFiles))
+		for name, path := range c.VariableFiles {
+			files[name] = resolvePath(dir, path)
+		}
+		c.VariableFiles = files
+	}
+	if c.CacheDir != "" {
+		c.CacheDir = resolvePath(dir, c.CacheDir)
+	}
+	if len(c.Shells) > 0 {
+		shells := make(map[string]Shell, len(c.Shells))
+		for name, shell := range c.Shells {
+			if shell.Template != "" {
+				shell.Template = resolvePath(dir, shell.Template)
+			}
+			shells[name] = shell
+		}
+		c.Shells = shells
+	}
+	return c
+}
+
+// resolvePath returns path relative to dir, or to the home directory when
+// starting with ~/.
+func resolvePath(dir, path string) string {
+	if rest, found := strings.CutPrefix(path, "~/"); found {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+func (f File) validate(path string) error {
+	for name, config := range f.Profiles {
+		if config.Concurrency < 0 {
+			return fmt.Errorf("%w %s: concurrency of profile %s is negative", InvalidConfigErr, path, name)
+		}
+		if err := validateShells(config.Shells); err != nil {
+			return fmt.Errorf("%w %s: profile %s: %w", InvalidConfigErr, path, name, err)
+		}
+	}
+	if f.Concurrency < 0 {
+		return fmt.Errorf("%w %s: concurrency is negative", InvalidConfigErr, path)
+	}
+	if err := validateShells(f.Shells); err != nil {
+		return fmt.Errorf("%w %s: %w", InvalidConfigErr, path, err)
+	}
+	return nil
+}
+
+func validateShells(shells map[string]Shell) error {
+	for _, name := range slices.Sorted(maps.Keys(shells)) {
+		if shells[name].Template == "" || len(shells[name].Command) == 0 {
+			return fmt.Errorf("shell %s needs a template and a command", name)
+		}
+	}
+	return nil
+}
+
+// Load returns the configuration of the files at paths, each one taking
+// precedence over the previous ones. When profile is not empty, its
+// settings in every file are then applied in the same order, one of the
+// files having to declare it.
+func Load(profile string, paths ...string) (Config, error) {
+	var config Config
+	files := make([]File, 0, len(paths))
+	for _, path := range paths {
+		file, err := ReadFile(path)
+		if err != nil {
+			return Config{}, err
+		}
+		files = append(files, file)
+		config = config.Merge(file.Config)
+	}
+
+	if profile == "" {
+		return config, nil
+	}
+	found := false
+	for _, file := range files {
+		if settings, ok := file.Profiles[profile]; ok {
+			config = config.Merge(settings)
+			found = true
+		}
+	}
+	if !found {
+		return Config{}, fmt.Errorf("%w %s", UnknownProfileErr, profile)
+	}
+	return config, nil
+}
+
+// FromEnv returns the settings given through the environment, looked up
+// with lookup such as os.LookupEnv.
+func FromEnv(lookup func(name string) (string, bool)) (Config, error) {
+	var config Config
+	config.Executor, _ = lookup(ExecutorEnv)
+	config.CacheDir, _ = lookup(CacheDirEnv)
+	config.PullPolicy, _ = lookup(PullPolicyEnv)
+	config.Shell, _ = lookup(ShellEnv)
+
+	if value, found := lookup(ConcurrencyEnv); found && value != "" {
+		concurrency, err := strconv.Atoi(value)
+		if err != nil || concurrency < 0 {
+			return Config{}, fmt.Errorf("%w: %s is not a positive number", InvalidConfigErr, ConcurrencyEnv)
+		}
+		config.Concurrency = concurrency
+	}
+	if value, found := lookup(OfflineEnv); found && value != "" {
+		offline, err := strconv.ParseBool(value)
+		if err != nil {
+			return Config{}, fmt.Errorf("%w: %s is not a boolean", InvalidConfigErr, OfflineEnv)
+		}
+		config.Offline = offline
+	}
+	return config, nil
+}
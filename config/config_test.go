@@ -0,0 +1,123 @@
+package config
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	project, err := filepath.Abs("testdata/project")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	paths := []string{"testdata/user.yml", filepath.Join(project, FileName)}
+
+	base := Config{
+		Executor: "docker",
+		Images: Images{
+			Default:   "alpine:3.20",
+			Overrides: map[string]string{"node:18": "node:20"},
+			Mirrors:   map[string]string{"docker.io": "mirror.example.com/dockerhub"},
+			Rewrites:  []string{"docker.io/* -> mirror.local:5000/*", "golang:* -> registry.example.com/golang:*"},
+		},
+		Variables: map[string]string{"REGISTRY": "registry.example.com", "TARGET": "staging"},
+		Secrets: Secrets{
+			Files:         []string{"/etc/pipelinefox/secrets.env", filepath.Join(project, "secrets.env")},
+			Env:           []string{"GITLAB_TOKEN", "AWS_*"},
+			Commands:      map[string]string{"DEPLOY_KEY": "pass show deploy/key"},
+			FileVariables: []string{"KUBECONFIG"},
+		},
+		VariableFiles: map[string]string{"GOOGLE_APPLICATION_CREDENTIALS": filepath.Join(project, "ci/service-account.json")},
+		Concurrency:   2,
+		CacheDir:      filepath.Join(project, ".cache"),
+		PullPolicy:    "if-not-present",
+		JobCache:      JobCache{Inputs: map[string][]string{"unit_tests": {"**/*.go", "go.mod", "go.sum"}}},
+		Shell:         "bash",
+		Shells:        map[string]Shell{"zsh": {Template: filepath.Join(project, "ci/zsh.tmpl"), Command: []string{"zsh"}}},
+		Docker: Docker{
+			CPUs:    "2",
+			Memory:  "2g",
+			Ulimits: []string{"nofile=1024:2048"},
+			CapDrop: []string{"NET_RAW"},
+		},
+	}
+
+	ci := base
+	ci.Concurrency = 8
+	ci.PullPolicy = "always"
+	ci.Variables = map[string]string{"REGISTRY": "registry.example.com", "TARGET": "ci"}
+
+	offline := base
+	offline.PullPolicy = "never"
+	offline.Offline = true
+
+	build := base
+	build.Docker.HostSocket = true
+	build.Docker.Memory = "4g"
+	build.Docker.CapDrop = []string{"NET_RAW", "MKNOD"}
+	build.Shell = "zsh"
+
+	cases := map[string]Config{"": base, "ci": ci, "offline": offline, "build": build}
+	for profile, expected := range cases {
+		got, err := Load(profile, paths...)
+		if err != nil {
+			t.Fatalf("unexpected error for profile %q: %s", profile, err)
+		}
+		if !reflect.DeepEqual(expected, got) {
+			t.Errorf("unexpected configuration for profile %q:\n got %+v\nwant %+v", profile, got, expected)
+		}
+	}
+
+	if _, err := Load("release", paths...); !errors.Is(err, UnknownProfileErr) {
+		t.Errorf("expected UnknownProfileErr, got %v", err)
+	}
+}
+
+func TestLoadMissingAndInvalidFiles(t *testing.T) {
+	got, err := Load("", "testdata/missing.yml")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(Config{}, got) {
+		t.Errorf("expected an empty configuration, got %+v", got)
+	}
+
+	if _, err := Load("", "testdata/invalid.yml"); !errors.Is(err, InvalidConfigErr) {
+		t.Errorf("expected InvalidConfigErr for an unknown key, got %v", err)
+	}
+	if _, err := Load("", "testdata/invalid-shell.yml"); !errors.Is(err, InvalidConfigErr) {
+		t.Errorf("expected InvalidConfigErr for a shell without command, got %v", err)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	env := map[string]string{
+		ExecutorEnv:    "interp",
+		ConcurrencyEnv: "4",
+		PullPolicyEnv:  "never",
+		OfflineEnv:     "true",
+		ShellEnv:       "pwsh",
+		// The variable of jobs is left to them.
+		"PIPELINEFOX_SHELL": "sh",
+	}
+	lookup := func(name string) (string, bool) {
+		value, found := env[name]
+		return value, found
+	}
+
+	got, err := FromEnv(lookup)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := Config{Executor: "interp", Concurrency: 4, PullPolicy: "never", Offline: true, Shell: "pwsh"}
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+
+	env[ConcurrencyEnv] = "many"
+	if _, err := FromEnv(lookup); !errors.Is(err, InvalidConfigErr) {
+		t.Errorf("expected InvalidConfigErr, got %v", err)
+	}
+}
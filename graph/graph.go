@@ -0,0 +1,248 @@
+package graph
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/powerpixel/pipelinefox/parser/common"
+)
+
+// Formats of the graph.
+const (
+	MermaidFormat = "mermaid"
+	DOTFormat     = "dot"
+	ASCIIFormat   = "ascii"
+)
+
+type EdgeKind string
+
+const (
+	// NeedsEdge links a job to one it needs.
+	NeedsEdge EdgeKind = "needs"
+	// DependenciesEdge links a job to one it downloads the artifacts of,
+	// without needing it.
+	DependenciesEdge EdgeKind = "dependencies"
+)
+
+// Graph is a pipeline as stages of jobs, along with the links between jobs.
+type Graph struct {
+	Stages []Stage
+	Edges  []Edge
+}
+
+type Stage struct {
+	Name string
+	Jobs []Job
+}
+
+type Job struct {
+	Name  string
+	Stage string
+	// When the job runs, once rules are evaluated.
+	When string
+	// Skipped tells whether rules left the job out of the pipeline.
+	Skipped bool
+}
+
+// Edge goes from a job to another one waiting for it.
+type Edge struct {
+	From     string
+	To       string
+	Kind     EdgeKind
+	Optional bool
+}
+
+// New builds the graph of pipeline, evaluating the rules of its jobs in
+// context. Stages without jobs are left out, as are links to jobs which are
+// not part of the pipeline.
+func New(pipeline common.PipelineDescriptor, context common.RuleContext) (Graph, error) {
+	var graph Graph
+	var names []string
+
+	for _, name := range pipeline.GetStageNames() {
+		stage := Stage{Name: name}
+		for _, descriptor := range pipeline.GetStages()[name] {
+			outcome, err := descriptor.EvaluateRules(context)
+			if err != nil {
+				return Graph{}, err
+			}
+			stage.Jobs = append(stage.Jobs, Job{
+				Name:    descriptor.GetName(),
+				Stage:   name,
+				When:    outcome.When,
+				Skipped: outcome.Skipped(),
+			})
+			names = append(names, descriptor.GetName())
+		}
+		if len(stage.Jobs) > 0 {
+			graph.Stages = append(graph.Stages, stage)
+		}
+	}
+
+	for _, name := range pipeline.GetStageNames() {
+		for _, descriptor := range pipeline.GetStages()[name] {
+			graph.Edges = append(graph.Edges, edges(descriptor, names)...)
+		}
+	}
+	return graph, nil
+}
+
+func edges(job common.PipelineJobDescriptor, names []string) []Edge {
+	var result []Edge
+	var needed []string
+
+	for _, need := range job.GetNeeds() {
+		if slices.Contains(names, need.Job) {
+			result = append(result, Edge{From: need.Job, To: job.GetName(), Kind: NeedsEdge, Optional: need.Optional})
+			needed = append(needed, need.Job)
+		}
+	}
+	for _, dependency := range job.GetDependencies() {
+		if slices.Contains(names, dependency) && !slices.Contains(needed, dependency) {
+			result = append(result, Edge{From: dependency, To: job.GetName(), Kind: DependenciesEdge})
+		}
+	}
+	return result
+}
+
+// Write writes graph to w in format.
+func Write(w io.Writer, format string, graph Graph) error {
+	switch format {
+	case MermaidFormat:
+		return WriteMermaid(w, graph)
+	case DOTFormat:
+		return WriteDOT(w, graph)
+	case ASCIIFormat:
+		return WriteASCII(w, graph)
+	default:
+		return fmt.Errorf("unknown graph format %s, expected mermaid, dot or ascii", format)
+	}
+}
+
+// label describes a job, telling when it does not run as usual.
+func (j Job) label() string {
+	switch {
+	case j.Skipped:
+		return j.Name + " (skipped)"
+	case j.When != common.WhenOnSuccess:
+		return j.Name + " (" + j.When + ")"
+	default:
+		return j.Name
+	}
+}
+
+// WriteMermaid writes graph as a Mermaid flowchart, with a subgraph per
+// stage. Dependencies are dotted and skipped jobs are greyed out.
+func WriteMermaid(w io.Writer, graph Graph) error {
+	ids := make(map[string]string)
+	var b strings.Builder
+
+	b.WriteString("flowchart LR\n")
+	for i, stage := range graph.Stages {
+		fmt.Fprintf(&b, "  subgraph stage%d[\"%s\"]\n", i, mermaidEscape(stage.Name))
+		for _, job := range stage.Jobs {
+			ids[job.Name] = fmt.Sprintf("job%d", len(ids))
+			fmt.Fprintf(&b, "    %s[\"%s\"]\n", ids[job.Name], mermaidEscape(job.label()))
+		}
+		b.WriteString("  end\n")
+	}
+
+	for _, edge := range graph.Edges {
+		arrow := "-->"
+		if edge.Kind == DependenciesEdge || edge.Optional {
+			arrow = "-.->"
+		}
+		fmt.Fprintf(&b, "  %s %s %s\n", ids[edge.From], arrow, ids[edge.To])
+	}
+
+	var skipped []string
+	for _, stage := range graph.Stages {
+		for _, job := range stage.Jobs {
+			if job.Skipped {
+				skipped = append(skipped, ids[job.Name])
+			}
+		}
+	}
+	if len(skipped) > 0 {
+		b.WriteString("  classDef skipped stroke-dasharray: 5 5,color:#999\n")
+		fmt.Fprintf(&b, "  class %s skipped\n", strings.Join(skipped, ","))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func mermaidEscape(text string) string {
+	return strings.ReplaceAll(text, `"`, "#quot;")
+}
+
+// WriteDOT writes graph in the Graphviz DOT language, with a cluster per
+// stage. Dependencies are dashed and skipped jobs are greyed out.
+func WriteDOT(w io.Writer, graph Graph) error {
+	var b strings.Builder
+
+	b.WriteString("digraph pipeline {\n  rankdir=LR;\n  node [shape=box];\n")
+	for i, stage := range graph.Stages {
+		fmt.Fprintf(&b, "  subgraph cluster_%d {\n    label=%s;\n", i, strconv.Quote(stage.Name))
+		for _, job := range stage.Jobs {
+			attributes := "label=" + strconv.Quote(job.label())
+			if job.Skipped {
+				attributes += ", style=dashed, fontcolor=gray"
+			}
+			fmt.Fprintf(&b, "    %s [%s];\n", strconv.Quote(job.Name), attributes)
+		}
+		b.WriteString("  }\n")
+	}
+
+	for _, edge := range graph.Edges {
+		attributes := ""
+		if edge.Kind == DependenciesEdge || edge.Optional {
+			attributes = " [style=dashed]"
+		}
+		fmt.Fprintf(&b, "  %s -> %s%s;\n", strconv.Quote(edge.From), strconv.Quote(edge.To), attributes)
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteASCII writes graph as a tree of stages and jobs, each job followed
+// by the ones it waits for.
+func WriteASCII(w io.Writer, graph Graph) error {
+	var b strings.Builder
+
+	for _, stage := range graph.Stages {
+		b.WriteString(stage.Name + "\n")
+		for i, job := range stage.Jobs {
+			branch := "├── "
+			if i == len(stage.Jobs)-1 {
+				branch = "└── "
+			}
+			b.WriteString(branch + job.label())
+
+			var links []string
+			for _, kind := range []EdgeKind{NeedsEdge, DependenciesEdge} {
+				var from []string
+				for _, edge := range graph.Edges {
+					if edge.To == job.Name && edge.Kind == kind {
+						from = append(from, edge.From)
+					}
+				}
+				if len(from) > 0 {
+					links = append(links, string(kind)+" "+strings.Join(from, ", "))
+				}
+			}
+			if len(links) > 0 {
+				b.WriteString(" ← " + strings.Join(links, "; "))
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
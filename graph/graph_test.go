@@ -0,0 +1,100 @@
+package graph
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/powerpixel/pipelinefox/parser/common"
+)
+
+func newTestGraph(t *testing.T) Graph {
+	t.Helper()
+
+	pipeline, err := common.NewPipelineDescriptor([]string{"build", "test", "deploy", "empty"}, []common.PipelineJobDescriptor{
+		common.NewPipelineJobDescriptor("compile", "build", []string{"make"}),
+		common.NewPipelineJobDescriptor("lint", "build", []string{"make lint"}),
+		common.NewPipelineJobDescriptor("unit", "test", []string{"make test"}).
+			WithNeeds([]common.Need{{Job: "compile", Artifacts: true}, {Job: "missing", Optional: true}}).
+			WithDependencies([]string{"compile", "lint"}),
+		common.NewPipelineJobDescriptor("deploy", "deploy", []string{"make deploy"}).
+			WithRules([]common.Rule{{If: `$CI_COMMIT_BRANCH == "main"`}}),
+		common.NewPipelineJobDescriptor("release", "deploy", []string{"make release"}).
+			WithWhen(common.WhenManual),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error : %v", err)
+	}
+
+	graph, err := New(*pipeline, common.RuleContext{Variables: map[string]string{"CI_COMMIT_BRANCH": "feature"}})
+	if err != nil {
+		t.Fatalf("unexpected error : %v", err)
+	}
+	return graph
+}
+
+func TestNewGraph(t *testing.T) {
+	graph := newTestGraph(t)
+
+	if len(graph.Stages) != 3 {
+		t.Fatalf("expected empty stages to be left out, got %+v", graph.Stages)
+	}
+	deploy := graph.Stages[2].Jobs
+	if !deploy[0].Skipped || deploy[1].Skipped || deploy[1].When != common.WhenManual {
+		t.Fatalf("unexpected deploy jobs %+v", deploy)
+	}
+
+	expected := []Edge{
+		{From: "compile", To: "unit", Kind: NeedsEdge},
+		{From: "lint", To: "unit", Kind: DependenciesEdge},
+	}
+	if len(graph.Edges) != len(expected) {
+		t.Fatalf("unexpected edges %+v", graph.Edges)
+	}
+	for i, edge := range expected {
+		if graph.Edges[i] != edge {
+			t.Errorf("expected edge %+v, got %+v", edge, graph.Edges[i])
+		}
+	}
+}
+
+func TestWriteGraph(t *testing.T) {
+	graph := newTestGraph(t)
+
+	cases := map[string][]string{
+		MermaidFormat: {
+			"flowchart LR\n",
+			"  subgraph stage0[\"build\"]\n    job0[\"compile\"]\n",
+			"    job3[\"deploy (skipped)\"]\n    job4[\"release (manual)\"]\n",
+			"  job0 --> job2\n  job1 -.-> job2\n",
+			"  class job3 skipped\n",
+		},
+		DOTFormat: {
+			"digraph pipeline {\n",
+			"  subgraph cluster_1 {\n    label=\"test\";\n    \"unit\" [label=\"unit\"];\n  }\n",
+			"\"deploy\" [label=\"deploy (skipped)\", style=dashed, fontcolor=gray];\n",
+			"  \"compile\" -> \"unit\";\n  \"lint\" -> \"unit\" [style=dashed];\n}\n",
+		},
+		ASCIIFormat: {
+			"build\n├── compile\n└── lint\ntest\n└── unit ← needs compile; dependencies lint\ndeploy\n├── deploy (skipped)\n└── release (manual)\n",
+		},
+	}
+
+	for format, expected := range cases {
+		t.Run(format, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := Write(&out, format, graph); err != nil {
+				t.Fatalf("unexpected error : %v", err)
+			}
+			for _, part := range expected {
+				if !strings.Contains(out.String(), part) {
+					t.Errorf("expected output to contain %q, got\n%s", part, out.String())
+				}
+			}
+		})
+	}
+
+	if err := Write(new(bytes.Buffer), "svg", graph); err == nil {
+		t.Fatalf("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,370 @@
+package jobcache
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	parserCommon "github.com/powerpixel/pipelinefox/parser/common"
+	"github.com/powerpixel/pipelinefox/runner/common"
+)
+
+// Dir is the directory of the cache directory holding the job results.
+const Dir = "jobs"
+
+// keyVersion is hashed into every key, to be changed when what a key covers
+// does, so that older results are not restored.
+const keyVersion = "pipelinefox-job-cache-v1"
+
+const (
+	resultFile   = "result.json"
+	logsDir      = "logs"
+	artifactsDir = "artifacts"
+)
+
+// ignoredDirs are the directories of the project whose files are never
+// inputs of jobs.
+var ignoredDirs = []string{".git", ".pipelinefox"}
+
+// Cache stores the results of the jobs of a project in a directory, keyed by
+// a hash of their definition, environment, inputs and upstream artifacts.
+type Cache struct {
+	root    string
+	dir     string
+	project string
+	inputs  map[string][]string
+}
+
+// New returns the cache of the project in dir stored in cacheDir. inputs
+// holds the patterns of the input files of jobs, keyed by job name, the
+// changes patterns of their rules applying otherwise, and every file of the
+// project when they have none.
+func New(cacheDir, project string, inputs map[string][]string) Cache {
+	return Cache{
+		root:    filepath.Clean(cacheDir),
+		dir:     filepath.Join(cacheDir, Dir),
+		project: filepath.Clean(project),
+		inputs:  inputs,
+	}
+}
+
+// definition is what a key covers of a job, every field of the descriptor
+// the outcome of the job may depend on.
+type definition struct {
+	Name         string                       `json:"name"`
+	Stage        string                       `json:"stage"`
+	Image        string                       `json:"image"`
+	Services     []parserCommon.Service       `json:"services"`
+	BeforeScript []string                     `json:"before_script,omitempty"`
+	Script       []string                     `json:"script"`
+	AfterScript  []string                     `json:"after_script"`
+	Timeout      time.Duration                `json:"timeout"`
+	Variables    map[string]string            `json:"variables"`
+	Reports      parserCommon.ArtifactReports `json:"reports"`
+	Paths        []string                     `json:"artifact_paths,omitempty"`
+	Dependencies []string                     `json:"dependencies"`
+}
+
+func (c Cache) Key(ctx context.Context, job parserCommon.PipelineJobDescriptor, environment string, upstream []common.JobResult) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\nenvironment %q\n", keyVersion, environment)
+
+	content, err := json.Marshal(definition{
+		Name:         job.GetName(),
+		Stage:        job.GetStage(),
+		Image:        job.GetImage(),
+		Services:     job.GetServices(),
+		BeforeScript: job.GetBeforeScript(),
+		Script:       job.GetScript(),
+		AfterScript:  job.GetAfterScript(),
+		Timeout:      job.GetTimeout(),
+		Variables:    job.GetVariables(),
+		Reports:      job.GetReports(),
+		Paths:        job.GetArtifactPaths(),
+		Dependencies: job.GetDependencies(),
+	})
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(h, "job %s\n", content)
+
+	if err := c.hashInputs(ctx, h, c.inputPatterns(job)); err != nil {
+		return "", err
+	}
+
+	upstream = slices.Clone(upstream)
+	slices.SortFunc(upstream, func(a, b common.JobResult) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	for _, result := range upstream {
+		if err := hashUpstream(h, result); err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// inputPatterns returns the patterns of the input files of job, nil when
+// every file of the project is one.
+func (c Cache) inputPatterns(job parserCommon.PipelineJobDescriptor) []string {
+	if patterns, found := c.inputs[job.GetName()]; found {
+		return patterns
+	}
+	var patterns []string
+	for _, rule := range job.GetRules() {
+		patterns = append(patterns, rule.Changes...)
+	}
+	return patterns
+}
+
+// hashInputs hashes the path and content of the files of the project
+// matching patterns, or of all of them when there are none.
+func (c Cache) hashInputs(ctx context.Context, h hash.Hash, patterns []string) error {
+	return filepath.WalkDir(c.project, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(c.project, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if entry.IsDir() {
+			if slices.Contains(ignoredDirs, rel) || path == c.root {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if len(patterns) > 0 && !slices.ContainsFunc(patterns, func(pattern string) bool {
+			return common.MatchPattern(pattern, rel)
+		}) {
+			return nil
+		}
+
+		switch {
+		case entry.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "input %q -> %q\n", rel, target)
+		case entry.Type().IsRegular():
+			sum, err := hashFile(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "input %q %s\n", rel, sum)
+		}
+		return nil
+	})
+}
+
+// hashUpstream hashes the dotenv variables and the content of the artifacts
+// of an upstream job, which is what the job receives from it.
+func hashUpstream(h hash.Hash, result common.JobResult) error {
+	fmt.Fprintf(h, "upstream %q %s\n", result.Name, result.Status)
+	for _, name := range slices.Sorted(maps.Keys(result.Dotenv)) {
+		fmt.Fprintf(h, "dotenv %q=%q\n", name, result.Dotenv[name])
+	}
+
+	sums := make([]string, 0, len(result.Artifacts))
+	for _, artifact := range result.Artifacts {
+		sum, err := hashFile(artifact)
+		if err != nil {
+			return fmt.Errorf("could not hash artifact of %s: %w", result.Name, err)
+		}
+		sums = append(sums, sum)
+	}
+	slices.Sort(sums)
+	for _, sum := range sums {
+		fmt.Fprintf(h, "artifact %s\n", sum)
+	}
+	return nil
+}
+
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// entry is the directory of the result stored under key.
+func (c Cache) entry(key string) string {
+	return filepath.Join(c.dir, key)
+}
+
+func (c Cache) Restore(key string, options common.RunnerOptions) (common.JobResult, bool, error) {
+	entry := c.entry(key)
+	content, err := os.ReadFile(filepath.Join(entry, resultFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return common.JobResult{}, false, nil
+	}
+	if err != nil {
+		return common.JobResult{}, false, err
+	}
+
+	var result common.JobResult
+	if err := json.Unmarshal(content, &result); err != nil {
+		return common.JobResult{}, false, fmt.Errorf("invalid cached result %s: %w", key, err)
+	}
+
+	if result.LogPath, err = copyLogs(filepath.Join(entry, logsDir), options.LogDir, result.Name); err != nil {
+		return common.JobResult{}, false, err
+	}
+
+	artifacts, reports, files := result.Artifacts, result.JUnitReports, result.ArtifactFiles
+	result.Artifacts, result.JUnitReports, result.ArtifactFiles = nil, nil, nil
+	if options.ArtifactDir != "" {
+		for _, artifact := range artifacts {
+			restored := filepath.Join(options.ArtifactDir, filepath.FromSlash(artifact))
+			if err := copyFile(filepath.Join(entry, artifactsDir, filepath.FromSlash(artifact)), restored); err != nil {
+				return common.JobResult{}, false, err
+			}
+			result.Artifacts = append(result.Artifacts, restored)
+			if slices.Contains(reports, artifact) {
+				result.JUnitReports = append(result.JUnitReports, restored)
+			}
+		}
+		for path, artifact := range files {
+			if result.ArtifactFiles == nil {
+				result.ArtifactFiles = make(map[string]string, len(files))
+			}
+			result.ArtifactFiles[path] = filepath.Join(options.ArtifactDir, filepath.FromSlash(artifact))
+		}
+	}
+
+	result.Reason = fmt.Sprintf("unchanged since %s, restored from the job cache", result.FinishedAt.Local().Format(time.DateTime))
+	return result, true, nil
+}
+
+// Save stores the result in a new directory, which then replaces the entry
+// of key, so that a result is never restored half written.
+func (c Cache) Save(key string, options common.RunnerOptions, result common.JobResult) error {
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(c.dir, key+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	if result.LogPath != "" {
+		if _, err := copyLogs(options.LogDir, filepath.Join(tmp, logsDir), result.Name); err != nil {
+			return err
+		}
+	}
+
+	// Artifacts are stored relative to the artifact directory, for them to
+	// be restored in the one of another run.
+	artifacts, reports, files := result.Artifacts, result.JUnitReports, result.ArtifactFiles
+	result.Artifacts, result.JUnitReports, result.ArtifactFiles = nil, nil, nil
+	for _, artifact := range artifacts {
+		rel, err := filepath.Rel(options.ArtifactDir, artifact)
+		if err != nil || !filepath.IsLocal(rel) {
+			return fmt.Errorf("artifact %s is outside of the artifact directory", artifact)
+		}
+		if err := copyFile(artifact, filepath.Join(tmp, artifactsDir, rel)); err != nil {
+			return err
+		}
+		result.Artifacts = append(result.Artifacts, filepath.ToSlash(rel))
+		if slices.Contains(reports, artifact) {
+			result.JUnitReports = append(result.JUnitReports, filepath.ToSlash(rel))
+		}
+		for path, file := range files {
+			if file != artifact {
+				continue
+			}
+			if result.ArtifactFiles == nil {
+				result.ArtifactFiles = make(map[string]string, len(files))
+			}
+			result.ArtifactFiles[path] = filepath.ToSlash(rel)
+		}
+	}
+
+	result.Reason = ""
+	result.LogPath = ""
+	content, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(tmp, resultFile), content, 0o644); err != nil {
+		return err
+	}
+
+	entry := c.entry(key)
+	if err := os.RemoveAll(entry); err != nil {
+		return err
+	}
+	return os.Rename(tmp, entry)
+}
+
+// copyLogs copies the log files of job from one directory to another,
+// returning the path of the combined log copied, empty when there is none.
+// Nothing is copied when either directory is empty.
+func copyLogs(from, to, job string) (string, error) {
+	if from == "" || to == "" {
+		return "", nil
+	}
+	combined := ""
+	for _, stream := range []common.Stream{"", common.Stdout, common.Stderr} {
+		err := copyFile(common.JobLogPath(from, job, stream), common.JobLogPath(to, job, stream))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if stream == "" {
+			combined = common.JobLogPath(to, job, stream)
+		}
+	}
+	return combined, nil
+}
+
+func copyFile(from, to string) error {
+	source, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	if err := os.MkdirAll(filepath.Dir(to), 0o755); err != nil {
+		return err
+	}
+	target, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(target, source); err != nil {
+		target.Close()
+		return err
+	}
+	return target.Close()
+}
@@ -0,0 +1,171 @@
+package jobcache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	parserCommon "github.com/powerpixel/pipelinefox/parser/common"
+	"github.com/powerpixel/pipelinefox/runner/common"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestKey(t *testing.T) {
+	project := t.TempDir()
+	writeFile(t, filepath.Join(project, "src/main.go"), "package main\n")
+	writeFile(t, filepath.Join(project, "docs/README.md"), "# docs\n")
+	writeFile(t, filepath.Join(project, ".git/HEAD"), "ref: refs/heads/main\n")
+	artifact := filepath.Join(t.TempDir(), "build", "report.xml")
+	writeFile(t, artifact, "<testsuite/>\n")
+
+	cache := New(filepath.Join(project, ".pipelinefox/cache"), project, map[string][]string{"unit": {"src/**/*.go"}})
+	unit := parserCommon.NewPipelineJobDescriptor("unit", "test", []string{"go test ./..."})
+	lint := parserCommon.NewPipelineJobDescriptor("lint", "test", []string{"golangci-lint run"})
+	upstream := []common.JobResult{{Name: "build", Status: common.JobStatusSuccess, Artifacts: []string{artifact}}}
+
+	key := func(job parserCommon.PipelineJobDescriptor, environment string, upstream []common.JobResult) string {
+		t.Helper()
+		key, err := cache.Key(context.Background(), job, environment, upstream)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return key
+	}
+	unitKey, lintKey := key(unit, "interp", upstream), key(lint, "interp", upstream)
+
+	if key(unit, "interp", upstream) != unitKey {
+		t.Fatal("expected the key of an unchanged job to be stable")
+	}
+	for name, changed := range map[string]string{
+		"script":      key(unit.WithAfterScript([]string{"echo done"}), "interp", upstream),
+		"variables":   key(unit.WithVariables(map[string]string{"GOFLAGS": "-race"}), "interp", upstream),
+		"artifacts":   key(unit.WithArtifactPaths([]string{"coverage/"}), "interp", upstream),
+		"environment": key(unit, "docker golang:1.23@sha256:0123", upstream),
+		"upstream":    key(unit, "interp", nil),
+	} {
+		if changed == unitKey {
+			t.Errorf("expected a change of %s to change the key", name)
+		}
+	}
+
+	// Only the declared inputs of unit matter, every file of the project,
+	// but the ones of .git and .pipelinefox, being an input of lint.
+	writeFile(t, filepath.Join(project, "docs/README.md"), "# updated docs\n")
+	writeFile(t, filepath.Join(project, ".git/HEAD"), "ref: refs/heads/feature\n")
+	writeFile(t, filepath.Join(project, ".pipelinefox/cache/jobs/entry"), "ignored\n")
+	if key(unit, "interp", upstream) != unitKey {
+		t.Error("expected a change outside of the inputs of unit to keep its key")
+	}
+	if key(lint, "interp", upstream) == lintKey {
+		t.Error("expected a change in the project to change the key of lint")
+	}
+
+	writeFile(t, filepath.Join(project, "src/main.go"), "package main\n\nfunc main() {}\n")
+	if key(unit, "interp", upstream) == unitKey {
+		t.Error("expected a change of an input to change the key")
+	}
+
+	writeFile(t, artifact, "<testsuite tests=\"1\"/>\n")
+	if key(lint, "interp", upstream) == lintKey {
+		t.Error("expected a change of an upstream artifact to change the key")
+	}
+}
+
+func TestRulesChangesAreInputs(t *testing.T) {
+	project := t.TempDir()
+	writeFile(t, filepath.Join(project, "web/app.js"), "app\n")
+	writeFile(t, filepath.Join(project, "api/main.go"), "package main\n")
+
+	cache := New(t.TempDir(), project, nil)
+	job := parserCommon.NewPipelineJobDescriptor("web", "test", []string{"npm test"}).
+		WithRules([]parserCommon.Rule{{Changes: []string{"web/**/*"}}})
+	before, err := cache.Key(context.Background(), job, "", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	writeFile(t, filepath.Join(project, "api/main.go"), "package api\n")
+	after, err := cache.Key(context.Background(), job, "", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if before != after {
+		t.Error("expected files outside of the changes of the rules to keep the key")
+	}
+}
+
+func TestSaveAndRestore(t *testing.T) {
+	cache := New(t.TempDir(), t.TempDir(), nil)
+	run := common.RunnerOptions{LogDir: t.TempDir(), ArtifactDir: t.TempDir()}
+
+	report := common.ArtifactPath(run.ArtifactDir, "unit", "reports/junit.xml")
+	writeFile(t, report, "<testsuite/>\n")
+	coverage := common.ArtifactPath(run.ArtifactDir, "unit", "coverage/index.html")
+	writeFile(t, coverage, "<html/>\n")
+	writeFile(t, common.JobLogPath(run.LogDir, "unit", ""), "ok\n")
+	writeFile(t, common.JobLogPath(run.LogDir, "unit", common.Stdout), "ok\n")
+	finished := time.Now()
+	result := common.JobResult{
+		Name:          "unit",
+		Stage:         "test",
+		Status:        common.JobStatusSuccess,
+		StartedAt:     finished.Add(-time.Minute),
+		FinishedAt:    finished,
+		LogPath:       common.JobLogPath(run.LogDir, "unit", ""),
+		Artifacts:     []string{report, coverage},
+		JUnitReports:  []string{report},
+		ArtifactFiles: map[string]string{"coverage/index.html": coverage},
+		Dotenv:        map[string]string{"COVERAGE": "87"},
+	}
+
+	if _, found, err := cache.Restore("key", run); found || err != nil {
+		t.Fatalf("expected no result before saving, got %v %v", found, err)
+	}
+	if err := cache.Save("key", run, result); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	next := common.RunnerOptions{LogDir: t.TempDir(), ArtifactDir: t.TempDir()}
+	restored, found, err := cache.Restore("key", next)
+	if err != nil || !found {
+		t.Fatalf("expected the result to be restored, got %v %v", found, err)
+	}
+
+	expectedReport := common.ArtifactPath(next.ArtifactDir, "unit", "reports/junit.xml")
+	expectedCoverage := common.ArtifactPath(next.ArtifactDir, "unit", "coverage/index.html")
+	if restored.Status != common.JobStatusSuccess || restored.Dotenv["COVERAGE"] != "87" || restored.Reason == "" {
+		t.Errorf("unexpected restored result %+v", restored)
+	}
+	if !slices.Equal([]string{expectedReport, expectedCoverage}, restored.Artifacts) || !slices.Equal([]string{expectedReport}, restored.JUnitReports) {
+		t.Errorf("expected artifacts in %s, got %v and %v", next.ArtifactDir, restored.Artifacts, restored.JUnitReports)
+	}
+	if restored.ArtifactFiles["coverage/index.html"] != expectedCoverage {
+		t.Errorf("expected the artifacts:paths file at %s, got %v", expectedCoverage, restored.ArtifactFiles)
+	}
+	if restored.LogPath != common.JobLogPath(next.LogDir, "unit", "") {
+		t.Errorf("unexpected log path %s", restored.LogPath)
+	}
+	for path, expected := range map[string]string{
+		expectedReport:   "<testsuite/>\n",
+		expectedCoverage: "<html/>\n",
+		restored.LogPath: "ok\n",
+		common.JobLogPath(next.LogDir, "unit", common.Stdout): "ok\n",
+	} {
+		content, err := os.ReadFile(path)
+		if err != nil || string(content) != expected {
+			t.Errorf("expected %s to hold %q, got %q (%v)", path, expected, content, err)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package junit
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+var UnknownRootElementErr = errors.New("the JUnit report root element is neither testsuites nor testsuite")
+
+// TestSuites is the root of a JUnit XML report.
+type TestSuites struct {
+	XMLName  xml.Name    `xml:"testsuites"`
+	Name     string      `xml:"name,attr,omitempty"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Skipped  int         `xml:"skipped,attr"`
+	Time     float64     `xml:"time,attr"`
+	Suites   []TestSuite `xml:"testsuite"`
+}
+
+type TestSuite struct {
+	XMLName   xml.Name    `xml:"testsuite"`
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Errors    int         `xml:"errors,attr"`
+	Skipped   int         `xml:"skipped,attr"`
+	Time      float64     `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr,omitempty"`
+	Cases     []TestCase  `xml:"testcase"`
+	Suites    []TestSuite `xml:"testsuite"`
+}
+
+type TestCase struct {
+	Name      string   `xml:"name,attr"`
+	Classname string   `xml:"classname,attr,omitempty"`
+	File      string   `xml:"file,attr,omitempty"`
+	Time      float64  `xml:"time,attr"`
+	Failure   *Outcome `xml:"failure"`
+	Error     *Outcome `xml:"error"`
+	Skipped   *Outcome `xml:"skipped"`
+	SystemOut string   `xml:"system-out,omitempty"`
+	SystemErr string   `xml:"system-err,omitempty"`
+}
+
+// Outcome details why a test case failed or was skipped.
+type Outcome struct {
+	Message string `xml:"message,attr,omitempty"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// Failed reports whether the test case failed or errored.
+func (c TestCase) Failed() bool {
+	return c.Failure != nil || c.Error != nil
+}
+
+// Message returns the message of the failure or error of the test case.
+func (c TestCase) Message() string {
+	for _, outcome := range []*Outcome{c.Failure, c.Error} {
+		if outcome == nil {
+			continue
+		}
+		if outcome.Message != "" {
+			return outcome.Message
+		}
+		return outcome.Text
+	}
+	return ""
+}
+
+// Parse reads a JUnit report whose root is either testsuites or a single
+// testsuite. Nested suites are flattened and counts are computed from the
+// test cases, tools often omitting them.
+func Parse(r io.Reader) (TestSuites, error) {
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return TestSuites{}, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		var suites TestSuites
+		switch start.Name.Local {
+		case "testsuites":
+			err = decoder.DecodeElement(&suites, &start)
+		case "testsuite":
+			var suite TestSuite
+			err = decoder.DecodeElement(&suite, &start)
+			suites.Suites = []TestSuite{suite}
+		default:
+			return TestSuites{}, fmt.Errorf("%w: got %s", UnknownRootElementErr, start.Name.Local)
+		}
+		if err != nil {
+			return TestSuites{}, err
+		}
+
+		return Merge(suites.Name, suites), nil
+	}
+}
+
+// ParseFile reads the JUnit report at path.
+func ParseFile(path string) (TestSuites, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return TestSuites{}, err
+	}
+	defer file.Close()
+
+	suites, err := Parse(file)
+	if err != nil {
+		return TestSuites{}, fmt.Errorf("could not parse %s: %w", path, err)
+	}
+	return suites, nil
+}
+
+// Merge gathers the suites of reports in a single report named name.
+func Merge(name string, reports ...TestSuites) TestSuites {
+	merged := TestSuites{Name: name}
+	for _, report := range reports {
+		for _, suite := range report.Suites {
+			merged.Suites = append(merged.Suites, flatten(suite)...)
+		}
+	}
+
+	for i := range merged.Suites {
+		suite := &merged.Suites[i]
+		suite.count()
+		merged.Tests += suite.Tests
+		merged.Failures += suite.Failures
+		merged.Errors += suite.Errors
+		merged.Skipped += suite.Skipped
+		merged.Time += suite.Time
+	}
+	return merged
+}
+
+// flatten returns suite followed by its nested suites, none of them holding
+// nested suites anymore.
+func flatten(suite TestSuite) []TestSuite {
+	nested := suite.Suites
+	suite.Suites = nil
+
+	var suites []TestSuite
+	if len(suite.Cases) > 0 || len(nested) == 0 {
+		suites = append(suites, suite)
+	}
+	for _, child := range nested {
+		suites = append(suites, flatten(child)...)
+	}
+	return suites
+}
+
+func (s *TestSuite) count() {
+	s.Tests, s.Failures, s.Errors, s.Skipped = len(s.Cases), 0, 0, 0
+	var time float64
+	for _, c := range s.Cases {
+		switch {
+		case c.Failure != nil:
+			s.Failures++
+		case c.Error != nil:
+			s.Errors++
+		case c.Skipped != nil:
+			s.Skipped++
+		}
+		time += c.Time
+	}
+	if s.Time == 0 {
+		s.Time = time
+	}
+}
+
+// FailedCases returns the failed and errored test cases of the report.
+func (s TestSuites) FailedCases() []TestCase {
+	var failed []TestCase
+	for _, suite := range s.Suites {
+		for _, c := range suite.Cases {
+			if c.Failed() {
+				failed = append(failed, c)
+			}
+		}
+	}
+	return failed
+}
+
+// Write writes the report as indented XML.
+func (s TestSuites) Write(w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(s); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,78 @@
+package junit
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseAndMergeReports(t *testing.T) {
+	goReport, err := ParseFile("testdata/go.xml")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	pytestReport, err := ParseFile("testdata/pytest.xml")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	merged := Merge("pipeline", goReport, pytestReport)
+
+	if merged.Tests != 5 || merged.Failures != 1 || merged.Errors != 1 || merged.Skipped != 1 {
+		t.Fatalf("unexpected counts %d tests, %d failures, %d errors, %d skipped", merged.Tests, merged.Failures, merged.Errors, merged.Skipped)
+	}
+	if len(merged.Suites) != 2 || merged.Suites[1].Name != "pytest" {
+		t.Fatalf("unexpected suites %+v", merged.Suites)
+	}
+
+	failed := merged.FailedCases()
+	if len(failed) != 2 {
+		t.Fatalf("expected 2 failed cases, got %+v", failed)
+	}
+	if failed[0].Name != "TestParseInvalid" || failed[0].Message() != "Failed" {
+		t.Errorf("unexpected failure %+v", failed[0])
+	}
+	if failed[1].Name != "test_post" || failed[1].Message() != "ConnectionError: refused" {
+		t.Errorf("unexpected error %+v", failed[1])
+	}
+
+	var out bytes.Buffer
+	if err := merged.Write(&out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	reparsed, err := Parse(&out)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if reparsed.Name != "pipeline" || reparsed.Tests != merged.Tests || len(reparsed.Suites) != 2 {
+		t.Fatalf("unexpected report once written %+v", reparsed)
+	}
+}
+
+func TestParseFlattensNestedSuites(t *testing.T) {
+	report, err := Parse(strings.NewReader(`<testsuite name="root">
+		<testsuite name="a"><testcase name="one"/></testsuite>
+		<testsuite name="b"><testcase name="two"><failure>boom</failure></testcase></testsuite>
+	</testsuite>`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(report.Suites) != 2 || report.Suites[0].Name != "a" || report.Suites[1].Name != "b" {
+		t.Fatalf("unexpected suites %+v", report.Suites)
+	}
+	if report.Tests != 2 || report.Failures != 1 {
+		t.Fatalf("unexpected counts %d tests, %d failures", report.Tests, report.Failures)
+	}
+	if message := report.FailedCases()[0].Message(); message != "boom" {
+		t.Fatalf("unexpected message %q", message)
+	}
+}
+
+func TestParseRejectsOtherDocuments(t *testing.T) {
+	_, err := Parse(strings.NewReader(`<html></html>`))
+	if !errors.Is(err, UnknownRootElementErr) {
+		t.Fatalf("expected UnknownRootElementErr, got %v", err)
+	}
+}
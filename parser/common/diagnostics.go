@@ -0,0 +1,111 @@
+package common
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+)
+
+// Codes of the diagnostics reported on pipeline descriptors.
+const (
+	SyntaxErrorCode       = "syntax-error"
+	InvalidTypeCode       = "invalid-type"
+	InvalidValueCode      = "invalid-value"
+	UnknownKeywordCode    = "unknown-keyword"
+	UndeclaredStageCode   = "undeclared-stage"
+	UnknownNeedsCode      = "unknown-needs"
+	UnknownDependencyCode = "unknown-dependency"
+	UnknownExtendsCode    = "unknown-extends"
+	MissingScriptCode     = "missing-script"
+	UnsupportedJobCode    = "unsupported-job"
+	DeprecatedKeywordCode = "deprecated-keyword"
+	SchemaViolationCode   = "schema-violation"
+)
+
+// Position locates a node of a descriptor, lines and columns starting at 1.
+// A zero line means the whole file.
+type Position struct {
+	File   string
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	switch {
+	case p.Line == 0:
+		return p.File
+	case p.Column == 0:
+		return fmt.Sprintf("%s:%d", p.File, p.Line)
+	default:
+		return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+	}
+}
+
+// Diagnostic is a problem found in a pipeline descriptor.
+type Diagnostic struct {
+	Position
+	Severity Severity
+	Code     string
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s [%s]", d.Position, d.Severity, d.Message, d.Code)
+}
+
+func (d Diagnostic) Error() string {
+	return d.String()
+}
+
+// Diagnostics is a list of diagnostics, usually for a single file.
+type Diagnostics []Diagnostic
+
+// HasErrors reports whether one of the diagnostics is an error.
+func (d Diagnostics) HasErrors() bool {
+	return slices.ContainsFunc(d, func(diagnostic Diagnostic) bool {
+		return diagnostic.Severity == SeverityError
+	})
+}
+
+// Err returns the errors among the diagnostics as a single error, nil if
+// there is none.
+func (d Diagnostics) Err() error {
+	var errs Diagnostics
+	for _, diagnostic := range d {
+		if diagnostic.Severity == SeverityError {
+			errs = append(errs, diagnostic)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func (d Diagnostics) Error() string {
+	lines := make([]string, 0, len(d))
+	for _, diagnostic := range d {
+		lines = append(lines, diagnostic.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Sort orders the diagnostics by file, then position.
+func (d Diagnostics) Sort() {
+	slices.SortStableFunc(d, func(a, b Diagnostic) int {
+		return cmp.Or(
+			cmp.Compare(a.File, b.File),
+			cmp.Compare(a.Line, b.Line),
+			cmp.Compare(a.Column, b.Column),
+		)
+	})
+}
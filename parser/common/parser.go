@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"maps"
 	"slices"
+	"time"
 )
 
 type StageJobMap map[string][]PipelineJobDescriptor
@@ -23,43 +24,296 @@ type CiParser interface {
 }
 
 type PipelineDescriptor struct {
-	stages StageJobMap
+	stageNames []string
+	stages     StageJobMap
 }
 
 func (p PipelineDescriptor) GetStages() StageJobMap {
 	return p.stages
 }
 
+// GetStageNames returns the declared stages, in execution order.
+func (p PipelineDescriptor) GetStageNames() []string {
+	return p.stageNames
+}
+
+// GetJobs returns the jobs of every stage, in execution order.
+func (p PipelineDescriptor) GetJobs() []PipelineJobDescriptor {
+	var result []PipelineJobDescriptor
+	for _, stage := range p.stageNames {
+		result = append(result, p.stages[stage]...)
+	}
+	return result
+}
+
+// When values tell in which conditions a job runs, as GitLab's when keyword.
+const (
+	WhenOnSuccess = "on_success"
+	WhenOnFailure = "on_failure"
+	WhenAlways    = "always"
+	WhenManual    = "manual"
+	WhenNever     = "never"
+)
+
+// ArtifactReports are the files a job declares under artifacts:reports.
+type ArtifactReports struct {
+	// JUnit holds the patterns of the JUnit XML test reports.
+	JUnit []string
+	// Dotenv holds the paths of the dotenv files whose variables are passed
+	// to the jobs of the following stages.
+	Dotenv []string
+}
+
+// Need is a job another one waits for, as listed under GitLab's needs
+// keyword.
+type Need struct {
+	Job string
+	// Optional needs are ignored when the job is not in the pipeline.
+	Optional bool
+	// Artifacts tells whether the artifacts of the job are downloaded.
+	Artifacts bool
+}
+
+// Service is an image run alongside a job, as listed under GitLab's
+// services keyword.
+type Service struct {
+	Name string
+	// Alias is the host name the job reaches the service at, derived from
+	// Name when empty.
+	Alias string
+	// PullPolicy holds the policies to pull the image with, in order of
+	// preference, nil when the runner default applies.
+	PullPolicy []string
+}
+
 type PipelineJobDescriptor struct {
-	name   string
-	stage string
-	script []string
+	name         string
+	stage        string
+	image        string
+	pullPolicy   []string
+	services     []Service
+	beforeScript []string
+	script       []string
+	afterScript  []string
+	timeout      time.Duration
+	when         string
+	variables    map[string]string
+	reports      ArtifactReports
+	paths        []string
+	received     map[string]string
+	needs        []Need
+	dependencies []string
+	rules        []Rule
 }
 
 func (j PipelineJobDescriptor) GetName() string {
-	return j.name 
+	return j.name
 }
 
 func (j PipelineJobDescriptor) GetStage() string {
 	return j.stage
 }
 
+// GetImage returns the image the job runs in, empty when the runner default
+// applies.
+func (j PipelineJobDescriptor) GetImage() string {
+	return j.image
+}
+
+// GetPullPolicy returns the policies to pull the image of the job with, in
+// order of preference, nil when the runner default applies.
+func (j PipelineJobDescriptor) GetPullPolicy() []string {
+	return j.pullPolicy
+}
+
+// GetServices returns the services run alongside the job.
+func (j PipelineJobDescriptor) GetServices() []Service {
+	return j.services
+}
+
+// GetBeforeScript returns the commands run ahead of the script, in the same
+// shell.
+func (j PipelineJobDescriptor) GetBeforeScript() []string {
+	return j.beforeScript
+}
+
 func (j PipelineJobDescriptor) GetScript() []string {
 	return j.script
 }
 
+// GetStepScript returns the commands of the step_script section: the
+// before_script of the job followed by its script, run as one script.
+func (j PipelineJobDescriptor) GetStepScript() []string {
+	return slices.Concat(j.beforeScript, j.script)
+}
+
+func (j PipelineJobDescriptor) GetAfterScript() []string {
+	return j.afterScript
+}
+
+// GetTimeout returns the maximum duration of the job, zero meaning no limit.
+func (j PipelineJobDescriptor) GetTimeout() time.Duration {
+	return j.timeout
+}
+
+// GetWhen returns the condition to run the job, on_success by default.
+func (j PipelineJobDescriptor) GetWhen() string {
+	if j.when == "" {
+		return WhenOnSuccess
+	}
+	return j.when
+}
+
+// GetVariables returns the variables exposed to the job scripts.
+func (j PipelineJobDescriptor) GetVariables() map[string]string {
+	return j.variables
+}
+
+func (j PipelineJobDescriptor) GetReports() ArtifactReports {
+	return j.reports
+}
+
+// GetArtifactPaths returns the patterns of the files the job declares under
+// artifacts:paths, a directory standing for the files it holds.
+func (j PipelineJobDescriptor) GetArtifactPaths() []string {
+	return j.paths
+}
+
+// GetReceivedArtifacts returns the artifacts the job receives from the jobs
+// it depends on: stored files by their path in the job working directory,
+// where they are written before its scripts run.
+func (j PipelineJobDescriptor) GetReceivedArtifacts() map[string]string {
+	return j.received
+}
+
+// GetNeeds returns the jobs to wait for before starting the job. Nil means
+// the job waits for the previous stages, while an empty list means it
+// starts right away.
+func (j PipelineJobDescriptor) GetNeeds() []Need {
+	return j.needs
+}
+
+// GetDependencies returns the jobs whose artifacts are downloaded, nil
+// meaning the ones of every previous stage.
+func (j PipelineJobDescriptor) GetDependencies() []string {
+	return j.dependencies
+}
+
+// GetRules returns the rules deciding whether the job is added to the
+// pipeline, nil when it always is.
+func (j PipelineJobDescriptor) GetRules() []Rule {
+	return j.rules
+}
+
+// WithVariables returns a copy of the job with variables added, replacing
+// the ones of the same name.
+func (j PipelineJobDescriptor) WithVariables(variables map[string]string) PipelineJobDescriptor {
+	merged := maps.Clone(j.variables)
+	if merged == nil {
+		merged = make(map[string]string, len(variables))
+	}
+	maps.Copy(merged, variables)
+	j.variables = merged
+	return j
+}
+
+// WithImage returns a copy of the job running in image.
+func (j PipelineJobDescriptor) WithImage(image string) PipelineJobDescriptor {
+	j.image = image
+	return j
+}
+
+// WithPullPolicy returns a copy of the job pulling its image according to
+// the first of policies which succeeds.
+func (j PipelineJobDescriptor) WithPullPolicy(policies []string) PipelineJobDescriptor {
+	j.pullPolicy = policies
+	return j
+}
+
+// WithServices returns a copy of the job run alongside services.
+func (j PipelineJobDescriptor) WithServices(services []Service) PipelineJobDescriptor {
+	j.services = services
+	return j
+}
+
+// WithNeeds returns a copy of the job waiting for needs.
+func (j PipelineJobDescriptor) WithNeeds(needs []Need) PipelineJobDescriptor {
+	j.needs = needs
+	return j
+}
+
+// WithDependencies returns a copy of the job downloading the artifacts of
+// dependencies.
+func (j PipelineJobDescriptor) WithDependencies(dependencies []string) PipelineJobDescriptor {
+	j.dependencies = dependencies
+	return j
+}
+
+// WithRules returns a copy of the job added to the pipeline according to
+// rules.
+func (j PipelineJobDescriptor) WithRules(rules []Rule) PipelineJobDescriptor {
+	j.rules = rules
+	return j
+}
+
+// WithReports returns a copy of the job collecting reports once over.
+func (j PipelineJobDescriptor) WithReports(reports ArtifactReports) PipelineJobDescriptor {
+	j.reports = reports
+	return j
+}
+
+// WithArtifactPaths returns a copy of the job collecting the files matching
+// paths once over.
+func (j PipelineJobDescriptor) WithArtifactPaths(paths []string) PipelineJobDescriptor {
+	j.paths = paths
+	return j
+}
+
+// WithReceivedArtifacts returns a copy of the job receiving the stored files
+// of artifacts, keyed by their path in its working directory.
+func (j PipelineJobDescriptor) WithReceivedArtifacts(artifacts map[string]string) PipelineJobDescriptor {
+	j.received = artifacts
+	return j
+}
+
+// WithWhen returns a copy of the job run according to when.
+func (j PipelineJobDescriptor) WithWhen(when string) PipelineJobDescriptor {
+	j.when = when
+	return j
+}
+
+// WithBeforeScript returns a copy of the job running beforeScript ahead of
+// its script, in the same shell.
+func (j PipelineJobDescriptor) WithBeforeScript(beforeScript []string) PipelineJobDescriptor {
+	j.beforeScript = beforeScript
+	return j
+}
+
+// WithAfterScript returns a copy of the job running afterScript once its
+// script is over, whatever its outcome.
+func (j PipelineJobDescriptor) WithAfterScript(afterScript []string) PipelineJobDescriptor {
+	j.afterScript = afterScript
+	return j
+}
+
+// WithTimeout returns a copy of the job limited to timeout.
+func (j PipelineJobDescriptor) WithTimeout(timeout time.Duration) PipelineJobDescriptor {
+	j.timeout = timeout
+	return j
+}
+
 func NewPipelineDescriptor(stages []string, jobs []PipelineJobDescriptor) (*PipelineDescriptor, error) {
 	resultStages := make(StageJobMap)
-	
+
 	for _, job := range jobs {
 		jobStage := job.GetStage()
-		if ! slices.Contains(stages, jobStage) {
+		if !slices.Contains(stages, jobStage) {
 			return nil, errors.New(fmt.Sprintf("Unknown stage %s for job %s", jobStage, job.GetName()))
 		}
 		stage, found := resultStages[jobStage]
 
-		if ! found {
-			resultStages[jobStage] = []PipelineJobDescriptor {
+		if !found {
+			resultStages[jobStage] = []PipelineJobDescriptor{
 				job,
 			}
 			continue
@@ -67,16 +321,17 @@ func NewPipelineDescriptor(stages []string, jobs []PipelineJobDescriptor) (*Pipe
 
 		resultStages[jobStage] = append(stage, job)
 	}
-	
+
 	return &PipelineDescriptor{
+		stages,
 		resultStages,
 	}, nil
 }
 
 func NewPipelineJobDescriptor(name string, stage string, script []string) PipelineJobDescriptor {
 	return PipelineJobDescriptor{
-		name,
-		stage,
-		script,
+		name:   name,
+		stage:  stage,
+		script: script,
 	}
 }
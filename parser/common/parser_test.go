@@ -0,0 +1,20 @@
+package common
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestGetJobsFollowsStageOrder(t *testing.T) {
+	pipeline := newSelectionPipeline(t)
+
+	var stages []string
+	for _, job := range pipeline.GetJobs() {
+		if len(stages) == 0 || stages[len(stages)-1] != job.GetStage() {
+			stages = append(stages, job.GetStage())
+		}
+	}
+	if !slices.Equal(stages, pipeline.GetStageNames()) {
+		t.Fatalf("got jobs in stages %v, want %v", stages, pipeline.GetStageNames())
+	}
+}
@@ -0,0 +1,365 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var InvalidExpressionErr = errors.New("invalid rules expression")
+
+// Rule is an entry of GitLab's rules keyword.
+type Rule struct {
+	// If is the expression the rule applies on, always true when empty.
+	If string
+	// Exists holds file patterns, one of them having to match a file.
+	Exists []string
+	// Changes holds file patterns, one of them having to match a changed
+	// file.
+	Changes []string
+	// When overrides the when of the job, empty keeping it.
+	When string
+	// Variables are added to the job when the rule applies.
+	Variables map[string]string
+}
+
+// RuleContext holds what rules are evaluated against.
+type RuleContext struct {
+	// Variables are the CI variables, predefined and declared ones alike.
+	Variables map[string]string
+	// Exists reports whether a file of the project matches pattern. No file
+	// exists when nil.
+	Exists func(pattern string) bool
+}
+
+// RulesOutcome tells how rules decided to add a job to the pipeline.
+type RulesOutcome struct {
+	// When the job runs, WhenNever when it is not added to the pipeline.
+	When string
+	// Rule is the index of the rule which applied, -1 when none did.
+	Rule int
+	// Variables are the ones of the rule which applied.
+	Variables map[string]string
+}
+
+// Skipped reports whether the job is left out of the pipeline.
+func (o RulesOutcome) Skipped() bool {
+	return o.When == WhenNever
+}
+
+// EvaluateRules evaluates the rules of the job in context. As GitLab, the
+// first rule applying decides, and the job is left out when none does. Jobs
+// without rules run according to their when. Changes are considered
+// matching, there being no push to compare the files against.
+func (j PipelineJobDescriptor) EvaluateRules(context RuleContext) (RulesOutcome, error) {
+	if j.rules == nil {
+		return RulesOutcome{When: j.GetWhen(), Rule: -1}, nil
+	}
+
+	// Variables of the context, such as the predefined ones, take precedence
+	// over the ones of the descriptor.
+	variables := maps.Clone(j.variables)
+	if variables == nil {
+		variables = make(map[string]string, len(context.Variables))
+	}
+	maps.Copy(variables, context.Variables)
+
+	for i, rule := range j.rules {
+		matches := true
+		if rule.If != "" {
+			var err error
+			matches, err = EvaluateExpression(rule.If, variables)
+			if err != nil {
+				return RulesOutcome{}, fmt.Errorf("rule %d of job %s: %w", i+1, j.name, err)
+			}
+		}
+		if matches && rule.Exists != nil {
+			matches = false
+			for _, pattern := range rule.Exists {
+				if context.Exists != nil && context.Exists(pattern) {
+					matches = true
+					break
+				}
+			}
+		}
+		if !matches {
+			continue
+		}
+
+		when := rule.When
+		if when == "" {
+			when = j.GetWhen()
+		}
+		return RulesOutcome{When: when, Rule: i, Variables: rule.Variables}, nil
+	}
+	return RulesOutcome{When: WhenNever, Rule: -1}, nil
+}
+
+// EvaluateExpression evaluates a GitLab CI expression, as the if of rules,
+// against variables. It supports variables, string and null literals,
+// ==, !=, =~ and !~ comparisons, && and || and parentheses.
+func EvaluateExpression(expression string, variables map[string]string) (bool, error) {
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return false, err
+	}
+
+	p := &expressionParser{tokens: tokens, variables: variables}
+	value, err := p.or()
+	if err != nil {
+		return false, err
+	}
+	if p.position < len(p.tokens) {
+		return false, fmt.Errorf("%w: unexpected %s in %q", InvalidExpressionErr, p.tokens[p.position].text, expression)
+	}
+	return value.truthy(), nil
+}
+
+type tokenKind int
+
+const (
+	variableToken tokenKind = iota
+	stringToken
+	regexpToken
+	nullToken
+	operatorToken
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+var operators = []string{"==", "!=", "=~", "!~", "&&", "||", "(", ")"}
+
+func tokenize(expression string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(expression); {
+		c := expression[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '$':
+			end := i + 1
+			if end < len(expression) && expression[end] == '{' {
+				closing := strings.IndexByte(expression[end:], '}')
+				if closing < 0 {
+					return nil, fmt.Errorf("%w: unterminated variable in %q", InvalidExpressionErr, expression)
+				}
+				tokens = append(tokens, token{variableToken, expression[end+1 : end+closing]})
+				i = end + closing + 1
+				continue
+			}
+			for end < len(expression) && isNameChar(rune(expression[end])) {
+				end++
+			}
+			tokens = append(tokens, token{variableToken, expression[i+1 : end]})
+			i = end
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(expression[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("%w: unterminated string in %q", InvalidExpressionErr, expression)
+			}
+			tokens = append(tokens, token{stringToken, expression[i+1 : i+1+end]})
+			i += end + 2
+		case c == '/':
+			end := i + 1
+			for end < len(expression) && expression[end] != '/' {
+				if expression[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(expression) {
+				return nil, fmt.Errorf("%w: unterminated regular expression in %q", InvalidExpressionErr, expression)
+			}
+			end++
+			for end < len(expression) && unicode.IsLetter(rune(expression[end])) {
+				end++
+			}
+			tokens = append(tokens, token{regexpToken, expression[i:end]})
+			i = end
+		case strings.HasPrefix(expression[i:], "null"):
+			tokens = append(tokens, token{nullToken, "null"})
+			i += len("null")
+		default:
+			operator := ""
+			for _, candidate := range operators {
+				if strings.HasPrefix(expression[i:], candidate) {
+					operator = candidate
+					break
+				}
+			}
+			if operator == "" {
+				return nil, fmt.Errorf("%w: unexpected %q in %q", InvalidExpressionErr, c, expression)
+			}
+			tokens = append(tokens, token{operatorToken, operator})
+			i += len(operator)
+		}
+	}
+	return tokens, nil
+}
+
+func isNameChar(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// value is an operand of an expression. Undefined variables and null are
+// nil.
+type value struct {
+	text   *string
+	regexp string
+}
+
+func (v value) truthy() bool {
+	return v.text != nil && *v.text != ""
+}
+
+type expressionParser struct {
+	tokens    []token
+	position  int
+	variables map[string]string
+}
+
+func (p *expressionParser) peek(operator string) bool {
+	return p.position < len(p.tokens) &&
+		p.tokens[p.position].kind == operatorToken &&
+		p.tokens[p.position].text == operator
+}
+
+func (p *expressionParser) or() (value, error) {
+	left, err := p.and()
+	for err == nil && p.peek("||") {
+		p.position++
+		var right value
+		if right, err = p.and(); err == nil {
+			left = boolean(left.truthy() || right.truthy())
+		}
+	}
+	return left, err
+}
+
+func (p *expressionParser) and() (value, error) {
+	left, err := p.comparison()
+	for err == nil && p.peek("&&") {
+		p.position++
+		var right value
+		if right, err = p.comparison(); err == nil {
+			left = boolean(left.truthy() && right.truthy())
+		}
+	}
+	return left, err
+}
+
+func (p *expressionParser) comparison() (value, error) {
+	left, err := p.operand()
+	if err != nil {
+		return value{}, err
+	}
+
+	for _, operator := range []string{"==", "!=", "=~", "!~"} {
+		if !p.peek(operator) {
+			continue
+		}
+		p.position++
+		right, err := p.operand()
+		if err != nil {
+			return value{}, err
+		}
+
+		switch operator {
+		case "==":
+			return boolean(equal(left, right)), nil
+		case "!=":
+			return boolean(!equal(left, right)), nil
+		}
+
+		matched, err := match(left, right)
+		if err != nil {
+			return value{}, err
+		}
+		return boolean(matched == (operator == "=~")), nil
+	}
+	return left, nil
+}
+
+func (p *expressionParser) operand() (value, error) {
+	if p.position >= len(p.tokens) {
+		return value{}, fmt.Errorf("%w: unexpected end of expression", InvalidExpressionErr)
+	}
+
+	t := p.tokens[p.position]
+	p.position++
+	switch t.kind {
+	case variableToken:
+		if text, ok := p.variables[t.text]; ok {
+			return value{text: &text}, nil
+		}
+		return value{}, nil
+	case stringToken:
+		return value{text: &t.text}, nil
+	case regexpToken:
+		return value{regexp: t.text}, nil
+	case nullToken:
+		return value{}, nil
+	}
+
+	if t.text == "(" {
+		inner, err := p.or()
+		if err != nil {
+			return value{}, err
+		}
+		if !p.peek(")") {
+			return value{}, fmt.Errorf("%w: missing closing parenthesis", InvalidExpressionErr)
+		}
+		p.position++
+		return inner, nil
+	}
+	return value{}, fmt.Errorf("%w: unexpected %s", InvalidExpressionErr, t.text)
+}
+
+func boolean(b bool) value {
+	if b {
+		text := "true"
+		return value{text: &text}
+	}
+	return value{}
+}
+
+func equal(a, b value) bool {
+	if a.text == nil || b.text == nil {
+		return a.text == nil && b.text == nil
+	}
+	return *a.text == *b.text
+}
+
+// match matches left against the pattern on the right, either a regular
+// expression literal or a variable holding one.
+func match(left, right value) (bool, error) {
+	pattern := right.regexp
+	if pattern == "" && right.text != nil {
+		pattern = *right.text
+	}
+	if len(pattern) < 2 || pattern[0] != '/' {
+		return false, fmt.Errorf("%w: %q is not a regular expression", InvalidExpressionErr, pattern)
+	}
+
+	end := strings.LastIndexByte(pattern, '/')
+	source, flags := pattern[1:end], pattern[end+1:]
+	if strings.Contains(flags, "i") {
+		source = "(?i)" + source
+	}
+	re, err := regexp.Compile(source)
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", InvalidExpressionErr, err)
+	}
+
+	text := ""
+	if left.text != nil {
+		text = *left.text
+	}
+	return re.MatchString(text), nil
+}
@@ -0,0 +1,105 @@
+package common
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEvaluateExpression(t *testing.T) {
+	variables := map[string]string{
+		"CI_COMMIT_BRANCH":   "feature/login",
+		"CI_PIPELINE_SOURCE": "push",
+		"EMPTY":              "",
+		"PATTERN":            "/^FEATURE/i",
+	}
+
+	cases := map[string]bool{
+		`$CI_COMMIT_BRANCH`:                 true,
+		`$EMPTY`:                            false,
+		`$UNDEFINED`:                        false,
+		`$CI_PIPELINE_SOURCE == "push"`:     true,
+		`$CI_PIPELINE_SOURCE != 'push'`:     false,
+		`$UNDEFINED == null`:                true,
+		`$EMPTY == null`:                    false,
+		`$EMPTY == ""`:                      true,
+		`$CI_COMMIT_BRANCH =~ /^feature\//`: true,
+		`$CI_COMMIT_BRANCH !~ /^feature\//`: false,
+		`$CI_COMMIT_BRANCH =~ $PATTERN`:     true,
+		`${CI_PIPELINE_SOURCE} == "schedule" || $CI_COMMIT_BRANCH`:                       true,
+		`$CI_PIPELINE_SOURCE == "push" && $UNDEFINED`:                                    false,
+		`$UNDEFINED || $CI_PIPELINE_SOURCE == "push" && $EMPTY`:                          false,
+		`($UNDEFINED || $CI_PIPELINE_SOURCE == "push") && $CI_COMMIT_BRANCH =~ /login$/`: true,
+	}
+
+	for expression, expected := range cases {
+		got, err := EvaluateExpression(expression, variables)
+		if err != nil {
+			t.Errorf("unexpected error for %s : %v", expression, err)
+			continue
+		}
+		if got != expected {
+			t.Errorf("expected %s to be %v", expression, expected)
+		}
+	}
+}
+
+func TestEvaluateExpressionRejectsInvalidOnes(t *testing.T) {
+	for _, expression := range []string{`$A ==`, `"unterminated`, `($A`, `$A =~ "text"`, `$A = "b"`} {
+		if _, err := EvaluateExpression(expression, nil); !errors.Is(err, InvalidExpressionErr) {
+			t.Errorf("expected %s to be invalid, got %v", expression, err)
+		}
+	}
+}
+
+func TestEvaluateRules(t *testing.T) {
+	job := NewPipelineJobDescriptor("deploy", "deploy", []string{"./deploy.sh"}).
+		WithVariables(map[string]string{"TARGET": "staging"}).
+		WithRules([]Rule{
+			{If: `$CI_COMMIT_BRANCH == "main"`, When: WhenManual},
+			{If: `$TARGET == "staging"`, Exists: []string{"deploy.sh"}, Variables: map[string]string{"DRY_RUN": "true"}},
+		})
+
+	cases := []struct {
+		name     string
+		context  RuleContext
+		expected RulesOutcome
+	}{
+		{
+			name:     "first matching rule",
+			context:  RuleContext{Variables: map[string]string{"CI_COMMIT_BRANCH": "main"}},
+			expected: RulesOutcome{When: WhenManual, Rule: 0},
+		},
+		{
+			name: "job variables and exists",
+			context: RuleContext{Exists: func(pattern string) bool {
+				return pattern == "deploy.sh"
+			}},
+			expected: RulesOutcome{When: WhenOnSuccess, Rule: 1},
+		},
+		{
+			name:     "context variables take precedence",
+			context:  RuleContext{Variables: map[string]string{"TARGET": "production"}},
+			expected: RulesOutcome{When: WhenNever, Rule: -1},
+		},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			got, err := job.EvaluateRules(testCase.context)
+			if err != nil {
+				t.Fatalf("unexpected error : %v", err)
+			}
+			if got.When != testCase.expected.When || got.Rule != testCase.expected.Rule {
+				t.Fatalf("expected %+v, got %+v", testCase.expected, got)
+			}
+			if got.Skipped() != (testCase.expected.When == WhenNever) {
+				t.Fatalf("unexpected skipped for %+v", got)
+			}
+		})
+	}
+
+	outcome, err := NewPipelineJobDescriptor("build", "build", nil).WithWhen(WhenManual).EvaluateRules(RuleContext{})
+	if err != nil || outcome.When != WhenManual || outcome.Rule != -1 {
+		t.Fatalf("expected jobs without rules to keep their when, got %+v, %v", outcome, err)
+	}
+}
@@ -0,0 +1,195 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+)
+
+var NoJobSelectedErr = errors.New("no job matches the selection")
+var UnknownStageErr = errors.New("unknown stage")
+
+// Selection tells which jobs of a pipeline to run. The zero value selects
+// every job.
+type Selection struct {
+	// Jobs holds the names of the jobs to run, or patterns matching them as
+	// path.Match does.
+	Jobs []string
+	// Stages holds the names of the stages to run.
+	Stages []string
+	// From is the first stage to run, Until the last one.
+	From  string
+	Until string
+	// Needs adds the jobs the selected ones need, and the ones they need in
+	// turn.
+	Needs bool
+	// Downstream adds the jobs needing the selected ones, and the ones
+	// needing them in turn.
+	Downstream bool
+}
+
+// IsZero reports whether the selection keeps every job.
+func (s Selection) IsZero() bool {
+	return len(s.Jobs) == 0 && len(s.Stages) == 0 && s.From == "" && s.Until == ""
+}
+
+// Select returns the pipeline restricted to the jobs of selection, along
+// with the names of the jobs the selected ones need which were left out.
+func (p PipelineDescriptor) Select(selection Selection) (PipelineDescriptor, []string, error) {
+	if selection.IsZero() {
+		return p, nil, nil
+	}
+
+	for _, stage := range append(slices.Clone(selection.Stages), selection.From, selection.Until) {
+		if stage != "" && !slices.Contains(p.stageNames, stage) {
+			return PipelineDescriptor{}, nil, fmt.Errorf("%w %s", UnknownStageErr, stage)
+		}
+	}
+	for _, pattern := range selection.Jobs {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return PipelineDescriptor{}, nil, fmt.Errorf("invalid job pattern %s: %w", pattern, err)
+		}
+	}
+
+	first, last := 0, len(p.stageNames)-1
+	if selection.From != "" {
+		first = slices.Index(p.stageNames, selection.From)
+	}
+	if selection.Until != "" {
+		last = slices.Index(p.stageNames, selection.Until)
+	}
+
+	selected := make(map[string]bool)
+	for i, stage := range p.stageNames {
+		for _, job := range p.stages[stage] {
+			if i >= first && i <= last && selection.matches(job) {
+				selected[job.name] = true
+			}
+		}
+	}
+	if len(selected) == 0 {
+		return PipelineDescriptor{}, nil, NoJobSelectedErr
+	}
+
+	if selection.Needs {
+		selected = p.closure(selected, p.upstream)
+	}
+	if selection.Downstream {
+		selected = p.closure(selected, p.downstream)
+	}
+
+	// Only the jobs needed directly are missing, the ones they need being
+	// of no use once their outcome is known.
+	needed := make(map[string]bool)
+	for _, job := range p.GetJobs() {
+		if selected[job.name] {
+			for _, name := range p.upstream(job) {
+				needed[name] = true
+			}
+		}
+	}
+	var missing []string
+	for _, job := range p.GetJobs() {
+		if needed[job.name] && !selected[job.name] {
+			missing = append(missing, job.name)
+		}
+	}
+
+	result := PipelineDescriptor{stageNames: p.stageNames, stages: make(StageJobMap)}
+	for stage, jobs := range p.stages {
+		for _, job := range jobs {
+			if selected[job.name] {
+				result.stages[stage] = append(result.stages[stage], job)
+			}
+		}
+	}
+	return result, missing, nil
+}
+
+func (s Selection) matches(job PipelineJobDescriptor) bool {
+	if len(s.Stages) > 0 && !slices.Contains(s.Stages, job.stage) {
+		return false
+	}
+	if len(s.Jobs) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(s.Jobs, func(pattern string) bool {
+		matched, _ := path.Match(pattern, job.name)
+		return matched
+	})
+}
+
+// closure returns the jobs of start along with the ones reached from them
+// through next.
+func (p PipelineDescriptor) closure(start map[string]bool, next func(job PipelineJobDescriptor) []string) map[string]bool {
+	reached := make(map[string]bool, len(start))
+	var queue []string
+	for name := range start {
+		reached[name] = true
+		queue = append(queue, name)
+	}
+
+	for len(queue) > 0 {
+		job, found := p.job(queue[0])
+		queue = queue[1:]
+		if !found {
+			continue
+		}
+		for _, name := range next(job) {
+			if !reached[name] {
+				reached[name] = true
+				queue = append(queue, name)
+			}
+		}
+	}
+	return reached
+}
+
+// upstream returns the jobs job waits for or downloads the artifacts of:
+// its needs and dependencies, or every job of the previous stages when it
+// declares none.
+func (p PipelineDescriptor) upstream(job PipelineJobDescriptor) []string {
+	var names []string
+	if job.needs == nil && job.dependencies == nil {
+		for _, stage := range p.stageNames {
+			if stage == job.stage {
+				break
+			}
+			for _, previous := range p.stages[stage] {
+				names = append(names, previous.name)
+			}
+		}
+		return names
+	}
+
+	for _, need := range job.needs {
+		if _, found := p.job(need.Job); found || !need.Optional {
+			names = append(names, need.Job)
+		}
+	}
+	return append(names, job.dependencies...)
+}
+
+// downstream returns the jobs waiting for job or downloading its artifacts.
+func (p PipelineDescriptor) downstream(job PipelineJobDescriptor) []string {
+	var names []string
+	for _, other := range p.GetJobs() {
+		if slices.Contains(p.upstream(other), job.name) {
+			names = append(names, other.name)
+		}
+	}
+	return names
+}
+
+// job returns the job called name.
+func (p PipelineDescriptor) job(name string) (PipelineJobDescriptor, bool) {
+	for _, jobs := range p.stages {
+		for _, job := range jobs {
+			if job.name == name {
+				return job, true
+			}
+		}
+	}
+	return PipelineJobDescriptor{}, false
+}
@@ -0,0 +1,85 @@
+package common
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func newSelectionPipeline(t *testing.T) PipelineDescriptor {
+	pipeline, err := NewPipelineDescriptor([]string{"build", "test", "deploy"}, []PipelineJobDescriptor{
+		NewPipelineJobDescriptor("build:app", "build", nil),
+		NewPipelineJobDescriptor("build:docs", "build", nil),
+		NewPipelineJobDescriptor("test:unit", "test", nil).WithNeeds([]Need{{Job: "build:app"}}),
+		NewPipelineJobDescriptor("test:e2e", "test", nil).WithNeeds([]Need{{Job: "build:app"}, {Job: "review", Optional: true}}),
+		NewPipelineJobDescriptor("lint", "test", nil).WithNeeds([]Need{}),
+		NewPipelineJobDescriptor("deploy", "deploy", nil),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return *pipeline
+}
+
+func selectedNames(pipeline PipelineDescriptor) []string {
+	var names []string
+	for _, job := range pipeline.GetStages().GetJobs() {
+		names = append(names, job.GetName())
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestSelect(t *testing.T) {
+	pipeline := newSelectionPipeline(t)
+
+	cases := []struct {
+		selection Selection
+		selected  []string
+		missing   []string
+	}{
+		{Selection{}, []string{"build:app", "build:docs", "deploy", "lint", "test:e2e", "test:unit"}, nil},
+		{Selection{Jobs: []string{"test:*"}}, []string{"test:e2e", "test:unit"}, []string{"build:app"}},
+		{Selection{Jobs: []string{"test:unit"}, Needs: true}, []string{"build:app", "test:unit"}, nil},
+		{Selection{Jobs: []string{"lint"}}, []string{"lint"}, nil},
+		{Selection{Stages: []string{"deploy"}}, []string{"deploy"}, []string{"build:app", "build:docs", "lint", "test:e2e", "test:unit"}},
+		{Selection{From: "test"}, []string{"deploy", "lint", "test:e2e", "test:unit"}, []string{"build:app", "build:docs"}},
+		{Selection{Until: "test", Stages: []string{"build", "deploy"}}, []string{"build:app", "build:docs"}, nil},
+		{Selection{Jobs: []string{"build:app"}, Downstream: true}, []string{"build:app", "deploy", "test:e2e", "test:unit"}, []string{"build:docs", "lint"}},
+	}
+
+	for _, c := range cases {
+		selected, missing, err := pipeline.Select(c.selection)
+		if err != nil {
+			t.Errorf("unexpected error for %+v: %s", c.selection, err)
+			continue
+		}
+		if names := selectedNames(selected); !slices.Equal(c.selected, names) {
+			t.Errorf("expected %v to be selected for %+v, got %v", c.selected, c.selection, names)
+		}
+		slices.Sort(missing)
+		if !slices.Equal(c.missing, missing) {
+			t.Errorf("expected %v to be missing for %+v, got %v", c.missing, c.selection, missing)
+		}
+		if !slices.Equal(pipeline.GetStageNames(), selected.GetStageNames()) {
+			t.Errorf("expected the stages to be kept for %+v, got %v", c.selection, selected.GetStageNames())
+		}
+	}
+}
+
+func TestSelectRejectsInvalidSelections(t *testing.T) {
+	pipeline := newSelectionPipeline(t)
+
+	if _, _, err := pipeline.Select(Selection{Jobs: []string{"unknown"}}); !errors.Is(err, NoJobSelectedErr) {
+		t.Errorf("expected NoJobSelectedErr, got %v", err)
+	}
+	if _, _, err := pipeline.Select(Selection{From: "deploy", Until: "build"}); !errors.Is(err, NoJobSelectedErr) {
+		t.Errorf("expected NoJobSelectedErr for an empty stage range, got %v", err)
+	}
+	if _, _, err := pipeline.Select(Selection{Stages: []string{"release"}}); !errors.Is(err, UnknownStageErr) {
+		t.Errorf("expected UnknownStageErr, got %v", err)
+	}
+	if _, _, err := pipeline.Select(Selection{Jobs: []string{"[test"}}); err == nil {
+		t.Errorf("expected an error for an invalid pattern")
+	}
+}
@@ -0,0 +1,150 @@
+package gitlab
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+
+	"github.com/powerpixel/pipelinefox/parser/common"
+	"sigs.k8s.io/yaml/goyaml.v3"
+)
+
+const (
+	mergeKey     = "<<"
+	referenceTag = "!reference"
+)
+
+var yamlErrorLineRegexp = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+// entry is a key of a YAML mapping along with its value.
+type entry struct {
+	key   *yaml.Node
+	value *yaml.Node
+}
+
+// parseDocument returns the root node of the CI descriptor in content. A
+// header holding the spec of the pipeline inputs is skipped, like GitLab
+// does.
+func parseDocument(file string, content []byte) (*yaml.Node, *common.Diagnostic) {
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+
+	var documents []*yaml.Node
+	for {
+		document := new(yaml.Node)
+		err := decoder.Decode(document)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, syntaxError(file, err)
+		}
+		documents = append(documents, document)
+	}
+
+	if len(documents) == 0 || len(documents[0].Content) == 0 {
+		return nil, &common.Diagnostic{
+			Position: common.Position{File: file},
+			Severity: common.SeverityError,
+			Code:     common.SyntaxErrorCode,
+			Message:  "the document is empty",
+		}
+	}
+
+	root := documents[0].Content[0]
+	if len(documents) > 1 && lookup(root, "spec") != nil {
+		root = documents[1].Content[0]
+	}
+	return resolve(root), nil
+}
+
+// syntaxError turns a YAML parsing error into a diagnostic, located when
+// the parser told where the error is.
+func syntaxError(file string, err error) *common.Diagnostic {
+	diagnostic := &common.Diagnostic{
+		Position: common.Position{File: file},
+		Severity: common.SeverityError,
+		Code:     common.SyntaxErrorCode,
+		Message:  err.Error(),
+	}
+	if match := yamlErrorLineRegexp.FindStringSubmatch(err.Error()); match != nil {
+		diagnostic.Line, _ = strconv.Atoi(match[1])
+		diagnostic.Message = match[2]
+	}
+	return diagnostic
+}
+
+// resolve follows aliases to the node they point to.
+func resolve(node *yaml.Node) *yaml.Node {
+	for node != nil && node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	return node
+}
+
+// entries returns the keys of a mapping, including the ones merged with <<.
+// Keys written explicitly take precedence over merged ones.
+func entries(node *yaml.Node) []entry {
+	node = resolve(node)
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	var explicit, merged []entry
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], resolve(node.Content[i+1])
+		if key.Value != mergeKey {
+			explicit = append(explicit, entry{key, value})
+			continue
+		}
+
+		sources := []*yaml.Node{value}
+		if value.Kind == yaml.SequenceNode {
+			sources = value.Content
+		}
+		for _, source := range sources {
+			merged = append(merged, entries(source)...)
+		}
+	}
+
+	seen := make(map[string]bool, len(explicit))
+	for _, e := range explicit {
+		seen[e.key.Value] = true
+	}
+	for _, e := range merged {
+		if !seen[e.key.Value] {
+			seen[e.key.Value] = true
+			explicit = append(explicit, e)
+		}
+	}
+	return explicit
+}
+
+// lookup returns the value of key in a mapping, nil if absent.
+func lookup(node *yaml.Node, key string) *yaml.Node {
+	for _, e := range entries(node) {
+		if e.key.Value == key {
+			return e.value
+		}
+	}
+	return nil
+}
+
+func isReference(node *yaml.Node) bool {
+	return node.Tag == referenceTag
+}
+
+func isNull(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && node.Tag == "!!null"
+}
+
+// isString reports whether node is a scalar, GitLab converting numbers and
+// booleans to strings where strings are expected.
+func isString(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && !isNull(node)
+}
+
+func position(file string, node *yaml.Node) common.Position {
+	return common.Position{File: file, Line: node.Line, Column: node.Column}
+}
@@ -0,0 +1,75 @@
+package gitlab
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationPartRegexp = regexp.MustCompile(`(\d+(?:\.\d+)?)\s*([a-z]*)`)
+
+var durationUnits = map[string]time.Duration{
+	"":        time.Second,
+	"s":       time.Second,
+	"sec":     time.Second,
+	"secs":    time.Second,
+	"second":  time.Second,
+	"seconds": time.Second,
+	"m":       time.Minute,
+	"min":     time.Minute,
+	"mins":    time.Minute,
+	"minute":  time.Minute,
+	"minutes": time.Minute,
+	"h":       time.Hour,
+	"hr":      time.Hour,
+	"hrs":     time.Hour,
+	"hour":    time.Hour,
+	"hours":   time.Hour,
+	"d":       24 * time.Hour,
+	"day":     24 * time.Hour,
+	"days":    24 * time.Hour,
+	"w":       7 * 24 * time.Hour,
+	"week":    7 * 24 * time.Hour,
+	"weeks":   7 * 24 * time.Hour,
+}
+
+// parseDuration reads durations the way GitLab does for keywords such as
+// timeout, e.g. "3600", "1h 30m", "1 hour and 30 minutes" or "2 days".
+func parseDuration(value string) (time.Duration, error) {
+	normalized := strings.ToLower(strings.TrimSpace(value))
+	normalized = strings.ReplaceAll(normalized, " and ", " ")
+	normalized = strings.ReplaceAll(normalized, ",", " ")
+
+	matches := durationPartRegexp.FindAllStringSubmatchIndex(normalized, -1)
+	if len(matches) == 0 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+
+	var total time.Duration
+	consumed := 0
+	for _, match := range matches {
+		if strings.TrimSpace(normalized[consumed:match[0]]) != "" {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		consumed = match[1]
+
+		amount, err := strconv.ParseFloat(normalized[match[2]:match[3]], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q: %w", value, err)
+		}
+
+		unit, ok := durationUnits[normalized[match[4]:match[5]]]
+		if !ok {
+			return 0, fmt.Errorf("invalid duration %q: unknown unit %q", value, normalized[match[4]:match[5]])
+		}
+		total += time.Duration(amount * float64(unit))
+	}
+
+	if strings.TrimSpace(normalized[consumed:]) != "" {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+
+	return total, nil
+}
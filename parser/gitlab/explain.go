@@ -0,0 +1,666 @@
+package gitlab
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/antchfx/jsonquery"
+	"github.com/powerpixel/pipelinefox/parser/common"
+	"sigs.k8s.io/yaml/goyaml.v3"
+)
+
+var UnknownJobErr = errors.New("unknown job")
+var ExtendsLoopErr = errors.New("extends forms a loop or is nested too deeply")
+var ReferenceErr = errors.New("invalid !reference tag")
+
+// maxExtendsDepth is the number of extends GitLab follows from a job.
+const maxExtendsDepth = 11
+
+// defaultTemplate is the template of the keys a job inherits from default.
+const defaultTemplate = "default"
+
+// defaultStage is the stage of the jobs declaring none.
+const defaultStage = "test"
+
+// Origin tells where the value of a key of a resolved job comes from.
+type Origin struct {
+	common.Position
+	// Template is the job or template the key is written in, default for
+	// the default keywords.
+	Template string
+	// Anchor is the YAML anchor the key is merged from with <<, if any.
+	Anchor string
+}
+
+func (o Origin) String() string {
+	var from []string
+	if o.Template != "" {
+		from = append(from, o.Template)
+	}
+	if o.Anchor != "" {
+		from = append(from, "*"+o.Anchor)
+	}
+	if len(from) == 0 {
+		return o.Position.String()
+	}
+	return fmt.Sprintf("%s (%s)", o.Position, strings.Join(from, ", "))
+}
+
+// ResolvedVariable is a variable of a resolved job along with where it is
+// declared.
+type ResolvedVariable struct {
+	Name   string
+	Value  string
+	Origin Origin
+}
+
+// ResolvedJob is a job once includes, anchors, extends, default and
+// !reference tags are applied, as GitLab shows it in the merged YAML.
+type ResolvedJob struct {
+	Name string
+	// Position is where the job is written.
+	Position common.Position
+	// Node is the mapping of the job keywords, each of them commented with
+	// where it comes from when not written in the job itself.
+	Node *yaml.Node
+	// Variables are the global variables the job inherits followed by its
+	// own ones, overriding them.
+	Variables []ResolvedVariable
+	// Job is the descriptor of the job, with its rules.
+	Job common.PipelineJobDescriptor
+	// Warnings tell what could not be resolved, such as remote includes.
+	Warnings []string
+}
+
+// value is a node of a descriptor remembering where it comes from. Mappings
+// are split in fields so that they can be merged.
+type value struct {
+	node   *yaml.Node
+	origin Origin
+	keys   []string
+	fields map[string]*value
+}
+
+func (v *value) isMapping() bool {
+	return v.fields != nil
+}
+
+func (v *value) field(key string) *value {
+	if v == nil || !v.isMapping() {
+		return nil
+	}
+	return v.fields[key]
+}
+
+// Resolver resolves the jobs of the descriptors of a project.
+type Resolver struct {
+	// Root is the directory of the project, local includes being relative
+	// to it.
+	Root     string
+	top      map[string]*value
+	order    []string
+	warnings []string
+}
+
+// NewResolver loads the descriptor at path along with the local files it
+// includes, which root is the directory of the project.
+func NewResolver(root, path string) (*Resolver, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return newContentResolver(root, path, content)
+}
+
+// newContentResolver loads content, the descriptor at path, along with the
+// local files it includes.
+func newContentResolver(root, path string, content []byte) (*Resolver, error) {
+	r := &Resolver{Root: root, top: make(map[string]*value)}
+	if err := r.loadContent(r.display(path), content, nil); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// load merges the descriptor at path into the top-level keys.
+func (r *Resolver) load(path string, loading []string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return r.loadContent(r.display(path), content, loading)
+}
+
+// loadContent merges content, the descriptor file, into the top-level keys.
+// Files included are loaded first, the including file overriding their keys.
+func (r *Resolver) loadContent(file string, content []byte, loading []string) error {
+	if slices.Contains(loading, file) {
+		return fmt.Errorf("%s includes itself", file)
+	}
+
+	root, diagnostic := parseDocument(file, content)
+	if diagnostic != nil {
+		return diagnostic
+	}
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s is not a mapping of keywords and jobs", file)
+	}
+
+	for _, include := range r.includes(file, lookup(root, "include")) {
+		if err := r.load(include, append(loading, file)); err != nil {
+			return err
+		}
+	}
+
+	for _, e := range entries(root) {
+		name := e.key.Value
+		if name == "include" {
+			continue
+		}
+		v := build(file, e.key, e.value, name)
+		if existing, found := r.top[name]; found {
+			r.top[name] = merge(existing, v)
+			continue
+		}
+		r.top[name] = v
+		r.order = append(r.order, name)
+	}
+	return nil
+}
+
+// includes returns the local files included by node. Others cannot be read
+// without network access and are reported as warnings.
+func (r *Resolver) includes(file string, node *yaml.Node) []string {
+	if node == nil {
+		return nil
+	}
+	items := []*yaml.Node{node}
+	if node.Kind == yaml.SequenceNode {
+		items = node.Content
+	}
+
+	var paths []string
+	for _, item := range items {
+		item = resolve(item)
+		local := ""
+		switch {
+		case isString(item) && !strings.Contains(item.Value, "://"):
+			local = item.Value
+		case item.Kind == yaml.MappingNode && lookup(item, "local") != nil:
+			local = lookup(item, "local").Value
+		default:
+			r.warnings = append(r.warnings, fmt.Sprintf("%s: the include is not local and was not resolved", position(file, item)))
+			continue
+		}
+
+		matches, err := filepath.Glob(filepath.Join(r.Root, filepath.FromSlash(strings.TrimPrefix(local, "/"))))
+		if err != nil || len(matches) == 0 {
+			r.warnings = append(r.warnings, fmt.Sprintf("%s: no file matches the local include %s", position(file, item), local))
+			continue
+		}
+		paths = append(paths, matches...)
+	}
+	return paths
+}
+
+// display returns path relative to the root of the project when inside of
+// it.
+func (r *Resolver) display(path string) string {
+	root, err := filepath.Abs(r.Root)
+	if err != nil {
+		return path
+	}
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(root, absolute); err == nil && filepath.IsLocal(rel) {
+		return filepath.ToSlash(rel)
+	}
+	return path
+}
+
+// Jobs returns the names of the jobs and templates, in the order they are
+// written.
+func (r *Resolver) Jobs() []string {
+	var names []string
+	for _, name := range r.order {
+		if !slices.Contains(globalKeywords, name) && deprecatedGlobalKeywords[name] == "" && name != "spec" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Resolve returns the job called name once fully resolved.
+func (r *Resolver) Resolve(name string) (*ResolvedJob, error) {
+	if !slices.Contains(r.Jobs(), name) {
+		return nil, fmt.Errorf("%w %s%s", UnknownJobErr, name, suggest(name, r.Jobs()))
+	}
+
+	job, err := r.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := &ResolvedJob{
+		Name:      name,
+		Position:  r.top[name].origin.Position,
+		Node:      job.yaml(name),
+		Variables: r.variables(job),
+		Warnings:  r.warnings,
+	}
+	if resolved.Job, err = r.descriptor(name, job); err != nil {
+		return nil, err
+	}
+	return resolved, nil
+}
+
+// resolve returns the job called name merged over the templates it extends
+// and default, its !reference tags replaced.
+func (r *Resolver) resolve(name string) (*value, error) {
+	job, err := r.extend(name, nil)
+	if err != nil {
+		return nil, err
+	}
+	return r.dereference(r.applyDefault(job), 0)
+}
+
+// stages returns the stages of the pipeline, the default ones when none
+// are declared.
+func (r *Resolver) stages() ([]string, error) {
+	stages := r.top["stages"]
+	if stages == nil {
+		stages = r.top["types"]
+	}
+	if stages == nil {
+		return slices.Clone(defaultStages), nil
+	}
+	return parseStages(instance(stages.yamlNode()))
+}
+
+// extend returns the job called name merged over the templates it extends.
+func (r *Resolver) extend(name string, visited []string) (*value, error) {
+	if slices.Contains(visited, name) || len(visited) >= maxExtendsDepth {
+		return nil, fmt.Errorf("%w: %s", ExtendsLoopErr, strings.Join(append(visited, name), " -> "))
+	}
+	job, found := r.top[name]
+	if !found || !job.isMapping() {
+		if len(visited) == 0 {
+			return nil, fmt.Errorf("%w %s", UnknownJobErr, name)
+		}
+		return nil, fmt.Errorf("%w %s, extended by %s", UnknownJobErr, name, visited[len(visited)-1])
+	}
+
+	var result *value
+	for _, parent := range targetNames(job.field("extends").yamlNode()) {
+		extended, err := r.extend(parent.Value, append(visited, name))
+		if err != nil {
+			return nil, err
+		}
+		result = merge(result, extended)
+	}
+	result = merge(result, job)
+	result.remove("extends")
+	return result, nil
+}
+
+// applyDefault adds the default keywords the job does not set, unless
+// inherit:default tells otherwise. The global keywords GitLab deprecated in
+// favor of default are defaults as well.
+func (r *Resolver) applyDefault(job *value) *value {
+	inherit := job.field("inherit").field("default").yamlNode()
+	defaults := r.top["default"]
+
+	for _, keyword := range defaultKeywords {
+		if job.field(keyword) != nil || !inherits(inherit, keyword) {
+			continue
+		}
+		inherited := defaults.field(keyword)
+		if inherited == nil && deprecatedGlobalKeywords[keyword] != "" {
+			inherited = r.top[keyword]
+		}
+		if inherited != nil {
+			job.set(keyword, inherited.withTemplate(defaultTemplate))
+		}
+	}
+	return job
+}
+
+// inherits reports whether the inherit setting node lets name through.
+func inherits(node *yaml.Node, name string) bool {
+	switch {
+	case node == nil:
+		return true
+	case node.Kind == yaml.SequenceNode:
+		return slices.ContainsFunc(node.Content, func(item *yaml.Node) bool {
+			return resolve(item).Value == name
+		})
+	default:
+		return node.Value != "false"
+	}
+}
+
+// dereference replaces the !reference tags of v with the values they point
+// to, splicing the lists referenced in lists.
+func (r *Resolver) dereference(v *value, depth int) (*value, error) {
+	if depth > maxExtendsDepth {
+		return nil, fmt.Errorf("%w: references are nested too deeply", ReferenceErr)
+	}
+
+	if v.isMapping() {
+		result := v.clone()
+		for _, key := range result.keys {
+			field, err := r.dereference(result.fields[key], depth)
+			if err != nil {
+				return nil, err
+			}
+			result.fields[key] = field
+		}
+		return result, nil
+	}
+
+	node := v.node
+	if isReference(node) {
+		referenced, err := r.reference(node)
+		if err != nil {
+			return nil, err
+		}
+		return r.dereference(referenced, depth+1)
+	}
+	if node.Kind != yaml.SequenceNode || !slices.ContainsFunc(node.Content, isReference) {
+		return v, nil
+	}
+
+	spliced := *node
+	spliced.Content = nil
+	for _, item := range node.Content {
+		if !isReference(item) {
+			spliced.Content = append(spliced.Content, item)
+			continue
+		}
+		referenced, err := r.reference(item)
+		if err != nil {
+			return nil, err
+		}
+		if referenced, err = r.dereference(referenced, depth+1); err != nil {
+			return nil, err
+		}
+		if referenced.node != nil && referenced.node.Kind == yaml.SequenceNode {
+			spliced.Content = append(spliced.Content, referenced.node.Content...)
+		} else {
+			spliced.Content = append(spliced.Content, referenced.yamlNode())
+		}
+	}
+	return &value{node: &spliced, origin: v.origin}, nil
+}
+
+// reference returns the value a !reference tag points to, the first element
+// of its path being a job or template resolved with its extends.
+func (r *Resolver) reference(node *yaml.Node) (*value, error) {
+	var path []string
+	for _, item := range node.Content {
+		path = append(path, resolve(item).Value)
+	}
+	if node.Kind != yaml.SequenceNode || len(path) == 0 {
+		return nil, fmt.Errorf("%w at line %d: expected a list of keys", ReferenceErr, node.Line)
+	}
+
+	v, err := r.extend(path[0], nil)
+	if err != nil {
+		if v = r.top[path[0]]; v == nil {
+			return nil, fmt.Errorf("%w at line %d: %w", ReferenceErr, node.Line, err)
+		}
+	}
+	for _, key := range path[1:] {
+		if v = v.field(key); v == nil {
+			return nil, fmt.Errorf("%w at line %d: %s does not exist", ReferenceErr, node.Line, strings.Join(path, "."))
+		}
+	}
+	return v, nil
+}
+
+// variables returns the variables of job, preceded by the global ones it
+// inherits.
+func (r *Resolver) variables(job *value) []ResolvedVariable {
+	var variables []ResolvedVariable
+	inherit := job.field("inherit").field("variables").yamlNode()
+
+	if global := r.top["variables"]; global != nil && global.isMapping() {
+		for _, name := range global.keys {
+			if inherits(inherit, name) {
+				variables = append(variables, variable(name, global.fields[name]))
+			}
+		}
+	}
+	if own := job.field("variables"); own != nil && own.isMapping() {
+		for _, name := range own.keys {
+			variables = slices.DeleteFunc(variables, func(v ResolvedVariable) bool { return v.Name == name })
+			variables = append(variables, variable(name, own.fields[name]))
+		}
+	}
+	return variables
+}
+
+func variable(name string, v *value) ResolvedVariable {
+	resolved := ResolvedVariable{Name: name, Origin: v.origin}
+	if field := v.field("value"); field != nil {
+		v = field
+	}
+	if node := v.yamlNode(); node != nil && !isNull(node) {
+		resolved.Value = node.Value
+	}
+	return resolved
+}
+
+// descriptor parses the resolved job, along with the global variables it
+// inherits, the way the pipeline runs it.
+func (r *Resolver) descriptor(name string, job *value) (common.PipelineJobDescriptor, error) {
+	content, err := json.Marshal(map[string]any{name: instance(job.yamlNode())})
+	if err != nil {
+		return common.PipelineJobDescriptor{}, err
+	}
+	doc, err := jsonquery.Parse(bytes.NewReader(content))
+	if err != nil {
+		return common.PipelineJobDescriptor{}, err
+	}
+
+	stage := defaultStage
+	if node := job.field("stage").yamlNode(); node != nil && isString(node) {
+		stage = node.Value
+	}
+	parsed, err := parseJob(doc.FirstChild, stage)
+	if err != nil {
+		return common.PipelineJobDescriptor{}, fmt.Errorf("%s: job %s: %w", r.top[name].origin.Position, name, err)
+	}
+
+	if variables := r.variables(job); len(variables) > 0 {
+		values := make(map[string]string, len(variables))
+		for _, variable := range variables {
+			values[variable.Name] = variable.Value
+		}
+		return parsed.WithVariables(values), nil
+	}
+	return *parsed, nil
+}
+
+// build returns the value of node, the key of which is key, written in the
+// job or template called template.
+func build(file string, key, node *yaml.Node, template string) *value {
+	node = resolve(node)
+	v := &value{origin: Origin{Position: position(file, key), Template: template}}
+	if node.Kind != yaml.MappingNode {
+		v.node = node
+		return v
+	}
+
+	anchors := mergedAnchors(node)
+	v.fields = make(map[string]*value)
+	for _, e := range entries(node) {
+		v.keys = append(v.keys, e.key.Value)
+		field := build(file, e.key, e.value, template)
+		if anchor := anchors[e.key.Value]; anchor != "" {
+			field = field.withAnchor(anchor)
+		}
+		v.fields[e.key.Value] = field
+	}
+	return v
+}
+
+// mergedAnchors returns the anchors of the aliases the keys of a mapping
+// are merged from with <<, keys written explicitly being left out.
+func mergedAnchors(node *yaml.Node) map[string]string {
+	anchors := make(map[string]string)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value != mergeKey {
+			anchors[node.Content[i].Value] = ""
+		}
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value != mergeKey {
+			continue
+		}
+		sources := []*yaml.Node{node.Content[i+1]}
+		if node.Content[i+1].Kind == yaml.SequenceNode {
+			sources = node.Content[i+1].Content
+		}
+		for _, source := range sources {
+			for _, e := range entries(source) {
+				if _, found := anchors[e.key.Value]; !found {
+					anchors[e.key.Value] = resolve(source).Anchor
+				}
+			}
+		}
+	}
+	return anchors
+}
+
+// merge returns src deeply merged over dst, as GitLab merges extends and
+// included files: mappings are merged key by key while other values are
+// replaced.
+func merge(dst, src *value) *value {
+	if dst == nil || !dst.isMapping() || !src.isMapping() {
+		return src.clone()
+	}
+
+	result := dst.clone()
+	result.origin = src.origin
+	for _, key := range src.keys {
+		if existing, found := result.fields[key]; found {
+			result.fields[key] = merge(existing, src.fields[key])
+			continue
+		}
+		result.set(key, src.fields[key].clone())
+	}
+	return result
+}
+
+// clone copies the fields of v so that merging does not alter templates.
+func (v *value) clone() *value {
+	copied := *v
+	if v.isMapping() {
+		copied.keys = slices.Clone(v.keys)
+		copied.fields = make(map[string]*value, len(v.fields))
+		for key, field := range v.fields {
+			copied.fields[key] = field.clone()
+		}
+	}
+	return &copied
+}
+
+func (v *value) set(key string, field *value) {
+	if _, found := v.fields[key]; !found {
+		v.keys = append(v.keys, key)
+	}
+	v.fields[key] = field
+}
+
+func (v *value) remove(key string) {
+	v.keys = slices.DeleteFunc(v.keys, func(k string) bool { return k == key })
+	delete(v.fields, key)
+}
+
+// withTemplate returns a copy of v telling it comes from template.
+func (v *value) withTemplate(template string) *value {
+	copied := v.clone()
+	copied.origin.Template = template
+	for key, field := range copied.fields {
+		copied.fields[key] = field.withTemplate(template)
+	}
+	return copied
+}
+
+// withAnchor returns a copy of v telling it is merged from anchor.
+func (v *value) withAnchor(anchor string) *value {
+	copied := v.clone()
+	copied.origin.Anchor = anchor
+	for key, field := range copied.fields {
+		copied.fields[key] = field.withAnchor(anchor)
+	}
+	return copied
+}
+
+// yamlNode returns the node v stands for, nil for a nil value.
+func (v *value) yamlNode() *yaml.Node {
+	if v == nil {
+		return nil
+	}
+	if !v.isMapping() {
+		return v.node
+	}
+
+	mapping := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, key := range v.keys {
+		mapping.Content = append(mapping.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+			v.fields[key].yamlNode(),
+		)
+	}
+	return mapping
+}
+
+// yaml returns the job as a single key mapping. Keys coming from elsewhere
+// than the mapping holding them are commented with their origin.
+func (v *value) yaml(name string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: name},
+		v.annotated(),
+	}}
+}
+
+func (v *value) annotated() *yaml.Node {
+	if !v.isMapping() {
+		node := *v.node
+		node.HeadComment, node.LineComment, node.FootComment = "", "", ""
+		return &node
+	}
+
+	mapping := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, key := range v.keys {
+		field := v.fields[key]
+		keyNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}
+		valueNode := field.annotated()
+		if field.origin.Template != v.origin.Template || field.origin.Anchor != v.origin.Anchor || field.origin.File != v.origin.File {
+			origin := field.origin
+			if origin.Template == v.origin.Template {
+				origin.Template = ""
+			}
+			// Comments of keys holding values written on the same line
+			// are not written, the value holds it then.
+			if valueNode.Kind == yaml.ScalarNode || valueNode.Style&yaml.FlowStyle != 0 {
+				valueNode.LineComment = origin.String()
+			} else {
+				keyNode.LineComment = origin.String()
+			}
+		}
+		mapping.Content = append(mapping.Content, keyNode, valueNode)
+	}
+	return mapping
+}
@@ -0,0 +1,106 @@
+package gitlab
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/powerpixel/pipelinefox/parser/common"
+	"sigs.k8s.io/yaml/goyaml.v3"
+)
+
+const explainRoot = "testdata/explain"
+
+func resolveTestJob(t *testing.T, name string) *ResolvedJob {
+	t.Helper()
+
+	resolver, err := NewResolver(explainRoot, explainRoot+"/.gitlab-ci.yml")
+	if err != nil {
+		t.Fatalf("unexpected error : %v", err)
+	}
+	job, err := resolver.Resolve(name)
+	if err != nil {
+		t.Fatalf("unexpected error : %v", err)
+	}
+	return job
+}
+
+func TestResolveMergesJob(t *testing.T) {
+	job := resolveTestJob(t, "build")
+
+	if job.Position.String() != ".gitlab-ci.yml:20:1" {
+		t.Errorf("unexpected position %s", job.Position)
+	}
+	if len(job.Warnings) != 1 || !strings.Contains(job.Warnings[0], "not local") {
+		t.Errorf("expected a warning about the remote include, got %v", job.Warnings)
+	}
+
+	content, err := yaml.Marshal(job.Node)
+	if err != nil {
+		t.Fatalf("unexpected error : %v", err)
+	}
+	for _, expected := range []string{
+		"image: golang:1.23 # ci/templates.yml:2:3 (.go)\n",
+		"CGO_ENABLED: \"0\" # ci/templates.yml:4:5 (.go)\n",
+		"GOFLAGS: -trimpath\n",
+		"expire_in: 1 week # ci/templates.yml:7:5 (.go)\n",
+		"paths: [dist/]\n",
+		"script:\n        - make lint\n        - go build ./...\n",
+		"timeout: 30m # .gitlab-ci.yml:14:3 (*setup)\n",
+		"tags: [docker] # .gitlab-ci.yml:7:3 (default)\n",
+	} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("expected the job to contain %q, got\n%s", expected, content)
+		}
+	}
+	if strings.Contains(string(content), "extends") {
+		t.Errorf("expected extends to be resolved, got\n%s", content)
+	}
+
+	expected := map[string]string{"GO_VERSION": "1.23", "CGO_ENABLED": "0", "GOFLAGS": "-trimpath"}
+	if len(job.Variables) != len(expected) {
+		t.Fatalf("unexpected variables %+v", job.Variables)
+	}
+	for _, variable := range job.Variables {
+		if expected[variable.Name] != variable.Value {
+			t.Errorf("unexpected variable %+v", variable)
+		}
+	}
+
+	outcome, err := job.Job.EvaluateRules(common.RuleContext{Variables: map[string]string{"CI_COMMIT_BRANCH": "main"}})
+	if err != nil || outcome.When != common.WhenManual {
+		t.Errorf("expected the rules of the job to be parsed, got %+v, %v", outcome, err)
+	}
+	if job.Job.GetStage() != "build" {
+		t.Errorf("unexpected stage %s", job.Job.GetStage())
+	}
+}
+
+func TestResolveAppliesInherit(t *testing.T) {
+	job := resolveTestJob(t, "isolated")
+
+	content, err := yaml.Marshal(job.Node)
+	if err != nil {
+		t.Fatalf("unexpected error : %v", err)
+	}
+	if strings.Contains(string(content), "image") || strings.Contains(string(content), "tags") {
+		t.Errorf("expected default to be left out, got\n%s", content)
+	}
+	if len(job.Variables) != 1 || job.Variables[0].Name != "GO_VERSION" || job.Variables[0].Origin.Line != 10 {
+		t.Errorf("unexpected variables %+v", job.Variables)
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	resolver, err := NewResolver(explainRoot, explainRoot+"/.gitlab-ci.yml")
+	if err != nil {
+		t.Fatalf("unexpected error : %v", err)
+	}
+
+	if _, err := resolver.Resolve("biuld"); !errors.Is(err, UnknownJobErr) || !strings.HasSuffix(err.Error(), "did you mean build?") {
+		t.Errorf("expected an unknown job error with a suggestion, got %v", err)
+	}
+	if _, err := resolver.Resolve("loop"); !errors.Is(err, ExtendsLoopErr) {
+		t.Errorf("expected %v, got %v", ExtendsLoopErr, err)
+	}
+}
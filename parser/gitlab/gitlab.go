@@ -1,82 +1,109 @@
 package gitlab
 
 import (
-	"bytes"
+	"cmp"
 	"errors"
 	"fmt"
 	"reflect"
+	"strings"
+	"time"
 
 	"github.com/powerpixel/pipelinefox/parser/common"
 
 	"github.com/antchfx/jsonquery"
-	"github.com/antchfx/xpath"
-	"sigs.k8s.io/yaml"
 )
 
 var UnknownScriptObjectErr = errors.New("the script tag in the yaml descriptor is neither a string or an array of string, this is not handled	")
-
-const (
-	stageQueryTemplate = "//*[stage='%v']"
-)
+var UnknownTimeoutObjectErr = errors.New("the timeout tag in the yaml descriptor is not a string")
+var UnknownWhenValueErr = errors.New("the when tag in the yaml descriptor is not one of on_success, on_failure, always, manual or never")
+var UnknownVariablesObjectErr = errors.New("the variables tag in the yaml descriptor is not a map of strings, numbers or booleans")
+var UnknownReportsObjectErr = errors.New("the artifacts:reports tag in the yaml descriptor is not a map of paths")
+var UnknownNeedsObjectErr = errors.New("the needs tag in the yaml descriptor is not a list of job names or job objects")
+var UnknownDependenciesObjectErr = errors.New("the dependencies tag in the yaml descriptor is not a list of job names")
+var UnknownRulesObjectErr = errors.New("the rules tag in the yaml descriptor is not a list of rule objects")
+var UnknownServicesObjectErr = errors.New("the services tag in the yaml descriptor is not a list of images")
+var UnknownImageObjectErr = errors.New("the image tag in the yaml descriptor is neither a string nor an object with a name and pull policies")
+var MissingScriptErr = errors.New("the job defines no script")
+var UnsupportedJobErr = errors.New("the job has a trigger or run keyword but no script, only GitLab can run it")
+
+// defaultFile is the path of the descriptor shown in errors when the parser
+// is not told where it is.
+const defaultFile = ".gitlab-ci.yml"
 
 type GitlabPipelineDescriptor struct {
 	Stages []string `json:"stages"`
 }
 
-type GitlabPipelineParser struct{}
+type GitlabPipelineParser struct {
+	root string
+	file string
+}
 
 func NewGitlabPipelineParser() GitlabPipelineParser {
 	return GitlabPipelineParser{}
 }
 
-func (p *GitlabPipelineParser) ParsePipelineDescriptor(content []byte) (*common.PipelineDescriptor, error) {
+// WithProject returns a copy of the parser reading the descriptor at file in
+// the project at root, the local files it includes being relative to root.
+func (p GitlabPipelineParser) WithProject(root, file string) GitlabPipelineParser {
+	p.root = root
+	p.file = file
+	return p
+}
 
-	json, err := yaml.YAMLToJSON(content)
+// ParsePipelineDescriptor returns the pipeline of the descriptor in content.
+// Its jobs are resolved as explain shows them: local includes, extends,
+// default and !reference tags are applied, hidden jobs being left out.
+func (p *GitlabPipelineParser) ParsePipelineDescriptor(content []byte) (*common.PipelineDescriptor, error) {
+	resolver, err := newContentResolver(p.root, cmp.Or(p.file, defaultFile), content)
 	if err != nil {
 		return nil, err
 	}
 
-	doc, err := jsonquery.Parse(bytes.NewReader(json))
+	parsedStages, err := resolver.stages()
 	if err != nil {
 		return nil, err
 	}
 
-	parsedStages, err := parseStages(doc)
-	if err != nil {
-		panic(err)
-	}
-
-	parsedJobs, err := parseJobs(parsedStages, doc)
-	if err != nil {
-		panic(err)
+	parsedJobs := make([]common.PipelineJobDescriptor, 0)
+	for _, name := range resolver.Jobs() {
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		job, err := resolver.resolve(name)
+		if err != nil {
+			return nil, err
+		}
+		parsedJob, err := resolver.descriptor(name, job)
+		if err != nil {
+			return nil, err
+		}
+		if parsedJob.GetScript() == nil {
+			reason := MissingScriptErr
+			if job.field("trigger") != nil || job.field("run") != nil {
+				reason = UnsupportedJobErr
+			}
+			return nil, fmt.Errorf("%s: job %s: %w", resolver.top[name].origin.Position, name, reason)
+		}
+		parsedJobs = append(parsedJobs, parsedJob)
 	}
 
-	descriptor, err := common.NewPipelineDescriptor(
+	return common.NewPipelineDescriptor(
 		parsedStages,
 		parsedJobs,
 	)
-
-	if err != nil {
-		return nil, err
-	}
-
-	return descriptor, nil
 }
 
-func parseStages(root *jsonquery.Node) ([]string, error) {
-
-	stages := jsonquery.FindOne(root, "stages")
-
+func parseStages(value any) ([]string, error) {
 	parsedStages := make([]string, 0)
 
-	if val, ok := stages.Value().([]interface{}); ok {
+	if val, ok := value.([]any); ok {
 		for _, stage := range val {
 			switch stageType := stage.(type) {
 			case string:
-				fmt.Printf("Discovered stage %v\n", stage)
 				parsedStages = append(parsedStages, stageType)
 			default:
-				fmt.Printf("Skipping uknown job type : %v\n", stage)
+				return nil, fmt.Errorf("stage %v is not a string", stage)
 			}
 		}
 	}
@@ -84,40 +111,380 @@ func parseStages(root *jsonquery.Node) ([]string, error) {
 	return parsedStages, nil
 }
 
-func parseJobs(stages []string, root *jsonquery.Node) ([]common.PipelineJobDescriptor, error) {
+// parseJob parses the job node, its script being nil when it has none, as
+// templates.
+func parseJob(node *jsonquery.Node, stage string) (*common.PipelineJobDescriptor, error) {
+	var script []string
+	if scriptNode := jsonquery.FindOne(node, "script"); scriptNode != nil {
+		var err error
+		if script, err = parseScript(scriptNode); err != nil {
+			return nil, err
+		}
+	}
 
-	parsedJobs := make([]common.PipelineJobDescriptor, 0)
+	parsedJob := common.NewPipelineJobDescriptor(node.Data, stage, script)
+
+	if imageNode := jsonquery.FindOne(node, "image"); imageNode != nil {
+		image, pullPolicy, err := parseImage(imageNode.Value())
+		if err != nil {
+			return nil, err
+		}
+		parsedJob = parsedJob.WithImage(image).WithPullPolicy(pullPolicy)
+	}
+
+	if servicesNode := jsonquery.FindOne(node, "services"); servicesNode != nil {
+		services, err := parseServices(servicesNode.Value())
+		if err != nil {
+			return nil, err
+		}
+		parsedJob = parsedJob.WithServices(services)
+	}
+
+	if beforeScriptNode := jsonquery.FindOne(node, "before_script"); beforeScriptNode != nil {
+		beforeScript, err := parseScript(beforeScriptNode)
+		if err != nil {
+			return nil, err
+		}
+		parsedJob = parsedJob.WithBeforeScript(beforeScript)
+	}
+
+	if afterScriptNode := jsonquery.FindOne(node, "after_script"); afterScriptNode != nil {
+		afterScript, err := parseScript(afterScriptNode)
+		if err != nil {
+			return nil, err
+		}
+		parsedJob = parsedJob.WithAfterScript(afterScript)
+	}
+
+	if timeoutNode := jsonquery.FindOne(node, "timeout"); timeoutNode != nil {
+		timeout, err := parseTimeout(timeoutNode)
+		if err != nil {
+			return nil, err
+		}
+		parsedJob = parsedJob.WithTimeout(timeout)
+	}
+
+	if whenNode := jsonquery.FindOne(node, "when"); whenNode != nil {
+		when, err := parseWhen(whenNode)
+		if err != nil {
+			return nil, err
+		}
+		parsedJob = parsedJob.WithWhen(when)
+	}
 
-	for _, stage := range stages {
+	if variablesNode := jsonquery.FindOne(node, "variables"); variablesNode != nil {
+		variables, err := parseVariables(variablesNode.Value())
+		if err != nil {
+			return nil, err
+		}
+		parsedJob = parsedJob.WithVariables(variables)
+	}
+
+	if needsNode := jsonquery.FindOne(node, "needs"); needsNode != nil {
+		needs, err := parseNeeds(needsNode.Value())
+		if err != nil {
+			return nil, err
+		}
+		parsedJob = parsedJob.WithNeeds(needs)
+	}
+
+	if dependenciesNode := jsonquery.FindOne(node, "dependencies"); dependenciesNode != nil {
+		dependencies, err := parseNames(dependenciesNode.Value(), UnknownDependenciesObjectErr)
+		if err != nil {
+			return nil, err
+		}
+		parsedJob = parsedJob.WithDependencies(dependencies)
+	}
 
-		jobNodes := jsonquery.QuerySelectorAll(root, xpath.MustCompile(fmt.Sprintf(stageQueryTemplate, stage)))
+	if rulesNode := jsonquery.FindOne(node, "rules"); rulesNode != nil {
+		rules, err := parseRules(rulesNode.Value())
+		if err != nil {
+			return nil, err
+		}
+		parsedJob = parsedJob.WithRules(rules)
+	}
 
-		for _, stageNode := range jobNodes {
-			parsedJob, err := parseJob(stageNode, stage)
+	if artifactsNode := jsonquery.FindOne(node, "artifacts"); artifactsNode != nil {
+		reports, err := parseReports(artifactsNode.Value())
+		if err != nil {
+			return nil, err
+		}
+		parsedJob = parsedJob.WithReports(reports)
 
+		if object, ok := artifactsNode.Value().(map[string]any); ok {
+			paths, err := parsePaths(object["paths"])
 			if err != nil {
 				return nil, err
 			}
+			parsedJob = parsedJob.WithArtifactPaths(paths)
+		}
+	}
 
-			parsedJobs = append(parsedJobs, *parsedJob)
+	return &parsedJob, nil
+}
+
+// parseImage reads an image, either its name or an object holding it along
+// with its pull policy, a single one or a list of them.
+func parseImage(value any) (string, []string, error) {
+	var pullPolicy []string
+	if object, ok := value.(map[string]any); ok {
+		value = object["name"]
+
+		switch policy := object["pull_policy"].(type) {
+		case nil:
+		case string:
+			pullPolicy = []string{policy}
+		default:
+			var err error
+			if pullPolicy, err = parseNames(policy, UnknownImageObjectErr); err != nil {
+				return "", nil, err
+			}
 		}
 	}
 
-	return parsedJobs, nil
+	name, ok := value.(string)
+	if !ok || name == "" {
+		return "", nil, fmt.Errorf("%w: got %v", UnknownImageObjectErr, reflect.TypeOf(value))
+	}
+	return name, pullPolicy, nil
 }
 
-func parseJob(node *jsonquery.Node, stage string) (*common.PipelineJobDescriptor, error) {
-	fmt.Printf("Parsing job %v\n", node.Data)
+// parseServices reads a list of services, each one being an image as
+// parseImage reads it, objects possibly giving an alias.
+func parseServices(value any) ([]common.Service, error) {
+	source, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: got %v", UnknownServicesObjectErr, reflect.TypeOf(value))
+	}
 
-	scriptNode := jsonquery.FindOne(node, "script")
+	services := make([]common.Service, 0, len(source))
+	for _, item := range source {
+		name, pullPolicy, err := parseImage(item)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", UnknownServicesObjectErr, err)
+		}
+		service := common.Service{Name: name, PullPolicy: pullPolicy}
+		if object, ok := item.(map[string]any); ok {
+			service.Alias, _ = object["alias"].(string)
+		}
+		services = append(services, service)
+	}
+	return services, nil
+}
 
-	script, err := parseScript(scriptNode)
-	if err != nil {
-		return nil, err
+// parseVariables reads a variables map, values being either scalars or
+// objects holding a value key.
+func parseVariables(value any) (map[string]string, error) {
+	source, ok := value.(map[string]any)
+	if !ok {
+		return nil, UnknownVariablesObjectErr
 	}
 
-	parsedJob := common.NewPipelineJobDescriptor(node.Data, stage, script)
-	return &parsedJob, nil
+	variables := make(map[string]string, len(source))
+	for name, value := range source {
+		if object, ok := value.(map[string]any); ok {
+			value = object["value"]
+		}
+
+		switch value := value.(type) {
+		case string:
+			variables[name] = value
+		case float64, bool:
+			variables[name] = fmt.Sprint(value)
+		case nil:
+			variables[name] = ""
+		default:
+			return nil, fmt.Errorf("%w: got %v for %s", UnknownVariablesObjectErr, reflect.TypeOf(value), name)
+		}
+	}
+
+	return variables, nil
+}
+
+// parseReports reads the artifacts:reports entries handled by pipelinefox,
+// others being ignored.
+func parseReports(artifacts any) (common.ArtifactReports, error) {
+	var reports common.ArtifactReports
+
+	object, ok := artifacts.(map[string]any)
+	if !ok || object["reports"] == nil {
+		return reports, nil
+	}
+	source, ok := object["reports"].(map[string]any)
+	if !ok {
+		return reports, UnknownReportsObjectErr
+	}
+
+	var err error
+	if reports.JUnit, err = parsePaths(source["junit"]); err != nil {
+		return reports, err
+	}
+	if reports.Dotenv, err = parsePaths(source["dotenv"]); err != nil {
+		return reports, err
+	}
+	return reports, nil
+}
+
+func parsePaths(value any) ([]string, error) {
+	switch value := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{value}, nil
+	case []any:
+		paths := make([]string, 0, len(value))
+		for _, path := range value {
+			path, ok := path.(string)
+			if !ok {
+				return nil, UnknownReportsObjectErr
+			}
+			paths = append(paths, path)
+		}
+		return paths, nil
+	default:
+		return nil, fmt.Errorf("%w: got %v", UnknownReportsObjectErr, reflect.TypeOf(value))
+	}
+}
+
+// parseNeeds reads the jobs of the pipeline the job needs, the ones of other
+// pipelines and projects being ignored.
+func parseNeeds(value any) ([]common.Need, error) {
+	source, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: got %v", UnknownNeedsObjectErr, reflect.TypeOf(value))
+	}
+
+	needs := make([]common.Need, 0, len(source))
+	for _, item := range source {
+		switch item := item.(type) {
+		case string:
+			needs = append(needs, common.Need{Job: item, Artifacts: true})
+		case map[string]any:
+			if item["pipeline"] != nil || item["project"] != nil {
+				continue
+			}
+			job, ok := item["job"].(string)
+			if !ok {
+				return nil, UnknownNeedsObjectErr
+			}
+			need := common.Need{Job: job, Artifacts: true}
+			if artifacts, ok := item["artifacts"].(bool); ok {
+				need.Artifacts = artifacts
+			}
+			if optional, ok := item["optional"].(bool); ok {
+				need.Optional = optional
+			}
+			needs = append(needs, need)
+		default:
+			return nil, fmt.Errorf("%w: got %v", UnknownNeedsObjectErr, reflect.TypeOf(item))
+		}
+	}
+	return needs, nil
+}
+
+// parseNames reads a list of job names, failing with err otherwise.
+func parseNames(value any, err error) ([]string, error) {
+	source, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: got %v", err, reflect.TypeOf(value))
+	}
+
+	names := make([]string, 0, len(source))
+	for _, item := range source {
+		name, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: got %v", err, reflect.TypeOf(item))
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func parseRules(value any) ([]common.Rule, error) {
+	source, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: got %v", UnknownRulesObjectErr, reflect.TypeOf(value))
+	}
+
+	rules := make([]common.Rule, 0, len(source))
+	for _, item := range source {
+		object, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%w: got %v", UnknownRulesObjectErr, reflect.TypeOf(item))
+		}
+
+		var rule common.Rule
+		if rule.If, ok = object["if"].(string); object["if"] != nil && !ok {
+			return nil, fmt.Errorf("%w: if is not a string", UnknownRulesObjectErr)
+		}
+		if object["when"] != nil {
+			when, ok := object["when"].(string)
+			if !ok {
+				return nil, UnknownWhenValueErr
+			}
+			if when != "delayed" {
+				if _, err := parseWhenValue(when); err != nil {
+					return nil, err
+				}
+			}
+			rule.When = when
+		}
+
+		var err error
+		if rule.Exists, err = parseRulePaths(object["exists"]); err != nil {
+			return nil, err
+		}
+		if rule.Changes, err = parseRulePaths(object["changes"]); err != nil {
+			return nil, err
+		}
+		if object["variables"] != nil {
+			if rule.Variables, err = parseVariables(object["variables"]); err != nil {
+				return nil, err
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// parseRulePaths reads the paths of exists and changes, given either as a
+// list or as an object holding it.
+func parseRulePaths(value any) ([]string, error) {
+	if object, ok := value.(map[string]any); ok {
+		value = object["paths"]
+	}
+	if value == nil {
+		return nil, nil
+	}
+	return parseNames(value, UnknownRulesObjectErr)
+}
+
+func parseWhen(node *jsonquery.Node) (string, error) {
+	when, ok := node.Value().(string)
+	if !ok {
+		return "", UnknownWhenValueErr
+	}
+	return parseWhenValue(when)
+}
+
+func parseWhenValue(when string) (string, error) {
+	switch when {
+	case common.WhenOnSuccess, common.WhenOnFailure, common.WhenAlways, common.WhenManual, common.WhenNever:
+		return when, nil
+	default:
+		return "", fmt.Errorf("%w: got %s", UnknownWhenValueErr, when)
+	}
+}
+
+func parseTimeout(node *jsonquery.Node) (time.Duration, error) {
+	switch value := node.Value().(type) {
+	case string:
+		return parseDuration(value)
+	case float64:
+		return time.Duration(value) * time.Second, nil
+	default:
+		return 0, UnknownTimeoutObjectErr
+	}
 }
 
 func parseScript(node *jsonquery.Node) ([]string, error) {
@@ -127,7 +494,7 @@ func parseScript(node *jsonquery.Node) ([]string, error) {
 	case []any:
 		source := node.Value().([]any)
 		// Try to convert it to a []string
-		r := make([]string, len(source))
+		r := make([]string, 0, len(source))
 
 		for _, e := range source {
 			switch e := e.(type) {
@@ -139,8 +506,7 @@ func parseScript(node *jsonquery.Node) ([]string, error) {
 		}
 		return r, nil
 	default:
-		fmt.Printf("Node of type %v is unknown...; Value is %v \n", reflect.TypeOf(node.Value()), node.Value())
-		return nil, UnknownScriptObjectErr
+		return nil, fmt.Errorf("%w: got %v", UnknownScriptObjectErr, reflect.TypeOf(node.Value()))
 	}
 
 }
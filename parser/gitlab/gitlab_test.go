@@ -1,8 +1,11 @@
 package gitlab
 
 import (
+	"errors"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/powerpixel/pipelinefox/parser/common"
 	"github.com/powerpixel/pipelinefox/utils"
@@ -15,6 +18,8 @@ type ParserTestCase struct {
 }
 
 func TestParseSimpleYamlGitlabCi(t *testing.T) {
+	mockServer := []common.Service{{Name: "registry.example.com/tools/mock-server:1.0"}}
+
 	cases := []ParserTestCase{
 		{
 			TestName:    "It parses a simple gitlab file correctly",
@@ -30,6 +35,180 @@ func TestParseSimpleYamlGitlabCi(t *testing.T) {
 					),
 				}),
 		},
+		{
+			TestName:    "It parses the timeout and after_script of a job",
+			YAMLContent: utils.ReadTestFile(t, "testdata/timeout.yaml"),
+			Expected: createNewPipelineDescriptor(t, []string{
+				"test",
+			},
+				[]common.PipelineJobDescriptor{
+					common.NewPipelineJobDescriptor(
+						"unit_tests",
+						"test",
+						[]string{"echo \"testing\"", "echo \"done\""},
+					).WithAfterScript(
+						[]string{"echo \"cleaning up\""},
+					).WithTimeout(90 * time.Minute),
+				}),
+		},
+		{
+			TestName:    "It parses the when keyword of a job",
+			YAMLContent: utils.ReadTestFile(t, "testdata/when.yaml"),
+			Expected: createNewPipelineDescriptor(t, []string{
+				"deploy",
+			},
+				[]common.PipelineJobDescriptor{
+					common.NewPipelineJobDescriptor(
+						"deploy_prod",
+						"deploy",
+						[]string{"./deploy.sh"},
+					).WithWhen(common.WhenManual),
+				}),
+		},
+		{
+			TestName:    "It parses the variables and artifacts reports of a job",
+			YAMLContent: utils.ReadTestFile(t, "testdata/reports.yaml"),
+			Expected: createNewPipelineDescriptor(t, []string{
+				"build",
+				"test",
+			},
+				[]common.PipelineJobDescriptor{
+					common.NewPipelineJobDescriptor(
+						"build_app",
+						"build",
+						[]string{"./build.sh > build.env"},
+					).WithVariables(map[string]string{
+						"GO_VERSION": "1.23",
+						"VERBOSE":    "true",
+						"RETRIES":    "3",
+						"TARGET":     "linux",
+					}).WithReports(common.ArtifactReports{
+						Dotenv: []string{"build.env"},
+					}).WithArtifactPaths([]string{"dist/"}),
+					common.NewPipelineJobDescriptor(
+						"unit_tests",
+						"test",
+						[]string{"go test ./... 2>&1 | go-junit-report > report.xml"},
+					).WithVariables(map[string]string{
+						"GO_VERSION": "1.23",
+						"VERBOSE":    "false",
+					}).WithReports(common.ArtifactReports{
+						JUnit: []string{"report.xml", "**/junit-*.xml"},
+					}),
+				}),
+		},
+		{
+			TestName:    "It parses the needs, dependencies and rules of a job",
+			YAMLContent: utils.ReadTestFile(t, "testdata/needs.yaml"),
+			Expected: createNewPipelineDescriptor(t, []string{
+				"build",
+				"test",
+			},
+				[]common.PipelineJobDescriptor{
+					common.NewPipelineJobDescriptor(
+						"build_app",
+						"build",
+						[]string{"make"},
+					),
+					common.NewPipelineJobDescriptor(
+						"unit_tests",
+						"test",
+						[]string{"make test"},
+					).WithNeeds([]common.Need{
+						{Job: "build_app", Artifacts: true},
+						{Job: "lint", Optional: true},
+					}).WithDependencies(
+						[]string{"build_app"},
+					).WithRules([]common.Rule{
+						{If: `$CI_COMMIT_BRANCH == "main"`, When: common.WhenAlways, Variables: map[string]string{"FULL": "true"}},
+						{Exists: []string{"go.mod"}},
+						{Changes: []string{"**/*.go"}, When: common.WhenManual},
+					}),
+				}),
+		},
+		{
+			TestName:    "It parses the image of jobs, default applying to the ones without",
+			YAMLContent: utils.ReadTestFile(t, "testdata/image.yaml"),
+			Expected: createNewPipelineDescriptor(t, []string{
+				"build",
+				"test",
+			},
+				[]common.PipelineJobDescriptor{
+					common.NewPipelineJobDescriptor(
+						"build_app",
+						"build",
+						[]string{"make"},
+					).WithImage("golang:1.23").WithPullPolicy([]string{"if-not-present"}).WithServices(mockServer),
+					common.NewPipelineJobDescriptor(
+						"unit_tests",
+						"test",
+						[]string{"make test"},
+					).WithImage("golang:1.23-alpine").WithPullPolicy([]string{"always", "if-not-present"}).WithServices(mockServer),
+					common.NewPipelineJobDescriptor(
+						"lint",
+						"test",
+						[]string{"golangci-lint run"},
+					).WithImage("golangci/golangci-lint:v2").WithServices(mockServer),
+					common.NewPipelineJobDescriptor(
+						"integration_tests",
+						"test",
+						[]string{"make integration"},
+					).WithImage("golang:1.23").WithPullPolicy([]string{"if-not-present"}).WithServices([]common.Service{
+						{Name: "postgres:16"},
+						{Name: "docker.io/library/redis:7", Alias: "cache", PullPolicy: []string{"never"}},
+					}),
+				}),
+		},
+		{
+			TestName:    "It parses the before_script of jobs, default applying to the ones without",
+			YAMLContent: utils.ReadTestFile(t, "testdata/before_script.yaml"),
+			Expected: createNewPipelineDescriptor(t, []string{
+				"build",
+				"test",
+			},
+				[]common.PipelineJobDescriptor{
+					common.NewPipelineJobDescriptor(
+						"build_app",
+						"build",
+						[]string{"echo \"greet=$GREETING\""},
+					).WithBeforeScript([]string{"export GREETING=hello"}),
+					common.NewPipelineJobDescriptor(
+						"unit_tests",
+						"test",
+						[]string{"make test"},
+					).WithBeforeScript(
+						[]string{"echo \"preparing\""},
+					).WithAfterScript(
+						[]string{"echo \"cleaning up\""},
+					),
+				}),
+		},
+		{
+			TestName:    "It resolves the extends, default and !reference tags of jobs",
+			YAMLContent: utils.ReadTestFile(t, "testdata/extends.yaml"),
+			Expected: createNewPipelineDescriptor(t, []string{
+				"build",
+				"test",
+			},
+				[]common.PipelineJobDescriptor{
+					common.NewPipelineJobDescriptor(
+						"build_app",
+						"build",
+						[]string{"go build ./..."},
+					).WithImage("golang:1.23").WithVariables(map[string]string{
+						"GO_VERSION":  "1.23",
+						"CGO_ENABLED": "0",
+					}),
+					common.NewPipelineJobDescriptor(
+						"unit_tests",
+						"test",
+						[]string{"golangci-lint run", "go test ./..."},
+					).WithImage("golang:1.23").WithVariables(map[string]string{
+						"GO_VERSION":  "1.23",
+						"CGO_ENABLED": "0",
+					}),
+				}),
+		},
 	}
 
 	for _, testCase := range cases {
@@ -45,6 +224,44 @@ func TestParseSimpleYamlGitlabCi(t *testing.T) {
 	}
 }
 
+func TestParseResolvesLocalIncludes(t *testing.T) {
+	parser := NewGitlabPipelineParser().WithProject("testdata/include", "testdata/include/.gitlab-ci.yml")
+	got, err := parser.ParsePipelineDescriptor([]byte(utils.ReadTestFile(t, "testdata/include/.gitlab-ci.yml")))
+	if err != nil {
+		t.Fatalf("unexpected error : %v", err)
+	}
+
+	assertPipelineDescriptor(t, *got, createNewPipelineDescriptor(t, []string{"build", "test"}, []common.PipelineJobDescriptor{
+		common.NewPipelineJobDescriptor("build_app", "build", []string{"make"}),
+		common.NewPipelineJobDescriptor("unit_tests", "test", []string{"make test"}).WithNeeds([]common.Need{{Job: "build_app", Artifacts: true}}),
+	}))
+}
+
+func TestParseRejectsJobsWithoutScript(t *testing.T) {
+	cases := []struct {
+		file     string
+		content  string
+		expected error
+		position string
+	}{
+		{".gitlab-ci.yml", utils.ReadTestFile(t, "testdata/trigger.yaml"), UnsupportedJobErr, ".gitlab-ci.yml:9:1: "},
+		{"ci.yml", "unit_tests:\n  extends: .test\n\n.test:\n  image: golang\n", MissingScriptErr, "ci.yml:1:1: "},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.expected.Error(), func(t *testing.T) {
+			parser := NewGitlabPipelineParser().WithProject("", testCase.file)
+			_, err := parser.ParsePipelineDescriptor([]byte(testCase.content))
+			if !errors.Is(err, testCase.expected) {
+				t.Fatalf("expected %v, got %v", testCase.expected, err)
+			}
+			if !strings.HasPrefix(err.Error(), testCase.position) {
+				t.Errorf("expected the error to be located at %s, got %v", testCase.position, err)
+			}
+		})
+	}
+}
+
 func createNewPipelineDescriptor(t testing.TB, stages []string, jobs []common.PipelineJobDescriptor) common.PipelineDescriptor {
 	t.Helper()
 	res, err := common.NewPipelineDescriptor(stages, jobs)
@@ -66,7 +283,34 @@ func assertPipelineDescriptor(t testing.TB, got, want common.PipelineDescriptor)
 		t.Fatalf("stages mismatch, got %v want %v", gotStage, wantStage)
 	}
 
-	if !reflect.DeepEqual(gotStage.GetJobs(), wantStage.GetJobs()) {
-		t.Fatalf("jobs mismatch, got %v want %v", gotStage.GetJobs(), wantStage.GetJobs())
+	if !reflect.DeepEqual(got.GetStageNames(), want.GetStageNames()) {
+		t.Fatalf("stage names mismatch, got %v want %v", got.GetStageNames(), want.GetStageNames())
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	cases := map[string]time.Duration{
+		"3600":                  time.Hour,
+		"10 minutes":            10 * time.Minute,
+		"1h 30m":                90 * time.Minute,
+		"1h30m":                 90 * time.Minute,
+		"1 hour and 15 minutes": 75 * time.Minute,
+		"2 days":                48 * time.Hour,
+	}
+
+	for value, expected := range cases {
+		t.Run(value, func(t *testing.T) {
+			got, err := parseDuration(value)
+			if err != nil {
+				t.Fatalf("unexpected error : %v", err)
+			}
+			if got != expected {
+				t.Fatalf("expected %s, got %s", expected, got)
+			}
+		})
+	}
+
+	if _, err := parseDuration("one hour"); err == nil {
+		t.Fatalf("expected an error for an invalid duration")
 	}
 }
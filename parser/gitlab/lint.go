@@ -0,0 +1,480 @@
+package gitlab
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/powerpixel/pipelinefox/parser/common"
+	"sigs.k8s.io/yaml/goyaml.v3"
+)
+
+// defaultStages are the stages of a pipeline declaring none.
+var defaultStages = []string{".pre", "build", "test", "deploy", ".post"}
+
+var globalKeywords = []string{"default", "include", "stages", "variables", "workflow"}
+
+// deprecatedGlobalKeywords maps the global keywords GitLab deprecated to
+// their replacement.
+var deprecatedGlobalKeywords = map[string]string{
+	"image":         "default:image",
+	"services":      "default:services",
+	"cache":         "default:cache",
+	"before_script": "default:before_script",
+	"after_script":  "default:after_script",
+	"types":         "stages",
+}
+
+var defaultKeywords = []string{
+	"after_script", "artifacts", "before_script", "cache", "hooks", "id_tokens", "image",
+	"interruptible", "retry", "services", "tags", "timeout",
+}
+
+var jobKeywords = []string{
+	"after_script", "allow_failure", "artifacts", "before_script", "cache", "coverage",
+	"dast_configuration", "dependencies", "environment", "except", "extends", "hooks",
+	"id_tokens", "identity", "image", "inherit", "interruptible", "manual_confirmation",
+	"needs", "only", "pages", "parallel", "release", "resource_group", "retry", "rules",
+	"run", "script", "secrets", "services", "stage", "start_in", "tags", "timeout",
+	"trigger", "variables", "when",
+}
+
+var artifactsKeywords = []string{
+	"access", "exclude", "expire_in", "expose_as", "name", "paths", "public", "reports",
+	"untracked", "when",
+}
+
+var whenValues = []string{
+	common.WhenOnSuccess, common.WhenOnFailure, common.WhenAlways, common.WhenManual,
+	common.WhenNever, "delayed",
+}
+
+// Lint checks the GitLab CI descriptor read from file. Unlike the parser, it
+// does not stop at the first problem and locates each of them.
+func Lint(file string, content []byte) common.Diagnostics {
+	root, diagnostic := parseDocument(file, content)
+	if diagnostic != nil {
+		return common.Diagnostics{*diagnostic}
+	}
+
+	l := &linter{
+		file:      file,
+		root:      root,
+		templates: make(map[string]*yaml.Node),
+		includes:  lookup(root, "include") != nil,
+	}
+	l.lint()
+	l.diagnostics.Sort()
+	return l.diagnostics
+}
+
+type linter struct {
+	file        string
+	root        *yaml.Node
+	stages      []string
+	templates   map[string]*yaml.Node
+	diagnostics common.Diagnostics
+	// includes tells whether the descriptor includes files, the jobs and
+	// templates of which are not linted.
+	includes bool
+}
+
+func (l *linter) report(node *yaml.Node, severity common.Severity, code, format string, args ...any) {
+	l.diagnostics = append(l.diagnostics, common.Diagnostic{
+		Position: position(l.file, node),
+		Severity: severity,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (l *linter) errorf(node *yaml.Node, code, format string, args ...any) {
+	l.report(node, common.SeverityError, code, format, args...)
+}
+
+func (l *linter) lint() {
+	if l.root.Kind != yaml.MappingNode {
+		l.errorf(l.root, common.InvalidTypeCode, "the descriptor must be a mapping of keywords and jobs")
+		return
+	}
+
+	var jobs []entry
+	for _, e := range entries(l.root) {
+		name := e.key.Value
+		switch {
+		case slices.Contains(globalKeywords, name):
+		case deprecatedGlobalKeywords[name] != "":
+			l.report(e.key, common.SeverityWarning, common.DeprecatedKeywordCode, "the global %s keyword is deprecated, use %s instead", name, deprecatedGlobalKeywords[name])
+		default:
+			// Every other key is a job, hidden ones being templates.
+			l.templates[name] = e.value
+			if !strings.HasPrefix(name, ".") {
+				jobs = append(jobs, e)
+			}
+		}
+	}
+
+	l.lintStages()
+	if variables := lookup(l.root, "variables"); variables != nil {
+		l.lintVariables("the pipeline", variables)
+	}
+	if defaults := lookup(l.root, "default"); defaults != nil {
+		l.lintKeywords("default", defaults, defaultKeywords)
+	}
+
+	for _, job := range jobs {
+		l.lintJob(job.key, job.value)
+	}
+}
+
+func (l *linter) lintStages() {
+	node := lookup(l.root, "stages")
+	if node == nil {
+		node = lookup(l.root, "types")
+	}
+	if node == nil {
+		l.stages = defaultStages
+		return
+	}
+
+	if node.Kind != yaml.SequenceNode {
+		l.errorf(node, common.InvalidTypeCode, "stages must be a list of strings")
+		l.stages = defaultStages
+		return
+	}
+
+	l.stages = []string{".pre"}
+	for _, stage := range node.Content {
+		stage = resolve(stage)
+		if !isString(stage) {
+			l.errorf(stage, common.InvalidTypeCode, "stage names must be strings")
+			continue
+		}
+		l.stages = append(l.stages, stage.Value)
+	}
+	l.stages = append(l.stages, ".post")
+}
+
+// lintKeywords checks that node is a mapping of known keywords, returning
+// its entries.
+func (l *linter) lintKeywords(name string, node *yaml.Node, keywords []string) []entry {
+	if node.Kind != yaml.MappingNode {
+		l.errorf(node, common.InvalidTypeCode, "%s must be a mapping", name)
+		return nil
+	}
+
+	mapping := entries(node)
+	for _, e := range mapping {
+		if !slices.Contains(keywords, e.key.Value) {
+			l.errorf(e.key, common.UnknownKeywordCode, "%s contains the unknown keyword %s%s", name, e.key.Value, suggest(e.key.Value, keywords))
+		}
+	}
+	return mapping
+}
+
+func (l *linter) lintJob(key, node *yaml.Node) {
+	name := key.Value
+	if node.Kind != yaml.MappingNode {
+		l.errorf(key, common.InvalidTypeCode, "job %s must be a mapping of keywords", name)
+		return
+	}
+
+	for _, e := range l.lintKeywords("job "+name, node, jobKeywords) {
+		keyword, value := e.key.Value, e.value
+		switch keyword {
+		case "script", "before_script", "after_script":
+			l.lintScript(fmt.Sprintf("%s of job %s", keyword, name), value)
+		case "stage":
+			if !isString(value) {
+				l.errorf(value, common.InvalidTypeCode, "stage of job %s must be a string", name)
+			}
+		case "when":
+			if !isString(value) || !slices.Contains(whenValues, value.Value) {
+				l.errorf(value, common.InvalidValueCode, "when of job %s must be one of %s", name, strings.Join(whenValues, ", "))
+			}
+		case "timeout":
+			if !isString(value) {
+				l.errorf(value, common.InvalidTypeCode, "timeout of job %s must be a string", name)
+			} else if _, err := parseDuration(value.Value); err != nil {
+				l.errorf(value, common.InvalidValueCode, "timeout of job %s is not a duration: %s", name, err)
+			}
+		case "variables":
+			l.lintVariables("job "+name, value)
+		case "artifacts":
+			l.lintKeywords("artifacts of job "+name, value, artifactsKeywords)
+		case "tags":
+			l.lintStrings("tags of job "+name, value)
+		case "allow_failure":
+			if value.Kind == yaml.ScalarNode && value.Tag != "!!bool" {
+				l.errorf(value, common.InvalidTypeCode, "allow_failure of job %s must be a boolean or a mapping of exit_codes", name)
+			}
+		case "needs":
+			l.lintNeeds(name, value)
+		case "dependencies":
+			l.lintTargets("dependencies of job "+name, value, common.UnknownDependencyCode, false)
+		case "extends":
+			l.lintTargets("extends of job "+name, value, common.UnknownExtendsCode, true)
+		case "only", "except":
+			l.report(e.key, common.SeverityWarning, common.DeprecatedKeywordCode, "%s of job %s is deprecated, use rules instead", keyword, name)
+		}
+	}
+
+	// The keywords the job does not hold may come from the included
+	// templates it extends.
+	if l.extendsIncluded(node, nil) {
+		return
+	}
+
+	stage, stageNode := l.inherited(node, "stage", nil)
+	switch {
+	case stageNode == nil:
+		if !slices.Contains(l.stages, "test") {
+			l.errorf(key, common.UndeclaredStageCode, "job %s runs in the default test stage, which is not declared", name)
+		}
+	case isString(stageNode) && !slices.Contains(l.stages, stage):
+		l.errorf(stageNode, common.UndeclaredStageCode, "job %s uses the undeclared stage %s%s", name, stage, suggest(stage, l.stages))
+	}
+
+	_, script := l.inherited(node, "script", nil)
+	_, trigger := l.inherited(node, "trigger", nil)
+	_, run := l.inherited(node, "run", nil)
+	switch {
+	case script == nil && trigger == nil && run == nil:
+		l.errorf(key, common.MissingScriptCode, "job %s must define a script, a trigger or a run keyword", name)
+	case script == nil:
+		l.report(key, common.SeverityWarning, common.UnsupportedJobCode, "job %s has no script, only GitLab can run it", name)
+	}
+}
+
+// extendsIncluded reports whether the job node extends templates of the
+// included files, directly or through the templates it extends.
+func (l *linter) extendsIncluded(node *yaml.Node, visited []*yaml.Node) bool {
+	if !l.includes || slices.Contains(visited, node) {
+		return false
+	}
+	for _, target := range targetNames(lookup(node, "extends")) {
+		template, found := l.templates[target.Value]
+		if !found || l.extendsIncluded(template, append(visited, node)) {
+			return true
+		}
+	}
+	return false
+}
+
+// inherited returns the value of keyword for the job node, looking for it
+// in the templates it extends when absent.
+func (l *linter) inherited(node *yaml.Node, keyword string, visited []*yaml.Node) (string, *yaml.Node) {
+	if value := lookup(node, keyword); value != nil {
+		return value.Value, value
+	}
+	if slices.Contains(visited, node) {
+		return "", nil
+	}
+	visited = append(visited, node)
+
+	// The last template extended takes precedence.
+	targets := targetNames(lookup(node, "extends"))
+	for i := len(targets) - 1; i >= 0; i-- {
+		if template, found := l.templates[targets[i].Value]; found {
+			if value, valueNode := l.inherited(template, keyword, visited); valueNode != nil {
+				return value, valueNode
+			}
+		}
+	}
+	return "", nil
+}
+
+func (l *linter) lintScript(name string, node *yaml.Node) {
+	switch {
+	case isString(node), isReference(node):
+		return
+	case node.Kind != yaml.SequenceNode:
+		l.errorf(node, common.InvalidTypeCode, "%s must be a string or a list of strings", name)
+		return
+	}
+
+	for _, line := range node.Content {
+		line = resolve(line)
+		switch {
+		case isString(line), isReference(line):
+		case line.Kind == yaml.SequenceNode:
+			// GitLab flattens nested lists, usually coming from anchors.
+			l.lintStrings(name, line)
+		default:
+			l.errorf(line, common.InvalidTypeCode, "%s must only hold strings, got a %s", name, kindName(line))
+		}
+	}
+}
+
+func (l *linter) lintStrings(name string, node *yaml.Node) {
+	if node.Kind != yaml.SequenceNode {
+		l.errorf(node, common.InvalidTypeCode, "%s must be a list of strings", name)
+		return
+	}
+	for _, item := range node.Content {
+		item = resolve(item)
+		if !isString(item) && !isReference(item) {
+			l.errorf(item, common.InvalidTypeCode, "%s must only hold strings, got a %s", name, kindName(item))
+		}
+	}
+}
+
+func (l *linter) lintVariables(owner string, node *yaml.Node) {
+	if node.Kind != yaml.MappingNode {
+		l.errorf(node, common.InvalidTypeCode, "variables of %s must be a mapping", owner)
+		return
+	}
+	for _, e := range entries(node) {
+		switch {
+		case e.value.Kind == yaml.ScalarNode:
+		case e.value.Kind == yaml.MappingNode && lookup(e.value, "value") != nil:
+		case e.value.Kind == yaml.MappingNode && lookup(e.value, "description") != nil:
+		default:
+			l.errorf(e.value, common.InvalidTypeCode, "variable %s of %s must be a string or a mapping with a value", e.key.Value, owner)
+		}
+	}
+}
+
+func (l *linter) lintNeeds(job string, node *yaml.Node) {
+	if node.Kind != yaml.SequenceNode {
+		l.errorf(node, common.InvalidTypeCode, "needs of job %s must be a list", job)
+		return
+	}
+
+	for _, need := range node.Content {
+		need = resolve(need)
+		target, optional := need, false
+		if need.Kind == yaml.MappingNode {
+			// Needs of other pipelines or projects cannot be checked locally.
+			if lookup(need, "pipeline") != nil || lookup(need, "project") != nil {
+				continue
+			}
+			target = lookup(need, "job")
+			if target == nil {
+				l.errorf(need, common.InvalidValueCode, "needs of job %s must name a job", job)
+				continue
+			}
+			if value := lookup(need, "optional"); value != nil && value.Value == "true" {
+				optional = true
+			}
+		}
+
+		if !isString(target) {
+			l.errorf(target, common.InvalidTypeCode, "needs of job %s must be job names", job)
+			continue
+		}
+		if _, found := l.templates[target.Value]; ((!found && !l.includes) || strings.HasPrefix(target.Value, ".")) && !optional {
+			l.errorf(target, common.UnknownNeedsCode, "job %s needs the unknown job %s%s", job, target.Value, suggest(target.Value, l.jobNames()))
+		}
+	}
+}
+
+// lintTargets checks that the names held by node are jobs, or templates if
+// allowed.
+func (l *linter) lintTargets(name string, node *yaml.Node, code string, templates bool) {
+	if !isString(node) && node.Kind != yaml.SequenceNode {
+		l.errorf(node, common.InvalidTypeCode, "%s must be a job name or a list of job names", name)
+		return
+	}
+
+	candidates := l.jobNames()
+	if templates {
+		candidates = l.templateNames()
+	}
+	for _, target := range targetNames(node) {
+		if !isString(target) {
+			l.errorf(target, common.InvalidTypeCode, "%s must only hold job names", name)
+			continue
+		}
+		if !slices.Contains(candidates, target.Value) && !l.includes {
+			l.errorf(target, code, "%s refers to the unknown job %s%s", name, target.Value, suggest(target.Value, candidates))
+		}
+	}
+}
+
+// targetNames returns the names of jobs given as a single string or as a
+// list.
+func targetNames(node *yaml.Node) []*yaml.Node {
+	switch {
+	case node == nil:
+		return nil
+	case node.Kind == yaml.SequenceNode:
+		names := make([]*yaml.Node, 0, len(node.Content))
+		for _, name := range node.Content {
+			names = append(names, resolve(name))
+		}
+		return names
+	default:
+		return []*yaml.Node{node}
+	}
+}
+
+func (l *linter) jobNames() []string {
+	var names []string
+	for name := range l.templates {
+		if !strings.HasPrefix(name, ".") {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (l *linter) templateNames() []string {
+	var names []string
+	for name := range l.templates {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func kindName(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "mapping"
+	case yaml.SequenceNode:
+		return "list"
+	default:
+		if isNull(node) {
+			return "null value"
+		}
+		return "scalar"
+	}
+}
+
+// suggest returns a hint naming the candidate closest to name, if one is
+// close enough to be a typo.
+func suggest(name string, candidates []string) string {
+	best, bestDistance := "", max(2, len(name)/3)+1
+	for _, candidate := range candidates {
+		if distance := levenshtein(name, candidate); distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(", did you mean %s?", best)
+}
+
+func levenshtein(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,90 @@
+package gitlab
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/powerpixel/pipelinefox/parser/common"
+	"github.com/powerpixel/pipelinefox/utils"
+)
+
+type lintExpectation struct {
+	Line     int
+	Column   int
+	Severity common.Severity
+	Code     string
+}
+
+func TestLintReportsLocatedDiagnostics(t *testing.T) {
+	diagnostics := Lint("lint.yaml", []byte(utils.ReadTestFile(t, "testdata/lint.yaml")))
+
+	expected := []lintExpectation{
+		{5, 1, common.SeverityWarning, common.DeprecatedKeywordCode},
+		{19, 3, common.SeverityError, common.UnknownKeywordCode},
+		{23, 10, common.SeverityError, common.UndeclaredStageCode},
+		{25, 5, common.SeverityError, common.InvalidTypeCode},
+		{26, 11, common.SeverityError, common.UnknownNeedsCode},
+		{27, 3, common.SeverityWarning, common.DeprecatedKeywordCode},
+		{30, 1, common.SeverityError, common.MissingScriptCode},
+		{31, 10, common.SeverityError, common.UndeclaredStageCode},
+		{32, 13, common.SeverityError, common.UnknownExtendsCode},
+		{33, 9, common.SeverityError, common.InvalidValueCode},
+		{34, 12, common.SeverityError, common.InvalidValueCode},
+		{37, 1, common.SeverityError, common.MissingScriptCode},
+		{40, 10, common.SeverityError, common.InvalidTypeCode},
+	}
+
+	got := make([]lintExpectation, 0, len(diagnostics))
+	for _, diagnostic := range diagnostics {
+		if diagnostic.File != "lint.yaml" {
+			t.Errorf("unexpected file in %s", diagnostic)
+		}
+		got = append(got, lintExpectation{diagnostic.Line, diagnostic.Column, diagnostic.Severity, diagnostic.Code})
+	}
+	if !slices.Equal(expected, got) {
+		t.Fatalf("unexpected diagnostics\n%s", diagnostics.Error())
+	}
+
+	if !diagnostics.HasErrors() || diagnostics.Err() == nil {
+		t.Fatalf("expected the diagnostics to hold errors")
+	}
+}
+
+func TestLintSuggestsCloseNames(t *testing.T) {
+	diagnostics := Lint("lint.yaml", []byte(utils.ReadTestFile(t, "testdata/lint.yaml")))
+
+	for _, expected := range []string{"did you mean artifacts?", "did you mean test?", "did you mean build?"} {
+		if !slices.ContainsFunc(diagnostics, func(d common.Diagnostic) bool {
+			return strings.HasSuffix(d.Message, expected)
+		}) {
+			t.Errorf("expected a diagnostic ending with %q in\n%s", expected, diagnostics.Error())
+		}
+	}
+}
+
+func TestLintAcceptsValidDescriptors(t *testing.T) {
+	for _, file := range []string{"testdata/simple.yaml", "testdata/timeout.yaml", "testdata/when.yaml", "testdata/reports.yaml", "testdata/extends.yaml", "testdata/include/.gitlab-ci.yml"} {
+		t.Run(file, func(t *testing.T) {
+			if diagnostics := Lint(file, []byte(utils.ReadTestFile(t, file))); len(diagnostics) > 0 {
+				t.Fatalf("expected no diagnostic, got\n%s", diagnostics.Error())
+			}
+		})
+	}
+}
+
+func TestLintWarnsAboutJobsWithoutScript(t *testing.T) {
+	diagnostics := Lint("trigger.yaml", []byte(utils.ReadTestFile(t, "testdata/trigger.yaml")))
+
+	if len(diagnostics) != 1 || diagnostics[0].Code != common.UnsupportedJobCode || diagnostics[0].Line != 9 || diagnostics.HasErrors() {
+		t.Fatalf("expected a warning about the trigger job, got\n%s", diagnostics.Error())
+	}
+}
+
+func TestLintReportsSyntaxErrors(t *testing.T) {
+	diagnostics := Lint("broken.yaml", []byte("stages:\n  - build\njob:\n  script: [echo\n"))
+
+	if len(diagnostics) != 1 || diagnostics[0].Code != common.SyntaxErrorCode || diagnostics[0].Line == 0 {
+		t.Fatalf("expected a located syntax error, got\n%s", diagnostics.Error())
+	}
+}
@@ -0,0 +1,356 @@
+package gitlab
+
+import (
+	"bytes"
+	"cmp"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/powerpixel/pipelinefox/parser/common"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"sigs.k8s.io/yaml/goyaml.v3"
+)
+
+// schemaURL is the location the schema is registered at, the one GitLab
+// publishes it under.
+const schemaURL = "https://gitlab.com/.gitlab-ci.yml"
+
+// embeddedSchema describes the GitLab CI descriptors, so that they are
+// checked without network access. It follows the layout of the JSON schema
+// of the GitLab repository, reduced to the keywords pipelinefox knows about;
+// go generate replaces it with the one of the v17.5.0-ee tag. Another copy
+// can be given with LoadSchema.
+//
+//go:generate curl -fsSL -o schema/ci.json https://gitlab.com/gitlab-org/gitlab/-/raw/v17.5.0-ee/app/assets/javascripts/editor/schema/ci.json
+//go:embed schema/ci.json
+var embeddedSchema []byte
+
+var InvalidSchemaErr = errors.New("invalid JSON schema")
+
+var schemaPrinter = message.NewPrinter(language.English)
+
+// Schema is a compiled GitLab CI JSON schema.
+type Schema struct {
+	schema *jsonschema.Schema
+}
+
+// DefaultSchema returns the schema embedded in pipelinefox.
+var DefaultSchema = sync.OnceValue(func() *Schema {
+	schema, err := LoadSchema(embeddedSchema)
+	if err != nil {
+		panic(err)
+	}
+	return schema
+})
+
+// LoadSchema compiles a GitLab CI JSON schema, such as the ci.json file of
+// the GitLab repository.
+func LoadSchema(content []byte) (*Schema, error) {
+	document, err := jsonschema.UnmarshalJSON(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", InvalidSchemaErr, err)
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.DefaultDraft(jsonschema.Draft7)
+	if err := compiler.AddResource(schemaURL, document); err != nil {
+		return nil, fmt.Errorf("%w: %w", InvalidSchemaErr, err)
+	}
+	schema, err := compiler.Compile(schemaURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", InvalidSchemaErr, err)
+	}
+	return &Schema{schema: schema}, nil
+}
+
+// schemaViolation is a diagnostic about a value of the document, spanning
+// from the line it is reported at to last.
+type schemaViolation struct {
+	common.Diagnostic
+	last int
+}
+
+// Validate checks the GitLab CI descriptor read from file against the
+// schema, each violation being located at the YAML node it is about.
+func (s *Schema) Validate(file string, content []byte) common.Diagnostics {
+	var diagnostics common.Diagnostics
+	for _, violation := range s.validate(file, content) {
+		diagnostics = append(diagnostics, violation.Diagnostic)
+	}
+	return diagnostics
+}
+
+func (s *Schema) validate(file string, content []byte) []schemaViolation {
+	root, diagnostic := parseDocument(file, content)
+	if diagnostic != nil {
+		return []schemaViolation{{Diagnostic: *diagnostic}}
+	}
+
+	err := s.schema.Validate(instance(root))
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return nil
+	}
+
+	var all []schemaViolation
+	for _, violation := range violations(validationErr) {
+		diagnostic := violationDiagnostic(file, root, violation)
+		last := diagnostic.Line
+		// The document as a whole is not a value any lint error is about.
+		if len(violation.InstanceLocation) > 0 {
+			node, _ := locate(root, violation.InstanceLocation)
+			last = max(last, lastLine(node))
+		}
+		all = append(all, schemaViolation{Diagnostic: diagnostic, last: last})
+	}
+	slices.SortFunc(all, func(a, b schemaViolation) int {
+		return cmp.Or(
+			cmp.Compare(a.Line, b.Line),
+			cmp.Compare(a.Column, b.Column),
+			strings.Compare(a.Message, b.Message),
+		)
+	})
+
+	// Nodes merged in several jobs are reported once, for the first of them.
+	var violations []schemaViolation
+	for _, violation := range all {
+		if len(violations) == 0 || violations[len(violations)-1].Position != violation.Position {
+			violations = append(violations, violation)
+		}
+	}
+	return violations
+}
+
+// Check lints the GitLab CI descriptor read from file and validates it
+// against schema, the default one when nil. Schema violations about a value
+// the linter reported an error in are left out, the linter telling more
+// about it.
+func Check(file string, content []byte, schema *Schema) common.Diagnostics {
+	if schema == nil {
+		schema = DefaultSchema()
+	}
+
+	diagnostics := Lint(file, content)
+	if slices.ContainsFunc(diagnostics, func(d common.Diagnostic) bool {
+		return d.Code == common.SyntaxErrorCode
+	}) {
+		return diagnostics
+	}
+
+	var violations []schemaViolation
+	for _, violation := range schema.validate(file, content) {
+		if !slices.ContainsFunc(diagnostics, func(d common.Diagnostic) bool {
+			return d.Severity == common.SeverityError && d.Line >= violation.Line && d.Line <= violation.last
+		}) {
+			violations = append(violations, violation)
+		}
+	}
+	for _, violation := range violations {
+		diagnostics = append(diagnostics, violation.Diagnostic)
+	}
+	diagnostics.Sort()
+	return diagnostics
+}
+
+// instance converts a YAML node to the JSON value it stands for, merge keys
+// being expanded and aliases followed.
+func instance(node *yaml.Node) any {
+	node = resolve(node)
+	switch node.Kind {
+	case yaml.MappingNode:
+		object := make(map[string]any)
+		for _, e := range entries(node) {
+			object[e.key.Value] = instance(e.value)
+		}
+		return object
+	case yaml.SequenceNode:
+		array := make([]any, 0, len(node.Content))
+		for _, item := range node.Content {
+			array = append(array, instance(item))
+		}
+		return array
+	}
+
+	switch node.Tag {
+	case "!!null":
+		return nil
+	case "!!bool":
+		var value bool
+		if node.Decode(&value) == nil {
+			return value
+		}
+	case "!!int", "!!float":
+		var value float64
+		if node.Decode(&value) == nil {
+			return json.Number(fmt.Sprint(value))
+		}
+	}
+	return node.Value
+}
+
+// violations returns the errors to report among the ones of a validation.
+// Of the alternatives of anyOf and oneOf, only the one going the deepest in
+// the document is kept, being most likely the one the author meant.
+func violations(err *jsonschema.ValidationError) []*jsonschema.ValidationError {
+	if len(err.Causes) == 0 {
+		return []*jsonschema.ValidationError{err}
+	}
+
+	switch err.ErrorKind.(type) {
+	case *kind.AnyOf, *kind.OneOf:
+		best := slices.MaxFunc(err.Causes, func(a, b *jsonschema.ValidationError) int {
+			return depth(a) - depth(b)
+		})
+		if depth(best) > len(err.InstanceLocation) {
+			return violations(best)
+		}
+		// When the value has the type of a single alternative, its
+		// errors tell more than the value matching none of them.
+		typed := slices.DeleteFunc(slices.Clone(err.Causes), isTypeError)
+		if len(typed) == 1 {
+			return violations(typed[0])
+		}
+		return []*jsonschema.ValidationError{err}
+	}
+
+	var all []*jsonschema.ValidationError
+	for _, cause := range err.Causes {
+		all = append(all, violations(cause)...)
+	}
+	return all
+}
+
+// isTypeError reports whether err only complains about the type of the
+// value.
+func isTypeError(err *jsonschema.ValidationError) bool {
+	if len(err.Causes) == 0 {
+		_, ok := err.ErrorKind.(*kind.Type)
+		return ok
+	}
+	for _, cause := range err.Causes {
+		if !isTypeError(cause) {
+			return false
+		}
+	}
+	return true
+}
+
+// depth returns the length of the deepest instance location among the
+// errors of err.
+func depth(err *jsonschema.ValidationError) int {
+	deepest := len(err.InstanceLocation)
+	for _, cause := range err.Causes {
+		deepest = max(deepest, depth(cause))
+	}
+	return deepest
+}
+
+func violationDiagnostic(file string, root *yaml.Node, violation *jsonschema.ValidationError) common.Diagnostic {
+	node, key := locate(root, violation.InstanceLocation)
+	message := violation.ErrorKind.LocalizedString(schemaPrinter)
+
+	switch k := violation.ErrorKind.(type) {
+	case *kind.AdditionalProperties:
+		// Point at the first unexpected key rather than at its parent.
+		if e := slices.IndexFunc(entries(node), func(e entry) bool {
+			return slices.Contains(k.Properties, e.key.Value)
+		}); e >= 0 {
+			key = entries(node)[e].key
+		}
+		message = fmt.Sprintf("unexpected keyword %s", strings.Join(quote(k.Properties), ", "))
+	case *kind.AnyOf, *kind.OneOf:
+		message = alternativesMessage(violation.Causes)
+	}
+
+	if len(violation.InstanceLocation) > 0 {
+		message = strings.Join(violation.InstanceLocation, ".") + ": " + message
+	}
+	return common.Diagnostic{
+		Position: position(file, key),
+		Severity: common.SeverityError,
+		Code:     common.SchemaViolationCode,
+		Message:  message,
+	}
+}
+
+// alternativesMessage describes a value matching none of alternatives,
+// summing up their expectations when they all are about types or required
+// keywords.
+func alternativesMessage(alternatives []*jsonschema.ValidationError) string {
+	var got string
+	var want, missing []string
+	for _, alternative := range alternatives {
+		switch k := alternative.ErrorKind.(type) {
+		case *kind.Type:
+			got = k.Got
+			want = append(want, k.Want...)
+		case *kind.Required:
+			missing = append(missing, k.Missing...)
+		default:
+			return "value matches none of the allowed forms"
+		}
+	}
+
+	switch {
+	case len(missing) == 0:
+		slices.Sort(want)
+		return fmt.Sprintf("got %s, want %s", got, strings.Join(slices.Compact(want), " or "))
+	case len(want) == 0:
+		return fmt.Sprintf("missing one of %s", strings.Join(quote(missing), ", "))
+	default:
+		return "value matches none of the allowed forms"
+	}
+}
+
+// locate returns the node at the JSON pointer tokens of location, along
+// with the node to report problems at: the key holding it when there is
+// one.
+func locate(root *yaml.Node, location []string) (node, at *yaml.Node) {
+	node, at = root, root
+	for _, token := range location {
+		switch node.Kind {
+		case yaml.MappingNode:
+			i := slices.IndexFunc(entries(node), func(e entry) bool { return e.key.Value == token })
+			if i < 0 {
+				return node, at
+			}
+			e := entries(node)[i]
+			node, at = e.value, e.key
+		case yaml.SequenceNode:
+			var index int
+			if _, err := fmt.Sscan(token, &index); err != nil || index < 0 || index >= len(node.Content) {
+				return node, at
+			}
+			node = resolve(node.Content[index])
+			at = node
+		default:
+			return node, at
+		}
+	}
+	return node, at
+}
+
+// lastLine returns the last line node and its children are written on.
+func lastLine(node *yaml.Node) int {
+	last := node.Line
+	for _, child := range node.Content {
+		last = max(last, lastLine(child))
+	}
+	return last
+}
+
+func quote(values []string) []string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = "'" + value + "'"
+	}
+	return quoted
+}
@@ -0,0 +1,100 @@
+package gitlab
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/powerpixel/pipelinefox/parser/common"
+	"github.com/powerpixel/pipelinefox/utils"
+)
+
+func TestSchemaLocatesViolations(t *testing.T) {
+	diagnostics := DefaultSchema().Validate("schema.yaml", []byte(utils.ReadTestFile(t, "testdata/schema.yaml")))
+
+	expected := []lintExpectation{
+		{7, 3, common.SeverityError, common.SchemaViolationCode},
+		{12, 3, common.SeverityError, common.SchemaViolationCode},
+		{20, 7, common.SeverityError, common.SchemaViolationCode},
+	}
+
+	got := make([]lintExpectation, 0, len(diagnostics))
+	for _, diagnostic := range diagnostics {
+		got = append(got, lintExpectation{diagnostic.Line, diagnostic.Column, diagnostic.Severity, diagnostic.Code})
+	}
+	if !slices.Equal(expected, got) {
+		t.Fatalf("unexpected diagnostics\n%s", diagnostics.Error())
+	}
+
+	for i, message := range []string{".defaults.retry: maximum: got 5, want 2", "build: unexpected keyword 'artifact'"} {
+		if diagnostics[i].Message != message {
+			t.Errorf("message mismatch, got %q want %q", diagnostics[i].Message, message)
+		}
+	}
+}
+
+func TestSchemaAcceptsValidDescriptors(t *testing.T) {
+	for _, file := range []string{"testdata/simple.yaml", "testdata/timeout.yaml", "testdata/when.yaml", "testdata/reports.yaml"} {
+		if diagnostics := DefaultSchema().Validate(file, []byte(utils.ReadTestFile(t, file))); len(diagnostics) > 0 {
+			t.Errorf("unexpected diagnostics for %s\n%s", file, diagnostics.Error())
+		}
+	}
+}
+
+func TestLoadSchema(t *testing.T) {
+	schema, err := LoadSchema([]byte(`{"type": "object", "properties": {"stages": {"type": "array"}}}`))
+	if err != nil {
+		t.Fatalf("unexpected error : %v", err)
+	}
+
+	diagnostics := schema.Validate("custom.yaml", []byte("stages: build\n"))
+	if len(diagnostics) != 1 || diagnostics[0].Line != 1 || diagnostics[0].Message != "stages: got string, want array" {
+		t.Fatalf("unexpected diagnostics\n%s", diagnostics.Error())
+	}
+
+	if _, err := LoadSchema([]byte(`{"type": `)); !errors.Is(err, InvalidSchemaErr) {
+		t.Fatalf("expected %v, got %v", InvalidSchemaErr, err)
+	}
+}
+
+func TestCheckLeavesOutViolationsReportedByLint(t *testing.T) {
+	diagnostics := Check("lint.yaml", []byte(utils.ReadTestFile(t, "testdata/lint.yaml")), nil)
+
+	lint := Lint("lint.yaml", []byte(utils.ReadTestFile(t, "testdata/lint.yaml")))
+	for _, diagnostic := range lint {
+		if !slices.Contains(diagnostics, diagnostic) {
+			t.Errorf("expected %s to be reported", diagnostic)
+		}
+	}
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Code == common.SchemaViolationCode {
+			t.Errorf("unexpected schema violation %s, already reported by lint", diagnostic)
+		}
+	}
+}
+
+func TestCheckLeavesOutViolationsAboutLintedValues(t *testing.T) {
+	// Like GitLab's schema, this one reports some violations at the job
+	// rather than at the keyword in it the linter reports.
+	schema, err := LoadSchema([]byte(`{
+		"type": "object",
+		"properties": {
+			"build": {"not": {"required": ["script"], "properties": {"script": {"type": "object"}}}},
+			"test": {"properties": {"tags": {"maxItems": 1}}}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error : %v", err)
+	}
+
+	content := "stages: [build]\nbuild:\n  stage: build\n  script:\n    run: tests\ntest:\n  stage: build\n  script: make\n  tags: [a, b]\n"
+	var violations []int
+	for _, diagnostic := range Check("check.yaml", []byte(content), schema) {
+		if diagnostic.Code == common.SchemaViolationCode {
+			violations = append(violations, diagnostic.Line)
+		}
+	}
+	if !slices.Equal(violations, []int{9}) {
+		t.Fatalf("expected a single schema violation at line 9, got %v", violations)
+	}
+}
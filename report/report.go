@@ -0,0 +1,196 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/powerpixel/pipelinefox/junit"
+	"github.com/powerpixel/pipelinefox/runner/common"
+	"github.com/powerpixel/pipelinefox/shell"
+)
+
+// Formats of the pipeline report.
+const (
+	TextFormat  = "text"
+	JSONFormat  = "json"
+	JUnitFormat = "junit"
+)
+
+// logTailLines is the number of log lines attached to failed jobs in JUnit
+// reports.
+const logTailLines = 50
+
+// Pipeline is the machine readable outcome of a pipeline run.
+type Pipeline struct {
+	// RunID identifies the run in the runs store, if it was recorded.
+	RunID      string           `json:"run_id,omitempty"`
+	Status     common.JobStatus `json:"status"`
+	StartedAt  time.Time        `json:"started_at"`
+	FinishedAt time.Time        `json:"finished_at"`
+	// Duration is expressed in seconds, as every duration of the report.
+	Duration float64 `json:"duration"`
+	Stages   []Stage `json:"stages"`
+}
+
+type Stage struct {
+	Name     string           `json:"name"`
+	Status   common.JobStatus `json:"status"`
+	Duration float64          `json:"duration"`
+	Jobs     []Job            `json:"jobs"`
+}
+
+type Job struct {
+	common.JobResult
+	Duration float64 `json:"duration"`
+}
+
+// New builds the report of result, jobs being grouped by stage in the order
+// they were run.
+func New(runID string, result common.PipelineResult) Pipeline {
+	pipeline := Pipeline{
+		RunID:      runID,
+		Status:     result.Status,
+		StartedAt:  result.StartedAt,
+		FinishedAt: result.FinishedAt,
+		Duration:   result.Duration().Seconds(),
+		Stages:     []Stage{},
+	}
+
+	for _, job := range result.Jobs {
+		if len(pipeline.Stages) == 0 || pipeline.Stages[len(pipeline.Stages)-1].Name != job.Stage {
+			pipeline.Stages = append(pipeline.Stages, Stage{Name: job.Stage})
+		}
+		stage := &pipeline.Stages[len(pipeline.Stages)-1]
+		stage.Jobs = append(stage.Jobs, Job{
+			JobResult: job,
+			Duration:  job.Duration().Seconds(),
+		})
+	}
+
+	for i := range pipeline.Stages {
+		pipeline.Stages[i].summarize()
+	}
+	return pipeline
+}
+
+// summarize derives the status and duration of the stage from its jobs, the
+// stage being skipped when none of them ran.
+func (s *Stage) summarize() {
+	var startedAt, finishedAt time.Time
+	s.Status = common.JobStatusSkipped
+
+	for _, job := range s.Jobs {
+		switch {
+		case job.Status == common.JobStatusFailed:
+			s.Status = common.JobStatusFailed
+		case job.Status == common.JobStatusCanceled && s.Status != common.JobStatusFailed:
+			s.Status = common.JobStatusCanceled
+		case job.Status == common.JobStatusSuccess && s.Status == common.JobStatusSkipped:
+			s.Status = common.JobStatusSuccess
+		}
+
+		if job.StartedAt.IsZero() {
+			continue
+		}
+		if startedAt.IsZero() || job.StartedAt.Before(startedAt) {
+			startedAt = job.StartedAt
+		}
+		if job.FinishedAt.After(finishedAt) {
+			finishedAt = job.FinishedAt
+		}
+	}
+
+	if !startedAt.IsZero() && !finishedAt.IsZero() {
+		s.Duration = finishedAt.Sub(startedAt).Seconds()
+	}
+}
+
+// Write writes the report of result to w in format. The text format writes
+// nothing, the outcome being printed by the user interface.
+func Write(w io.Writer, format, runID string, result common.PipelineResult) error {
+	switch format {
+	case TextFormat:
+		return nil
+	case JSONFormat:
+		return WriteJSON(w, New(runID, result))
+	case JUnitFormat:
+		return WriteJUnit(w, New(runID, result))
+	default:
+		return fmt.Errorf("unknown output format %s, expected text, json or junit", format)
+	}
+}
+
+func WriteJSON(w io.Writer, pipeline Pipeline) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(pipeline)
+}
+
+// WriteJUnit writes the pipeline as a JUnit report, with a test suite per
+// stage and a test case per job. Failed jobs hold the end of their log.
+func WriteJUnit(w io.Writer, pipeline Pipeline) error {
+	var suites []junit.TestSuite
+
+	for _, stage := range pipeline.Stages {
+		suite := junit.TestSuite{
+			Name:      stage.Name,
+			Timestamp: timestamp(pipeline.StartedAt),
+		}
+		for _, job := range stage.Jobs {
+			suite.Cases = append(suite.Cases, testCase(job))
+		}
+		suites = append(suites, suite)
+	}
+
+	return junit.Merge("pipelinefox", junit.TestSuites{Suites: suites}).Write(w)
+}
+
+func testCase(job Job) junit.TestCase {
+	testCase := junit.TestCase{
+		Name:      job.Name,
+		Classname: job.Stage,
+		File:      job.LogPath,
+		Time:      job.Duration,
+	}
+
+	outcome := &junit.Outcome{
+		Message: job.Reason,
+		Type:    string(job.Status),
+	}
+	switch job.Status {
+	case common.JobStatusFailed:
+		outcome.Text = logTail(job.LogPath, logTailLines)
+		testCase.Failure = outcome
+	case common.JobStatusCanceled:
+		testCase.Error = outcome
+	case common.JobStatusSkipped, common.JobStatusManual, common.JobStatusCreated:
+		testCase.Skipped = outcome
+	}
+	return testCase
+}
+
+// logTail returns the last lines of the log at path, without section
+// markers nor command echoes. Unreadable logs are reported as empty.
+func logTail(path string, lines int) string {
+	if path == "" {
+		return ""
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	all := strings.Split(strings.TrimRight(shell.PlainTrace(string(content)), "\n"), "\n")
+	return strings.Join(all[max(0, len(all)-lines):], "\n")
+}
+
+func timestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
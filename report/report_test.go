@@ -0,0 +1,171 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/powerpixel/pipelinefox/junit"
+	parserCommon "github.com/powerpixel/pipelinefox/parser/common"
+	"github.com/powerpixel/pipelinefox/runner/common"
+)
+
+func TestReportGroupsJobsByStage(t *testing.T) {
+	pipeline := New("run-1", newTestResult(t))
+
+	if pipeline.Status != common.JobStatusFailed || pipeline.Duration != 10 {
+		t.Fatalf("unexpected pipeline %+v", pipeline)
+	}
+
+	expected := map[string]common.JobStatus{
+		"build":  common.JobStatusSuccess,
+		"test":   common.JobStatusFailed,
+		"deploy": common.JobStatusSkipped,
+	}
+	if len(pipeline.Stages) != len(expected) {
+		t.Fatalf("unexpected stages %+v", pipeline.Stages)
+	}
+	for _, stage := range pipeline.Stages {
+		if stage.Status != expected[stage.Name] {
+			t.Errorf("expected stage %s to be %s, got %s", stage.Name, expected[stage.Name], stage.Status)
+		}
+	}
+	if pipeline.Stages[1].Duration != 6 || len(pipeline.Stages[1].Jobs) != 2 {
+		t.Errorf("unexpected test stage %+v", pipeline.Stages[1])
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var out bytes.Buffer
+	if err := Write(&out, JSONFormat, "run-1", newTestResult(t)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var decoded struct {
+		RunID  string `json:"run_id"`
+		Stages []struct {
+			Jobs []map[string]any `json:"jobs"`
+		} `json:"stages"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("unexpected error: %s\n%s", err, out.String())
+	}
+
+	job := decoded.Stages[1].Jobs[0]
+	if decoded.RunID != "run-1" || job["name"] != "unit_tests" || job["exit_code"] != 2.0 || job["duration"] != 4.0 {
+		t.Fatalf("unexpected report\n%s", out.String())
+	}
+	if job["reason"] != "script exited with status 2" || job["log_path"] == "" {
+		t.Fatalf("unexpected report\n%s", out.String())
+	}
+}
+
+func TestWriteJUnitTreatsJobsAsTestCases(t *testing.T) {
+	var out bytes.Buffer
+	if err := Write(&out, JUnitFormat, "", newTestResult(t)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	report, err := junit.Parse(&out)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if report.Tests != 4 || report.Failures != 1 || report.Skipped != 1 {
+		t.Fatalf("unexpected counts %+v", report)
+	}
+
+	failed := report.FailedCases()
+	if len(failed) != 1 || failed[0].Name != "unit_tests" || failed[0].Classname != "test" {
+		t.Fatalf("unexpected failed cases %+v", failed)
+	}
+	if text := failed[0].Failure.Text; text != "FAIL TestParse" {
+		t.Fatalf("expected the end of the log without echoes, got %q", text)
+	}
+}
+
+func TestWriteRejectsUnknownFormat(t *testing.T) {
+	if err := Write(new(bytes.Buffer), "yaml", "", common.PipelineResult{}); err == nil {
+		t.Fatalf("expected an error")
+	}
+}
+
+func TestLogTailKeepsLastLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "job.log")
+	if err := os.WriteFile(path, []byte(strings.Repeat("line\n", 60)+"last\n"), 0o644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	tail := strings.Split(logTail(path, 3), "\n")
+	if len(tail) != 3 || tail[2] != "last" {
+		t.Fatalf("unexpected tail %q", tail)
+	}
+}
+
+func TestWriteSARIF(t *testing.T) {
+	diagnostics := parserCommon.Diagnostics{
+		{
+			Position: parserCommon.Position{File: ".gitlab-ci.yml", Line: 12, Column: 3},
+			Severity: parserCommon.SeverityError,
+			Code:     parserCommon.UnknownKeywordCode,
+			Message:  "job build contains the unknown keyword artifact",
+		},
+		{
+			Position: parserCommon.Position{File: ".gitlab-ci.yml"},
+			Severity: parserCommon.SeverityWarning,
+			Code:     parserCommon.DeprecatedKeywordCode,
+			Message:  "the global image keyword is deprecated",
+		},
+	}
+
+	var out bytes.Buffer
+	if err := WriteSARIF(&out, diagnostics); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(out.Bytes(), &log); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	results := log.Runs[0].Results
+	if log.Version != "2.1.0" || len(log.Runs[0].Tool.Driver.Rules) != 2 || len(results) != 2 {
+		t.Fatalf("unexpected log\n%s", out.String())
+	}
+	location := results[0].Locations[0].PhysicalLocation
+	if results[0].Level != "error" || location.ArtifactLocation.URI != ".gitlab-ci.yml" || location.Region.StartLine != 12 {
+		t.Fatalf("unexpected result %+v", results[0])
+	}
+	if results[1].Level != "warning" || results[1].Locations[0].PhysicalLocation.Region != nil {
+		t.Fatalf("unexpected result %+v", results[1])
+	}
+}
+
+func newTestResult(t testing.TB) common.PipelineResult {
+	t.Helper()
+
+	logPath := filepath.Join(t.TempDir(), "unit_tests.log")
+	log := "\x1b[32;1m$ go test ./...\x1b[0;m\nFAIL TestParse\n"
+	if err := os.WriteFile(logPath, []byte(log), 0o644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(seconds int) time.Time {
+		return start.Add(time.Duration(seconds) * time.Second)
+	}
+
+	return common.PipelineResult{
+		Status:     common.JobStatusFailed,
+		StartedAt:  start,
+		FinishedAt: at(10),
+		Jobs: []common.JobResult{
+			{Name: "build_app", Stage: "build", Status: common.JobStatusSuccess, StartedAt: at(0), FinishedAt: at(3)},
+			{Name: "unit_tests", Stage: "test", Status: common.JobStatusFailed, ExitCode: 2, StartedAt: at(3), FinishedAt: at(7), LogPath: logPath, Reason: "script exited with status 2"},
+			{Name: "lint", Stage: "test", Status: common.JobStatusSuccess, StartedAt: at(7), FinishedAt: at(9)},
+			{Name: "deploy_app", Stage: "deploy", Status: common.JobStatusSkipped, Reason: "a job of a previous stage failed"},
+		},
+	}
+}
@@ -0,0 +1,124 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"slices"
+
+	parserCommon "github.com/powerpixel/pipelinefox/parser/common"
+)
+
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+	toolName     = "pipelinefox"
+	toolURI      = "https://github.com/powerpixel/pipelinefox"
+)
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID string `json:"id"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// WriteSARIF writes diagnostics as a SARIF 2.1.0 log, the format read by
+// code scanning tools.
+func WriteSARIF(w io.Writer, diagnostics parserCommon.Diagnostics) error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           toolName,
+			InformationURI: toolURI,
+			Rules:          []sarifRule{},
+		}},
+		Results: []sarifResult{},
+	}
+
+	var rules []string
+	for _, diagnostic := range diagnostics {
+		if !slices.Contains(rules, diagnostic.Code) {
+			rules = append(rules, diagnostic.Code)
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: diagnostic.Code})
+		}
+
+		location := sarifPhysicalLocation{
+			ArtifactLocation: sarifArtifactLocation{URI: diagnostic.File},
+		}
+		if diagnostic.Line > 0 {
+			location.Region = &sarifRegion{StartLine: diagnostic.Line, StartColumn: diagnostic.Column}
+		}
+
+		run.Results = append(run.Results, sarifResult{
+			RuleID:    diagnostic.Code,
+			Level:     sarifLevel(diagnostic.Severity),
+			Message:   sarifMessage{Text: diagnostic.Message},
+			Locations: []sarifLocation{{PhysicalLocation: location}},
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs:    []sarifRun{run},
+	})
+}
+
+func sarifLevel(severity parserCommon.Severity) string {
+	switch severity {
+	case parserCommon.SeverityError:
+		return "error"
+	case parserCommon.SeverityWarning:
+		return "warning"
+	default:
+		return "note"
+	}
+}
@@ -0,0 +1,104 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/powerpixel/pipelinefox/parser/common"
+)
+
+// JobCache holds the results of jobs by a key derived from everything they
+// depend on, for unchanged jobs to be restored instead of run again.
+type JobCache interface {
+	// Key returns the key of job, run in environment once the jobs of
+	// upstream, whose artifacts it receives, are over.
+	Key(ctx context.Context, job common.PipelineJobDescriptor, environment string, upstream []JobResult) (string, error)
+	// Restore returns the result stored under key, its logs and artifacts
+	// being copied into the directories of options. found is false when the
+	// cache holds no result for key.
+	Restore(key string, options RunnerOptions) (result JobResult, found bool, err error)
+	// Save stores result, whose logs and artifacts are in the directories
+	// of options, under key.
+	Save(key string, options RunnerOptions, result JobResult) error
+}
+
+// JobEnvironment returns what identifies the environment job runs in, such
+// as the digest of its image, for results to be reused in the same one only.
+// It returns as well the function running job in that very environment, nil
+// when the job function of the runner does.
+type JobEnvironment func(ctx context.Context, job common.PipelineJobDescriptor) (string, JobFunc, error)
+
+// runCachedJob restores the result of job from the options cache when it
+// holds one, and otherwise runs job through runJob, caching its result when
+// it succeeds. Problems with the cache are reported as warnings, the job
+// being run then.
+func runCachedJob(ctx context.Context, options RunnerOptions, environment JobEnvironment, upstream []JobResult, stdout, stderr io.Writer, job common.PipelineJobDescriptor, runJob JobFunc) (JobResult, error) {
+	if options.JobCache == nil {
+		return runJob(ctx, stdout, stderr, job)
+	}
+
+	warn := func(format string, args ...any) {
+		options.Events.Publish(Warning{
+			Time:    time.Now(),
+			Job:     job.GetName(),
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	prepared := options.PrepareJob(job)
+	env := ""
+	if environment != nil {
+		var runInEnvironment JobFunc
+		var err error
+		if env, runInEnvironment, err = environment(ctx, prepared); err != nil {
+			warn("job is not cached, its environment is unknown: %s", err)
+			return runJob(ctx, stdout, stderr, job)
+		}
+		if runInEnvironment != nil {
+			runJob = runInEnvironment
+		}
+	}
+
+	key, err := options.JobCache.Key(ctx, prepared, env, upstream)
+	if err != nil {
+		warn("job is not cached, its cache key could not be computed: %s", err)
+		return runJob(ctx, stdout, stderr, job)
+	}
+
+	cached, found, err := options.JobCache.Restore(key, options)
+	if err != nil {
+		warn("could not restore the job from the cache: %s", err)
+	}
+	if found && err == nil {
+		options.Events.Publish(JobFinished{Time: time.Now(), Result: cached})
+		return cached, nil
+	}
+
+	result, err := runJob(ctx, stdout, stderr, job)
+	if err == nil && result.Status == JobStatusSuccess {
+		if err := options.JobCache.Save(key, options, result); err != nil {
+			warn("could not cache the job result: %s", err)
+		}
+	}
+	return result, err
+}
+
+// upstreamResults returns the results of the jobs whose artifacts job
+// receives: the ones it needs, or else the ones of the previous stages.
+func upstreamResults(job common.PipelineJobDescriptor, previous []JobResult) []JobResult {
+	needs := job.GetNeeds()
+	if needs == nil {
+		return slices.Clone(previous)
+	}
+
+	var upstream []JobResult
+	for _, result := range previous {
+		if slices.ContainsFunc(needs, func(need common.Need) bool { return need.Job == result.Name }) {
+			upstream = append(upstream, result)
+		}
+	}
+	return upstream
+}
@@ -0,0 +1,54 @@
+package common
+
+import (
+	"context"
+	"time"
+)
+
+// AfterScriptTimeout bounds the time spent running after_script once a job
+// is over, the same default GitLab runner applies.
+const AfterScriptTimeout = 5 * time.Minute
+
+// StopGracePeriod is the time given to job processes to exit after being
+// asked to stop before they are killed.
+const StopGracePeriod = 10 * time.Second
+
+type killContextKey struct{}
+
+// WithKill attaches kill to ctx. Cancelling kill means the user asked for a
+// forced stop: graceful cleanup steps are skipped, only resources are removed.
+func WithKill(ctx, kill context.Context) context.Context {
+	return context.WithValue(ctx, killContextKey{}, kill)
+}
+
+// GracefulContext returns a context suited to cleanup work such as running
+// after_script or stopping processes. It outlives the cancellation of ctx but
+// is cancelled after timeout or when a forced stop is requested.
+func GracefulContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	graceful, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+
+	kill, ok := ctx.Value(killContextKey{}).(context.Context)
+	if !ok {
+		return graceful, cancel
+	}
+
+	stop := context.AfterFunc(kill, cancel)
+	return graceful, func() {
+		stop()
+		cancel()
+	}
+}
+
+// CleanupContext returns a context used to release resources (containers,
+// networks, directories). It is never cancelled by the user.
+func CleanupContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+}
+
+// JobContext applies the job timeout to ctx, if any.
+func JobContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
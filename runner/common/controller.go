@@ -0,0 +1,55 @@
+package common
+
+import (
+	"context"
+	"sync"
+)
+
+// JobController lets callers cancel single jobs while a pipeline runs. A nil
+// controller is valid and ignores every job.
+type JobController struct {
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+}
+
+func NewJobController() *JobController {
+	return &JobController{
+		cancels: make(map[string]context.CancelFunc),
+	}
+}
+
+// Cancel stops the job named name, reporting whether it was running.
+func (c *JobController) Cancel(name string) bool {
+	if c == nil {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cancel, found := c.cancels[name]
+	if found {
+		cancel()
+	}
+	return found
+}
+
+// track derives a cancelable context for the job named name. The returned
+// function must be called once the job is over.
+func (c *JobController) track(ctx context.Context, name string) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	if c == nil {
+		return ctx, cancel
+	}
+
+	c.mu.Lock()
+	c.cancels[name] = cancel
+	c.mu.Unlock()
+
+	return ctx, func() {
+		c.mu.Lock()
+		delete(c.cancels, name)
+		c.mu.Unlock()
+		cancel()
+	}
+}
@@ -0,0 +1,154 @@
+package common
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// Event is published on an EventBus while pipelines run.
+type Event interface {
+	Timestamp() time.Time
+}
+
+type PipelineStarted struct {
+	Time   time.Time
+	Stages []string
+	Jobs   int
+}
+
+type StageStarted struct {
+	Time  time.Time
+	Stage string
+}
+
+// ImagePulling reports the progress of an image pull, one event being sent
+// per message of the registry stream.
+type ImagePulling struct {
+	Time    time.Time
+	Job     string
+	Image   string
+	Layer   string
+	Status  string
+	Current int64
+	Total   int64
+}
+
+type JobStarted struct {
+	Time  time.Time
+	Job   string
+	Stage string
+}
+
+type Stream string
+
+const (
+	Stdout Stream = "stdout"
+	Stderr Stream = "stderr"
+)
+
+// LogLine is a line written by a job, without its trailing newline.
+type LogLine struct {
+	Time   time.Time
+	Job    string
+	Stream Stream
+	Line   string
+}
+
+type JobFinished struct {
+	Time   time.Time
+	Result JobResult
+}
+
+type ArtifactUploaded struct {
+	Time time.Time
+	Job  string
+	Path string
+	Size int64
+}
+
+// Warning reports a non fatal problem met while running a job.
+type Warning struct {
+	Time    time.Time
+	Job     string
+	Message string
+}
+
+// ContainerKept reports the container of a failed job kept for debugging,
+// along with the commands opening a shell in it and removing it.
+type ContainerKept struct {
+	Time      time.Time
+	Job       string
+	Container string
+	Shell     string
+	Cleanup   []string
+}
+
+type PipelineFinished struct {
+	Time   time.Time
+	Result PipelineResult
+}
+
+func (e PipelineStarted) Timestamp() time.Time  { return e.Time }
+func (e StageStarted) Timestamp() time.Time     { return e.Time }
+func (e ImagePulling) Timestamp() time.Time     { return e.Time }
+func (e JobStarted) Timestamp() time.Time       { return e.Time }
+func (e LogLine) Timestamp() time.Time          { return e.Time }
+func (e JobFinished) Timestamp() time.Time      { return e.Time }
+func (e ArtifactUploaded) Timestamp() time.Time { return e.Time }
+func (e Warning) Timestamp() time.Time          { return e.Time }
+func (e ContainerKept) Timestamp() time.Time    { return e.Time }
+func (e PipelineFinished) Timestamp() time.Time { return e.Time }
+
+// Subscriber receives the events published on a bus. Events are delivered
+// one at a time, in publication order, so subscribers need no locking but
+// must not block nor publish themselves.
+type Subscriber func(Event)
+
+// EventBus dispatches pipeline events to its subscribers. A nil bus is valid
+// and drops every event.
+type EventBus struct {
+	mu          sync.Mutex
+	nextId      int
+	subscribers []subscription
+}
+
+type subscription struct {
+	id         int
+	subscriber Subscriber
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+// Subscribe registers s and returns a function removing it from the bus.
+func (b *EventBus) Subscribe(s Subscriber) (unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextId
+	b.nextId++
+	b.subscribers = append(b.subscribers, subscription{id, s})
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.subscribers = slices.DeleteFunc(b.subscribers, func(sub subscription) bool {
+			return sub.id == id
+		})
+	}
+}
+
+func (b *EventBus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, sub := range b.subscribers {
+		sub.subscriber(e)
+	}
+}
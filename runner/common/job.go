@@ -0,0 +1,171 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/powerpixel/pipelinefox/parser/common"
+	"github.com/powerpixel/pipelinefox/shell"
+)
+
+// RunnerOptions holds the settings shared by every runner.
+type RunnerOptions struct {
+	// Events receives the events of the pipelines and jobs being run.
+	Events *EventBus
+	// Controller allows to cancel jobs individually.
+	Controller *JobController
+	// LogDir is the directory where the output of every job is persisted,
+	// see JobLogPath. Logs are not persisted when empty.
+	LogDir string
+	// ArtifactDir is the directory where the files collected from jobs are
+	// stored, see ArtifactPath. JUnit reports and artifacts:paths files are
+	// not collected when empty.
+	ArtifactDir string
+	// Variables are given to every job, taking precedence over the ones of
+	// the descriptor as the CI/CD variables of a GitLab project do.
+	Variables map[string]string
+	// Secrets are given to every job after the variables, the masked ones
+	// being redacted from the job logs.
+	Secrets []Secret
+	// Concurrency is the maximum number of jobs of a stage run at once, jobs
+	// being run one at a time when lower than 2. The writers given to the
+	// runner must then be safe for concurrent use.
+	Concurrency int
+	// Restored holds the results of jobs left out of the pipeline but needed
+	// by its jobs, reused from a previous run. They are reported along with
+	// the jobs run, and their dotenv variables are passed on.
+	Restored []JobResult
+	// JobCache restores the jobs it holds the result of instead of running
+	// them. Every job is run when nil.
+	JobCache JobCache
+	// Step pauses the scripts of jobs before their commands, see
+	// NewStepWriter. Scripts run straight when nil.
+	Step *Stepper
+	// Shell is the name of the shell of the jobs selecting none, see
+	// JobShell. The runners detect it when empty.
+	Shell string
+	// Shells holds the custom shells jobs may select along with the
+	// built-in ones.
+	Shells shell.Shells
+	// Rules is the context the rules of jobs are evaluated in, the jobs they
+	// leave out being skipped and the others run with the when and variables
+	// of the rule which applied. Rules are not evaluated when nil.
+	Rules *common.RuleContext
+}
+
+// ObserveJob runs job through run, publishing its start and end on the
+// options bus as well as every line it writes to stdout and stderr. The
+// context given to run can be canceled through the options controller.
+func ObserveJob(ctx context.Context, options RunnerOptions, job common.PipelineJobDescriptor, stdout, stderr io.Writer, run func(ctx context.Context, stdout, stderr io.Writer) (JobResult, error)) (JobResult, error) {
+	bus := options.Events
+
+	ctx, done := options.Controller.track(ctx, job.GetName())
+	defer done()
+
+	bus.Publish(JobStarted{
+		Time:  time.Now(),
+		Job:   job.GetName(),
+		Stage: job.GetStage(),
+	})
+
+	var logs *jobLogs
+	if options.LogDir != "" {
+		var err error
+		logs, err = createJobLogs(options.LogDir, job.GetName())
+		if err != nil {
+			bus.Publish(Warning{
+				Time:    time.Now(),
+				Job:     job.GetName(),
+				Message: fmt.Sprintf("could not persist the job logs: %s", err),
+			})
+		} else {
+			stdout = logs.tee(Stdout, stdout)
+			stderr = logs.tee(Stderr, stderr)
+		}
+	}
+
+	outWriter := newLineWriter(bus, job.GetName(), Stdout, stdout)
+	errWriter := newLineWriter(bus, job.GetName(), Stderr, stderr)
+
+	// Masked values are redacted before anything is published or persisted.
+	var jobOut, jobErr io.Writer = outWriter, errWriter
+	var redactors []*RedactWriter
+	if values := options.maskedValues(); len(values) > 0 {
+		redactors = []*RedactWriter{NewRedactWriter(outWriter, values), NewRedactWriter(errWriter, values)}
+		jobOut, jobErr = redactors[0], redactors[1]
+	}
+
+	result, err := run(ctx, jobOut, jobErr)
+
+	for _, redactor := range redactors {
+		redactor.Flush()
+	}
+	outWriter.Flush()
+	errWriter.Flush()
+
+	if logs != nil {
+		logs.Close()
+		result.LogPath = JobLogPath(options.LogDir, job.GetName(), "")
+	}
+
+	bus.Publish(JobFinished{
+		Time:   time.Now(),
+		Result: result,
+	})
+
+	return result, err
+}
+
+// lineWriter forwards writes to w and publishes every complete line on bus.
+type lineWriter struct {
+	bus    *EventBus
+	job    string
+	stream Stream
+	w      io.Writer
+	buf    []byte
+}
+
+func newLineWriter(bus *EventBus, job string, stream Stream, w io.Writer) *lineWriter {
+	return &lineWriter{
+		bus:    bus,
+		job:    job,
+		stream: stream,
+		w:      w,
+	}
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	n, err := l.w.Write(p)
+
+	l.buf = append(l.buf, p[:n]...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
+		}
+		l.publish(l.buf[:i])
+		l.buf = l.buf[i+1:]
+	}
+
+	return n, err
+}
+
+// Flush publishes the last line if it was not terminated by a newline.
+func (l *lineWriter) Flush() {
+	if len(l.buf) > 0 {
+		l.publish(l.buf)
+		l.buf = nil
+	}
+}
+
+func (l *lineWriter) publish(line []byte) {
+	l.bus.Publish(LogLine{
+		Time:   time.Now(),
+		Job:    l.job,
+		Stream: l.stream,
+		Line:   string(line),
+	})
+}
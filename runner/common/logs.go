@@ -0,0 +1,109 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// FileName returns name with the bytes other than letters, digits, _ and -
+// escaped as %XX, so that distinct names get distinct file names.
+func FileName(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_' || c == '-' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// JobLogPath returns the path of the log file of job in dir. The file holds
+// both streams when stream is empty, only the given stream otherwise.
+func JobLogPath(dir, job string, stream Stream) string {
+	name := FileName(job)
+	if stream != "" {
+		name += "." + string(stream)
+	}
+	return filepath.Join(dir, name+".log")
+}
+
+// jobLogs persists the output of a job, once combined and once per stream.
+type jobLogs struct {
+	mu       sync.Mutex
+	combined *os.File
+	stdout   *os.File
+	stderr   *os.File
+}
+
+// createJobLogs truncates the log files of job in dir, which is created if
+// needed.
+func createJobLogs(dir, job string) (*jobLogs, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	logs := &jobLogs{}
+	files := []struct {
+		file   **os.File
+		stream Stream
+	}{
+		{&logs.combined, ""},
+		{&logs.stdout, Stdout},
+		{&logs.stderr, Stderr},
+	}
+	for _, f := range files {
+		file, err := os.Create(JobLogPath(dir, job, f.stream))
+		if err != nil {
+			logs.Close()
+			return nil, err
+		}
+		*f.file = file
+	}
+
+	return logs, nil
+}
+
+// tee returns a writer copying everything written to w into the log of
+// stream and the combined log.
+func (l *jobLogs) tee(stream Stream, w io.Writer) io.Writer {
+	file := l.stdout
+	if stream == Stderr {
+		file = l.stderr
+	}
+	return &logWriter{logs: l, file: file, w: w}
+}
+
+func (l *jobLogs) Close() error {
+	var errs []error
+	for _, file := range []*os.File{l.combined, l.stdout, l.stderr} {
+		if file != nil {
+			errs = append(errs, file.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type logWriter struct {
+	logs *jobLogs
+	file *os.File
+	w    io.Writer
+}
+
+// Write forwards p to the wrapped writer, log failures being ignored so that
+// a full disk does not fail the job.
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.logs.mu.Lock()
+	w.logs.combined.Write(p)
+	w.file.Write(p)
+	w.logs.mu.Unlock()
+
+	return w.w.Write(p)
+}
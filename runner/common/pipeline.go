@@ -0,0 +1,218 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/powerpixel/pipelinefox/parser/common"
+)
+
+// JobFunc runs a single job, usually the RunPipelineJob method of a runner.
+type JobFunc func(ctx context.Context, stdout, stderr io.Writer, job common.PipelineJobDescriptor) (JobResult, error)
+
+// RunStages runs the stages of pipeline in order, each job of a stage through
+// runJob. Jobs run according to their rules, evaluated in the options rules
+// context, and their when condition: once a job failed, the
+// on_success jobs of the following stages are skipped, and manual jobs wait
+// to be triggered. Once ctx is canceled the remaining jobs are marked as
+// canceled. The variables of the dotenv reports of a stage are given to the
+// jobs of the following ones, and the artifacts:paths files of the jobs they
+// depend on are written in their working directory. Up to the options
+// concurrency jobs of a stage run at once. Jobs whose result the options cache holds for the same
+// definition, environment, inputs and upstream artifacts are restored rather
+// than run. The progress of the pipeline is published on the options bus.
+func RunStages(ctx context.Context, options RunnerOptions, stdout, stderr io.Writer, pipeline common.PipelineDescriptor, runJob JobFunc, environment JobEnvironment) (PipelineResult, error) {
+	bus := options.Events
+	result := PipelineResult{
+		StartedAt: time.Now(),
+	}
+	var errs []error
+	failed := false
+
+	bus.Publish(PipelineStarted{
+		Time:   result.StartedAt,
+		Stages: pipeline.GetStageNames(),
+		Jobs:   len(pipeline.GetJobs()) + len(options.Restored),
+	})
+
+	skip := func(job common.PipelineJobDescriptor, status JobStatus, reason string) JobResult {
+		jobResult := NewSkippedJobResult(job, status, reason)
+		bus.Publish(JobFinished{Time: time.Now(), Result: jobResult})
+		return jobResult
+	}
+
+	// Variables of the dotenv reports are passed to the following stages.
+	// Restored jobs being needed by the ones run, theirs are known upfront.
+	dotenv := make(map[string]string)
+	for _, restored := range options.Restored {
+		maps.Copy(dotenv, restored.Dotenv)
+	}
+
+	for _, stage := range pipeline.GetStageNames() {
+		for _, restored := range options.Restored {
+			if restored.Stage == stage {
+				result.Jobs = append(result.Jobs, restored)
+				bus.Publish(JobFinished{Time: time.Now(), Result: restored})
+			}
+		}
+
+		jobs := pipeline.GetStages()[stage]
+		if len(jobs) == 0 {
+			continue
+		}
+
+		if ctx.Err() == nil {
+			bus.Publish(StageStarted{Time: time.Now(), Stage: stage})
+		}
+
+		// Jobs of the stage run up to the concurrency at once, their results
+		// being kept in declaration order.
+		results := make([]JobResult, len(jobs))
+		slots := make(chan struct{}, max(options.Concurrency, 1))
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		previous := slices.Clone(result.Jobs)
+
+		for i, job := range jobs {
+			slots <- struct{}{}
+
+			if ctx.Err() != nil {
+				results[i] = skip(job, JobStatusCanceled, "pipeline was canceled")
+				<-slots
+				continue
+			}
+
+			job, reason, err := applyRules(job, options.Rules)
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+			if reason != "" {
+				results[i] = skip(job, JobStatusSkipped, reason)
+				<-slots
+				continue
+			}
+
+			if status, reason, run := shouldRun(job, failed); !run {
+				results[i] = skip(job, status, reason)
+				<-slots
+				continue
+			}
+
+			if len(dotenv) > 0 {
+				job = job.WithVariables(dotenv)
+			}
+			if received := receivedArtifacts(job, previous); len(received) > 0 {
+				job = job.WithReceivedArtifacts(received)
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-slots }()
+
+				jobResult, err := runCachedJob(ctx, options, environment, upstreamResults(job, previous), stdout, stderr, job, runJob)
+				if err != nil {
+					mu.Lock()
+					errs = append(errs, fmt.Errorf("job %s: %w", job.GetName(), err))
+					mu.Unlock()
+				}
+				results[i] = jobResult
+			}()
+		}
+		wg.Wait()
+		result.Jobs = append(result.Jobs, results...)
+
+		for _, job := range result.Jobs {
+			if job.Stage != stage {
+				continue
+			}
+			if job.Status == JobStatusFailed {
+				failed = true
+			}
+			maps.Copy(dotenv, job.Dotenv)
+		}
+	}
+
+	result.FinishedAt = time.Now()
+	result.updateStatus()
+
+	bus.Publish(PipelineFinished{
+		Time:   result.FinishedAt,
+		Result: result,
+	})
+
+	return result, errors.Join(errs...)
+}
+
+// receivedArtifacts returns the artifacts:paths files job receives from the
+// jobs of previous, by their path in its working directory: the ones of the
+// jobs it needs with their artifacts, and of its dependencies when it lists
+// them. The files of later jobs replace the ones of earlier jobs.
+func receivedArtifacts(job common.PipelineJobDescriptor, previous []JobResult) map[string]string {
+	received := make(map[string]string)
+	for _, upstream := range upstreamResults(job, previous) {
+		i := slices.IndexFunc(job.GetNeeds(), func(need common.Need) bool { return need.Job == upstream.Name })
+		if i >= 0 && !job.GetNeeds()[i].Artifacts {
+			continue
+		}
+		if dependencies := job.GetDependencies(); dependencies != nil && !slices.Contains(dependencies, upstream.Name) {
+			continue
+		}
+		maps.Copy(received, upstream.ArtifactFiles)
+	}
+	return received
+}
+
+// applyRules returns job with the when and variables of the first of its
+// rules applying in context, or the reason to skip it when they leave it out
+// of the pipeline. Rules are not evaluated when context is nil.
+func applyRules(job common.PipelineJobDescriptor, context *common.RuleContext) (common.PipelineJobDescriptor, string, error) {
+	if context == nil || job.GetRules() == nil {
+		return job, "", nil
+	}
+	outcome, err := job.EvaluateRules(*context)
+	if err != nil {
+		return job, "rules could not be evaluated", err
+	}
+	if outcome.Skipped() {
+		if outcome.Rule < 0 {
+			return job, "no rule adds the job to the pipeline", nil
+		}
+		return job, fmt.Sprintf("rule %d leaves the job out of the pipeline", outcome.Rule+1), nil
+	}
+	if len(outcome.Variables) > 0 {
+		job = job.WithVariables(outcome.Variables)
+	}
+	return job.WithWhen(outcome.When), "", nil
+}
+
+// shouldRun tells whether job runs given the outcome of the previous stages,
+// and otherwise the status and reason to report.
+func shouldRun(job common.PipelineJobDescriptor, failed bool) (JobStatus, string, bool) {
+	switch job.GetWhen() {
+	case common.WhenManual:
+		return JobStatusManual, "manual job waiting to be triggered", false
+	case common.WhenNever:
+		return JobStatusSkipped, "job is configured to never run", false
+	case common.WhenAlways:
+		return "", "", true
+	case common.WhenOnFailure:
+		if !failed {
+			return JobStatusSkipped, "no job of a previous stage failed", false
+		}
+		return "", "", true
+	default:
+		if failed {
+			return JobStatusSkipped, "a job of a previous stage failed", false
+		}
+		return "", "", true
+	}
+}
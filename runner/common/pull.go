@@ -0,0 +1,78 @@
+package common
+
+import "strings"
+
+// PullProgress sums up the ImagePulling events of an image into the
+// progress of its pull.
+type PullProgress struct {
+	layers map[string]*layerProgress
+	// Status is the final message of the pull, such as "Downloaded newer
+	// image for alpine:latest", empty until the pull is over.
+	Status string
+}
+
+type layerProgress struct {
+	current, total int64
+	done           bool
+}
+
+func NewPullProgress() *PullProgress {
+	return &PullProgress{layers: make(map[string]*layerProgress)}
+}
+
+// Update accounts for event, which must be about the image of p.
+func (p *PullProgress) Update(event ImagePulling) {
+	if status, found := strings.CutPrefix(event.Status, "Status: "); found {
+		p.Status = status
+		return
+	}
+	// Messages without layer, or about the tag pulled, are not progress.
+	if event.Layer == "" || strings.HasPrefix(event.Status, "Pulling from ") {
+		return
+	}
+
+	layer, found := p.layers[event.Layer]
+	if !found {
+		layer = &layerProgress{}
+		p.layers[event.Layer] = layer
+	}
+	switch event.Status {
+	case "Downloading":
+		layer.current, layer.total = event.Current, max(layer.total, event.Total)
+	case "Verifying Checksum", "Download complete", "Extracting":
+		layer.current = layer.total
+	case "Pull complete", "Already exists":
+		layer.current = layer.total
+		layer.done = true
+	}
+}
+
+// Layers returns the number of layers pulled, or already present, and the
+// number of layers of the image known so far.
+func (p *PullProgress) Layers() (done, total int) {
+	for _, layer := range p.layers {
+		if layer.done {
+			done++
+		}
+	}
+	return done, len(p.layers)
+}
+
+// Bytes returns the number of bytes downloaded and the size of the layers
+// whose size is known so far.
+func (p *PullProgress) Bytes() (current, total int64) {
+	for _, layer := range p.layers {
+		current += layer.current
+		total += layer.total
+	}
+	return current, total
+}
+
+// Percent returns the part of the image downloaded, from 0 to 100.
+func (p *PullProgress) Percent() int {
+	current, total := p.Bytes()
+	if total == 0 {
+		return 0
+	}
+	return int(current * 100 / total)
+}
@@ -0,0 +1,46 @@
+package common
+
+import "testing"
+
+func TestPullProgress(t *testing.T) {
+	progress := NewPullProgress()
+	for _, event := range []ImagePulling{
+		{Layer: "latest", Status: "Pulling from library/alpine"},
+		{Layer: "a", Status: "Already exists"},
+		{Layer: "b", Status: "Pulling fs layer"},
+		{Layer: "c", Status: "Pulling fs layer"},
+		{Layer: "b", Status: "Downloading", Current: 100, Total: 400},
+		{Layer: "c", Status: "Downloading", Current: 50, Total: 100},
+	} {
+		progress.Update(event)
+	}
+
+	if done, total := progress.Layers(); done != 1 || total != 3 {
+		t.Errorf("expected 1 of 3 layers, got %d of %d", done, total)
+	}
+	if percent := progress.Percent(); percent != 30 {
+		t.Errorf("expected 30%%, got %d%%", percent)
+	}
+
+	for _, event := range []ImagePulling{
+		{Layer: "c", Status: "Download complete"},
+		{Layer: "c", Status: "Pull complete"},
+		{Layer: "b", Status: "Download complete"},
+		{Layer: "b", Status: "Extracting", Current: 200, Total: 400},
+		{Layer: "b", Status: "Pull complete"},
+		{Status: "Digest: sha256:0123"},
+		{Status: "Status: Downloaded newer image for alpine:latest"},
+	} {
+		progress.Update(event)
+	}
+
+	if done, total := progress.Layers(); done != 3 || total != 3 {
+		t.Errorf("expected 3 of 3 layers, got %d of %d", done, total)
+	}
+	if current, total := progress.Bytes(); current != 500 || total != 500 {
+		t.Errorf("expected 500 of 500 bytes, got %d of %d", current, total)
+	}
+	if progress.Status != "Downloaded newer image for alpine:latest" {
+		t.Errorf("unexpected status %q", progress.Status)
+	}
+}
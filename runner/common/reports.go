@@ -0,0 +1,289 @@
+package common
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/powerpixel/pipelinefox/parser/common"
+)
+
+// CollectTimeout bounds the time spent collecting the reports of a job.
+const CollectTimeout = time.Minute
+
+var dotenvNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Workspace gives access to the files of a job once its scripts are over,
+// paths being relative to the job working directory.
+type Workspace interface {
+	// Glob returns the regular files matching pattern, see MatchPattern.
+	Glob(ctx context.Context, pattern string) ([]string, error)
+	Open(ctx context.Context, path string) (io.ReadCloser, error)
+}
+
+// CollectReports fetches the artifacts reports and artifacts:paths files of
+// job from workspace. JUnit reports and artifacts:paths files are copied to
+// the options artifact directory, dotenv variables are read into the result.
+// Like GitLab, reports are collected whatever the outcome of the job, missing
+// files only raising warnings.
+func CollectReports(ctx context.Context, options RunnerOptions, job common.PipelineJobDescriptor, workspace Workspace, result JobResult) JobResult {
+	reports := job.GetReports()
+	if len(reports.JUnit) == 0 && len(reports.Dotenv) == 0 && len(job.GetArtifactPaths()) == 0 {
+		return result
+	}
+
+	ctx, cancel := GracefulContext(ctx, CollectTimeout)
+	defer cancel()
+
+	warn := func(format string, args ...any) {
+		options.Events.Publish(Warning{
+			Time:    time.Now(),
+			Job:     job.GetName(),
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	if len(reports.JUnit) > 0 && options.ArtifactDir == "" {
+		warn("junit reports are not collected as no artifact directory is set")
+	}
+	for _, pattern := range reports.JUnit {
+		if options.ArtifactDir == "" {
+			break
+		}
+		paths, err := workspace.Glob(ctx, pattern)
+		if err != nil {
+			warn("could not look for junit reports %s: %s", pattern, err)
+			continue
+		}
+		if len(paths) == 0 {
+			warn("no junit report matching %s", pattern)
+		}
+		for _, path := range paths {
+			saved, size, err := saveArtifact(ctx, options.ArtifactDir, job.GetName(), workspace, path)
+			if err != nil {
+				warn("could not collect junit report %s: %s", path, err)
+				continue
+			}
+			result.Artifacts = append(result.Artifacts, saved)
+			result.JUnitReports = append(result.JUnitReports, saved)
+			options.Events.Publish(ArtifactUploaded{
+				Time: time.Now(),
+				Job:  job.GetName(),
+				Path: path,
+				Size: size,
+			})
+		}
+	}
+
+	if len(job.GetArtifactPaths()) > 0 && options.ArtifactDir == "" {
+		warn("artifacts:paths files are not collected as no artifact directory is set")
+	}
+	for _, pattern := range job.GetArtifactPaths() {
+		if options.ArtifactDir == "" {
+			break
+		}
+		// As GitLab, a directory stands for the files it holds.
+		paths, err := workspace.Glob(ctx, pattern)
+		if err == nil {
+			var inside []string
+			inside, err = workspace.Glob(ctx, path.Join(pattern, "**"))
+			paths = append(paths, inside...)
+		}
+		if err != nil {
+			warn("could not look for artifacts %s: %s", pattern, err)
+			continue
+		}
+		if len(paths) == 0 {
+			warn("no artifact matching %s", pattern)
+		}
+		for _, file := range paths {
+			if _, found := result.ArtifactFiles[file]; found {
+				continue
+			}
+			saved, size, err := saveArtifact(ctx, options.ArtifactDir, job.GetName(), workspace, file)
+			if err != nil {
+				warn("could not collect artifact %s: %s", file, err)
+				continue
+			}
+			if result.ArtifactFiles == nil {
+				result.ArtifactFiles = make(map[string]string)
+			}
+			result.ArtifactFiles[file] = saved
+			if !slices.Contains(result.Artifacts, saved) {
+				result.Artifacts = append(result.Artifacts, saved)
+			}
+			options.Events.Publish(ArtifactUploaded{
+				Time: time.Now(),
+				Job:  job.GetName(),
+				Path: file,
+				Size: size,
+			})
+		}
+	}
+
+	for _, path := range reports.Dotenv {
+		variables, err := readDotenv(ctx, workspace, path)
+		if err != nil {
+			warn("could not read dotenv report %s: %s", path, err)
+			continue
+		}
+		if result.Dotenv == nil {
+			result.Dotenv = make(map[string]string, len(variables))
+		}
+		for name, value := range variables {
+			result.Dotenv[name] = value
+		}
+	}
+
+	return result
+}
+
+// ArtifactPath returns where the file at path collected from job is stored
+// in dir.
+func ArtifactPath(dir, job, path string) string {
+	return filepath.Join(dir, FileName(job), filepath.FromSlash(path))
+}
+
+func saveArtifact(ctx context.Context, dir, job string, workspace Workspace, path string) (string, int64, error) {
+	if !filepath.IsLocal(filepath.FromSlash(path)) {
+		return "", 0, fmt.Errorf("%s is outside of the job directory", path)
+	}
+
+	reader, err := workspace.Open(ctx, path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer reader.Close()
+
+	saved := ArtifactPath(dir, job, path)
+	if err := os.MkdirAll(filepath.Dir(saved), 0o755); err != nil {
+		return "", 0, err
+	}
+	file, err := os.Create(saved)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	size, err := io.Copy(file, reader)
+	return saved, size, err
+}
+
+func readDotenv(ctx context.Context, workspace Workspace, path string) (map[string]string, error) {
+	reader, err := workspace.Open(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return ParseDotenv(reader)
+}
+
+// ParseDotenv reads the KEY=value lines of a dotenv report. Empty lines and
+// comments are ignored, values may be surrounded by quotes.
+func ParseDotenv(r io.Reader) (map[string]string, error) {
+	variables := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, value, found := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		name = strings.TrimSpace(name)
+		if !found || !dotenvNameRegexp.MatchString(name) {
+			return nil, fmt.Errorf("line %d is not a KEY=value pair", number)
+		}
+
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		variables[name] = value
+	}
+
+	return variables, scanner.Err()
+}
+
+// MatchPattern reports whether the slash separated name matches pattern,
+// whose ** elements match any number of directories.
+func MatchPattern(pattern, name string) bool {
+	return matchElements(strings.Split(path.Clean(pattern), "/"), strings.Split(path.Clean(name), "/"))
+}
+
+func matchElements(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchElements(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(name) == 0 {
+		return false
+	}
+	matched, err := path.Match(pattern[0], name[0])
+	return err == nil && matched && matchElements(pattern[1:], name[1:])
+}
+
+// PatternBase returns the directory of pattern holding no wildcard, where
+// looking for matching files starts.
+func PatternBase(pattern string) string {
+	elements := strings.Split(path.Clean(pattern), "/")
+	i := slices.IndexFunc(elements, func(element string) bool {
+		return strings.ContainsAny(element, `*?[\`)
+	})
+	if i < 0 {
+		return path.Dir(path.Clean(pattern))
+	}
+	return path.Join(append([]string{"."}, elements[:i]...)...)
+}
+
+// DirWorkspace is the workspace of a job run in a directory of the host.
+type DirWorkspace string
+
+func (d DirWorkspace) Glob(_ context.Context, pattern string) ([]string, error) {
+	var paths []string
+
+	root := string(d)
+	base := filepath.Join(root, filepath.FromSlash(PatternBase(pattern)))
+	err := filepath.WalkDir(base, func(path string, entry os.DirEntry, err error) error {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if MatchPattern(pattern, filepath.ToSlash(rel)) {
+			paths = append(paths, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+
+	return paths, err
+}
+
+func (d DirWorkspace) Open(_ context.Context, path string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(string(d), filepath.FromSlash(path)))
+}
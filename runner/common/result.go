@@ -0,0 +1,144 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/powerpixel/pipelinefox/parser/common"
+)
+
+type JobStatus string
+
+const (
+	JobStatusCreated  JobStatus = "created"
+	JobStatusRunning  JobStatus = "running"
+	JobStatusSuccess  JobStatus = "success"
+	JobStatusFailed   JobStatus = "failed"
+	JobStatusCanceled JobStatus = "canceled"
+	JobStatusSkipped  JobStatus = "skipped"
+	JobStatusManual   JobStatus = "manual"
+)
+
+// JobResult describes the outcome of a single job.
+type JobResult struct {
+	Name       string    `json:"name"`
+	Stage      string    `json:"stage"`
+	Status     JobStatus `json:"status"`
+	ExitCode   int       `json:"exit_code"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// LogPath is the file holding the job output, if it was persisted.
+	LogPath string `json:"log_path,omitempty"`
+	// Artifacts lists the paths of the files collected from the job.
+	Artifacts []string `json:"artifacts,omitempty"`
+	// JUnitReports lists the collected JUnit test reports, among Artifacts.
+	JUnitReports []string `json:"junit_reports,omitempty"`
+	// ArtifactFiles maps the paths of the artifacts:paths files of the job,
+	// relative to its working directory, to their copies among Artifacts.
+	ArtifactFiles map[string]string `json:"artifact_files,omitempty"`
+	// Dotenv holds the variables of the job dotenv reports.
+	Dotenv map[string]string `json:"dotenv,omitempty"`
+	// Reason explains why the job was skipped, failed or canceled, or where
+	// the result of a restored job comes from.
+	Reason string `json:"reason,omitempty"`
+}
+
+func (r JobResult) Duration() time.Duration {
+	if r.StartedAt.IsZero() || r.FinishedAt.IsZero() {
+		return 0
+	}
+	return r.FinishedAt.Sub(r.StartedAt)
+}
+
+// NewJobResult returns the result of a job starting now.
+func NewJobResult(job common.PipelineJobDescriptor) JobResult {
+	return JobResult{
+		Name:      job.GetName(),
+		Stage:     job.GetStage(),
+		Status:    JobStatusRunning,
+		StartedAt: time.Now(),
+	}
+}
+
+// NewSkippedJobResult returns the result of a job which was not run.
+func NewSkippedJobResult(job common.PipelineJobDescriptor, status JobStatus, reason string) JobResult {
+	return JobResult{
+		Name:   job.GetName(),
+		Stage:  job.GetStage(),
+		Status: status,
+		Reason: reason,
+	}
+}
+
+// Finish stamps the end of the job and derives its status from the job
+// context, the error met while running it and the exit code of its script.
+// Only errors preventing the job from running are returned, a failing script
+// is reported through the status.
+func (r JobResult) Finish(ctx context.Context, exitCode int, err error) (JobResult, error) {
+	r.FinishedAt = time.Now()
+	r.ExitCode = exitCode
+
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		r.Status = JobStatusFailed
+		r.Reason = "job timed out"
+		return r, nil
+	case ctx.Err() != nil:
+		r.Status = JobStatusCanceled
+		r.Reason = "job was canceled"
+		return r, nil
+	case err != nil:
+		r.Status = JobStatusFailed
+		r.Reason = err.Error()
+		return r, err
+	case exitCode != 0:
+		r.Status = JobStatusFailed
+		r.Reason = fmt.Sprintf("script exited with status %d", exitCode)
+		return r, nil
+	default:
+		r.Status = JobStatusSuccess
+		return r, nil
+	}
+}
+
+// PipelineResult describes the outcome of a pipeline, jobs being ordered by
+// stage then by declaration.
+type PipelineResult struct {
+	Status     JobStatus   `json:"status"`
+	StartedAt  time.Time   `json:"started_at"`
+	FinishedAt time.Time   `json:"finished_at"`
+	Jobs       []JobResult `json:"jobs"`
+}
+
+func (r PipelineResult) Duration() time.Duration {
+	return r.FinishedAt.Sub(r.StartedAt)
+}
+
+// GetJob returns the result of the job named name.
+func (r PipelineResult) GetJob(name string) (JobResult, bool) {
+	for _, job := range r.Jobs {
+		if job.Name == name {
+			return job, true
+		}
+	}
+	return JobResult{}, false
+}
+
+// Succeeded reports whether no job failed nor was canceled.
+func (r PipelineResult) Succeeded() bool {
+	return r.Status == JobStatusSuccess
+}
+
+func (r *PipelineResult) updateStatus() {
+	r.Status = JobStatusSuccess
+	for _, job := range r.Jobs {
+		switch job.Status {
+		case JobStatusFailed:
+			r.Status = JobStatusFailed
+			return
+		case JobStatusCanceled:
+			r.Status = JobStatusCanceled
+		}
+	}
+}
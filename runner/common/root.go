@@ -1,12 +1,16 @@
 package common
 
 import (
+	"context"
 	"io"
 
 	"github.com/powerpixel/pipelinefox/parser/common"
 )
 
+// PipelineRunner executes pipelines or single jobs, streaming the job output
+// to stdout and stderr. Failing jobs are reported through the returned
+// results, errors being kept for problems preventing jobs from running.
 type PipelineRunner interface {
-	RunPipeline(stdout, stderr io.Writer, pipeline common.PipelineDescriptor) error
-	RunPipelineJob(stdout, stderr io.Writer, job common.PipelineJobDescriptor) error
+	RunPipeline(ctx context.Context, stdout, stderr io.Writer, pipeline common.PipelineDescriptor) (PipelineResult, error)
+	RunPipelineJob(ctx context.Context, stdout, stderr io.Writer, job common.PipelineJobDescriptor) (JobResult, error)
 }
@@ -0,0 +1,138 @@
+package common
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/powerpixel/pipelinefox/parser/common"
+)
+
+// MaskedValue replaces the values of masked secrets in job logs.
+const MaskedValue = "[MASKED]"
+
+// minMaskedLength is the length of the shortest value GitLab masks.
+const minMaskedLength = 8
+
+// Secret is a variable given to jobs without being part of the descriptor,
+// such as a token.
+type Secret struct {
+	Name  string
+	Value string
+	// Masked secrets have their value replaced by [MASKED] in job logs.
+	Masked bool
+	// File secrets are written to a file, the variable holding its path as
+	// for GitLab file type variables.
+	File bool
+}
+
+// CanMask reports whether value can be masked, GitLab requiring a single
+// line of 8 characters or more.
+func CanMask(value string) bool {
+	return len(value) >= minMaskedLength && !strings.ContainsAny(value, "\r\n")
+}
+
+// PrepareJob returns job with the variables of the options and the secrets
+// which are not files added, taking precedence over its own ones.
+func (o RunnerOptions) PrepareJob(job common.PipelineJobDescriptor) common.PipelineJobDescriptor {
+	variables := make(map[string]string, len(o.Variables)+len(o.Secrets))
+	for name, value := range o.Variables {
+		variables[name] = value
+	}
+	for _, secret := range o.Secrets {
+		if !secret.File {
+			variables[secret.Name] = secret.Value
+		}
+	}
+	if len(variables) == 0 {
+		return job
+	}
+	return job.WithVariables(variables)
+}
+
+// maskedValues returns the values to redact from job logs.
+func (o RunnerOptions) maskedValues() []string {
+	var values []string
+	for _, secret := range o.Secrets {
+		if secret.Masked && CanMask(secret.Value) {
+			values = append(values, secret.Value)
+		}
+	}
+	return values
+}
+
+// RedactWriter replaces values in the stream written to it before passing
+// it on. The end of a write which may be the beginning of a value is held
+// back until the next write, so that values split across writes are caught
+// as well. Flush writes what is held back once the stream is over.
+type RedactWriter struct {
+	w       io.Writer
+	values  [][]byte
+	pending []byte
+}
+
+// NewRedactWriter returns a writer replacing values with [MASKED] in what
+// it passes on to w.
+func NewRedactWriter(w io.Writer, values []string) *RedactWriter {
+	r := &RedactWriter{w: w}
+	for _, value := range values {
+		if value != "" {
+			r.values = append(r.values, []byte(value))
+		}
+	}
+	// Longer values are matched first, so that a value holding a shorter
+	// one is fully redacted.
+	slices.SortFunc(r.values, func(a, b []byte) int {
+		return len(b) - len(a)
+	})
+	return r
+}
+
+func (r *RedactWriter) Write(p []byte) (int, error) {
+	r.pending = append(r.pending, p...)
+	if err := r.redact(false); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush writes what was held back.
+func (r *RedactWriter) Flush() error {
+	return r.redact(true)
+}
+
+// redact writes the pending bytes with values replaced. Unless final, the
+// pending bytes starting with the beginning of a value are kept for later.
+func (r *RedactWriter) redact(final bool) error {
+	var out []byte
+	start, i := 0, 0
+
+scan:
+	for i < len(r.pending) {
+		rest := r.pending[i:]
+		for _, value := range r.values {
+			if !final && len(rest) < len(value) && bytes.HasPrefix(value, rest) {
+				break scan
+			}
+		}
+		for _, value := range r.values {
+			if bytes.HasPrefix(rest, value) {
+				out = append(out, r.pending[start:i]...)
+				out = append(out, MaskedValue...)
+				i += len(value)
+				start = i
+				continue scan
+			}
+		}
+		i++
+	}
+
+	out = append(out, r.pending[start:i]...)
+	r.pending = append(r.pending[:0], r.pending[i:]...)
+	if len(out) == 0 {
+		return nil
+	}
+	_, err := r.w.Write(out)
+	return err
+}
@@ -0,0 +1,68 @@
+package common
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRedactWriter(t *testing.T) {
+	values := []string{"s3cr3t-token", "s3cr3t-token-long", "password"}
+
+	cases := []struct {
+		writes   []string
+		expected string
+	}{
+		{[]string{"token is s3cr3t-token\n"}, "token is [MASKED]\n"},
+		{[]string{"token is s3cr", "3t-tok", "en, done\n"}, "token is [MASKED], done\n"},
+		{[]string{"s3cr3t-token-long and s3cr3t-token-lo"}, "[MASKED] and [MASKED]-lo"},
+		{[]string{"s3cr3t-token", "-long"}, "[MASKED]"},
+		{[]string{"pass", "wordpassword"}, "[MASKED][MASKED]"},
+		{[]string{"s3cr3", "t is not a secret"}, "s3cr3t is not a secret"},
+		{[]string{"nothing to hide\n", "", "at all\n"}, "nothing to hide\nat all\n"},
+	}
+
+	for _, c := range cases {
+		var out bytes.Buffer
+		w := NewRedactWriter(&out, values)
+		for _, write := range c.writes {
+			n, err := w.Write([]byte(write))
+			if err != nil || n != len(write) {
+				t.Fatalf("unexpected write of %d bytes for %q: %v", n, write, err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if out.String() != c.expected {
+			t.Errorf("expected %q for %q, got %q", c.expected, c.writes, out.String())
+		}
+	}
+}
+
+func TestRedactWriterHoldsBackPossibleSecrets(t *testing.T) {
+	var out bytes.Buffer
+	w := NewRedactWriter(&out, []string{"password"})
+
+	w.Write([]byte("line\npass"))
+	if out.String() != "line\n" {
+		t.Fatalf("expected the beginning of the secret to be held back, got %q", out.String())
+	}
+	w.Write([]byte("port\n"))
+	if out.String() != "line\npassport\n" {
+		t.Fatalf("expected the held back bytes once known not to be a secret, got %q", out.String())
+	}
+}
+
+func TestCanMask(t *testing.T) {
+	cases := map[string]bool{
+		"12345678":        true,
+		"with spaces too": true,
+		"short":           false,
+		"two\nlines here": false,
+	}
+	for value, expected := range cases {
+		if CanMask(value) != expected {
+			t.Errorf("expected CanMask(%q) to be %v", value, expected)
+		}
+	}
+}
@@ -1,13 +1,30 @@
 package common
 
 import (
+	"context"
 	"strings"
 
+	"github.com/powerpixel/pipelinefox/parser/common"
+	"github.com/powerpixel/pipelinefox/shell"
 	"mvdan.cc/sh/v3/expand"
 	"mvdan.cc/sh/v3/syntax"
 )
 
 func ParseShell(s string) ([]string, error) {
+	return expandWords(s, &expand.Config{Env: nil})
+}
+
+// ParseShellEnv is ParseShell expanding the variables of env, failing on the
+// ones env does not hold.
+func ParseShellEnv(s string, env map[string]string) ([]string, error) {
+	pairs := make([]string, 0, len(env))
+	for name, value := range env {
+		pairs = append(pairs, name+"="+value)
+	}
+	return expandWords(s, &expand.Config{Env: expand.ListEnviron(pairs...), NoUnset: true})
+}
+
+func expandWords(s string, cfg *expand.Config) ([]string, error) {
 	p := syntax.NewParser()
 	var words []*syntax.Word
 	for w, err := range p.WordsSeq(strings.NewReader(s)) {
@@ -16,6 +33,26 @@ func ParseShell(s string) ([]string, error) {
 		}
 		words = append(words, w)
 	}
-	cfg := &expand.Config{Env: nil}
 	return expand.Fields(cfg, words...)
 }
+
+// ShellVariable is the variable selecting the shell of a job by name.
+const ShellVariable = "PIPELINEFOX_SHELL"
+
+// JobShell returns the shell the scripts of job are written for: the one
+// its ShellVariable names, else the one of the options, else the one detect
+// finds in the environment of the job.
+func (o RunnerOptions) JobShell(ctx context.Context, job common.PipelineJobDescriptor, detect func(ctx context.Context) (string, error)) (shell.Shell, error) {
+	name := job.GetVariables()[ShellVariable]
+	if name == "" {
+		name = o.Shell
+	}
+	if name == "" {
+		detected, err := detect(ctx)
+		if err != nil {
+			return shell.Shell{}, err
+		}
+		name = detected
+	}
+	return o.Shells.Lookup(name)
+}
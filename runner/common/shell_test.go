@@ -0,0 +1,63 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	parserCommon "github.com/powerpixel/pipelinefox/parser/common"
+	"github.com/powerpixel/pipelinefox/shell"
+)
+
+func TestParseShellEnv(t *testing.T) {
+	words, err := ParseShellEnv(`echo "$GREETING world" ${EMPTY}`, map[string]string{"GREETING": "hello", "EMPTY": ""})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := []string{"echo", "hello world"}; !slices.Equal(expected, words) {
+		t.Fatalf("expected %q, got %q", expected, words)
+	}
+
+	if _, err := ParseShellEnv("echo $UNSET", nil); err == nil {
+		t.Fatal("expected an error for an unset variable")
+	}
+}
+
+func TestJobShell(t *testing.T) {
+	detect := func(context.Context) (string, error) { return shell.BashName, nil }
+	custom, err := shell.NewShell("zsh", "{{ template \"commands\" . }}", []string{"zsh"}, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cases := []struct {
+		configured string
+		variables  map[string]string
+		expected   string
+	}{
+		{"", nil, shell.BashName},
+		{shell.ShName, nil, shell.ShName},
+		{shell.ShName, map[string]string{ShellVariable: shell.PwshName}, shell.PwshName},
+		{"", map[string]string{ShellVariable: "zsh"}, "zsh"},
+		// GitLab runner feature flags mean something else than a shell.
+		{shell.ShName, map[string]string{"FF_USE_POWERSHELL_PATH_RESOLVER": "true"}, shell.ShName},
+		{"", map[string]string{"FF_USE_NEW_BASH_EVAL_STRATEGY": "1"}, shell.BashName},
+	}
+	for _, c := range cases {
+		options := RunnerOptions{Shell: c.configured, Shells: shell.Shells{"zsh": custom}}
+		job := parserCommon.NewPipelineJobDescriptor("build", "build", nil).WithVariables(c.variables)
+		got, err := options.JobShell(context.Background(), job, detect)
+		if err != nil {
+			t.Fatalf("unexpected error for %v: %s", c, err)
+		}
+		if got.Name != c.expected {
+			t.Errorf("expected shell %s for %v, got %s", c.expected, c, got.Name)
+		}
+	}
+
+	job := parserCommon.NewPipelineJobDescriptor("build", "build", nil).WithVariables(map[string]string{ShellVariable: "fish"})
+	if _, err := (RunnerOptions{}).JobShell(context.Background(), job, detect); !errors.Is(err, shell.UnknownShellErr) {
+		t.Fatalf("expected UnknownShellErr, got %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/powerpixel/pipelinefox/parser/common"
+	"github.com/powerpixel/pipelinefox/shell"
+)
+
+// Modes telling when stepped scripts pause.
+const (
+	// StepEvery pauses before every command.
+	StepEvery = "every"
+	// StepBreakpoints pauses before the commands following a break marker
+	// only.
+	StepBreakpoints = "break"
+)
+
+var UnknownStepModeErr = errors.New("unknown step mode, expected every or break")
+
+// Stepper pauses the scripts of jobs before their commands, asking on its
+// terminal whether to run, skip or edit them, or to open a shell first.
+type Stepper struct {
+	mode     string
+	terminal *Terminal
+}
+
+func NewStepper(mode string, terminal *Terminal) (*Stepper, error) {
+	switch mode {
+	case StepEvery, StepBreakpoints:
+		return &Stepper{mode: mode, terminal: terminal}, nil
+	default:
+		return nil, fmt.Errorf("%w: got %s", UnknownStepModeErr, mode)
+	}
+}
+
+// ShellFunc opens an interactive shell on terminal in the environment of a
+// job, returning once it exits. The caller holds the lock of terminal.
+type ShellFunc func(ctx context.Context, terminal *Terminal) error
+
+// StepWriter is given the standard output of a stepped script, see
+// shell.CreateSteppedShellScript. It passes it on, pausing at each step
+// marker to ask what to do with the next command, then answering the script.
+type StepWriter struct {
+	ctx      context.Context
+	w        io.Writer
+	stepper  *Stepper
+	job      common.PipelineJobDescriptor
+	commands []string
+	masked   []string
+	answer   func(string) error
+	shell    ShellFunc
+
+	pending []byte
+	// breakNext pauses before the next command, following a break marker.
+	breakNext bool
+	// resumed runs the commands until the next breakpoint.
+	resumed bool
+}
+
+// NewStepWriter returns the writer of the script of job running commands,
+// which is answered through answer. shell opens a shell in the environment
+// of job when asked to.
+func (o RunnerOptions) NewStepWriter(ctx context.Context, w io.Writer, job common.PipelineJobDescriptor, commands []string, answer func(string) error, shell ShellFunc) *StepWriter {
+	return &StepWriter{
+		ctx:      ctx,
+		w:        w,
+		stepper:  o.Step,
+		job:      job,
+		commands: commands,
+		masked:   o.maskedValues(),
+		answer:   answer,
+		shell:    shell,
+	}
+}
+
+func (s *StepWriter) Write(p []byte) (int, error) {
+	s.pending = append(s.pending, p...)
+	marker := []byte(shell.StepMarker)
+	for {
+		i := bytes.Index(s.pending, marker)
+		if i < 0 {
+			// The end may be the beginning of a marker, held back until
+			// the next write.
+			keep := 0
+			for n := min(len(marker)-1, len(s.pending)); n > 0; n-- {
+				if bytes.HasSuffix(s.pending, marker[:n]) {
+					keep = n
+					break
+				}
+			}
+			return len(p), s.flush(len(s.pending) - keep)
+		}
+
+		end := bytes.IndexByte(s.pending[i:], '\n')
+		if end < 0 {
+			return len(p), s.flush(i)
+		}
+		// Once flushed, the marker starts what is held and its line ends at
+		// end.
+		if err := s.flush(i); err != nil {
+			return 0, err
+		}
+		index, err := strconv.Atoi(string(s.pending[len(marker):end]))
+		s.pending = s.pending[end+1:]
+		if err != nil {
+			index = -1
+		}
+		if err := s.answer(s.step(index)); err != nil {
+			return 0, fmt.Errorf("could not answer the stepped script: %w", err)
+		}
+	}
+}
+
+// flush passes the first n bytes held on.
+func (s *StepWriter) flush(n int) error {
+	if n == 0 {
+		return nil
+	}
+	_, err := s.w.Write(s.pending[:n])
+	s.pending = s.pending[n:]
+	return err
+}
+
+// Flush passes on what was held back, once the script is over.
+func (s *StepWriter) Flush() error {
+	return s.flush(len(s.pending))
+}
+
+// step returns the answer to the script about to run the command at index.
+func (s *StepWriter) step(index int) string {
+	if index < 0 || index >= len(s.commands) {
+		return shell.StepRun
+	}
+	command := s.commands[index]
+	if shell.IsBreakpoint(command) {
+		s.breakNext = true
+		return shell.StepRun
+	}
+
+	pause := s.breakNext || shell.HasBreakpoint(command) || (s.stepper.mode == StepEvery && !s.resumed)
+	s.breakNext = false
+	if !pause {
+		return shell.StepRun
+	}
+	s.resumed = false
+	return s.prompt(index, command)
+}
+
+// prompt shows the command at index, its variables expanded, and asks what
+// to do with it until answered.
+func (s *StepWriter) prompt(index int, command string) string {
+	t := s.stepper.terminal
+	t.Lock()
+	defer t.Unlock()
+
+	fmt.Fprintf(t, "\nStep %d/%d of job %s:\n", index+1, len(s.commands), s.job.GetName())
+	for _, line := range strings.Split(strings.TrimSpace(command), "\n") {
+		fmt.Fprintf(t, "  $ %s\n", s.redact(line))
+	}
+	if words, err := ParseShellEnv(command, s.job.GetVariables()); err == nil {
+		if expanded := strings.Join(words, " "); expanded != strings.TrimSpace(command) {
+			fmt.Fprintf(t, "  = %s\n", s.redact(expanded))
+		}
+	}
+
+	for {
+		fmt.Fprint(t, "[Enter] run, (s)kip, (e)dit, (d)rop into a shell, (c)ontinue to the next breakpoint, (a)bort: ")
+		line, err := t.ReadLine(s.ctx)
+		if err != nil {
+			fmt.Fprintln(t)
+			return shell.StepAbort
+		}
+
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "", "r", "run":
+			return shell.StepRun
+		case "s", "skip":
+			return shell.StepSkip
+		case "e", "edit":
+			fmt.Fprint(t, "Command to run instead: ")
+			edited, err := t.ReadLine(s.ctx)
+			if err != nil {
+				fmt.Fprintln(t)
+				return shell.StepAbort
+			}
+			if edited = strings.TrimSpace(edited); edited != "" {
+				return shell.StepEdit + " " + edited
+			}
+		case "d", "shell":
+			if err := s.shell(s.ctx, t); err != nil {
+				fmt.Fprintf(t, "Could not open a shell: %s\n", err)
+			}
+		case "c", "continue":
+			s.resumed = true
+			return shell.StepRun
+		case "a", "abort":
+			return shell.StepAbort
+		default:
+			fmt.Fprintf(t, "Unknown answer %q\n", line)
+		}
+	}
+}
+
+func (s *StepWriter) redact(text string) string {
+	for _, value := range s.masked {
+		text = strings.ReplaceAll(text, value, MaskedValue)
+	}
+	return text
+}
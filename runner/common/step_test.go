@@ -0,0 +1,118 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	parserCommon "github.com/powerpixel/pipelinefox/parser/common"
+	"github.com/powerpixel/pipelinefox/shell"
+)
+
+// newTestTerminal returns a terminal given typed as input, writing to out.
+func newTestTerminal(t *testing.T, typed string, out *bytes.Buffer) *Terminal {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	t.Cleanup(func() { r.Close() })
+	go func() {
+		w.WriteString(typed)
+		w.Close()
+	}()
+	return &Terminal{in: r, out: out, input: make(chan []byte)}
+}
+
+func TestStepWriter(t *testing.T) {
+	commands := []string{
+		"echo $GREETING",
+		"echo skipped",
+		"echo edited",
+		shell.BreakMarker,
+		"echo paused",
+		"echo resumed",
+		"echo again # " + shell.BreakMarker,
+		"echo aborted",
+	}
+	cases := []struct {
+		mode     string
+		typed    string
+		answers  []string
+		prompted []string
+	}{
+		{
+			mode:     StepEvery,
+			typed:    "\ns\ne\necho instead\nc\nwhat\nr\nA\n",
+			answers:  []string{"run", "skip", "edit echo instead", "run", "run", "run", "run", "abort"},
+			prompted: []string{"Step 1/8", "Step 2/8", "Step 3/8", "Step 5/8", "Step 7/8", "Step 8/8"},
+		},
+		{
+			mode:     StepBreakpoints,
+			typed:    "s\n\n",
+			answers:  []string{"run", "run", "run", "run", "skip", "run", "run", "run"},
+			prompted: []string{"Step 5/8", "Step 7/8"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.mode, func(t *testing.T) {
+			var term bytes.Buffer
+			stepper, err := NewStepper(c.mode, newTestTerminal(t, c.typed, &term))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			options := RunnerOptions{Step: stepper, Secrets: []Secret{{Name: "TOKEN", Value: "s3cr3t-token", Masked: true}}}
+			job := parserCommon.NewPipelineJobDescriptor("build", "build", commands).WithVariables(map[string]string{"GREETING": "s3cr3t-token"})
+
+			var out bytes.Buffer
+			var answers []string
+			w := options.NewStepWriter(context.Background(), &out, job, commands, func(answer string) error {
+				answers = append(answers, answer)
+				return nil
+			}, nil)
+
+			// Markers are split across writes, as the output of scripts may be.
+			var script strings.Builder
+			for i := range commands {
+				script.WriteString(shell.StepMarker + string(rune('0'+i)) + "\noutput\n")
+			}
+			for chunk := range slices.Chunk([]byte(script.String()), 7) {
+				if _, err := w.Write(chunk); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if !slices.Equal(c.answers, answers) {
+				t.Fatalf("expected answers %q, got %q", c.answers, answers)
+			}
+			if expected := strings.Repeat("output\n", len(commands)); out.String() != expected {
+				t.Fatalf("expected the markers to be removed from %q", out.String())
+			}
+			for _, prompt := range c.prompted {
+				if !strings.Contains(term.String(), prompt+" of job build") {
+					t.Errorf("expected to be prompted for %s, got\n%s", prompt, term.String())
+				}
+			}
+			if strings.Count(term.String(), "Step ") != len(c.prompted) {
+				t.Errorf("expected %d prompts, got\n%s", len(c.prompted), term.String())
+			}
+			if strings.Contains(term.String(), "s3cr3t-token") {
+				t.Errorf("expected the masked value to be redacted, got\n%s", term.String())
+			}
+		})
+	}
+}
+
+func TestUnknownStepMode(t *testing.T) {
+	if _, err := NewStepper("sometimes", nil); !errors.Is(err, UnknownStepModeErr) {
+		t.Fatalf("expected UnknownStepModeErr, got %v", err)
+	}
+}
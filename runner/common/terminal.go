@@ -0,0 +1,154 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+var NotATerminalErr = errors.New("interactive debugging needs a terminal")
+
+// Terminal is the interactive terminal jobs are debugged on, by one job at
+// a time: callers hold its lock while they use it.
+type Terminal struct {
+	sync.Mutex
+	in  *os.File
+	out io.Writer
+	// input receives what is typed, read by a single goroutine for no
+	// keystroke to be lost between uses of the terminal.
+	input     chan []byte
+	startRead sync.Once
+	// pending is what was typed after the last line read.
+	pending []byte
+}
+
+// NewTerminal returns the terminal reading in and writing out, failing when
+// in is not a terminal.
+func NewTerminal(in *os.File, out io.Writer) (*Terminal, error) {
+	if !term.IsTerminal(int(in.Fd())) {
+		return nil, NotATerminalErr
+	}
+	return &Terminal{in: in, out: out, input: make(chan []byte)}, nil
+}
+
+func (t *Terminal) Write(p []byte) (int, error) {
+	return t.out.Write(p)
+}
+
+// Size returns the width and height of the terminal.
+func (t *Terminal) Size() (width, height int, err error) {
+	return term.GetSize(int(t.in.Fd()))
+}
+
+func (t *Terminal) read() {
+	for {
+		buf := make([]byte, 1024)
+		n, err := t.in.Read(buf)
+		if n > 0 {
+			t.input <- buf[:n]
+		}
+		if err != nil {
+			close(t.input)
+			return
+		}
+	}
+}
+
+// next returns what was typed since the last call, io.EOF once the input is
+// closed.
+func (t *Terminal) next(ctx context.Context) ([]byte, error) {
+	if len(t.pending) > 0 {
+		data := t.pending
+		t.pending = nil
+		return data, nil
+	}
+
+	t.startRead.Do(func() { go t.read() })
+	select {
+	case data, open := <-t.input:
+		if !open {
+			return nil, io.EOF
+		}
+		return data, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// ReadLine returns the next line typed, without its newline.
+func (t *Terminal) ReadLine(ctx context.Context) (string, error) {
+	var line []byte
+	for {
+		data, err := t.next(ctx)
+		if err != nil {
+			return "", err
+		}
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line = append(line, data[:i]...)
+			t.pending = data[i+1:]
+			return string(bytes.TrimSuffix(line, []byte("\r"))), nil
+		}
+		line = append(line, data...)
+	}
+}
+
+// Attach puts the terminal in raw mode and forwards what is typed to w until
+// done receives, returning what it received. closeInput is called once the
+// input of the terminal is closed.
+func (t *Terminal) Attach(w io.Writer, done <-chan error, closeInput func() error) error {
+	fd := int(t.in.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+
+	// What is typed while the attachment ends is kept for the next use of
+	// the terminal.
+	ctx, cancel := context.WithCancel(context.Background())
+	var forwarding sync.WaitGroup
+	defer func() {
+		cancel()
+		forwarding.Wait()
+	}()
+
+	typed := make(chan []byte)
+	forwarding.Add(1)
+	go func() {
+		defer forwarding.Done()
+		defer close(typed)
+		for {
+			data, err := t.next(ctx)
+			if err != nil {
+				return
+			}
+			select {
+			case typed <- data:
+			case <-ctx.Done():
+				t.pending = append(data, t.pending...)
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case err := <-done:
+			return err
+		case data, open := <-typed:
+			if !open {
+				typed = nil
+				closeInput()
+				continue
+			}
+			if _, err := w.Write(data); err != nil {
+				return err
+			}
+		}
+	}
+}
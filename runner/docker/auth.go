@@ -0,0 +1,214 @@
+package docker
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/registry"
+)
+
+// authConfigVariable holds registry credentials in the format of the docker
+// config.json, as for GitLab runners.
+const authConfigVariable = "DOCKER_AUTH_CONFIG"
+
+// dockerHubServer is the server Docker Hub credentials are stored for.
+const dockerHubServer = "https://index.docker.io/v1/"
+
+// helperTimeout bounds the time a credential helper may take.
+const helperTimeout = 30 * time.Second
+
+var CredentialHelperErr = errors.New("credential helper failed")
+
+// dockerConfig is the part of a docker config.json about registries.
+type dockerConfig struct {
+	Auths       map[string]dockerAuth `json:"auths"`
+	CredsStore  string                `json:"credsStore"`
+	CredHelpers map[string]string     `json:"credHelpers"`
+}
+
+type dockerAuth struct {
+	Auth          string `json:"auth"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	IdentityToken string `json:"identitytoken"`
+}
+
+// helperCredentials is the output of the get command of credential helpers.
+type helperCredentials struct {
+	Username string
+	Secret   string
+}
+
+// registryAuth returns the credentials to pull image with, encoded for
+// image.PullOptions, empty when none are known. As GitLab runners do, the
+// DOCKER_AUTH_CONFIG variable of the job is looked up first, then the one
+// of the environment and finally the docker config.json of the user, the
+// first one knowing the registry of image winning.
+func registryAuth(ctx context.Context, image string, variables map[string]string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", nil
+	}
+	host := reference.Domain(named)
+
+	for _, load := range []func() (dockerConfig, error){
+		func() (dockerConfig, error) { return parseDockerConfig(variables[authConfigVariable]) },
+		func() (dockerConfig, error) { return parseDockerConfig(os.Getenv(authConfigVariable)) },
+		readDockerConfig,
+	} {
+		config, err := load()
+		if err != nil {
+			return "", err
+		}
+		auth, found, err := config.lookup(ctx, host)
+		if err != nil {
+			return "", err
+		}
+		if found {
+			return registry.EncodeAuthConfig(auth)
+		}
+	}
+	return "", nil
+}
+
+func parseDockerConfig(content string) (dockerConfig, error) {
+	var config dockerConfig
+	if content == "" {
+		return config, nil
+	}
+	if err := json.Unmarshal([]byte(content), &config); err != nil {
+		return config, fmt.Errorf("invalid %s: %w", authConfigVariable, err)
+	}
+	return config, nil
+}
+
+// readDockerConfig reads the config.json of DOCKER_CONFIG, or of ~/.docker,
+// a missing file knowing no registry.
+func readDockerConfig() (dockerConfig, error) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return dockerConfig{}, nil
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+
+	path := filepath.Join(dir, "config.json")
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return dockerConfig{}, nil
+	}
+	if err != nil {
+		return dockerConfig{}, err
+	}
+
+	var config dockerConfig
+	if err := json.Unmarshal(content, &config); err != nil {
+		return config, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// lookup returns the credentials of the registry host. As the docker CLI
+// does, the credential helper of the registry comes first, then the store
+// of every credentials, then the credentials written in the file.
+func (c dockerConfig) lookup(ctx context.Context, host string) (registry.AuthConfig, bool, error) {
+	server := host
+	if host == "docker.io" {
+		server = dockerHubServer
+	}
+
+	for key, helper := range c.CredHelpers {
+		if registryHost(key) == host {
+			return runCredentialHelper(ctx, helper, server)
+		}
+	}
+
+	if c.CredsStore != "" {
+		auth, found, err := runCredentialHelper(ctx, c.CredsStore, server)
+		if err != nil || found {
+			return auth, found, err
+		}
+	}
+
+	for key, entry := range c.Auths {
+		if registryHost(key) != host {
+			continue
+		}
+		auth := registry.AuthConfig{
+			Username:      entry.Username,
+			Password:      entry.Password,
+			IdentityToken: entry.IdentityToken,
+			ServerAddress: server,
+		}
+		if entry.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+			if err != nil {
+				return registry.AuthConfig{}, false, fmt.Errorf("invalid credentials for %s: %w", key, err)
+			}
+			auth.Username, auth.Password, _ = strings.Cut(string(decoded), ":")
+		}
+		return auth, true, nil
+	}
+	return registry.AuthConfig{}, false, nil
+}
+
+// registryHost returns the host of a registry as keyed in a config.json,
+// which may be a URL, Docker Hub having several names.
+func registryHost(key string) string {
+	key = strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+	host, _, _ := strings.Cut(key, "/")
+	switch host {
+	case "index.docker.io", "registry-1.docker.io":
+		return "docker.io"
+	}
+	return host
+}
+
+// runCredentialHelper gets the credentials of server from the helper, run
+// as docker-credential-<helper> get. Servers it knows nothing about are not
+// found.
+func runCredentialHelper(ctx context.Context, helper, server string) (registry.AuthConfig, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, helperTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(server)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		output := strings.TrimSpace(stdout.String() + stderr.String())
+		if strings.Contains(output, "credentials not found") {
+			return registry.AuthConfig{}, false, nil
+		}
+		return registry.AuthConfig{}, false, fmt.Errorf("%w: docker-credential-%s: %s", CredentialHelperErr, helper, cmp.Or(output, err.Error()))
+	}
+
+	var credentials helperCredentials
+	if err := json.Unmarshal(stdout.Bytes(), &credentials); err != nil {
+		return registry.AuthConfig{}, false, fmt.Errorf("%w: docker-credential-%s: %w", CredentialHelperErr, helper, err)
+	}
+
+	auth := registry.AuthConfig{ServerAddress: server}
+	// Helpers store identity tokens under a <token> user name.
+	if credentials.Username == "<token>" {
+		auth.IdentityToken = credentials.Secret
+	} else {
+		auth.Username, auth.Password = credentials.Username, credentials.Secret
+	}
+	return auth, true, nil
+}
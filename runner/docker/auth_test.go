@@ -0,0 +1,296 @@
+package docker
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/go-connections/nat"
+	parserCommon "github.com/powerpixel/pipelinefox/parser/common"
+	"github.com/powerpixel/pipelinefox/runner/common"
+)
+
+// fakeHelper answers like a credential helper knowing the servers of
+// credentials, printing "credentials not found" for the other ones.
+const fakeHelper = `#!/bin/sh
+read server
+case "$server" in
+%s
+*) echo "credentials not found in native keychain"; exit 1 ;;
+esac
+`
+
+func installCredentialHelper(t *testing.T, name string, credentials map[string]helperCredentials) {
+	t.Helper()
+	cases := ""
+	for server, entry := range credentials {
+		content, err := json.Marshal(entry)
+		expectNoError(t, err)
+		cases += fmt.Sprintf("%q) echo '%s' ;;\n", server, content)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "docker-credential-"+name)
+	expectNoError(t, os.WriteFile(path, []byte(fmt.Sprintf(fakeHelper, cases)), 0o755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func writeDockerConfig(t *testing.T, config dockerConfig) {
+	t.Helper()
+	dir := t.TempDir()
+	content, err := json.Marshal(config)
+	expectNoError(t, err)
+	expectNoError(t, os.WriteFile(filepath.Join(dir, "config.json"), content, 0o600))
+	t.Setenv("DOCKER_CONFIG", dir)
+}
+
+func decodeAuth(t *testing.T, encoded string) registry.AuthConfig {
+	t.Helper()
+	var auth registry.AuthConfig
+	if encoded == "" {
+		return auth
+	}
+	content, err := base64.URLEncoding.DecodeString(encoded)
+	expectNoError(t, err)
+	expectNoError(t, json.Unmarshal(content, &auth))
+	return auth
+}
+
+func basicAuth(user, password string) string {
+	return base64.StdEncoding.EncodeToString([]byte(user + ":" + password))
+}
+
+func TestRegistryAuth(t *testing.T) {
+	t.Setenv(authConfigVariable, "")
+	installCredentialHelper(t, "test", map[string]helperCredentials{
+		"helper.example.com":          {Username: "helper-user", Secret: "helper-secret"},
+		"token.example.com":           {Username: "<token>", Secret: "identity-token"},
+		"https://index.docker.io/v1/": {Username: "hub-user", Secret: "hub-secret"},
+	})
+	writeDockerConfig(t, dockerConfig{
+		Auths: map[string]dockerAuth{
+			"https://file.example.com/v1/": {Auth: basicAuth("file-user", "file-password")},
+			"plain.example.com":            {Username: "plain-user", Password: "plain-password"},
+		},
+		CredHelpers: map[string]string{
+			"helper.example.com": "test",
+			"token.example.com":  "test",
+			"index.docker.io":    "test",
+		},
+	})
+
+	cases := []struct {
+		image    string
+		user     string
+		password string
+		token    string
+	}{
+		{"file.example.com/team/app:1.0", "file-user", "file-password", ""},
+		{"plain.example.com/app", "plain-user", "plain-password", ""},
+		{"helper.example.com/app", "helper-user", "helper-secret", ""},
+		{"token.example.com/app", "", "", "identity-token"},
+		{"alpine:3.20", "hub-user", "hub-secret", ""},
+		{"unknown.example.com/app", "", "", ""},
+	}
+
+	for _, c := range cases {
+		encoded, err := registryAuth(context.Background(), c.image, nil)
+		expectNoError(t, err)
+		auth := decodeAuth(t, encoded)
+		if auth.Username != c.user || auth.Password != c.password || auth.IdentityToken != c.token {
+			t.Errorf("unexpected credentials for %s: %+v", c.image, auth)
+		}
+	}
+}
+
+func TestRegistryAuthPrecedence(t *testing.T) {
+	writeDockerConfig(t, dockerConfig{Auths: map[string]dockerAuth{
+		"registry.example.com": {Auth: basicAuth("file-user", "file-password")},
+	}})
+	t.Setenv(authConfigVariable, fmt.Sprintf(`{"auths": {"registry.example.com": {"auth": %q}}}`, basicAuth("env-user", "env-password")))
+	variables := map[string]string{
+		authConfigVariable: fmt.Sprintf(`{"auths": {"https://registry.example.com": {"auth": %q}}}`, basicAuth("job-user", "job-password")),
+	}
+
+	encoded, err := registryAuth(context.Background(), "registry.example.com/app", variables)
+	expectNoError(t, err)
+	expectEqualString(t, "job-user", decodeAuth(t, encoded).Username)
+
+	encoded, err = registryAuth(context.Background(), "registry.example.com/app", nil)
+	expectNoError(t, err)
+	expectEqualString(t, "env-user", decodeAuth(t, encoded).Username)
+
+	t.Setenv(authConfigVariable, "")
+	encoded, err = registryAuth(context.Background(), "registry.example.com/app", nil)
+	expectNoError(t, err)
+	expectEqualString(t, "file-user", decodeAuth(t, encoded).Username)
+
+	_, err = registryAuth(context.Background(), "registry.example.com/app", map[string]string{authConfigVariable: "{"})
+	if err == nil {
+		t.Fatal("expected an invalid DOCKER_AUTH_CONFIG to be reported")
+	}
+}
+
+func TestCredentialsStore(t *testing.T) {
+	t.Setenv(authConfigVariable, "")
+	installCredentialHelper(t, "store", map[string]helperCredentials{
+		"store.example.com": {Username: "store-user", Secret: "store-secret"},
+	})
+	writeDockerConfig(t, dockerConfig{
+		CredsStore: "store",
+		Auths: map[string]dockerAuth{
+			"file.example.com": {Auth: basicAuth("file-user", "file-password")},
+		},
+	})
+
+	encoded, err := registryAuth(context.Background(), "store.example.com/app", nil)
+	expectNoError(t, err)
+	expectEqualString(t, "store-user", decodeAuth(t, encoded).Username)
+
+	// Servers unknown to the store fall back to the credentials of the file.
+	encoded, err = registryAuth(context.Background(), "file.example.com/app", nil)
+	expectNoError(t, err)
+	expectEqualString(t, "file-user", decodeAuth(t, encoded).Username)
+
+	writeDockerConfig(t, dockerConfig{CredsStore: "missing"})
+	if _, err := registryAuth(context.Background(), "store.example.com/app", nil); !errors.Is(err, CredentialHelperErr) {
+		t.Fatalf("expected CredentialHelperErr, got %v", err)
+	}
+}
+
+func TestRegistryHost(t *testing.T) {
+	cases := map[string]string{
+		"https://index.docker.io/v1/": "docker.io",
+		"registry-1.docker.io":        "docker.io",
+		"http://localhost:5000/v2/":   "localhost:5000",
+		"registry.example.com":        "registry.example.com",
+	}
+	for key, expected := range cases {
+		expectEqualString(t, expected, registryHost(key))
+	}
+}
+
+// Credentials of the registry:2 standing in for a private registry, the
+// htpasswd entry holding the bcrypt hash of the password.
+const (
+	registryUser      = "pipelinefox"
+	registryPassword  = "registry-password"
+	registryHtpasswd  = "pipelinefox:$2b$05$ItPHeWJm8OmSOXyTYRhj7OeSOV54MJrTGJ3aacwfNPAkt6sJB9t42\n"
+	registryTestImage = "alpine:3.20"
+)
+
+// TestPullFromPrivateRegistry pulls the image of jobs from a registry:2
+// container requiring credentials, standing in for a private registry.
+func TestPullFromPrivateRegistry(t *testing.T) {
+	ctx := context.Background()
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	expectNoError(t, err)
+	if _, err := cli.Ping(ctx); err != nil {
+		t.Skipf("docker is not available: %s", err)
+	}
+
+	host := startRegistry(t, cli)
+	t.Setenv(authConfigVariable, "")
+	writeDockerConfig(t, dockerConfig{})
+
+	auth, err := registry.EncodeAuthConfig(registry.AuthConfig{Username: registryUser, Password: registryPassword, ServerAddress: host})
+	expectNoError(t, err)
+	private := host + "/pipelinefox/alpine:test"
+	pushImage(t, cli, registryTestImage, private, auth)
+
+	runner, err := NewDockerPipelineRunner(Options{PullPolicy: PullAlways})
+	expectNoError(t, err)
+	job := parserCommon.NewPipelineJobDescriptor("private", "build", []string{"true"}).WithImage(private)
+
+	result, _ := runner.RunPipelineJob(ctx, io.Discard, io.Discard, job)
+	if result.Status != common.JobStatusFailed {
+		t.Fatalf("expected the pull without credentials to fail, got %s", result.Status)
+	}
+
+	config := fmt.Sprintf(`{"auths": {%q: {"auth": %q}}}`, host, basicAuth(registryUser, registryPassword))
+	result, err = runner.RunPipelineJob(ctx, io.Discard, io.Discard, job.WithVariables(map[string]string{authConfigVariable: config}))
+	expectNoError(t, err)
+	if result.Status != common.JobStatusSuccess {
+		t.Fatalf("expected the job to succeed, got %s: %s", result.Status, result.Reason)
+	}
+}
+
+// startRegistry runs registry:2 with htpasswd authentication, returning the
+// host it listens on.
+func startRegistry(t *testing.T, cli client.APIClient) string {
+	t.Helper()
+	ctx := context.Background()
+	pullForTest(t, cli, "registry:2")
+
+	port := nat.Port("5000/tcp")
+	created, err := cli.ContainerCreate(ctx, &container.Config{
+		Image:        "registry:2",
+		ExposedPorts: nat.PortSet{port: {}},
+		Env: []string{
+			"REGISTRY_AUTH=htpasswd",
+			"REGISTRY_AUTH_HTPASSWD_REALM=pipelinefox",
+			"REGISTRY_AUTH_HTPASSWD_PATH=/tmp/htpasswd",
+		},
+	}, &container.HostConfig{
+		PortBindings: nat.PortMap{port: []nat.PortBinding{{HostIP: "127.0.0.1"}}},
+	}, nil, nil, "")
+	expectNoError(t, err)
+	t.Cleanup(func() {
+		cli.ContainerRemove(context.Background(), created.ID, container.RemoveOptions{Force: true, RemoveVolumes: true})
+	})
+
+	payload, err := createPayload(payloadEntry{name: "htpasswd", mode: 0o644, content: []byte(registryHtpasswd)})
+	expectNoError(t, err)
+	expectNoError(t, cli.CopyToContainer(ctx, created.ID, "/tmp", payload, container.CopyToContainerOptions{}))
+	expectNoError(t, cli.ContainerStart(ctx, created.ID, container.StartOptions{}))
+
+	inspect, err := cli.ContainerInspect(ctx, created.ID)
+	expectNoError(t, err)
+	bindings := inspect.NetworkSettings.Ports[port]
+	if len(bindings) == 0 {
+		t.Fatal("registry port is not published")
+	}
+	// Give the registry a moment to listen.
+	time.Sleep(time.Second)
+	return "localhost:" + bindings[0].HostPort
+}
+
+func pullForTest(t *testing.T, cli client.APIClient, ref string) {
+	t.Helper()
+	reader, err := cli.ImagePull(context.Background(), ref, image.PullOptions{})
+	expectNoError(t, err)
+	defer reader.Close()
+	expectNoError(t, jsonmessage.DisplayJSONMessagesStream(reader, io.Discard, 0, false, nil))
+}
+
+// pushImage pushes source to the registry as target, removing target from
+// the daemon so that jobs have to pull it.
+func pushImage(t *testing.T, cli client.APIClient, source, target, auth string) {
+	t.Helper()
+	ctx := context.Background()
+	pullForTest(t, cli, source)
+	expectNoError(t, cli.ImageTag(ctx, source, target))
+
+	reader, err := cli.ImagePush(ctx, target, image.PushOptions{RegistryAuth: auth})
+	expectNoError(t, err)
+	defer reader.Close()
+	expectNoError(t, jsonmessage.DisplayJSONMessagesStream(reader, io.Discard, 0, false, nil))
+
+	remove := func() {
+		cli.ImageRemove(context.Background(), target, image.RemoveOptions{})
+	}
+	remove()
+	t.Cleanup(remove)
+}
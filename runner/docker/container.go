@@ -0,0 +1,222 @@
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/go-units"
+	parserCommon "github.com/powerpixel/pipelinefox/parser/common"
+)
+
+var InvalidContainerOptionErr = errors.New("invalid container option")
+
+// Job variables overriding the container options, the CPU and memory ones
+// of GitLab kubernetes runners being honored as well. Lists are separated by
+// commas or spaces, but the tmpfs mounts, separated by spaces and written
+// as path:options.
+const (
+	containerVariablePrefix = "PIPELINEFOX_DOCKER_"
+	kubernetesCPULimit      = "KUBERNETES_CPU_LIMIT"
+	kubernetesMemoryLimit   = "KUBERNETES_MEMORY_LIMIT"
+)
+
+// ContainerOptions are the resource limits, user and security options of the
+// containers jobs run in. Sizes are written as docker does, such as 512m or
+// 1g, kubernetes units such as 512Mi being accepted as well.
+type ContainerOptions struct {
+	// CPUs is the number of CPUs, such as 1.5, or of millicores, such as
+	// 500m.
+	CPUs string
+	// Memory is the memory limit.
+	Memory string
+	// MemorySwap is the limit of memory and swap together, -1 for an
+	// unlimited swap.
+	MemorySwap string
+	// ShmSize is the size of /dev/shm.
+	ShmSize string
+	// Ulimits are written as docker run --ulimit does, such as
+	// nofile=1024:2048.
+	Ulimits []string
+	CapAdd  []string
+	CapDrop []string
+	// Privileged gives the container every capability and device of the
+	// host.
+	Privileged bool
+	// ReadOnly mounts the root filesystem of the container read-only.
+	ReadOnly bool
+	// Tmpfs holds the tmpfs mounts, keyed by path, their value holding
+	// their options such as rw,size=64m.
+	Tmpfs map[string]string
+	// ExtraHosts are host names added to /etc/hosts, as host:ip.
+	ExtraHosts []string
+	DNS        []string
+	DNSSearch  []string
+	// User runs the scripts of the job, as user, uid or uid:gid.
+	User string
+}
+
+// jobContainerOptions returns options overridden by the variables of job.
+func jobContainerOptions(options ContainerOptions, job parserCommon.PipelineJobDescriptor) (ContainerOptions, error) {
+	variables := job.GetVariables()
+	lookup := func(name string) (string, bool) {
+		value, found := variables[containerVariablePrefix+name]
+		return value, found
+	}
+	list := func(value string) []string {
+		return strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+	flag := func(name string, value string) (bool, error) {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return false, fmt.Errorf("%w: %s%s is not a boolean", InvalidContainerOptionErr, containerVariablePrefix, name)
+		}
+		return enabled, nil
+	}
+
+	if value, found := variables[kubernetesCPULimit]; found {
+		options.CPUs = value
+	}
+	if value, found := variables[kubernetesMemoryLimit]; found {
+		options.Memory = value
+	}
+	for name, field := range map[string]*string{
+		"CPUS":        &options.CPUs,
+		"MEMORY":      &options.Memory,
+		"MEMORY_SWAP": &options.MemorySwap,
+		"SHM_SIZE":    &options.ShmSize,
+		"USER":        &options.User,
+	} {
+		if value, found := lookup(name); found {
+			*field = value
+		}
+	}
+	for name, field := range map[string]*[]string{
+		"ULIMITS":     &options.Ulimits,
+		"CAP_ADD":     &options.CapAdd,
+		"CAP_DROP":    &options.CapDrop,
+		"EXTRA_HOSTS": &options.ExtraHosts,
+		"DNS":         &options.DNS,
+		"DNS_SEARCH":  &options.DNSSearch,
+	} {
+		if value, found := lookup(name); found {
+			*field = list(value)
+		}
+	}
+	for name, field := range map[string]*bool{
+		"PRIVILEGED": &options.Privileged,
+		"READ_ONLY":  &options.ReadOnly,
+	} {
+		if value, found := lookup(name); found {
+			enabled, err := flag(name, value)
+			if err != nil {
+				return ContainerOptions{}, err
+			}
+			*field = enabled
+		}
+	}
+	if value, found := lookup("TMPFS"); found {
+		options.Tmpfs = make(map[string]string)
+		for _, entry := range strings.Fields(value) {
+			target, mountOptions, _ := strings.Cut(entry, ":")
+			options.Tmpfs[target] = mountOptions
+		}
+	}
+	return options, nil
+}
+
+// apply sets the options on the configuration of a container.
+func (o ContainerOptions) apply(config *container.Config, hostConfig *container.HostConfig) error {
+	var err error
+	if o.CPUs != "" {
+		if hostConfig.NanoCPUs, err = parseCPUs(o.CPUs); err != nil {
+			return err
+		}
+	}
+	if hostConfig.Memory, err = parseSize("memory", o.Memory); err != nil {
+		return err
+	}
+	if o.MemorySwap == "-1" {
+		hostConfig.MemorySwap = -1
+	} else if hostConfig.MemorySwap, err = parseSize("memory swap", o.MemorySwap); err != nil {
+		return err
+	}
+	if hostConfig.ShmSize, err = parseSize("shm size", o.ShmSize); err != nil {
+		return err
+	}
+
+	for _, value := range o.Ulimits {
+		ulimit, err := units.ParseUlimit(value)
+		if err != nil {
+			return fmt.Errorf("%w: ulimit %s: %w", InvalidContainerOptionErr, value, err)
+		}
+		hostConfig.Ulimits = append(hostConfig.Ulimits, ulimit)
+	}
+
+	for target := range o.Tmpfs {
+		if !path.IsAbs(target) {
+			return fmt.Errorf("%w: tmpfs path %s is not absolute", InvalidContainerOptionErr, target)
+		}
+		if path.Clean(target) == scriptDir {
+			return fmt.Errorf("%w: tmpfs cannot be mounted on %s, where the scripts of jobs are written", InvalidContainerOptionErr, scriptDir)
+		}
+	}
+	if len(o.Tmpfs) > 0 {
+		hostConfig.Tmpfs = maps.Clone(o.Tmpfs)
+	}
+	// Scripts are copied into scriptDir, which has to remain writable.
+	if o.ReadOnly {
+		hostConfig.Mounts = append(hostConfig.Mounts, mount.Mount{Type: mount.TypeVolume, Target: scriptDir})
+	}
+
+	hostConfig.CapAdd = o.CapAdd
+	hostConfig.CapDrop = o.CapDrop
+	hostConfig.Privileged = o.Privileged
+	hostConfig.ReadonlyRootfs = o.ReadOnly
+	hostConfig.ExtraHosts = o.ExtraHosts
+	hostConfig.DNS = o.DNS
+	hostConfig.DNSSearch = o.DNSSearch
+	config.User = o.User
+	return nil
+}
+
+// validate reports the first invalid option.
+func (o ContainerOptions) validate() error {
+	return o.apply(&container.Config{}, &container.HostConfig{})
+}
+
+// parseCPUs returns the nano CPUs of a number of CPUs, or of millicores
+// when suffixed by m.
+func parseCPUs(value string) (int64, error) {
+	number, milli := strings.CutSuffix(value, "m")
+	cpus, err := strconv.ParseFloat(number, 64)
+	if err != nil || cpus <= 0 {
+		return 0, fmt.Errorf("%w: %s is not a number of CPUs", InvalidContainerOptionErr, value)
+	}
+	if milli {
+		cpus /= 1000
+	}
+	return int64(cpus * 1e9), nil
+}
+
+// parseSize returns the bytes of a size, 0 when empty. Sizes are binary,
+// the kubernetes suffixes, such as Mi, being read as MiB.
+func parseSize(name, value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	written := value
+	if strings.HasSuffix(value, "i") || strings.HasSuffix(value, "I") {
+		written += "B"
+	}
+	size, err := units.RAMInBytes(written)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s %s: %w", InvalidContainerOptionErr, name, value, err)
+	}
+	return size, nil
+}
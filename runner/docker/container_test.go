@@ -0,0 +1,130 @@
+package docker
+
+import (
+	"errors"
+	"maps"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/go-units"
+	parserCommon "github.com/powerpixel/pipelinefox/parser/common"
+)
+
+func TestJobContainerOptions(t *testing.T) {
+	base := ContainerOptions{
+		CPUs:    "2",
+		Memory:  "2g",
+		CapDrop: []string{"NET_RAW"},
+		Tmpfs:   map[string]string{"/run": ""},
+		User:    "1000",
+	}
+	job := parserCommon.NewPipelineJobDescriptor("test", "build", nil).WithVariables(map[string]string{
+		"KUBERNETES_CPU_LIMIT":           "500m",
+		"KUBERNETES_MEMORY_LIMIT":        "256Mi",
+		"PIPELINEFOX_DOCKER_MEMORY_SWAP": "-1",
+		"PIPELINEFOX_DOCKER_CAP_ADD":     "SYS_PTRACE, NET_ADMIN",
+		"PIPELINEFOX_DOCKER_READ_ONLY":   "true",
+		"PIPELINEFOX_DOCKER_TMPFS":       "/cache:rw,size=64m /run",
+		"PIPELINEFOX_DOCKER_USER":        "nobody",
+	})
+
+	got, err := jobContainerOptions(base, job)
+	expectNoError(t, err)
+	expected := ContainerOptions{
+		CPUs:       "500m",
+		Memory:     "256Mi",
+		MemorySwap: "-1",
+		CapAdd:     []string{"SYS_PTRACE", "NET_ADMIN"},
+		CapDrop:    []string{"NET_RAW"},
+		ReadOnly:   true,
+		Tmpfs:      map[string]string{"/cache": "rw,size=64m", "/run": ""},
+		User:       "nobody",
+	}
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %+v, got %+v", expected, got)
+	}
+
+	// The variable of pipelinefox takes precedence over the kubernetes one.
+	job = job.WithVariables(map[string]string{"PIPELINEFOX_DOCKER_CPUS": "1.5"})
+	got, err = jobContainerOptions(base, job)
+	expectNoError(t, err)
+	expectEqualString(t, "1.5", got.CPUs)
+
+	job = job.WithVariables(map[string]string{"PIPELINEFOX_DOCKER_PRIVILEGED": "sometimes"})
+	if _, err := jobContainerOptions(base, job); !errors.Is(err, InvalidContainerOptionErr) {
+		t.Fatalf("expected InvalidContainerOptionErr, got %v", err)
+	}
+}
+
+func TestApplyContainerOptions(t *testing.T) {
+	options := ContainerOptions{
+		CPUs:       "1.5",
+		Memory:     "512m",
+		MemorySwap: "1Gi",
+		ShmSize:    "64m",
+		Ulimits:    []string{"nofile=1024:2048", "nproc=512"},
+		CapAdd:     []string{"SYS_PTRACE"},
+		CapDrop:    []string{"ALL"},
+		ReadOnly:   true,
+		Tmpfs:      map[string]string{"/run": "rw,size=16m"},
+		ExtraHosts: []string{"registry.local:10.0.0.2"},
+		DNS:        []string{"10.0.0.53"},
+		DNSSearch:  []string{"corp.example.com"},
+		User:       "1000:1000",
+	}
+	var config container.Config
+	var hostConfig container.HostConfig
+	expectNoError(t, options.apply(&config, &hostConfig))
+
+	if hostConfig.NanoCPUs != 1_500_000_000 {
+		t.Errorf("expected 1.5 CPUs, got %d nano CPUs", hostConfig.NanoCPUs)
+	}
+	for name, sizes := range map[string][2]int64{
+		"memory":      {512 << 20, hostConfig.Memory},
+		"memory swap": {1 << 30, hostConfig.MemorySwap},
+		"shm size":    {64 << 20, hostConfig.ShmSize},
+	} {
+		if sizes[0] != sizes[1] {
+			t.Errorf("expected %s of %d, got %d", name, sizes[0], sizes[1])
+		}
+	}
+	expectedUlimits := []*units.Ulimit{{Name: "nofile", Soft: 1024, Hard: 2048}, {Name: "nproc", Soft: 512, Hard: 512}}
+	if !reflect.DeepEqual(expectedUlimits, hostConfig.Ulimits) {
+		t.Errorf("expected ulimits %v, got %v", expectedUlimits, hostConfig.Ulimits)
+	}
+	if !hostConfig.ReadonlyRootfs || !slices.Contains(hostConfig.Mounts, mount.Mount{Type: mount.TypeVolume, Target: scriptDir}) {
+		t.Errorf("expected a read-only root filesystem with a volume on %s, got %v", scriptDir, hostConfig.Mounts)
+	}
+	if !maps.Equal(options.Tmpfs, hostConfig.Tmpfs) {
+		t.Errorf("expected tmpfs %v, got %v", options.Tmpfs, hostConfig.Tmpfs)
+	}
+	if !slices.Equal(options.CapAdd, hostConfig.CapAdd) || !slices.Equal(options.CapDrop, hostConfig.CapDrop) {
+		t.Errorf("expected capabilities +%v -%v, got +%v -%v", options.CapAdd, options.CapDrop, hostConfig.CapAdd, hostConfig.CapDrop)
+	}
+	if !slices.Equal(options.ExtraHosts, hostConfig.ExtraHosts) || !slices.Equal(options.DNS, hostConfig.DNS) || !slices.Equal(options.DNSSearch, hostConfig.DNSSearch) {
+		t.Errorf("expected hosts %v and dns %v %v, got %v and %v %v", options.ExtraHosts, options.DNS, options.DNSSearch, hostConfig.ExtraHosts, hostConfig.DNS, hostConfig.DNSSearch)
+	}
+	expectEqualString(t, "1000:1000", config.User)
+}
+
+func TestInvalidContainerOptions(t *testing.T) {
+	cases := map[string]ContainerOptions{
+		"cpus":          {CPUs: "many"},
+		"zero cpus":     {CPUs: "0"},
+		"memory":        {Memory: "lots"},
+		"ulimit":        {Ulimits: []string{"nofile"}},
+		"relative path": {Tmpfs: map[string]string{"run": ""}},
+		"script dir":    {Tmpfs: map[string]string{scriptDir + "/": ""}},
+	}
+	for name, options := range cases {
+		if err := options.validate(); !errors.Is(err, InvalidContainerOptionErr) {
+			t.Errorf("%s: expected InvalidContainerOptionErr, got %v", name, err)
+		}
+		if _, err := NewDockerPipelineRunner(Options{Container: options}); !errors.Is(err, InvalidContainerOptionErr) {
+			t.Errorf("%s: expected the runner creation to fail with InvalidContainerOptionErr, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	parserCommon "github.com/powerpixel/pipelinefox/parser/common"
+	"github.com/powerpixel/pipelinefox/runner/common"
+)
+
+// debugShellCmd opens bash when the image has it, sh otherwise.
+var debugShellCmd = []string{"sh", "-c", "command -v bash >/dev/null 2>&1 && exec bash || exec sh"}
+
+// debugFailedJob opens a debug shell in the container of a failed job, called
+// name, then reports whether the container and services of the job are kept.
+func (d dockerPipelineRunner) debugFailedJob(ctx context.Context, job parserCommon.PipelineJobDescriptor, result common.JobResult, containerId, name string, services jobServices) bool {
+	if d.options.DebugShell != nil {
+		if err := d.openDebugShell(ctx, job, result, containerId); err != nil {
+			d.warn(job, "could not open a debug shell: %s", err)
+		}
+	}
+	if !d.options.KeepOnFailure {
+		return false
+	}
+
+	cleanup := []string{strings.Join(append([]string{"docker rm -f -v", name}, services.containers...), " ")}
+	if services.network != "" {
+		cleanup = append(cleanup, "docker network rm "+services.network)
+	}
+	if len(services.volumes) > 0 {
+		cleanup = append(cleanup, "docker volume rm "+strings.Join(services.volumes, " "))
+	}
+	d.options.Events.Publish(common.ContainerKept{
+		Time:      time.Now(),
+		Job:       job.GetName(),
+		Container: name,
+		Shell:     "docker exec -it " + name + " sh",
+		Cleanup:   cleanup,
+	})
+	return true
+}
+
+// openDebugShell opens a shell in the container of the failed job, once the
+// terminal is no longer used by other jobs.
+func (d dockerPipelineRunner) openDebugShell(ctx context.Context, job parserCommon.PipelineJobDescriptor, result common.JobResult, containerId string) error {
+	t := d.options.DebugShell
+	t.Lock()
+	defer t.Unlock()
+
+	fmt.Fprintf(t, "Job %s failed: %s. Opening a shell in its container, exit it to go on.\n", job.GetName(), result.Reason)
+	// The shell is opened even when the job timed out.
+	return d.attachShell(context.WithoutCancel(ctx), t, containerId)
+}
+
+// attachShell attaches t to an interactive shell run in the container, with
+// the environment and working directory of its job, until the shell exits.
+// The caller holds the lock of t.
+func (d dockerPipelineRunner) attachShell(ctx context.Context, t *common.Terminal, containerId string) error {
+	options := container.ExecOptions{
+		Cmd:          debugShellCmd,
+		Tty:          true,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+	}
+	if width, height, err := t.Size(); err == nil {
+		options.ConsoleSize = &[2]uint{uint(height), uint(width)}
+	}
+
+	execResp, err := d.cli.ContainerExecCreate(ctx, containerId, options)
+	if err != nil {
+		return err
+	}
+	attachResp, err := d.cli.ContainerExecAttach(ctx, execResp.ID, container.ExecStartOptions{Tty: true, ConsoleSize: options.ConsoleSize})
+	if err != nil {
+		return err
+	}
+	defer attachResp.Close()
+
+	output := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(t, attachResp.Reader)
+		output <- err
+	}()
+	return t.Attach(attachResp.Conn, output, attachResp.CloseWrite)
+}
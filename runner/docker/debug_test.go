@@ -0,0 +1,109 @@
+package docker
+
+import (
+	"context"
+	"io"
+	"slices"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	parserCommon "github.com/powerpixel/pipelinefox/parser/common"
+	"github.com/powerpixel/pipelinefox/runner/common"
+)
+
+func TestKeptContainerCleanup(t *testing.T) {
+	events := common.NewEventBus()
+	var kept []common.ContainerKept
+	events.Subscribe(func(event common.Event) {
+		if e, ok := event.(common.ContainerKept); ok {
+			kept = append(kept, e)
+		}
+	})
+
+	job := parserCommon.NewPipelineJobDescriptor("build", "build", nil)
+	services := jobServices{
+		network:    "pipelinefox_build_0a1b2c3d",
+		containers: []string{"c0ffee"},
+		volumes:    []string{"pipelinefox_build_0a1b2c3d_certs"},
+	}
+
+	runner := dockerPipelineRunner{options: Options{RunnerOptions: common.RunnerOptions{Events: events}}}
+	if runner.debugFailedJob(context.Background(), job, common.JobResult{}, "id", "pipelinefox_build_4e5f6a7b", services) {
+		t.Fatal("expected the container not to be kept without KeepOnFailure")
+	}
+
+	runner.options.KeepOnFailure = true
+	if !runner.debugFailedJob(context.Background(), job, common.JobResult{}, "id", "pipelinefox_build_4e5f6a7b", services) {
+		t.Fatal("expected the container to be kept")
+	}
+	if len(kept) != 1 {
+		t.Fatalf("expected one kept container, got %v", kept)
+	}
+	expectEqualString(t, "pipelinefox_build_4e5f6a7b", kept[0].Container)
+	expectEqualString(t, "docker exec -it pipelinefox_build_4e5f6a7b sh", kept[0].Shell)
+	expectedCleanup := []string{
+		"docker rm -f -v pipelinefox_build_4e5f6a7b c0ffee",
+		"docker network rm pipelinefox_build_0a1b2c3d",
+		"docker volume rm pipelinefox_build_0a1b2c3d_certs",
+	}
+	if !slices.Equal(expectedCleanup, kept[0].Cleanup) {
+		t.Fatalf("expected cleanup %v, got %v", expectedCleanup, kept[0].Cleanup)
+	}
+}
+
+func TestKeepOnFailure(t *testing.T) {
+	ctx := context.Background()
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	expectNoError(t, err)
+	if _, err := cli.Ping(ctx); err != nil {
+		t.Skipf("docker is not available: %s", err)
+	}
+
+	runner, err := NewDockerPipelineRunner(Options{KeepOnFailure: true})
+	expectNoError(t, err)
+
+	jobContainers := func(name string) []container.Summary {
+		t.Helper()
+		containers, err := cli.ContainerList(ctx, container.ListOptions{All: true, Filters: filters.NewArgs(filters.Arg("name", prefix+name+"_"))})
+		expectNoError(t, err)
+		return containers
+	}
+	t.Cleanup(func() {
+		for _, kept := range jobContainers("kept") {
+			cli.ContainerRemove(context.Background(), kept.ID, container.RemoveOptions{Force: true, RemoveVolumes: true})
+		}
+	})
+
+	// The container kept from the first run does not keep the job from
+	// running again.
+	job := parserCommon.NewPipelineJobDescriptor("kept", "test", []string{"echo kept > /tmp/state", "exit 3"}).WithImage("alpine:3.20")
+	for range 2 {
+		result, err := runner.RunPipelineJob(ctx, io.Discard, io.Discard, job)
+		expectNoError(t, err)
+		if result.Status != common.JobStatusFailed {
+			t.Fatalf("expected the job to fail, got %s: %s", result.Status, result.Reason)
+		}
+	}
+
+	kept := jobContainers("kept")
+	if len(kept) != 2 {
+		t.Fatalf("expected the containers of both runs to be kept, got %d", len(kept))
+	}
+	for _, c := range kept {
+		if c.State != "running" {
+			t.Fatalf("expected the kept container to be running, got %s", c.State)
+		}
+	}
+
+	success := parserCommon.NewPipelineJobDescriptor("removed", "test", []string{"true"}).WithImage("alpine:3.20")
+	result, err := runner.RunPipelineJob(ctx, io.Discard, io.Discard, success)
+	expectNoError(t, err)
+	if result.Status != common.JobStatusSuccess {
+		t.Fatalf("expected the job to succeed, got %s: %s", result.Status, result.Reason)
+	}
+	if removed := jobContainers("removed"); len(removed) > 0 {
+		t.Fatalf("expected the container of the successful job to be removed, got %v", removed)
+	}
+}
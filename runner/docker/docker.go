@@ -1,251 +1,729 @@
-package docker
-
-import (
-	"archive/tar"
-	"bufio"
-	"bytes"
-	"context"
-	"fmt"
-	"io"
-	"time"
-
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/image"
-	"github.com/docker/docker/api/types/network"
-	"github.com/docker/docker/client"
-	"github.com/docker/docker/pkg/stdcopy"
-	v1 "github.com/opencontainers/image-spec/specs-go/v1"
-	parserCommon "github.com/powerpixel/pipelinefox/parser/common"
-	"github.com/powerpixel/pipelinefox/runner/common"
-	"github.com/powerpixel/pipelinefox/shell"
-)
-
-const (
-	defaultImage = "ubuntu:25.10"
-	prefix       = "pipelinefox_"
-)
-
-type dockerPipelineRunner struct {
-	cli client.APIClient
-}
-
-func (d dockerPipelineRunner) RunPipeline(stdout, stderr io.Writer, pipeline parserCommon.PipelineDescriptor) (err error) {
-	for stage, jobs := range pipeline.GetStages() {
-		err := d.runJobs(stdout, stderr, stage, jobs)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func (d dockerPipelineRunner) runJobs(stdout, stderr io.Writer, stage string, jobs []parserCommon.PipelineJobDescriptor) error {
-	fmt.Printf("Running stage %s\n", stage)
-	for _, job := range jobs {
-		err := d.RunPipelineJob(stdout, stderr, job)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func (d dockerPipelineRunner) RunPipelineJob(stdout, stderr io.Writer, job parserCommon.PipelineJobDescriptor) error {
-	ctx := context.Background()
-	image := d.getImageFromJob(job)
-
-	if err := d.checkImageExistence(ctx, image); err != nil {
-		if err := d.pullImage(ctx, image); err != nil {
-			return fmt.Errorf("failed to pull image %s: %w", image, err)
-		}
-	}
-
-	createResp, err := d.createContainerForJob(ctx, job, image)
-	if err != nil {
-		return err
-	}
-
-	defer d.removeContainer(ctx, createResp.ID)
-
-	if err = d.startContainer(ctx, createResp.ID); err != nil {
-		return err
-	}
-	d.waitForContainer(ctx, createResp.ID)
-
-	if err = d.injectScriptIntoContainer(ctx, job, createResp.ID); err != nil {
-		return fmt.Errorf("failed to inject script into container: %w", err)
-	}
-
-	execResp, err := d.cli.ContainerExecCreate(ctx, createResp.ID, container.ExecOptions{
-		Cmd:          []string{"sh", "-c", "/tmp/ppfox-bootstrap.sh"},
-		AttachStdout: true,
-		AttachStderr: true,
-		Tty:          false,
-	})
-
-	if err != nil {
-		return err
-	}
-
-	attachResp, err := d.cli.ContainerExecAttach(ctx, execResp.ID, container.ExecStartOptions{
-		Tty: false,
-	})
-
-	if err != nil {
-		return err
-	}
-	defer attachResp.Close()
-
-	_, err = stdcopy.StdCopy(stdout, stderr, attachResp.Reader)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (d dockerPipelineRunner) injectScriptIntoContainer(ctx context.Context, job parserCommon.PipelineJobDescriptor, containerId string) error {
-	var scriptBuffer bytes.Buffer
-	scriptBuffer.Reset()
-
-	err := shell.CreateShellScriptFromCommands(&scriptBuffer, job.GetScript())
-
-	if err != nil {
-		return err
-	}
-
-	payload, err := d.createScriptPayload(ctx, scriptBuffer)
-
-	if err != nil {
-		return err
-	}
-
-	return d.cli.CopyToContainer(ctx, containerId, "/tmp", payload, container.CopyToContainerOptions{})
-}
-
-func (d dockerPipelineRunner) createScriptPayload(ctx context.Context, scriptBuffer bytes.Buffer) (*bytes.Buffer, error) {
-	tarBuffer := new(bytes.Buffer)
-	tarWriter := tar.NewWriter(tarBuffer)
-
-	header := &tar.Header{
-		Name: "ppfox-bootstrap.sh",
-		Mode: 0755,
-		Size: int64(scriptBuffer.Len()),
-	}
-
-	if err := tarWriter.WriteHeader(header); err != nil {
-		return tarBuffer, err
-	}
-
-	if _, err := io.Copy(tarWriter, &scriptBuffer); err != nil {
-		return tarBuffer, err
-	}
-
-	if err := tarWriter.Close(); err != nil {
-		return tarBuffer, err
-	}
-
-	return tarBuffer, nil
-}
-
-func (d dockerPipelineRunner) startContainer(ctx context.Context, containerID string) error {
-	if err := d.cli.ContainerStart(ctx, containerID, container.StartOptions{}); err != nil {
-		return err
-	}
-
-	if _, err := d.cli.ContainerInspect(ctx, containerID); err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (d dockerPipelineRunner) createContainerForJob(ctx context.Context, job parserCommon.PipelineJobDescriptor, image string) (*container.CreateResponse, error) {
-	createResp, err := d.cli.ContainerCreate(
-		ctx,
-		&container.Config{
-			Image:       image,
-			AttachStdin: true,
-			Tty:         false,
-			Cmd:         []string{"tail", "-f", "/dev/null"},
-			OpenStdin:   true,
-		},
-		&container.HostConfig{},
-		&network.NetworkingConfig{},
-		v1.DescriptorEmptyJSON.Platform,
-		prefix+job.GetName(),
-	)
-
-	if err != nil {
-		return nil, err
-	}
-
-	for warning := range createResp.Warnings {
-		fmt.Print(warning)
-	}
-
-	return &createResp, nil
-}
-
-func (d dockerPipelineRunner) removeContainer(ctx context.Context, containerId string) {
-	if containerId == "" {
-		return
-	}
-	fmt.Printf("Deleting container %s...\n", containerId)
-	err := d.cli.ContainerRemove(ctx, containerId, container.RemoveOptions{Force: true, RemoveVolumes: true})
-	if err != nil {
-		panic(fmt.Sprintf("Could not delete container %s : %s\n", containerId, err.Error()))
-	}
-}
-
-func (d dockerPipelineRunner) waitForContainer(ctx context.Context, id string) {
-	inspectResp, err := d.cli.ContainerInspect(ctx, id)
-	for err != nil && !inspectResp.State.Running {
-		time.Sleep(100 * time.Millisecond)
-		inspectResp, err = d.cli.ContainerInspect(ctx, id)
-	}
-}
-
-func (d dockerPipelineRunner) checkImageExistence(ctx context.Context, image string) error {
-	_, err := d.cli.ImageInspect(ctx, image)
-	return err
-}
-
-func (d dockerPipelineRunner) pullImage(ctx context.Context, img string) error {
-	io, err := d.cli.ImagePull(ctx, img, image.PullOptions{})
-
-	if err != nil {
-		return err
-	}
-	defer io.Close()
-	scanner := bufio.NewScanner(io)
-
-	for scanner.Scan() {
-		if scanner.Err() != nil {
-			fmt.Print(scanner.Text())
-			return scanner.Err()
-		}
-	}
-	return nil
-}
-
-func (d dockerPipelineRunner) getImageFromJob(_ parserCommon.PipelineJobDescriptor) string {
-	// TODO : add fetching image from job descriptor
-	return defaultImage
-}
-
-func NewDockerPipelineRunner() (common.PipelineRunner, error) {
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
-	if err != nil {
-		return nil, err
-	}
-
-	return dockerPipelineRunner{
-		cli,
-	}, checkDockerExistence(cli)
-}
-
-func checkDockerExistence(cli *client.Client) error {
-	_, err := cli.Info(context.Background())
-	return err
-}
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/docker/pkg/stdcopy"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	parserCommon "github.com/powerpixel/pipelinefox/parser/common"
+	"github.com/powerpixel/pipelinefox/runner/common"
+	"github.com/powerpixel/pipelinefox/shell"
+)
+
+const (
+	defaultImage    = "ubuntu:25.10"
+	prefix          = "pipelinefox_"
+	scriptDir       = "/tmp"
+	scriptFile      = "ppfox-bootstrap"
+	afterScriptFile = "ppfox-after-script"
+	// variablesDir is the directory, in scriptDir, holding the files of
+	// the file variables.
+	variablesDir = "ppfox-variables"
+)
+
+// killTreeScript signals a process and all its descendants, children first
+// being collected before the parent so that none of them gets reparented.
+const killTreeScript = `kill_tree() {
+	for child in $(cat /proc/$1/task/*/children 2>/dev/null); do
+		kill_tree "$child" "$2"
+	done
+	kill -"$2" "$1" 2>/dev/null
+}
+[ -f %[1]s ] && kill_tree "$(cat %[1]s)" %[2]s
+true`
+
+// Policies deciding when the image of a job is pulled.
+const (
+	PullAlways       = "always"
+	PullIfNotPresent = "if-not-present"
+	PullNever        = "never"
+)
+
+var UnknownPullPolicyErr = errors.New("unknown pull policy, expected always, if-not-present or never")
+
+// Options configures the docker runner.
+type Options struct {
+	common.RunnerOptions
+	// DefaultImage is the image of the jobs declaring none, ubuntu when
+	// empty.
+	DefaultImage string
+	// ImageOverrides replaces the images of jobs, keyed by the image
+	// replaced.
+	ImageOverrides map[string]string
+	// Mirrors holds the registries images are pulled from instead of the
+	// ones keyed, e.g. docker.io to mirror.example.com/dockerhub.
+	Mirrors map[string]string
+	// Rewrites replaces the images of jobs and services, the first rule
+	// matching an image applying. They apply after overrides and before
+	// mirrors.
+	Rewrites []RewriteRule
+	// PullPolicy tells when images are pulled, if-not-present when empty.
+	PullPolicy string
+	// Offline refuses every pull, images having to be present locally.
+	Offline bool
+	// HostSocket gives jobs the docker socket of the host instead of
+	// starting their docker:dind services. Jobs then control every container
+	// of the host; the images and volumes they create are left to the user
+	// to remove, the daemon not telling them apart from the others.
+	HostSocket bool
+	// Container holds the resource limits, user and security options of the
+	// containers of jobs, which their variables may override.
+	Container ContainerOptions
+	// KeepOnFailure keeps the containers and services of failed jobs, for
+	// them to be inspected.
+	KeepOnFailure bool
+	// DebugShell is the terminal an interactive shell in the container of
+	// failed jobs is attached to, before it is removed. Nil disables it.
+	DebugShell *common.Terminal
+}
+
+type dockerPipelineRunner struct {
+	cli     client.APIClient
+	options Options
+}
+
+func (d dockerPipelineRunner) RunPipeline(ctx context.Context, stdout, stderr io.Writer, pipeline parserCommon.PipelineDescriptor) (common.PipelineResult, error) {
+	return common.RunStages(ctx, d.options.RunnerOptions, stdout, stderr, pipeline, d.RunPipelineJob, d.jobEnvironment)
+}
+
+// jobEnvironment identifies the image job runs in by its ID, the image
+// being first made available according to the pull policies. The job is
+// then run in the image of that ID, without pulling it again.
+func (d dockerPipelineRunner) jobEnvironment(ctx context.Context, job parserCommon.PipelineJobDescriptor) (string, common.JobFunc, error) {
+	image := d.getImageFromJob(job)
+	if err := d.ensureImage(ctx, job, image); err != nil {
+		return "", nil, err
+	}
+	inspect, err := d.cli.ImageInspect(ctx, image)
+	if err != nil {
+		return "", nil, err
+	}
+	run := func(ctx context.Context, stdout, stderr io.Writer, job parserCommon.PipelineJobDescriptor) (common.JobResult, error) {
+		return d.runPipelineJob(ctx, stdout, stderr, job, inspect.ID)
+	}
+	return "docker " + image + "@" + inspect.ID, run, nil
+}
+
+func (d dockerPipelineRunner) RunPipelineJob(ctx context.Context, stdout, stderr io.Writer, job parserCommon.PipelineJobDescriptor) (common.JobResult, error) {
+	return d.runPipelineJob(ctx, stdout, stderr, job, "")
+}
+
+// runPipelineJob runs job in the image of ID imageID, or in the one of job
+// made available according to the pull policies when imageID is empty.
+func (d dockerPipelineRunner) runPipelineJob(ctx context.Context, stdout, stderr io.Writer, job parserCommon.PipelineJobDescriptor, imageID string) (common.JobResult, error) {
+	job = d.options.PrepareJob(job)
+	return common.ObserveJob(ctx, d.options.RunnerOptions, job, stdout, stderr, func(ctx context.Context, stdout, stderr io.Writer) (common.JobResult, error) {
+		return d.runJob(ctx, stdout, stderr, job, imageID)
+	})
+}
+
+func (d dockerPipelineRunner) runJob(ctx context.Context, stdout, stderr io.Writer, job parserCommon.PipelineJobDescriptor, imageID string) (common.JobResult, error) {
+	result := common.NewJobResult(job)
+
+	ctx, cancel := common.JobContext(ctx, job.GetTimeout())
+	defer cancel()
+
+	files, paths := fileVariables(d.options.Secrets)
+	job = job.WithVariables(paths)
+
+	image := imageID
+	if image == "" {
+		image = d.getImageFromJob(job)
+		if err := d.ensureImage(ctx, job, image); err != nil {
+			return result.Finish(ctx, 0, err)
+		}
+	}
+
+	// The container and services of a failed job may be kept for debugging.
+	kept := false
+	services, err := d.startServices(ctx, job)
+	defer func() {
+		if !kept {
+			d.removeServices(ctx, job, services)
+		}
+	}()
+	if err != nil {
+		return result.Finish(ctx, 0, err)
+	}
+
+	socket := ""
+	if d.options.HostSocket {
+		if socket, err = d.hostSocketPath(); err != nil {
+			return result.Finish(ctx, 0, err)
+		}
+		d.warn(job, "the docker socket of the host is given to the job, which can control every container and gain root access to the host")
+		defer d.warn(job, "the images and volumes the job created through the docker socket are left on the host, `docker image prune` and `docker volume prune` remove the unused ones")
+
+		job = job.WithVariables(map[string]string{
+			"DOCKER_HOST":       "unix://" + hostSocket,
+			"DOCKER_TLS_VERIFY": "",
+			"DOCKER_CERT_PATH":  "",
+		})
+	}
+
+	name := uniqueName(job)
+	createResp, err := d.createContainerForJob(ctx, job, name, image, services, socket)
+	if err != nil {
+		return result.Finish(ctx, 0, err)
+	}
+
+	defer func() {
+		if !kept {
+			d.removeContainer(ctx, job, createResp.ID)
+		}
+	}()
+
+	if err = d.startContainer(ctx, createResp.ID); err != nil {
+		return result.Finish(ctx, 0, err)
+	}
+	d.waitForContainer(ctx, createResp.ID)
+
+	if len(files) > 0 {
+		if err = d.copyToContainer(ctx, createResp.ID, files...); err != nil {
+			return result.Finish(ctx, 0, fmt.Errorf("failed to write file variables into container: %w", err))
+		}
+	}
+
+	if received := job.GetReceivedArtifacts(); len(received) > 0 {
+		if err = (containerWorkspace{d, createResp.ID}).WriteArtifacts(ctx, received); err != nil {
+			return result.Finish(ctx, 0, fmt.Errorf("failed to write the artifacts it receives into container: %w", err))
+		}
+	}
+
+	jobShell, err := d.options.JobShell(ctx, job, func(ctx context.Context) (string, error) {
+		return d.detectShell(ctx, createResp.ID)
+	})
+	if err != nil {
+		return result.Finish(ctx, 0, err)
+	}
+
+	stepped := d.options.Step != nil
+	if stepped && !jobShell.Steps {
+		d.warn(job, "the scripts of shell %s cannot be stepped, the job runs straight", jobShell.Name)
+		stepped = false
+	}
+	scriptOut := stdout
+	if stepped {
+		stepper, err := d.injectSteppedScript(ctx, stdout, job, jobShell, createResp.ID)
+		if err != nil {
+			return result.Finish(ctx, 0, fmt.Errorf("failed to inject script into container: %w", err))
+		}
+		scriptOut = stepper
+	} else if err = d.injectScriptIntoContainer(ctx, jobShell, job.GetStepScript(), scriptFile, createResp.ID); err != nil {
+		return result.Finish(ctx, 0, fmt.Errorf("failed to inject script into container: %w", err))
+	}
+
+	shell.WriteSectionStart(stdout, shell.StepScriptSection, shell.StepScriptHeader, false)
+	exitCode, err := d.runScript(ctx, scriptOut, stderr, job, jobShell, createResp.ID, scriptFile)
+	if stepper, ok := scriptOut.(*common.StepWriter); ok {
+		stepper.Flush()
+	}
+	shell.WriteSectionEnd(stdout, shell.StepScriptSection)
+
+	if afterErr := d.runAfterScript(ctx, stdout, stderr, job, jobShell, createResp.ID); afterErr != nil {
+		d.warn(job, "after_script failed: %s", afterErr)
+	}
+
+	result = common.CollectReports(ctx, d.options.RunnerOptions, job, containerWorkspace{d, createResp.ID}, result)
+
+	result, err = result.Finish(ctx, exitCode, err)
+	if result.Status == common.JobStatusFailed {
+		kept = d.debugFailedJob(ctx, job, result, createResp.ID, name, services)
+	}
+	return result, err
+}
+
+// runAfterScript runs the after_script of the job once its script is over,
+// even when the job was canceled or timed out.
+func (d dockerPipelineRunner) runAfterScript(ctx context.Context, stdout, stderr io.Writer, job parserCommon.PipelineJobDescriptor, jobShell shell.Shell, containerId string) error {
+	if len(job.GetAfterScript()) == 0 {
+		return nil
+	}
+
+	afterCtx, cancel := common.GracefulContext(ctx, common.AfterScriptTimeout)
+	defer cancel()
+
+	if err := d.injectScriptIntoContainer(afterCtx, jobShell, job.GetAfterScript(), afterScriptFile, containerId); err != nil {
+		return fmt.Errorf("failed to inject after_script into container: %w", err)
+	}
+
+	shell.WriteSectionStart(stdout, shell.AfterScriptSection, shell.AfterScriptHeader, false)
+	exitCode, err := d.runScript(afterCtx, stdout, stderr, job, jobShell, containerId, afterScriptFile)
+	shell.WriteSectionEnd(stdout, shell.AfterScriptSection)
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("exited with status %d", exitCode)
+	}
+	return afterCtx.Err()
+}
+
+// runScript executes with its shell a script previously injected in the
+// container, streams its output and returns its exit code. The script is
+// started through sh, which records its PID. When ctx is done, the script
+// processes are stopped gracefully before the stream is forcibly closed.
+func (d dockerPipelineRunner) runScript(ctx context.Context, stdout, stderr io.Writer, job parserCommon.PipelineJobDescriptor, jobShell shell.Shell, containerId, script string) (int, error) {
+	execCtx := context.WithoutCancel(ctx)
+
+	path := scriptDir + "/" + script + jobShell.Extension
+	cmd := append([]string{"sh", "-c", `echo $$ > "$0" && exec "$@"`, path + ".pid"}, jobShell.Command...)
+	execResp, err := d.cli.ContainerExecCreate(execCtx, containerId, container.ExecOptions{
+		Cmd:          append(cmd, path),
+		AttachStdout: true,
+		AttachStderr: true,
+		Tty:          false,
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	attachResp, err := d.cli.ContainerExecAttach(execCtx, execResp.ID, container.ExecStartOptions{
+		Tty: false,
+	})
+
+	if err != nil {
+		return 0, err
+	}
+	defer attachResp.Close()
+
+	copyDone := make(chan error, 1)
+	go func() {
+		_, err := stdcopy.StdCopy(stdout, stderr, attachResp.Reader)
+		copyDone <- err
+	}()
+
+	select {
+	case err = <-copyDone:
+		if err != nil {
+			return 0, err
+		}
+		return d.getExitCode(execCtx, execResp.ID)
+	case <-ctx.Done():
+	}
+
+	stopCtx, cancel := common.GracefulContext(ctx, common.StopGracePeriod)
+	defer cancel()
+
+	d.stopScript(stopCtx, job, containerId, script+jobShell.Extension)
+
+	select {
+	case <-copyDone:
+	case <-stopCtx.Done():
+		attachResp.Close()
+		<-copyDone
+	}
+	return d.getExitCode(execCtx, execResp.ID)
+}
+
+func (d dockerPipelineRunner) getExitCode(ctx context.Context, execId string) (int, error) {
+	inspectResp, err := d.cli.ContainerExecInspect(ctx, execId)
+	if err != nil {
+		return 0, err
+	}
+	return inspectResp.ExitCode, nil
+}
+
+// stopScript sends SIGTERM to the script process tree, then SIGKILL once ctx
+// is done if processes are still alive.
+func (d dockerPipelineRunner) stopScript(ctx context.Context, job parserCommon.PipelineJobDescriptor, containerId, script string) {
+	pidFile := scriptDir + "/" + script + ".pid"
+
+	if err := d.signalScript(ctx, containerId, pidFile, "TERM"); err != nil {
+		d.warn(job, "could not stop script %s in container %s : %s", script, containerId, err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		killCtx, cancel := common.CleanupContext(ctx)
+		defer cancel()
+		_ = d.signalScript(killCtx, containerId, pidFile, "KILL")
+	}()
+}
+
+func (d dockerPipelineRunner) signalScript(ctx context.Context, containerId, pidFile, signal string) error {
+	execResp, err := d.cli.ContainerExecCreate(ctx, containerId, container.ExecOptions{
+		Cmd: []string{"sh", "-c", fmt.Sprintf(killTreeScript, pidFile, signal)},
+	})
+	if err != nil {
+		return err
+	}
+
+	return d.cli.ContainerExecStart(ctx, execResp.ID, container.ExecStartOptions{})
+}
+
+// injectScriptIntoContainer writes the script running commands in the
+// scriptDir of the container, name getting the extension of jobShell.
+func (d dockerPipelineRunner) injectScriptIntoContainer(ctx context.Context, jobShell shell.Shell, commands []string, name string, containerId string) error {
+	var scriptBuffer bytes.Buffer
+
+	if err := jobShell.CreateScript(&scriptBuffer, commands); err != nil {
+		return err
+	}
+
+	return d.copyToContainer(ctx, containerId, payloadEntry{name: name + jobShell.Extension, mode: 0755, content: scriptBuffer.Bytes()})
+}
+
+// copyToContainer writes entries in the scriptDir of the container, owned by
+// its user for jobs not run as root to read them.
+func (d dockerPipelineRunner) copyToContainer(ctx context.Context, containerId string, entries ...payloadEntry) error {
+	payload, err := createPayload(entries...)
+	if err != nil {
+		return err
+	}
+
+	return d.cli.CopyToContainer(ctx, containerId, scriptDir, payload, container.CopyToContainerOptions{CopyUIDGID: true})
+}
+
+// payloadEntry is a file or a directory of an archive copied into a
+// container.
+type payloadEntry struct {
+	name    string
+	mode    int64
+	content []byte
+	dir     bool
+}
+
+func createPayload(entries ...payloadEntry) (*bytes.Buffer, error) {
+	tarBuffer := new(bytes.Buffer)
+	tarWriter := tar.NewWriter(tarBuffer)
+
+	for _, entry := range entries {
+		header := &tar.Header{
+			Name:     entry.name,
+			Mode:     entry.mode,
+			Size:     int64(len(entry.content)),
+			Typeflag: tar.TypeReg,
+		}
+		if entry.dir {
+			header.Typeflag = tar.TypeDir
+		}
+
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return tarBuffer, err
+		}
+		if _, err := tarWriter.Write(entry.content); err != nil {
+			return tarBuffer, err
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return tarBuffer, err
+	}
+
+	return tarBuffer, nil
+}
+
+// fileVariables returns the entries writing the file secrets into the
+// container, readable by its user only, along with the variables holding
+// their path.
+func fileVariables(secrets []common.Secret) ([]payloadEntry, map[string]string) {
+	var entries []payloadEntry
+	paths := make(map[string]string)
+
+	for _, secret := range secrets {
+		if !secret.File {
+			continue
+		}
+		if entries == nil {
+			entries = append(entries, payloadEntry{name: variablesDir + "/", mode: 0700, dir: true})
+		}
+		name := variablesDir + "/" + secret.Name
+		entries = append(entries, payloadEntry{name: name, mode: 0600, content: []byte(secret.Value)})
+		paths[secret.Name] = scriptDir + "/" + name
+	}
+	return entries, paths
+}
+
+func (d dockerPipelineRunner) startContainer(ctx context.Context, containerID string) error {
+	if err := d.cli.ContainerStart(ctx, containerID, container.StartOptions{}); err != nil {
+		return err
+	}
+
+	if _, err := d.cli.ContainerInspect(ctx, containerID); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// createContainerForJob creates the container of job called name with the
+// container options its variables override, on the network of its services
+// and, when socket is not empty, with the docker socket of the host at socket
+// mounted.
+func (d dockerPipelineRunner) createContainerForJob(ctx context.Context, job parserCommon.PipelineJobDescriptor, name, image string, services jobServices, socket string) (*container.CreateResponse, error) {
+	config := &container.Config{
+		Image:       image,
+		Env:         jobEnv(job),
+		AttachStdin: true,
+		Tty:         false,
+		Cmd:         []string{"tail", "-f", "/dev/null"},
+		OpenStdin:   true,
+	}
+	hostConfig := &container.HostConfig{}
+	options, err := jobContainerOptions(d.options.Container, job)
+	if err != nil {
+		return nil, err
+	}
+	if err := options.apply(config, hostConfig); err != nil {
+		return nil, err
+	}
+	if options.Privileged {
+		d.warn(job, "the job runs privileged, with full access to the host")
+	}
+
+	networking := &network.NetworkingConfig{}
+	if services.network != "" {
+		hostConfig.NetworkMode = container.NetworkMode(services.network)
+		networking.EndpointsConfig = map[string]*network.EndpointSettings{services.network: {}}
+	}
+	if services.certs != "" {
+		hostConfig.Mounts = append(hostConfig.Mounts, mount.Mount{Type: mount.TypeVolume, Source: services.certs, Target: dindCertsDir, ReadOnly: true})
+	}
+	if socket != "" {
+		hostConfig.Mounts = append(hostConfig.Mounts, mount.Mount{Type: mount.TypeBind, Source: socket, Target: hostSocket})
+	}
+
+	createResp, err := d.cli.ContainerCreate(
+		ctx,
+		config,
+		hostConfig,
+		networking,
+		v1.DescriptorEmptyJSON.Platform,
+		name,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, warning := range createResp.Warnings {
+		d.warn(job, "%s", warning)
+	}
+
+	return &createResp, nil
+}
+
+// jobEnv returns the variables of job as KEY=value pairs.
+func jobEnv(job parserCommon.PipelineJobDescriptor) []string {
+	var env []string
+	for _, name := range slices.Sorted(maps.Keys(job.GetVariables())) {
+		env = append(env, name+"="+job.GetVariables()[name])
+	}
+	return env
+}
+
+// removeContainer deletes the container even if ctx was canceled, so that no
+// pipelinefox_ container outlives the run.
+func (d dockerPipelineRunner) removeContainer(ctx context.Context, job parserCommon.PipelineJobDescriptor, containerId string) {
+	if containerId == "" {
+		return
+	}
+	ctx, cancel := common.CleanupContext(ctx)
+	defer cancel()
+
+	err := d.cli.ContainerRemove(ctx, containerId, container.RemoveOptions{Force: true, RemoveVolumes: true})
+	if err != nil {
+		d.warn(job, "could not delete container %s : %s", containerId, err.Error())
+	}
+}
+
+func (d dockerPipelineRunner) waitForContainer(ctx context.Context, id string) {
+	inspectResp, err := d.cli.ContainerInspect(ctx, id)
+	for err != nil && !inspectResp.State.Running && ctx.Err() == nil {
+		time.Sleep(100 * time.Millisecond)
+		inspectResp, err = d.cli.ContainerInspect(ctx, id)
+	}
+}
+
+// ensureImage makes image available according to the pull policies of job,
+// or to the one of the options when it declares none. As for GitLab
+// runners, the policies are tried in order until one of them succeeds.
+// Offline, images present locally are used whatever the policies.
+func (d dockerPipelineRunner) ensureImage(ctx context.Context, job parserCommon.PipelineJobDescriptor, image string) error {
+	if d.options.Offline {
+		err := d.checkImageExistence(ctx, image)
+		if client.IsErrNotFound(err) {
+			return fmt.Errorf("%w: %s", OfflineErr, image)
+		}
+		return err
+	}
+
+	policies := job.GetPullPolicy()
+	if len(policies) == 0 {
+		policies = []string{cmp.Or(d.options.PullPolicy, PullIfNotPresent)}
+	}
+
+	var err error
+	for _, policy := range policies {
+		if err = d.applyPullPolicy(ctx, job, image, policy); err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return err
+}
+
+func (d dockerPipelineRunner) applyPullPolicy(ctx context.Context, job parserCommon.PipelineJobDescriptor, image, policy string) error {
+	switch policy {
+	case PullAlways:
+	case PullIfNotPresent, PullNever:
+		err := d.checkImageExistence(ctx, image)
+		if err == nil {
+			return nil
+		}
+		if policy == PullNever {
+			return fmt.Errorf("image %s is not present and the pull policy is never: %w", image, err)
+		}
+	default:
+		return fmt.Errorf("%w: got %s for job %s", UnknownPullPolicyErr, policy, job.GetName())
+	}
+
+	if err := d.pullImage(ctx, job, image); err != nil {
+		return fmt.Errorf("failed to pull image %s: %w", image, err)
+	}
+	return nil
+}
+
+func (d dockerPipelineRunner) checkImageExistence(ctx context.Context, image string) error {
+	_, err := d.cli.ImageInspect(ctx, image)
+	return err
+}
+
+// pullImage pulls img with the credentials known for its registry,
+// publishing the progress reported by the registry.
+func (d dockerPipelineRunner) pullImage(ctx context.Context, job parserCommon.PipelineJobDescriptor, img string) error {
+	auth, err := registryAuth(ctx, img, job.GetVariables())
+	if err != nil {
+		return err
+	}
+
+	reader, err := d.cli.ImagePull(ctx, img, image.PullOptions{RegistryAuth: auth})
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	decoder := json.NewDecoder(reader)
+	for {
+		var message jsonmessage.JSONMessage
+		if err := decoder.Decode(&message); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		if message.Error != nil {
+			return message.Error
+		}
+
+		event := common.ImagePulling{
+			Time:   time.Now(),
+			Job:    job.GetName(),
+			Image:  img,
+			Layer:  message.ID,
+			Status: message.Status,
+		}
+		if message.Progress != nil {
+			event.Current = message.Progress.Current
+			event.Total = message.Progress.Total
+		}
+		d.options.Events.Publish(event)
+	}
+}
+
+func (d dockerPipelineRunner) warn(job parserCommon.PipelineJobDescriptor, format string, args ...any) {
+	d.options.Events.Publish(common.Warning{
+		Time:    time.Now(),
+		Job:     job.GetName(),
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// getImageFromJob returns the image job runs in once overrides, rewrite
+// rules and mirrors are applied.
+func (d dockerPipelineRunner) getImageFromJob(job parserCommon.PipelineJobDescriptor) string {
+	return d.resolveImage(cmp.Or(job.GetImage(), d.options.DefaultImage, defaultImage))
+}
+
+// mirrorImage returns image pulled from the mirror of its registry, if any.
+// Images which are not valid references are returned as is, pulling them
+// reporting the error.
+func mirrorImage(image string, mirrors map[string]string) string {
+	if len(mirrors) == 0 {
+		return image
+	}
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return image
+	}
+	mirror, found := mirrors[reference.Domain(named)]
+	if !found {
+		return image
+	}
+
+	mirrored := strings.TrimSuffix(mirror, "/") + "/" + reference.Path(named)
+	if tagged, ok := named.(reference.Tagged); ok {
+		mirrored += ":" + tagged.Tag()
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		mirrored += "@" + digested.Digest().String()
+	}
+	return mirrored
+}
+
+func NewDockerPipelineRunner(options Options) (common.PipelineRunner, error) {
+	runner, err := newDockerPipelineRunner(options)
+	if err != nil {
+		return nil, err
+	}
+	return runner, nil
+}
+
+func newDockerPipelineRunner(options Options) (dockerPipelineRunner, error) {
+	switch options.PullPolicy {
+	case "", PullAlways, PullIfNotPresent, PullNever:
+	default:
+		return dockerPipelineRunner{}, fmt.Errorf("%w: got %s", UnknownPullPolicyErr, options.PullPolicy)
+	}
+	if err := options.Container.validate(); err != nil {
+		return dockerPipelineRunner{}, err
+	}
+
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return dockerPipelineRunner{}, err
+	}
+
+	return dockerPipelineRunner{
+		cli,
+		options,
+	}, checkDockerExistence(cli)
+}
+
+func checkDockerExistence(cli *client.Client) error {
+	_, err := cli.Info(context.Background())
+	return err
+}
@@ -1,11 +1,25 @@
 package docker
 
 import (
+	"archive/tar"
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"strings"
 	"testing"
 
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/powerpixel/pipelinefox/jobcache"
 	parserCommon "github.com/powerpixel/pipelinefox/parser/common"
 	"github.com/powerpixel/pipelinefox/runner/common"
+	"github.com/powerpixel/pipelinefox/shell"
 )
 
 func TestSimpleDockerPipelineExecution(t *testing.T) {
@@ -67,16 +81,142 @@ world ;)
 
 			pipeline := common.CreateNewPipelineDescriptor(t, testCase.Stages, testCase.Jobs)
 
-			err := runner.RunPipeline(stdout, stderr, pipeline)
+			result, err := runner.RunPipeline(context.Background(), stdout, stderr, pipeline)
 
 			expectNoError(t, err)
-			expectEqualString(t, testCase.ExpectedOutput, stdout.String())
+			expectPipelineStatus(t, common.JobStatusSuccess, result)
+			expectEqualString(t, testCase.ExpectedOutput, shell.PlainTrace(stdout.String()))
 			expectEqualString(t, testCase.ExpectedErrorOutput, stderr.String())
 		})
 	}
 
 }
 
+func TestGetImageFromJob(t *testing.T) {
+	runner := dockerPipelineRunner{options: Options{
+		DefaultImage:   "alpine:3.20",
+		ImageOverrides: map[string]string{"node:18": "node:20"},
+		Mirrors:        map[string]string{"docker.io": "mirror.example.com/dockerhub/"},
+	}}
+
+	cases := map[string]string{
+		"":                            "mirror.example.com/dockerhub/library/alpine:3.20",
+		"node:18":                     "mirror.example.com/dockerhub/library/node:20",
+		"golangci/golangci-lint:v2":   "mirror.example.com/dockerhub/golangci/golangci-lint:v2",
+		"registry.gitlab.com/app:1.0": "registry.gitlab.com/app:1.0",
+		"Invalid Image":               "Invalid Image",
+	}
+	for image, expected := range cases {
+		job := parserCommon.NewPipelineJobDescriptor("test", "build", nil).WithImage(image)
+		expectEqualString(t, expected, runner.getImageFromJob(job))
+	}
+
+	runner = dockerPipelineRunner{}
+	expectEqualString(t, defaultImage, runner.getImageFromJob(parserCommon.NewPipelineJobDescriptor("test", "build", nil)))
+}
+
+func TestFileVariablesPayload(t *testing.T) {
+	entries, paths := fileVariables([]common.Secret{
+		{Name: "TOKEN", Value: "glpat-0123456789", Masked: true},
+		{Name: "KUBECONFIG", Value: "apiVersion: v1\n", File: true},
+		{Name: "EMPTY", File: true},
+	})
+
+	expectedPaths := map[string]string{
+		"KUBECONFIG": "/tmp/ppfox-variables/KUBECONFIG",
+		"EMPTY":      "/tmp/ppfox-variables/EMPTY",
+	}
+	if !maps.Equal(expectedPaths, paths) {
+		t.Fatalf("expected paths %v, got %v", expectedPaths, paths)
+	}
+
+	payload, err := createPayload(entries...)
+	expectNoError(t, err)
+
+	type file struct {
+		mode     int64
+		typeflag byte
+		content  string
+	}
+	expected := map[string]file{
+		"ppfox-variables/":           {0700, tar.TypeDir, ""},
+		"ppfox-variables/KUBECONFIG": {0600, tar.TypeReg, "apiVersion: v1\n"},
+		"ppfox-variables/EMPTY":      {0600, tar.TypeReg, ""},
+	}
+	archive := tar.NewReader(payload)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		expectNoError(t, err)
+
+		content, err := io.ReadAll(archive)
+		expectNoError(t, err)
+		got := file{header.Mode, header.Typeflag, string(content)}
+		if got != expected[header.Name] {
+			t.Errorf("expected %+v for %s, got %+v", expected[header.Name], header.Name, got)
+		}
+		delete(expected, header.Name)
+	}
+	if len(expected) > 0 {
+		t.Errorf("missing entries %v", expected)
+	}
+}
+
+// pullCountingClient counts the pulls of images and records the image of
+// the created containers, failing their creation.
+type pullCountingClient struct {
+	client.APIClient
+	pulls   int
+	created string
+}
+
+func (c *pullCountingClient) ImagePull(context.Context, string, image.PullOptions) (io.ReadCloser, error) {
+	c.pulls++
+	return io.NopCloser(strings.NewReader("")), nil
+}
+
+func (c *pullCountingClient) ImageInspect(context.Context, string, ...client.ImageInspectOption) (image.InspectResponse, error) {
+	return image.InspectResponse{ID: fmt.Sprintf("sha256:%064d", c.pulls)}, nil
+}
+
+func (c *pullCountingClient) ContainerCreate(_ context.Context, config *container.Config, _ *container.HostConfig, _ *network.NetworkingConfig, _ *v1.Platform, _ string) (container.CreateResponse, error) {
+	c.created = config.Image
+	return container.CreateResponse{}, errors.New("no daemon")
+}
+
+func TestCachedJobPullsImageOnce(t *testing.T) {
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	cli := &pullCountingClient{}
+	runner := dockerPipelineRunner{cli: cli, options: Options{
+		RunnerOptions: common.RunnerOptions{
+			JobCache: jobcache.New(t.TempDir(), t.TempDir(), nil),
+			LogDir:   t.TempDir(),
+		},
+		PullPolicy: PullAlways,
+	}}
+
+	pipeline := common.CreateNewPipelineDescriptor(t, []string{"build"}, []parserCommon.PipelineJobDescriptor{
+		parserCommon.NewPipelineJobDescriptor("build_app", "build", []string{"make"}).WithImage("golang:1.23"),
+	})
+	// The job stops once its container is to be created.
+	if _, err := runner.RunPipeline(context.Background(), io.Discard, io.Discard, pipeline); err == nil {
+		t.Fatal("expected the container creation to fail")
+	}
+
+	if cli.pulls != 1 {
+		t.Fatalf("expected the image to be pulled once, got %d pulls", cli.pulls)
+	}
+	expectEqualString(t, fmt.Sprintf("sha256:%064d", 1), cli.created)
+}
+
+func TestUnknownPullPolicy(t *testing.T) {
+	if _, err := NewDockerPipelineRunner(Options{PullPolicy: "sometimes"}); !errors.Is(err, UnknownPullPolicyErr) {
+		t.Fatalf("expected UnknownPullPolicyErr, got %v", err)
+	}
+}
+
 func expectEqualString(t *testing.T, expected, actual string) {
 	t.Helper()
 	if expected != actual {
@@ -87,6 +227,13 @@ func expectEqualString(t *testing.T, expected, actual string) {
 	}
 }
 
+func expectPipelineStatus(t *testing.T, expected common.JobStatus, result common.PipelineResult) {
+	t.Helper()
+	if result.Status != expected {
+		t.Fatalf("expected pipeline status %s, got %s (jobs %+v)", expected, result.Status, result.Jobs)
+	}
+}
+
 func expectNoError(t *testing.T, err error) {
 	t.Helper()
 	if err != nil {
@@ -96,7 +243,7 @@ func expectNoError(t *testing.T, err error) {
 
 func createNewDockerRunner(t testing.TB) common.PipelineRunner {
 	t.Helper()
-	res, err := NewDockerPipelineRunner()
+	res, err := NewDockerPipelineRunner(Options{})
 
 	if err != nil {
 		t.Fatalf("unexpected error during docker runner creation : %s", err.Error())
@@ -0,0 +1,159 @@
+package docker
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/client"
+	parserCommon "github.com/powerpixel/pipelinefox/parser/common"
+)
+
+var InvalidRewriteRuleErr = errors.New("invalid image rewrite rule, expected pattern -> replacement such as docker.io/* -> mirror.local:5000/*")
+var OfflineErr = errors.New("image is not present locally and pulls are disabled in offline mode")
+
+// RewriteRule replaces the images matching From by To. From may hold a *
+// matching any text, which replaces the * of To.
+type RewriteRule struct {
+	From string
+	To   string
+}
+
+// ParseRewriteRule reads a rule written as "pattern -> replacement".
+func ParseRewriteRule(rule string) (RewriteRule, error) {
+	from, to, found := strings.Cut(rule, "->")
+	from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+	if !found || from == "" || to == "" || strings.Count(from, "*") > 1 || strings.Count(to, "*") > strings.Count(from, "*") {
+		return RewriteRule{}, fmt.Errorf("%w: got %q", InvalidRewriteRuleErr, rule)
+	}
+	return RewriteRule{From: from, To: to}, nil
+}
+
+// apply returns image rewritten by the rule, reporting whether it matched.
+func (r RewriteRule) apply(image string) (string, bool) {
+	prefix, suffix, wildcard := strings.Cut(r.From, "*")
+	if !wildcard {
+		return r.To, image == r.From
+	}
+	if len(image) < len(prefix)+len(suffix) || !strings.HasPrefix(image, prefix) || !strings.HasSuffix(image, suffix) {
+		return "", false
+	}
+	return strings.Replace(r.To, "*", image[len(prefix):len(image)-len(suffix)], 1), true
+}
+
+// rewriteImage returns image rewritten by the first rule matching it. Rules
+// are matched against the image as written, then its short form, such as
+// golang:1.23, and its full one, such as docker.io/library/golang:1.23.
+func rewriteImage(image string, rules []RewriteRule) string {
+	if len(rules) == 0 {
+		return image
+	}
+
+	forms := []string{image}
+	if named, err := reference.ParseNormalizedNamed(image); err == nil {
+		forms = append(forms, reference.FamiliarString(named), named.String())
+	}
+	for _, rule := range rules {
+		for _, form := range forms {
+			if rewritten, matched := rule.apply(form); matched {
+				return rewritten
+			}
+		}
+	}
+	return image
+}
+
+// resolveImage returns image once overrides, rewrite rules and mirrors are
+// applied, in that order.
+func (d dockerPipelineRunner) resolveImage(image string) string {
+	if override, found := d.options.ImageOverrides[image]; found {
+		image = override
+	}
+	return mirrorImage(rewriteImage(image, d.options.Rewrites), d.options.Mirrors)
+}
+
+// JobImage is an image a pipeline needs, the one a job runs in or one of
+// its services.
+type JobImage struct {
+	Name string
+	// Job is the first job needing the image, whose variables give the
+	// credentials to pull it.
+	Job parserCommon.PipelineJobDescriptor
+}
+
+// ImageStore fetches the images of pipelines ahead of their runs, so that
+// they can run offline.
+type ImageStore interface {
+	// Images returns the images the jobs of pipeline and their services run
+	// in, once resolved, in the order of the stages.
+	Images(pipeline parserCommon.PipelineDescriptor) []JobImage
+	// Missing returns the images which are not present locally.
+	Missing(ctx context.Context, images []JobImage) ([]JobImage, error)
+	// Pull pulls images, whatever the pull policy, reporting the ones which
+	// could not be.
+	Pull(ctx context.Context, images []JobImage) error
+}
+
+func NewImageStore(options Options) (ImageStore, error) {
+	runner, err := newDockerPipelineRunner(options)
+	if err != nil {
+		return nil, err
+	}
+	return runner, nil
+}
+
+func (d dockerPipelineRunner) Images(pipeline parserCommon.PipelineDescriptor) []JobImage {
+	var images []JobImage
+	seen := make(map[string]bool)
+	add := func(name string, job parserCommon.PipelineJobDescriptor) {
+		if !seen[name] {
+			seen[name] = true
+			images = append(images, JobImage{Name: name, Job: job})
+		}
+	}
+
+	stages := pipeline.GetStages()
+	for _, stage := range pipeline.GetStageNames() {
+		for _, job := range stages[stage] {
+			job = d.options.PrepareJob(job)
+			add(d.getImageFromJob(job), job)
+			for _, service := range job.GetServices() {
+				add(d.resolveImage(service.Name), job)
+			}
+		}
+	}
+	return images
+}
+
+func (d dockerPipelineRunner) Missing(ctx context.Context, images []JobImage) ([]JobImage, error) {
+	var missing []JobImage
+	for _, image := range images {
+		err := d.checkImageExistence(ctx, image.Name)
+		if client.IsErrNotFound(err) {
+			missing = append(missing, image)
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return missing, nil
+}
+
+func (d dockerPipelineRunner) Pull(ctx context.Context, images []JobImage) error {
+	var errs []error
+	for _, image := range images {
+		if d.options.Offline {
+			errs = append(errs, fmt.Errorf("%w: %s", OfflineErr, image.Name))
+			continue
+		}
+		if err := d.pullImage(ctx, image.Job, image.Name); err != nil {
+			errs = append(errs, fmt.Errorf("failed to pull image %s: %w", image.Name, err))
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return cmp.Or(ctx.Err(), errors.Join(errs...))
+}
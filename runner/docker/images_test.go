@@ -0,0 +1,80 @@
+package docker
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	parserCommon "github.com/powerpixel/pipelinefox/parser/common"
+	"github.com/powerpixel/pipelinefox/runner/common"
+)
+
+func TestParseRewriteRule(t *testing.T) {
+	rule, err := ParseRewriteRule("  docker.io/*  ->  mirror.local:5000/*")
+	expectNoError(t, err)
+	if rule != (RewriteRule{From: "docker.io/*", To: "mirror.local:5000/*"}) {
+		t.Errorf("unexpected rule %+v", rule)
+	}
+
+	for _, invalid := range []string{"docker.io/*", "-> mirror.local/*", "golang:1.23 -> our-golang:*", "*/*:* -> a"} {
+		if _, err := ParseRewriteRule(invalid); !errors.Is(err, InvalidRewriteRuleErr) {
+			t.Errorf("expected InvalidRewriteRuleErr for %q, got %v", invalid, err)
+		}
+	}
+}
+
+func TestRewriteImage(t *testing.T) {
+	rules := []RewriteRule{
+		{From: "golang:*", To: "our-golang:*"},
+		{From: "docker.io/*", To: "mirror.local:5000/*"},
+		{From: "registry.gitlab.com/group/app:1.0", To: "registry.example.com/app:1.0"},
+	}
+
+	cases := map[string]string{
+		"golang:1.23":                       "our-golang:1.23",
+		"docker.io/library/golang:1.23":     "our-golang:1.23",
+		"alpine:3.20":                       "mirror.local:5000/library/alpine:3.20",
+		"bitnami/kubectl":                   "mirror.local:5000/bitnami/kubectl",
+		"registry.gitlab.com/group/app:1.0": "registry.example.com/app:1.0",
+		"registry.gitlab.com/group/app:2.0": "registry.gitlab.com/group/app:2.0",
+		"Invalid Image":                     "Invalid Image",
+	}
+	for image, expected := range cases {
+		expectEqualString(t, expected, rewriteImage(image, rules))
+	}
+}
+
+func TestPipelineImages(t *testing.T) {
+	runner := dockerPipelineRunner{options: Options{
+		DefaultImage: "alpine:3.20",
+		Rewrites:     []RewriteRule{{From: "docker.io/*", To: "mirror.local:5000/*"}},
+		Mirrors:      map[string]string{"mirror.local:5000": "airgap.local/mirror"},
+	}}
+
+	postgres := parserCommon.Service{Name: "postgres:16", Alias: "db"}
+	pipeline := common.CreateNewPipelineDescriptor(t, []string{"build", "test"}, []parserCommon.PipelineJobDescriptor{
+		parserCommon.NewPipelineJobDescriptor("compile", "build", nil).WithImage("golang:1.23"),
+		parserCommon.NewPipelineJobDescriptor("unit", "test", nil).WithImage("golang:1.23"),
+		parserCommon.NewPipelineJobDescriptor("integration", "test", nil).WithServices([]parserCommon.Service{postgres}),
+		parserCommon.NewPipelineJobDescriptor("e2e", "test", nil).WithImage("registry.example.com/e2e:1.0").WithServices([]parserCommon.Service{postgres}),
+	})
+
+	var names, jobs []string
+	for _, image := range runner.Images(pipeline) {
+		names = append(names, image.Name)
+		jobs = append(jobs, image.Job.GetName())
+	}
+
+	expectedNames := []string{
+		"airgap.local/mirror/library/golang:1.23",
+		"airgap.local/mirror/library/alpine:3.20",
+		"airgap.local/mirror/library/postgres:16",
+		"registry.example.com/e2e:1.0",
+	}
+	if !slices.Equal(expectedNames, names) {
+		t.Errorf("expected images %v, got %v", expectedNames, names)
+	}
+	if expectedJobs := []string{"compile", "integration", "integration", "e2e"}; !slices.Equal(expectedJobs, jobs) {
+		t.Errorf("expected jobs %v, got %v", expectedJobs, jobs)
+	}
+}
@@ -0,0 +1,244 @@
+package docker
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	parserCommon "github.com/powerpixel/pipelinefox/parser/common"
+	"github.com/powerpixel/pipelinefox/runner/common"
+)
+
+const (
+	// dindCertsDir is where docker:dind services write the TLS certificates
+	// of their clients, shared with the job as GitLab runners do.
+	dindCertsDir = "/certs/client"
+	// hostSocket is where the docker socket of the host is mounted in the
+	// jobs it is given to.
+	hostSocket = "/var/run/docker.sock"
+	// serviceReadyTimeout bounds the time a service may take to be ready.
+	serviceReadyTimeout = time.Minute
+)
+
+var ServiceNotReadyErr = errors.New("service is not ready")
+var HostSocketErr = errors.New("the docker socket can only be given to jobs when the daemon listens on a unix socket")
+
+// jobServices are the resources created for the services of a job, removed
+// once it is over.
+type jobServices struct {
+	network    string
+	containers []string
+	volumes    []string
+	// certs is the volume holding the TLS certificates of the dind service.
+	certs string
+}
+
+// isDind reports whether image runs a docker daemon, such as docker:dind or
+// docker:27-dind.
+func isDind(image string) bool {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return false
+	}
+	tagged, ok := named.(reference.Tagged)
+	return ok && reference.Path(named) == "library/docker" && strings.Contains(tagged.Tag(), "dind")
+}
+
+// serviceAliases returns the host names of service. Without alias, they are
+// derived from its image as GitLab does: tag removed, then slashes replaced
+// by double underscores, and by dashes.
+func serviceAliases(service parserCommon.Service) []string {
+	if aliases := strings.FieldsFunc(service.Alias, func(r rune) bool { return r == ',' || r == ' ' }); len(aliases) > 0 {
+		return aliases
+	}
+
+	name, _, _ := strings.Cut(service.Name, "@")
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name = name[:i]
+	}
+	aliases := []string{strings.ReplaceAll(name, "/", "__")}
+	if dashed := strings.ReplaceAll(name, "/", "-"); dashed != aliases[0] {
+		aliases = append(aliases, dashed)
+	}
+	return aliases
+}
+
+// uniqueName returns a name for the container or the services of job, its
+// random suffix keeping it from conflicting with the ones kept from previous
+// runs. The characters docker refuses in names are replaced by _.
+func uniqueName(job parserCommon.PipelineJobDescriptor) string {
+	name := strings.Map(func(r rune) rune {
+		if 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || r == '_' || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, job.GetName())
+
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return prefix + name + "_" + hex.EncodeToString(suffix)
+}
+
+// startServices starts the services of job on a network of their own,
+// which the job joins. With the host socket given to jobs, docker:dind
+// services are not needed and left out.
+func (d dockerPipelineRunner) startServices(ctx context.Context, job parserCommon.PipelineJobDescriptor) (jobServices, error) {
+	var started jobServices
+	services := job.GetServices()
+	if d.options.HostSocket {
+		services = slices.DeleteFunc(slices.Clone(services), func(service parserCommon.Service) bool {
+			return isDind(service.Name)
+		})
+	}
+	if len(services) == 0 {
+		return started, nil
+	}
+
+	name := uniqueName(job)
+
+	if _, err := d.cli.NetworkCreate(ctx, name, network.CreateOptions{Driver: "bridge"}); err != nil {
+		return started, fmt.Errorf("failed to create the network of the services: %w", err)
+	}
+	started.network = name
+
+	for i, service := range services {
+		serviceJob := job.WithImage(service.Name).WithPullPolicy(service.PullPolicy)
+		img := d.resolveImage(service.Name)
+		if err := d.ensureImage(ctx, serviceJob, img); err != nil {
+			return started, err
+		}
+
+		dind := isDind(service.Name)
+		hostConfig := &container.HostConfig{NetworkMode: container.NetworkMode(name)}
+		if dind {
+			d.warn(job, "service %s runs privileged, with full access to the host, for jobs to build images", service.Name)
+			hostConfig.Privileged = true
+			if started.certs == "" {
+				certs, err := d.cli.VolumeCreate(ctx, volume.CreateOptions{Name: name + "_certs"})
+				if err != nil {
+					return started, fmt.Errorf("failed to create the certificates volume of %s: %w", service.Name, err)
+				}
+				started.certs = certs.Name
+				started.volumes = append(started.volumes, certs.Name)
+			}
+			hostConfig.Mounts = []mount.Mount{{Type: mount.TypeVolume, Source: started.certs, Target: dindCertsDir}}
+		}
+
+		created, err := d.cli.ContainerCreate(ctx,
+			&container.Config{Image: img, Env: jobEnv(job)},
+			hostConfig,
+			&network.NetworkingConfig{EndpointsConfig: map[string]*network.EndpointSettings{
+				name: {Aliases: serviceAliases(service)},
+			}},
+			v1.DescriptorEmptyJSON.Platform,
+			fmt.Sprintf("%s_service_%d", name, i),
+		)
+		if err != nil {
+			return started, fmt.Errorf("failed to create service %s: %w", service.Name, err)
+		}
+		started.containers = append(started.containers, created.ID)
+
+		if err := d.cli.ContainerStart(ctx, created.ID, container.StartOptions{}); err != nil {
+			return started, fmt.Errorf("failed to start service %s: %w", service.Name, err)
+		}
+		if err := d.waitForService(ctx, created.ID, dind); err != nil {
+			return started, fmt.Errorf("%w: %s: %w", ServiceNotReadyErr, service.Name, err)
+		}
+	}
+	return started, nil
+}
+
+// waitForService waits for the service container to run and, for docker
+// daemons, to answer.
+func (d dockerPipelineRunner) waitForService(ctx context.Context, id string, dind bool) error {
+	ctx, cancel := context.WithTimeout(ctx, serviceReadyTimeout)
+	defer cancel()
+
+	for {
+		inspect, err := d.cli.ContainerInspect(ctx, id)
+		if err != nil {
+			return err
+		}
+		if inspect.State != nil && !inspect.State.Running && inspect.State.Status != "created" {
+			return fmt.Errorf("exited with status %d", inspect.State.ExitCode)
+		}
+		if inspect.State != nil && inspect.State.Running && (!dind || d.daemonAnswers(ctx, id)) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// daemonAnswers reports whether the docker daemon of the service answers
+// on its unix socket, whatever the DOCKER_HOST of the job.
+func (d dockerPipelineRunner) daemonAnswers(ctx context.Context, id string) bool {
+	exec, err := d.cli.ContainerExecCreate(ctx, id, container.ExecOptions{
+		Cmd: []string{"docker", "info"},
+		Env: []string{"DOCKER_HOST=unix:///var/run/docker.sock"},
+	})
+	if err != nil {
+		return false
+	}
+	if err := d.cli.ContainerExecStart(ctx, exec.ID, container.ExecStartOptions{}); err != nil {
+		return false
+	}
+	for ctx.Err() == nil {
+		inspect, err := d.cli.ContainerExecInspect(ctx, exec.ID)
+		if err != nil {
+			return false
+		}
+		if !inspect.Running {
+			return inspect.ExitCode == 0
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return false
+}
+
+// removeServices deletes the containers, volumes and network of the
+// services, even if ctx was canceled. Removing a dind service removes the
+// images and volumes created in it as well.
+func (d dockerPipelineRunner) removeServices(ctx context.Context, job parserCommon.PipelineJobDescriptor, services jobServices) {
+	for _, id := range services.containers {
+		d.removeContainer(ctx, job, id)
+	}
+
+	ctx, cancel := common.CleanupContext(ctx)
+	defer cancel()
+	for _, name := range services.volumes {
+		if err := d.cli.VolumeRemove(ctx, name, true); err != nil {
+			d.warn(job, "could not delete volume %s : %s", name, err)
+		}
+	}
+	if services.network != "" {
+		if err := d.cli.NetworkRemove(ctx, services.network); err != nil {
+			d.warn(job, "could not delete network %s : %s", services.network, err)
+		}
+	}
+}
+
+// hostSocketPath returns the path of the unix socket of the daemon, to be
+// given to jobs.
+func (d dockerPipelineRunner) hostSocketPath() (string, error) {
+	path, found := strings.CutPrefix(d.cli.DaemonHost(), "unix://")
+	if !found {
+		return "", fmt.Errorf("%w, got %s", HostSocketErr, d.cli.DaemonHost())
+	}
+	return path, nil
+}
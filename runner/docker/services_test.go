@@ -0,0 +1,189 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	parserCommon "github.com/powerpixel/pipelinefox/parser/common"
+	"github.com/powerpixel/pipelinefox/runner/common"
+)
+
+func TestIsDind(t *testing.T) {
+	cases := map[string]bool{
+		"docker:dind":                      true,
+		"docker:27-dind":                   true,
+		"docker:27.3-dind-rootless":        true,
+		"docker.io/library/docker:dind":    true,
+		"docker:27-cli":                    false,
+		"docker":                           false,
+		"registry.example.com/docker:dind": false,
+		"postgres:16":                      false,
+		"not a valid reference:dind":       false,
+	}
+	for image, expected := range cases {
+		if got := isDind(image); got != expected {
+			t.Errorf("expected %t for %s, got %t", expected, image, got)
+		}
+	}
+}
+
+func TestServiceAliases(t *testing.T) {
+	cases := []struct {
+		service  parserCommon.Service
+		expected []string
+	}{
+		{parserCommon.Service{Name: "postgres:16"}, []string{"postgres"}},
+		{parserCommon.Service{Name: "docker:27-dind"}, []string{"docker"}},
+		{parserCommon.Service{Name: "tutum/wordpress:latest"}, []string{"tutum__wordpress", "tutum-wordpress"}},
+		{parserCommon.Service{Name: "registry.example.com:5000/group/redis@sha256:0123"}, []string{"registry.example.com:5000__group__redis", "registry.example.com:5000-group-redis"}},
+		{parserCommon.Service{Name: "postgres:16", Alias: "db"}, []string{"db"}},
+		{parserCommon.Service{Name: "postgres:16", Alias: "db, database primary"}, []string{"db", "database", "primary"}},
+	}
+	for _, c := range cases {
+		if got := serviceAliases(c.service); !slices.Equal(c.expected, got) {
+			t.Errorf("expected aliases %v for %+v, got %v", c.expected, c.service, got)
+		}
+	}
+}
+
+func TestUniqueName(t *testing.T) {
+	valid := regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+	cases := map[string]string{
+		"build":          "pipelinefox_build_",
+		"test/unit":      "pipelinefox_test_unit_",
+		"test: 1/2":      "pipelinefox_test__1_2_",
+		"deploy prod.eu": "pipelinefox_deploy_prod.eu_",
+		"tëst":           "pipelinefox_t_st_",
+	}
+	for job, expected := range cases {
+		name := uniqueName(parserCommon.NewPipelineJobDescriptor(job, "test", nil))
+		if !strings.HasPrefix(name, expected) || len(name) != len(expected)+8 {
+			t.Errorf("expected a name made of %s and a random suffix for job %q, got %s", expected, job, name)
+		}
+		if !valid.MatchString(name) {
+			t.Errorf("expected a name docker accepts for job %q, got %s", job, name)
+		}
+	}
+
+	job := parserCommon.NewPipelineJobDescriptor("build", "build", nil)
+	if uniqueName(job) == uniqueName(job) {
+		t.Fatalf("expected distinct names for two runs of a job")
+	}
+}
+
+func TestHostSocketNeedsUnixDaemon(t *testing.T) {
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://127.0.0.1:2375"))
+	expectNoError(t, err)
+
+	runner := dockerPipelineRunner{cli: cli}
+	if _, err := runner.hostSocketPath(); !errors.Is(err, HostSocketErr) {
+		t.Fatalf("expected HostSocketErr, got %v", err)
+	}
+
+	cli, err = client.NewClientWithOpts(client.WithHost("unix:///run/user/1000/docker.sock"))
+	expectNoError(t, err)
+	runner = dockerPipelineRunner{cli: cli}
+	path, err := runner.hostSocketPath()
+	expectNoError(t, err)
+	expectEqualString(t, "/run/user/1000/docker.sock", path)
+}
+
+func TestDockerInDocker(t *testing.T) {
+	ctx := context.Background()
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	expectNoError(t, err)
+	if _, err := cli.Ping(ctx); err != nil {
+		t.Skipf("docker is not available: %s", err)
+	}
+
+	runner, err := NewDockerPipelineRunner(Options{})
+	expectNoError(t, err)
+	job := parserCommon.NewPipelineJobDescriptor("build_image", "build", []string{
+		"docker info",
+		"printf 'FROM alpine:3.20\\nRUN echo built > /built\\n' | docker build -t pipelinefox-dind-test -",
+		"docker run --rm pipelinefox-dind-test cat /built",
+	}).
+		WithImage("docker:27-cli").
+		WithServices([]parserCommon.Service{{Name: "docker:27-dind"}}).
+		WithVariables(map[string]string{
+			"DOCKER_HOST":        "tcp://docker:2376",
+			"DOCKER_TLS_CERTDIR": "/certs",
+			"DOCKER_TLS_VERIFY":  "1",
+			"DOCKER_CERT_PATH":   "/certs/client",
+		})
+
+	var stdout strings.Builder
+	result, err := runner.RunPipelineJob(ctx, &stdout, io.Discard, job)
+	expectNoError(t, err)
+	if result.Status != common.JobStatusSuccess {
+		t.Fatalf("expected the job to succeed, got %s: %s", result.Status, result.Reason)
+	}
+	if !strings.Contains(stdout.String(), "built") {
+		t.Fatalf("expected the image built in the dind service to run, got %q", stdout.String())
+	}
+
+	networks, err := cli.NetworkList(ctx, network.ListOptions{Filters: filters.NewArgs(filters.Arg("name", prefix+"build_image_"))})
+	expectNoError(t, err)
+	if len(networks) > 0 {
+		t.Fatalf("expected the network of the services to be removed, got %v", networks)
+	}
+}
+
+func TestHostSocketKeepsImagesOfOthers(t *testing.T) {
+	ctx := context.Background()
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	expectNoError(t, err)
+	if _, err := cli.Ping(ctx); err != nil {
+		t.Skipf("docker is not available: %s", err)
+	}
+
+	runner, err := newDockerPipelineRunner(Options{HostSocket: true})
+	expectNoError(t, err)
+	if _, err := runner.hostSocketPath(); err != nil {
+		t.Skipf("docker does not listen on a unix socket: %s", err)
+	}
+
+	// An image and a volume made by a concurrent job while this one runs.
+	const survivor = "pipelinefox-socket-survivor"
+	pullForTest(t, cli, "alpine:3.20")
+	t.Cleanup(func() {
+		cli.ImageRemove(context.Background(), survivor, image.RemoveOptions{})
+		cli.VolumeRemove(context.Background(), survivor, true)
+	})
+	created := make(chan error, 1)
+	job := parserCommon.NewPipelineJobDescriptor("socket", "test", []string{"sleep 3"}).WithImage("alpine:3.20")
+	go func() {
+		time.Sleep(time.Second)
+		if err := cli.ImageTag(ctx, "alpine:3.20", survivor); err != nil {
+			created <- err
+			return
+		}
+		_, err := cli.VolumeCreate(ctx, volume.CreateOptions{Name: survivor})
+		created <- err
+	}()
+
+	result, err := runner.RunPipelineJob(ctx, io.Discard, io.Discard, job)
+	expectNoError(t, err)
+	if result.Status != common.JobStatusSuccess {
+		t.Fatalf("expected the job to succeed, got %s: %s", result.Status, result.Reason)
+	}
+	expectNoError(t, <-created)
+
+	if _, err := cli.ImageInspect(ctx, survivor); err != nil {
+		t.Fatalf("expected the image of the concurrent job to be kept, got %s", err)
+	}
+	if _, err := cli.VolumeInspect(ctx, survivor); err != nil {
+		t.Fatalf("expected the volume of the concurrent job to be kept, got %s", err)
+	}
+}
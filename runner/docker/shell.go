@@ -0,0 +1,31 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/powerpixel/pipelinefox/shell"
+)
+
+var ShellDetectionErr = errors.New("could not detect the shell of the image, which needs sh to run scripts")
+
+// detectShellScript prints the shell of the image, bash when present as
+// GitLab runners prefer it.
+const detectShellScript = "if command -v bash >/dev/null 2>&1; then echo " + shell.BashName + "; else echo " + shell.ShName + "; fi"
+
+// detectShell returns the name of the shell of the scripts of the jobs
+// selecting none.
+func (d dockerPipelineRunner) detectShell(ctx context.Context, containerId string) (string, error) {
+	out, err := d.execOutput(ctx, containerId, []string{"sh", "-c", detectShellScript})
+	if err != nil {
+		return "", err
+	}
+	switch name := strings.TrimSpace(out); name {
+	case shell.BashName, shell.ShName:
+		return name, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ShellDetectionErr, name)
+	}
+}
@@ -0,0 +1,55 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	parserCommon "github.com/powerpixel/pipelinefox/parser/common"
+	"github.com/powerpixel/pipelinefox/runner/common"
+	"github.com/powerpixel/pipelinefox/shell"
+)
+
+// stepAnswers is the FIFO, in scriptDir, stepped scripts read their answers
+// from.
+const stepAnswers = "ppfox-step.fifo"
+
+// answerScript writes its first argument to the FIFO given second, blocking
+// until the script reads it.
+const answerScript = `printf '%s\n' "$1" > "$2"`
+
+// injectSteppedScript injects the script of job pausing before its commands,
+// and returns the writer its standard output goes through to be answered.
+func (d dockerPipelineRunner) injectSteppedScript(ctx context.Context, stdout io.Writer, job parserCommon.PipelineJobDescriptor, jobShell shell.Shell, containerId string) (*common.StepWriter, error) {
+	answers := scriptDir + "/" + stepAnswers
+	var script bytes.Buffer
+	if err := jobShell.CreateSteppedScript(&script, job.GetStepScript(), answers); err != nil {
+		return nil, err
+	}
+	if err := d.copyToContainer(ctx, containerId, payloadEntry{name: scriptFile + jobShell.Extension, mode: 0755, content: script.Bytes()}); err != nil {
+		return nil, err
+	}
+	if _, err := d.execOutput(ctx, containerId, []string{"mkfifo", answers}); err != nil {
+		return nil, err
+	}
+
+	answer := func(answer string) error {
+		// Writing blocks until the script reads, which it no longer does
+		// once stopped.
+		done := make(chan error, 1)
+		go func() {
+			_, err := d.execOutput(context.WithoutCancel(ctx), containerId, []string{"sh", "-c", answerScript, "sh", answer, answers})
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	debugShell := func(ctx context.Context, t *common.Terminal) error {
+		return d.attachShell(ctx, t, containerId)
+	}
+	return d.options.NewStepWriter(ctx, stdout, job, job.GetStepScript(), answer, debugShell), nil
+}
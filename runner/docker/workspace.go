@@ -0,0 +1,129 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/powerpixel/pipelinefox/runner/common"
+)
+
+// containerWorkspace reads the files of a job from its container, relative to
+// the container working directory.
+type containerWorkspace struct {
+	runner      dockerPipelineRunner
+	containerId string
+}
+
+func (w containerWorkspace) Glob(ctx context.Context, pattern string) ([]string, error) {
+	// find exits with an error when the base does not exist, the listed
+	// files being used anyway.
+	output, err := w.runner.execOutput(ctx, w.containerId, []string{"find", common.PatternBase(pattern), "-xdev", "-type", "f"})
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimPrefix(line, "./")
+		if line != "" && common.MatchPattern(pattern, line) {
+			paths = append(paths, line)
+		}
+	}
+	return paths, nil
+}
+
+func (w containerWorkspace) Open(ctx context.Context, file string) (io.ReadCloser, error) {
+	dir, err := w.workDir(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, _, err := w.runner.cli.CopyFromContainer(ctx, w.containerId, path.Join(dir, file))
+	if err != nil {
+		return nil, err
+	}
+
+	archive := tar.NewReader(reader)
+	if _, err := archive.Next(); err != nil {
+		reader.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{archive, reader}, nil
+}
+
+// WriteArtifacts copies the stored files of artifacts into the container, at
+// their path in its working directory.
+func (w containerWorkspace) WriteArtifacts(ctx context.Context, artifacts map[string]string) error {
+	dir, err := w.workDir(ctx)
+	if err != nil {
+		return err
+	}
+
+	var entries []payloadEntry
+	for _, file := range slices.Sorted(maps.Keys(artifacts)) {
+		if !filepath.IsLocal(filepath.FromSlash(file)) {
+			return fmt.Errorf("%s is outside of the job directory", file)
+		}
+		content, err := os.ReadFile(artifacts[file])
+		if err != nil {
+			return err
+		}
+		entries = append(entries, payloadEntry{name: file, mode: 0644, content: content})
+	}
+	payload, err := createPayload(entries...)
+	if err != nil {
+		return err
+	}
+	return w.runner.cli.CopyToContainer(ctx, w.containerId, dir, payload, container.CopyToContainerOptions{CopyUIDGID: true})
+}
+
+// workDir returns the working directory of the container, the one of the
+// scripts of the job.
+func (w containerWorkspace) workDir(ctx context.Context) (string, error) {
+	inspectResp, err := w.runner.cli.ContainerInspect(ctx, w.containerId)
+	if err != nil {
+		return "", err
+	}
+	if inspectResp.Config != nil && inspectResp.Config.WorkingDir != "" {
+		return inspectResp.Config.WorkingDir, nil
+	}
+	return "/", nil
+}
+
+// execOutput runs cmd in the container and returns what it wrote to stdout.
+func (d dockerPipelineRunner) execOutput(ctx context.Context, containerId string, cmd []string) (string, error) {
+	execResp, err := d.cli.ContainerExecCreate(ctx, containerId, container.ExecOptions{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	attachResp, err := d.cli.ContainerExecAttach(ctx, execResp.ID, container.ExecStartOptions{})
+	if err != nil {
+		return "", err
+	}
+	defer attachResp.Close()
+
+	var stdout bytes.Buffer
+	if _, err := stdcopy.StdCopy(&stdout, io.Discard, attachResp.Reader); err != nil {
+		return "", err
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,341 @@
+package interp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	parserCommon "github.com/powerpixel/pipelinefox/parser/common"
+	"github.com/powerpixel/pipelinefox/runner/common"
+	"github.com/powerpixel/pipelinefox/shell"
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/interp"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+const (
+	prefix     = "pipelinefox_"
+	scriptName = "ppfox-bootstrap.sh"
+)
+
+var UnsupportedShellErr = errors.New("the interp executor interprets sh and bash scripts only")
+
+// ExecHandler is a middleware wrapping the handler used to run external commands.
+// It allows callers to stub or restrict binaries invoked by job scripts.
+type ExecHandler = func(next interp.ExecHandlerFunc) interp.ExecHandlerFunc
+
+// Options configures the in-process interpreter runner.
+type Options struct {
+	common.RunnerOptions
+	// BaseDir is the directory in which per-job sandboxes are created.
+	// The system temporary directory is used when empty.
+	BaseDir string
+	// Env holds additional KEY=value pairs exposed to job scripts.
+	Env []string
+	// ExecHandlers are applied around the default exec handler, outermost first.
+	ExecHandlers []ExecHandler
+	// Trace receives one line per executed command when set.
+	Trace io.Writer
+}
+
+type interpPipelineRunner struct {
+	options Options
+}
+
+func (r interpPipelineRunner) RunPipeline(ctx context.Context, stdout, stderr io.Writer, pipeline parserCommon.PipelineDescriptor) (common.PipelineResult, error) {
+	return common.RunStages(ctx, r.options.RunnerOptions, stdout, stderr, pipeline, r.RunPipelineJob, r.jobEnvironment)
+}
+
+// jobEnvironment identifies the host jobs run on, their scripts running in
+// the shell interpreter of pipelinefox.
+func (r interpPipelineRunner) jobEnvironment(context.Context, parserCommon.PipelineJobDescriptor) (string, common.JobFunc, error) {
+	return "interp " + runtime.GOOS + "/" + runtime.GOARCH, nil, nil
+}
+
+func (r interpPipelineRunner) RunPipelineJob(ctx context.Context, stdout, stderr io.Writer, job parserCommon.PipelineJobDescriptor) (common.JobResult, error) {
+	job = r.options.PrepareJob(job)
+	return common.ObserveJob(ctx, r.options.RunnerOptions, job, stdout, stderr, func(ctx context.Context, stdout, stderr io.Writer) (common.JobResult, error) {
+		return r.runJob(ctx, stdout, stderr, job)
+	})
+}
+
+func (r interpPipelineRunner) runJob(ctx context.Context, stdout, stderr io.Writer, job parserCommon.PipelineJobDescriptor) (common.JobResult, error) {
+	result := common.NewJobResult(job)
+
+	ctx, cancel := common.JobContext(ctx, job.GetTimeout())
+	defer cancel()
+
+	sandbox, err := os.MkdirTemp(r.options.BaseDir, prefix+common.FileName(job.GetName())+"_")
+	if err != nil {
+		return result.Finish(ctx, 0, fmt.Errorf("failed to create sandbox: %w", err))
+	}
+	defer os.RemoveAll(sandbox)
+
+	// As GitLab, file secrets are written next to the project directory
+	// rather than in it, so that they are not collected as artifacts.
+	job, err = writeFileSecrets(sandbox+".tmp", r.options.Secrets, job)
+	defer os.RemoveAll(sandbox + ".tmp")
+	if err != nil {
+		return result.Finish(ctx, 0, fmt.Errorf("failed to write file secrets: %w", err))
+	}
+
+	if err := writeArtifacts(sandbox, job.GetReceivedArtifacts()); err != nil {
+		return result.Finish(ctx, 0, fmt.Errorf("failed to write the artifacts it receives: %w", err))
+	}
+
+	if err := r.checkShell(ctx, job); err != nil {
+		return result.Finish(ctx, 0, err)
+	}
+
+	shell.WriteSectionStart(stdout, shell.StepScriptSection, shell.StepScriptHeader, false)
+	exitCode, err := r.runScript(ctx, stdout, stderr, job, sandbox, job.GetStepScript(), r.options.Step != nil)
+	shell.WriteSectionEnd(stdout, shell.StepScriptSection)
+
+	if len(job.GetAfterScript()) > 0 {
+		afterCtx, cancel := common.GracefulContext(ctx, common.AfterScriptTimeout)
+		defer cancel()
+
+		shell.WriteSectionStart(stdout, shell.AfterScriptSection, shell.AfterScriptHeader, false)
+		afterExitCode, afterErr := r.runScript(afterCtx, stdout, stderr, job, sandbox, job.GetAfterScript(), false)
+		shell.WriteSectionEnd(stdout, shell.AfterScriptSection)
+		if afterErr == nil && afterExitCode != 0 {
+			afterErr = fmt.Errorf("exited with status %d", afterExitCode)
+		}
+		if afterErr != nil {
+			r.options.Events.Publish(common.Warning{
+				Time:    time.Now(),
+				Job:     job.GetName(),
+				Message: fmt.Sprintf("after_script failed: %s", afterErr),
+			})
+		}
+	}
+
+	result = common.CollectReports(ctx, r.options.RunnerOptions, job, common.DirWorkspace(sandbox), result)
+
+	return result.Finish(ctx, exitCode, err)
+}
+
+// checkShell fails when the shell of job is not a POSIX one, the only ones
+// interpreted. Bash scripts are interpreted as sh ones.
+func (r interpPipelineRunner) checkShell(ctx context.Context, job parserCommon.PipelineJobDescriptor) error {
+	jobShell, err := r.options.JobShell(ctx, job, func(context.Context) (string, error) {
+		return shell.ShName, nil
+	})
+	if err != nil {
+		return err
+	}
+	switch jobShell.Name {
+	case shell.ShName:
+	case shell.BashName:
+		r.options.Events.Publish(common.Warning{
+			Time:    time.Now(),
+			Job:     job.GetName(),
+			Message: "bash scripts are interpreted as sh ones, without pipefail and errtrace",
+		})
+	default:
+		return fmt.Errorf("%w: %s", UnsupportedShellErr, jobShell.Name)
+	}
+	return nil
+}
+
+// writeFileSecrets writes the file secrets in dir, readable by the user
+// only, and returns job with their variables holding the paths.
+func writeFileSecrets(dir string, secrets []common.Secret, job parserCommon.PipelineJobDescriptor) (parserCommon.PipelineJobDescriptor, error) {
+	paths := make(map[string]string)
+	for _, secret := range secrets {
+		if !secret.File {
+			continue
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return job, err
+		}
+		path := filepath.Join(dir, secret.Name)
+		if err := os.WriteFile(path, []byte(secret.Value), 0600); err != nil {
+			return job, err
+		}
+		paths[secret.Name] = path
+	}
+	if len(paths) == 0 {
+		return job, nil
+	}
+	return job.WithVariables(paths), nil
+}
+
+// writeArtifacts copies the stored files of artifacts to their path in dir.
+func writeArtifacts(dir string, artifacts map[string]string) error {
+	for path, stored := range artifacts {
+		if !filepath.IsLocal(filepath.FromSlash(path)) {
+			return fmt.Errorf("%s is outside of the job directory", path)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		content, err := os.ReadFile(stored)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, content, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runScript interprets commands in the sandbox and returns their exit code.
+// Stepped, the commands pause as the options step tells.
+func (r interpPipelineRunner) runScript(ctx context.Context, stdout, stderr io.Writer, job parserCommon.PipelineJobDescriptor, sandbox string, commands []string, stepped bool) (int, error) {
+	var answers chan string
+	if stepped {
+		answers = make(chan string, 1)
+		stepper := r.newStepWriter(ctx, stdout, job, sandbox, commands, answers)
+		defer stepper.Flush()
+		stdout = stepper
+	}
+
+	script, err := r.parseScript(commands, stepped)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse script: %w", err)
+	}
+
+	runner, err := r.newRunner(job, sandbox, stdout, stderr, answers)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = runner.Run(ctx, script); err != nil {
+		if status, ok := interp.IsExitStatus(err); ok {
+			return int(status), nil
+		}
+		if ctx.Err() != nil {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	return 0, nil
+}
+
+// newRunner returns the interpreter of the scripts of job, stepped ones
+// reading their answers from answers.
+func (r interpPipelineRunner) newRunner(job parserCommon.PipelineJobDescriptor, sandbox string, stdout, stderr io.Writer, answers <-chan string) (*interp.Runner, error) {
+	return interp.New(
+		interp.Dir(sandbox),
+		interp.Env(expand.ListEnviron(r.environment(job, sandbox)...)),
+		interp.StdIO(nil, stdout, stderr),
+		interp.OpenHandler(sandboxOpenHandler(answers)),
+		interp.ExecHandlers(r.execHandlers()...),
+	)
+}
+
+func (r interpPipelineRunner) parseScript(commands []string, stepped bool) (*syntax.File, error) {
+	var scriptBuffer bytes.Buffer
+
+	create := shell.CreateShellScriptFromCommands
+	if stepped {
+		create = func(w io.Writer, script []string) error {
+			return shell.CreateSteppedShellScript(w, script, stepAnswers)
+		}
+	}
+	if err := create(&scriptBuffer, commands); err != nil {
+		return nil, err
+	}
+
+	return syntax.NewParser().Parse(&scriptBuffer, scriptName)
+}
+
+// environment builds the variables visible to the job. The host environment is
+// deliberately not inherited, only PATH is kept so that binaries can be found.
+// The job variables come before the runner ones, which take precedence.
+func (r interpPipelineRunner) environment(job parserCommon.PipelineJobDescriptor, sandbox string) []string {
+	env := []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + sandbox,
+		"CI=true",
+		"CI_PROJECT_DIR=" + sandbox,
+		"CI_JOB_NAME=" + job.GetName(),
+		"CI_JOB_STAGE=" + job.GetStage(),
+	}
+	for _, name := range slices.Sorted(maps.Keys(job.GetVariables())) {
+		env = append(env, name+"="+job.GetVariables()[name])
+	}
+	return append(env, r.options.Env...)
+}
+
+func (r interpPipelineRunner) execHandlers() []ExecHandler {
+	handlers := make([]ExecHandler, 0, len(r.options.ExecHandlers)+1)
+	if r.options.Trace != nil {
+		handlers = append(handlers, traceExecHandler(r.options.Trace))
+	}
+	return append(handlers, r.options.ExecHandlers...)
+}
+
+func traceExecHandler(w io.Writer) ExecHandler {
+	return func(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
+		return func(ctx context.Context, args []string) error {
+			start := time.Now()
+			err := next(ctx, args)
+
+			status := 0
+			if code, ok := interp.IsExitStatus(err); ok {
+				status = int(code)
+			}
+			fmt.Fprintf(w, "+ %s (exit %d, %s)\n", strings.Join(args, " "), status, time.Since(start).Round(time.Millisecond))
+			return err
+		}
+	}
+}
+
+// sandboxOpenHandler maps the standard stream device files to the job writers
+// instead of the host ones, and the answers file of stepped scripts to
+// answers.
+func sandboxOpenHandler(answers <-chan string) interp.OpenHandlerFunc {
+	defaultHandler := interp.DefaultOpenHandler()
+	return func(ctx context.Context, path string, flag int, perm os.FileMode) (io.ReadWriteCloser, error) {
+		hc := interp.HandlerCtx(ctx)
+		switch path {
+		case "/dev/stdout":
+			return nopCloser{Writer: hc.Stdout}, nil
+		case "/dev/stderr":
+			return nopCloser{Writer: hc.Stderr}, nil
+		case stepAnswers:
+			if answers != nil {
+				return answerFile(ctx, answers)
+			}
+		}
+		return defaultHandler(ctx, path, flag, perm)
+	}
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Read([]byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+func NewInterpPipelineRunner(options Options) (common.PipelineRunner, error) {
+	if options.BaseDir != "" {
+		if err := os.MkdirAll(options.BaseDir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	return interpPipelineRunner{
+		options,
+	}, nil
+}
@@ -0,0 +1,725 @@
+package interp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/powerpixel/pipelinefox/jobcache"
+	parserCommon "github.com/powerpixel/pipelinefox/parser/common"
+	"github.com/powerpixel/pipelinefox/parser/gitlab"
+	"github.com/powerpixel/pipelinefox/runner/common"
+	"github.com/powerpixel/pipelinefox/shell"
+	"mvdan.cc/sh/v3/interp"
+)
+
+func TestSimpleInterpPipelineExecution(t *testing.T) {
+	testCases := []common.RunnerTestCase{
+		{
+			Title:  "it should run a simple echo command",
+			Stages: []string{"build"},
+			Jobs: []parserCommon.PipelineJobDescriptor{
+				parserCommon.NewPipelineJobDescriptor("test", "build", []string{
+					"echo \"hello :)\"",
+				}),
+			},
+			ExpectedOutput: "hello :)\n",
+		},
+		{
+			Title:  "it should run 2 simple echo jobs in the same stage",
+			Stages: []string{"build"},
+			Jobs: []parserCommon.PipelineJobDescriptor{
+				parserCommon.NewPipelineJobDescriptor("test", "build", []string{
+					"echo \"hello :)\"",
+				}),
+				parserCommon.NewPipelineJobDescriptor("test_2", "build", []string{
+					"echo \"world ;)\"",
+				}),
+			},
+			ExpectedOutput: `hello :)
+world ;)
+`,
+		},
+		{
+			Title:  "it should output string on stderr",
+			Stages: []string{"build"},
+			Jobs: []parserCommon.PipelineJobDescriptor{
+				parserCommon.NewPipelineJobDescriptor("test", "build", []string{
+					"echo \"error :(\" >> /dev/stderr",
+				}),
+			},
+			ExpectedErrorOutput: "error :(\n",
+		},
+		{
+			Title:  "it should expose the job name to the script",
+			Stages: []string{"build"},
+			Jobs: []parserCommon.PipelineJobDescriptor{
+				parserCommon.NewPipelineJobDescriptor("test", "build", []string{
+					"echo \"$CI_JOB_NAME in $CI_JOB_STAGE\"",
+				}),
+			},
+			ExpectedOutput: "test in build\n",
+		},
+		{
+			Title:  "it should run relative file operations inside the sandbox",
+			Stages: []string{"build"},
+			Jobs: []parserCommon.PipelineJobDescriptor{
+				parserCommon.NewPipelineJobDescriptor("test", "build", []string{
+					"echo sandboxed > out.txt",
+					"read content < out.txt",
+					"echo \"$content\"",
+				}),
+			},
+			ExpectedOutput: "sandboxed\n",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Title, func(t *testing.T) {
+			stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+			runner := createNewInterpRunner(t, Options{BaseDir: t.TempDir()})
+
+			pipeline := common.CreateNewPipelineDescriptor(t, testCase.Stages, testCase.Jobs)
+
+			result, err := runner.RunPipeline(context.Background(), stdout, stderr, pipeline)
+
+			expectNoError(t, err)
+			expectPipelineStatus(t, common.JobStatusSuccess, result)
+			expectEqualString(t, testCase.ExpectedOutput, shell.PlainTrace(stdout.String()))
+			expectEqualString(t, testCase.ExpectedErrorOutput, stderr.String())
+		})
+	}
+}
+
+func TestInterpRunsBeforeScript(t *testing.T) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	runner := createNewInterpRunner(t, Options{BaseDir: t.TempDir()})
+
+	parser := gitlab.NewGitlabPipelineParser()
+	pipeline, err := parser.ParsePipelineDescriptor([]byte(`
+stages: [build, test]
+
+default:
+  before_script:
+    - export GREETING=hello
+
+inherited:
+  stage: build
+  script:
+    - echo "greet=$GREETING"
+
+own:
+  stage: test
+  before_script: export GREETING=hi
+  script:
+    - echo "greet=$GREETING"
+  after_script:
+    - echo "after=$GREETING"
+`))
+	expectNoError(t, err)
+
+	result, err := runner.RunPipeline(context.Background(), stdout, stderr, *pipeline)
+
+	expectNoError(t, err)
+	expectPipelineStatus(t, common.JobStatusSuccess, result)
+	expectEqualString(t, "greet=hello\ngreet=hi\nafter=\n", shell.PlainTrace(stdout.String()))
+	if !strings.Contains(stdout.String(), "export GREETING=hello") {
+		t.Fatalf("expected the before_script commands to be echoed, got %q", stdout.String())
+	}
+}
+
+func TestInterpFailingJob(t *testing.T) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	runner := createNewInterpRunner(t, Options{BaseDir: t.TempDir()})
+
+	job := parserCommon.NewPipelineJobDescriptor("test", "build", []string{
+		"echo before",
+		"exit 3",
+		"echo after",
+	})
+
+	result, err := runner.RunPipelineJob(context.Background(), stdout, stderr, job)
+
+	expectNoError(t, err)
+	expectJobResult(t, result, common.JobStatusFailed, 3)
+	expectEqualString(t, "before\n", shell.PlainTrace(stdout.String()))
+}
+
+func TestInterpJobTimeoutRunsAfterScript(t *testing.T) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	runner := createNewInterpRunner(t, Options{BaseDir: t.TempDir()})
+
+	job := parserCommon.NewPipelineJobDescriptor("test", "build", []string{
+		"echo started",
+		"sleep 5",
+		"echo unreachable",
+	}).WithAfterScript([]string{
+		"echo cleaned",
+	}).WithTimeout(100 * time.Millisecond)
+
+	start := time.Now()
+	result, err := runner.RunPipelineJob(context.Background(), stdout, stderr, job)
+
+	expectNoError(t, err)
+	expectJobResult(t, result, common.JobStatusFailed, 0)
+	if result.Reason != "job timed out" {
+		t.Fatalf("expected job to be reported as timed out, got %q", result.Reason)
+	}
+	if elapsed := time.Since(start); elapsed > 4*time.Second {
+		t.Fatalf("expected job to be stopped by its timeout, took %s", elapsed)
+	}
+	expectEqualString(t, "started\ncleaned\n", shell.PlainTrace(stdout.String()))
+}
+
+func TestInterpCanceledJob(t *testing.T) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	runner := createNewInterpRunner(t, Options{BaseDir: t.TempDir()})
+
+	job := parserCommon.NewPipelineJobDescriptor("test", "build", []string{
+		"sleep 5",
+	}).WithAfterScript([]string{
+		"echo cleaned",
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	result, err := runner.RunPipelineJob(ctx, stdout, stderr, job)
+
+	expectNoError(t, err)
+	expectJobResult(t, result, common.JobStatusCanceled, 0)
+	expectEqualString(t, "cleaned\n", shell.PlainTrace(stdout.String()))
+}
+
+func TestInterpExecHandlersAndTracing(t *testing.T) {
+	stdout, stderr, trace := new(bytes.Buffer), new(bytes.Buffer), new(bytes.Buffer)
+	var called [][]string
+
+	stub := func(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
+		return func(ctx context.Context, args []string) error {
+			called = append(called, args)
+			if args[0] == "make" {
+				return interp.NewExitStatus(0)
+			}
+			return next(ctx, args)
+		}
+	}
+
+	runner := createNewInterpRunner(t, Options{
+		BaseDir:      t.TempDir(),
+		ExecHandlers: []ExecHandler{stub},
+		Trace:        trace,
+	})
+
+	job := parserCommon.NewPipelineJobDescriptor("test", "build", []string{
+		"make build",
+	})
+
+	result, err := runner.RunPipelineJob(context.Background(), stdout, stderr, job)
+
+	expectNoError(t, err)
+	expectJobResult(t, result, common.JobStatusSuccess, 0)
+	if len(called) != 1 || strings.Join(called[0], " ") != "make build" {
+		t.Fatalf("expected exec handler to be called with make build, got %v", called)
+	}
+	if !strings.HasPrefix(trace.String(), "+ make build (exit 0") {
+		t.Fatalf("expected trace to contain the executed command, got %q", trace.String())
+	}
+}
+
+func TestInterpSandboxIsRemoved(t *testing.T) {
+	baseDir := t.TempDir()
+	runner := createNewInterpRunner(t, Options{BaseDir: baseDir})
+
+	job := parserCommon.NewPipelineJobDescriptor("test", "build", []string{
+		"echo content > file.txt",
+	})
+
+	_, err := runner.RunPipelineJob(context.Background(), new(bytes.Buffer), new(bytes.Buffer), job)
+	expectNoError(t, err)
+
+	entries, err := os.ReadDir(baseDir)
+	expectNoError(t, err)
+	if len(entries) != 0 {
+		t.Fatalf("expected sandbox to be removed after the job, found %d entries", len(entries))
+	}
+}
+
+func TestInterpJobNameWithSlash(t *testing.T) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	baseDir := t.TempDir()
+	runner := createNewInterpRunner(t, Options{
+		RunnerOptions: common.RunnerOptions{
+			Secrets: []common.Secret{{Name: "KUBECONFIG", Value: "apiVersion: v1", File: true}},
+		},
+		BaseDir: baseDir,
+	})
+
+	job := parserCommon.NewPipelineJobDescriptor("test/unit", "test", []string{
+		"cat \"$KUBECONFIG\"; echo",
+	})
+
+	result, err := runner.RunPipelineJob(context.Background(), stdout, stderr, job)
+
+	expectNoError(t, err)
+	expectJobResult(t, result, common.JobStatusSuccess, 0)
+	expectEqualString(t, "apiVersion: v1\n", shell.PlainTrace(stdout.String()))
+	entries, err := os.ReadDir(baseDir)
+	expectNoError(t, err)
+	if len(entries) != 0 {
+		t.Fatalf("expected sandbox to be removed after the job, found %d entries", len(entries))
+	}
+}
+
+func TestInterpPipelineStagesOrderAndFailure(t *testing.T) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	runner := createNewInterpRunner(t, Options{BaseDir: t.TempDir()})
+
+	pipeline := common.CreateNewPipelineDescriptor(t, []string{"build", "test", "deploy"}, []parserCommon.PipelineJobDescriptor{
+		parserCommon.NewPipelineJobDescriptor("deploy_app", "deploy", []string{"echo deploy"}),
+		parserCommon.NewPipelineJobDescriptor("test_app", "test", []string{"echo test", "false"}),
+		parserCommon.NewPipelineJobDescriptor("lint_app", "test", []string{"echo lint"}),
+		parserCommon.NewPipelineJobDescriptor("build_app", "build", []string{"echo build"}),
+	})
+
+	result, err := runner.RunPipeline(context.Background(), stdout, stderr, pipeline)
+
+	expectNoError(t, err)
+	expectPipelineStatus(t, common.JobStatusFailed, result)
+	expectEqualString(t, "build\ntest\nlint\n", shell.PlainTrace(stdout.String()))
+
+	expected := map[string]common.JobStatus{
+		"build_app":  common.JobStatusSuccess,
+		"test_app":   common.JobStatusFailed,
+		"lint_app":   common.JobStatusSuccess,
+		"deploy_app": common.JobStatusSkipped,
+	}
+	for name, status := range expected {
+		job, found := result.GetJob(name)
+		if !found {
+			t.Fatalf("expected a result for job %s", name)
+		}
+		if job.Status != status {
+			t.Fatalf("expected job %s to be %s, got %s", name, status, job.Status)
+		}
+	}
+}
+
+func TestInterpPipelineWhenConditions(t *testing.T) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	runner := createNewInterpRunner(t, Options{BaseDir: t.TempDir()})
+
+	pipeline := common.CreateNewPipelineDescriptor(t, []string{"build", "cleanup"}, []parserCommon.PipelineJobDescriptor{
+		parserCommon.NewPipelineJobDescriptor("build_app", "build", []string{"false"}),
+		parserCommon.NewPipelineJobDescriptor("deploy_app", "build", []string{"echo deploy"}).WithWhen(parserCommon.WhenManual),
+		parserCommon.NewPipelineJobDescriptor("report", "cleanup", []string{"echo report"}).WithWhen(parserCommon.WhenOnFailure),
+		parserCommon.NewPipelineJobDescriptor("notify", "cleanup", []string{"echo notify"}).WithWhen(parserCommon.WhenAlways),
+	})
+
+	result, err := runner.RunPipeline(context.Background(), stdout, stderr, pipeline)
+
+	expectNoError(t, err)
+	expectEqualString(t, "report\nnotify\n", shell.PlainTrace(stdout.String()))
+	deploy, _ := result.GetJob("deploy_app")
+	if deploy.Status != common.JobStatusManual {
+		t.Fatalf("expected manual job to wait, got %s", deploy.Status)
+	}
+}
+
+func TestInterpCollectsReports(t *testing.T) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	artifactDir := t.TempDir()
+	runner := createNewInterpRunner(t, Options{
+		RunnerOptions: common.RunnerOptions{ArtifactDir: artifactDir},
+		BaseDir:       t.TempDir(),
+	})
+
+	pipeline := common.CreateNewPipelineDescriptor(t, []string{"build", "test"}, []parserCommon.PipelineJobDescriptor{
+		parserCommon.NewPipelineJobDescriptor("build_app", "build", []string{
+			"echo 'VERSION=\"1.2.3\"' > build.env",
+			"echo '# built by ci' >> build.env",
+		}).WithReports(parserCommon.ArtifactReports{Dotenv: []string{"build.env"}}),
+		parserCommon.NewPipelineJobDescriptor("test_app", "test", []string{
+			"echo \"$GREETING $VERSION\"",
+			"mkdir -p reports/unit",
+			"echo '<testsuite/>' > reports/unit/junit-1.xml",
+			"echo '<testsuite/>' > junit-2.xml",
+			"echo ignored > reports/unit/other.xml",
+			"false",
+		}).WithVariables(map[string]string{"GREETING": "version"}).WithReports(parserCommon.ArtifactReports{JUnit: []string{"**/junit-*.xml"}}),
+	})
+
+	result, err := runner.RunPipeline(context.Background(), stdout, stderr, pipeline)
+
+	expectNoError(t, err)
+	expectEqualString(t, "version 1.2.3\n", shell.PlainTrace(stdout.String()))
+
+	build, _ := result.GetJob("build_app")
+	expectEqualString(t, "1.2.3", build.Dotenv["VERSION"])
+
+	test, _ := result.GetJob("test_app")
+	expectJobResult(t, test, common.JobStatusFailed, 1)
+	expected := []string{
+		common.ArtifactPath(artifactDir, "test_app", "junit-2.xml"),
+		common.ArtifactPath(artifactDir, "test_app", "reports/unit/junit-1.xml"),
+	}
+	if !slices.Equal(expected, test.JUnitReports) {
+		t.Fatalf("expected reports %v, got %v", expected, test.JUnitReports)
+	}
+	for _, path := range expected {
+		content, err := os.ReadFile(path)
+		expectNoError(t, err)
+		expectEqualString(t, "<testsuite/>\n", string(content))
+	}
+}
+
+func TestInterpPipelineEvaluatesRules(t *testing.T) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	rules := parserCommon.RuleContext{Variables: map[string]string{"CI_COMMIT_BRANCH": "feature"}}
+	runner := createNewInterpRunner(t, Options{
+		RunnerOptions: common.RunnerOptions{Rules: &rules},
+		BaseDir:       t.TempDir(),
+	})
+
+	pipeline := common.CreateNewPipelineDescriptor(t, []string{"build", "deploy"}, []parserCommon.PipelineJobDescriptor{
+		parserCommon.NewPipelineJobDescriptor("build_app", "build", []string{"echo \"build $TARGET\""}).WithRules([]parserCommon.Rule{
+			{If: `$CI_COMMIT_BRANCH == "main"`, When: parserCommon.WhenNever},
+			{Variables: map[string]string{"TARGET": "review"}},
+		}),
+		parserCommon.NewPipelineJobDescriptor("deploy_app", "deploy", []string{"echo deploy"}).WithRules([]parserCommon.Rule{
+			{If: `$CI_COMMIT_BRANCH == "main"`},
+		}),
+	})
+
+	result, err := runner.RunPipeline(context.Background(), stdout, stderr, pipeline)
+
+	expectNoError(t, err)
+	expectPipelineStatus(t, common.JobStatusSuccess, result)
+	expectEqualString(t, "build review\n", shell.PlainTrace(stdout.String()))
+	deploy, _ := result.GetJob("deploy_app")
+	if deploy.Status != common.JobStatusSkipped {
+		t.Fatalf("expected the job left out by its rules to be skipped, got %s", deploy.Status)
+	}
+}
+
+func TestInterpReportsRestoredJobs(t *testing.T) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	binary := filepath.Join(t.TempDir(), "app")
+	expectNoError(t, os.WriteFile(binary, []byte("built\n"), 0644))
+	restored := common.JobResult{
+		Name:          "build_app",
+		Stage:         "build",
+		Status:        common.JobStatusSuccess,
+		Artifacts:     []string{binary},
+		ArtifactFiles: map[string]string{"dist/app": binary},
+		Dotenv:        map[string]string{"VERSION": "1.2.3"},
+		Reason:        "restored from run 1",
+	}
+	runner := createNewInterpRunner(t, Options{
+		RunnerOptions: common.RunnerOptions{Restored: []common.JobResult{restored}},
+		BaseDir:       t.TempDir(),
+	})
+
+	pipeline := common.CreateNewPipelineDescriptor(t, []string{"build", "test"}, []parserCommon.PipelineJobDescriptor{
+		parserCommon.NewPipelineJobDescriptor("test_app", "test", []string{"echo \"$VERSION\"", "cat dist/app"}),
+	})
+
+	result, err := runner.RunPipeline(context.Background(), stdout, stderr, pipeline)
+
+	expectNoError(t, err)
+	expectPipelineStatus(t, common.JobStatusSuccess, result)
+	expectEqualString(t, "1.2.3\nbuilt\n", shell.PlainTrace(stdout.String()))
+	if len(result.Jobs) != 2 || result.Jobs[0].Name != "build_app" || result.Jobs[0].Reason != restored.Reason {
+		t.Fatalf("expected the restored job to be reported first, got %+v", result.Jobs)
+	}
+}
+
+func TestInterpPassesArtifacts(t *testing.T) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	runner := createNewInterpRunner(t, Options{
+		RunnerOptions: common.RunnerOptions{ArtifactDir: t.TempDir()},
+		BaseDir:       t.TempDir(),
+	})
+
+	pipeline := common.CreateNewPipelineDescriptor(t, []string{"build", "test"}, []parserCommon.PipelineJobDescriptor{
+		parserCommon.NewPipelineJobDescriptor("build_app", "build", []string{
+			"mkdir -p dist/bin && echo built > dist/bin/app && echo notes > notes.txt",
+		}).WithArtifactPaths([]string{"dist/", "*.txt"}),
+		parserCommon.NewPipelineJobDescriptor("lint", "build", []string{"echo linted > lint.txt"}).WithArtifactPaths([]string{"lint.txt"}),
+		parserCommon.NewPipelineJobDescriptor("test_app", "test", []string{"cat dist/bin/app notes.txt", "test ! -e lint.txt"}).WithDependencies([]string{"build_app"}),
+	})
+
+	result, err := runner.RunPipeline(context.Background(), stdout, stderr, pipeline)
+
+	expectNoError(t, err)
+	expectPipelineStatus(t, common.JobStatusSuccess, result)
+	expectEqualString(t, "built\nnotes\n", shell.PlainTrace(stdout.String()))
+	build, _ := result.GetJob("build_app")
+	if len(build.ArtifactFiles) != 2 {
+		t.Fatalf("expected the files of artifacts:paths to be collected, got %v", build.ArtifactFiles)
+	}
+}
+
+func TestInterpJobCache(t *testing.T) {
+	runs := filepath.Join(t.TempDir(), "runs.txt")
+	options := common.RunnerOptions{
+		JobCache: jobcache.New(t.TempDir(), t.TempDir(), nil),
+		LogDir:   t.TempDir(),
+	}
+	runner := createNewInterpRunner(t, Options{RunnerOptions: options, BaseDir: t.TempDir()})
+
+	pipeline := func(script string) parserCommon.PipelineDescriptor {
+		return common.CreateNewPipelineDescriptor(t, []string{"build", "test"}, []parserCommon.PipelineJobDescriptor{
+			parserCommon.NewPipelineJobDescriptor("build_app", "build", []string{
+				"echo build >> " + runs,
+				"echo VERSION=1.2.3 > build.env",
+			}).WithReports(parserCommon.ArtifactReports{Dotenv: []string{"build.env"}}),
+			parserCommon.NewPipelineJobDescriptor("test_app", "test", []string{
+				script + " >> " + runs,
+			}),
+		})
+	}
+
+	for _, script := range []string{"echo \"test $VERSION\"", "echo \"test $VERSION\"", "echo \"tests $VERSION\""} {
+		result, err := runner.RunPipeline(context.Background(), io.Discard, io.Discard, pipeline(script))
+		expectNoError(t, err)
+		expectPipelineStatus(t, common.JobStatusSuccess, result)
+	}
+
+	content, err := os.ReadFile(runs)
+	expectNoError(t, err)
+	expectEqualString(t, "build\ntest 1.2.3\ntests 1.2.3\n", string(content))
+}
+
+func TestInterpRunsJobsConcurrently(t *testing.T) {
+	dir := t.TempDir()
+	runner := createNewInterpRunner(t, Options{
+		RunnerOptions: common.RunnerOptions{
+			Concurrency: 2,
+			Variables:   map[string]string{"DIR": dir, "TARGET": "local"},
+		},
+		BaseDir: t.TempDir(),
+	})
+
+	// Each job waits for the other one to start, which only ends when both
+	// run at once.
+	pipeline := common.CreateNewPipelineDescriptor(t, []string{"test"}, []parserCommon.PipelineJobDescriptor{
+		parserCommon.NewPipelineJobDescriptor("first", "test", []string{
+			"touch \"$DIR/first\"",
+			"while [ ! -f \"$DIR/second\" ]; do sleep 0.01; done",
+			"echo \"$TARGET\" > \"$DIR/target\"",
+		}).WithVariables(map[string]string{"TARGET": "staging"}),
+		parserCommon.NewPipelineJobDescriptor("second", "test", []string{
+			"touch \"$DIR/second\"",
+			"while [ ! -f \"$DIR/first\" ]; do sleep 0.01; done",
+		}),
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	result, err := runner.RunPipeline(ctx, io.Discard, io.Discard, pipeline)
+
+	expectNoError(t, err)
+	expectPipelineStatus(t, common.JobStatusSuccess, result)
+	if len(result.Jobs) != 2 || result.Jobs[0].Name != "first" || result.Jobs[1].Name != "second" {
+		t.Fatalf("expected results in declaration order, got %+v", result.Jobs)
+	}
+	target, err := os.ReadFile(filepath.Join(dir, "target"))
+	expectNoError(t, err)
+	expectEqualString(t, "local\n", string(target))
+}
+
+func TestInterpSecrets(t *testing.T) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	runner := createNewInterpRunner(t, Options{
+		RunnerOptions: common.RunnerOptions{
+			Secrets: []common.Secret{
+				{Name: "TOKEN", Value: "glpat-0123456789", Masked: true},
+				{Name: "KUBECONFIG", Value: "apiVersion: v1", File: true},
+			},
+		},
+		BaseDir: t.TempDir(),
+	})
+
+	pipeline := common.CreateNewPipelineDescriptor(t, []string{"deploy"}, []parserCommon.PipelineJobDescriptor{
+		parserCommon.NewPipelineJobDescriptor("deploy", "deploy", []string{
+			"printf 'token: %s\\n' \"$TOKEN\"",
+			"printf 'glpat-0123' >&2; printf '456789\\n' >&2",
+			"cat \"$KUBECONFIG\"; echo",
+			"case \"$KUBECONFIG\" in \"$CI_PROJECT_DIR\"/*) echo inside;; *) echo outside;; esac",
+		}).WithVariables(map[string]string{"TOKEN": "from the descriptor"}),
+	})
+
+	result, err := runner.RunPipeline(context.Background(), stdout, stderr, pipeline)
+
+	expectNoError(t, err)
+	expectPipelineStatus(t, common.JobStatusSuccess, result)
+	expectEqualString(t, "token: [MASKED]\napiVersion: v1\noutside\n", shell.PlainTrace(stdout.String()))
+	expectEqualString(t, "[MASKED]\n", stderr.String())
+}
+
+func TestInterpControllerCancelsJob(t *testing.T) {
+	controller := common.NewJobController()
+	runner := createNewInterpRunner(t, Options{
+		RunnerOptions: common.RunnerOptions{Controller: controller},
+		BaseDir:       t.TempDir(),
+	})
+
+	job := parserCommon.NewPipelineJobDescriptor("test", "build", []string{"sleep 5"})
+	time.AfterFunc(100*time.Millisecond, func() {
+		controller.Cancel("test")
+	})
+
+	result, err := runner.RunPipelineJob(context.Background(), new(bytes.Buffer), new(bytes.Buffer), job)
+
+	expectNoError(t, err)
+	expectJobResult(t, result, common.JobStatusCanceled, 0)
+	if controller.Cancel("test") {
+		t.Fatalf("expected the job to be forgotten by the controller once over")
+	}
+}
+
+func TestInterpSteppedJobWithoutBreakpoints(t *testing.T) {
+	// Without breakpoints, the steps are answered without the terminal.
+	stepper, err := common.NewStepper(common.StepBreakpoints, nil)
+	expectNoError(t, err)
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	runner := createNewInterpRunner(t, Options{
+		RunnerOptions: common.RunnerOptions{Step: stepper},
+		BaseDir:       t.TempDir(),
+	})
+
+	job := parserCommon.NewPipelineJobDescriptor("test", "build", []string{"echo first", "echo second"}).WithAfterScript([]string{"echo after"})
+	result, err := runner.RunPipelineJob(context.Background(), stdout, stderr, job)
+
+	expectNoError(t, err)
+	expectJobResult(t, result, common.JobStatusSuccess, 0)
+	expectEqualString(t, "first\nsecond\nafter\n", shell.PlainTrace(stdout.String()))
+	if strings.Contains(stdout.String(), shell.StepMarker) {
+		t.Fatalf("expected the step markers to be removed, got %q", stdout.String())
+	}
+}
+
+func TestInterpShells(t *testing.T) {
+	runner := createNewInterpRunner(t, Options{
+		RunnerOptions: common.RunnerOptions{Shell: shell.BashName},
+		BaseDir:       t.TempDir(),
+	})
+
+	stdout := new(bytes.Buffer)
+	job := parserCommon.NewPipelineJobDescriptor("bash", "build", []string{"echo ${GREETING:-hello}"})
+	result, err := runner.RunPipelineJob(context.Background(), stdout, new(bytes.Buffer), job)
+	expectNoError(t, err)
+	expectJobResult(t, result, common.JobStatusSuccess, 0)
+	expectEqualString(t, "hello\n", shell.PlainTrace(stdout.String()))
+
+	job = parserCommon.NewPipelineJobDescriptor("pwsh", "build", []string{"Write-Output hello"}).WithVariables(map[string]string{common.ShellVariable: shell.PwshName})
+	result, err = runner.RunPipelineJob(context.Background(), new(bytes.Buffer), new(bytes.Buffer), job)
+	if !errors.Is(err, UnsupportedShellErr) {
+		t.Fatalf("expected UnsupportedShellErr, got %v", err)
+	}
+	if result.Status != common.JobStatusFailed {
+		t.Fatalf("expected the job to fail, got %s", result.Status)
+	}
+}
+
+func TestInterpPublishesEvents(t *testing.T) {
+	bus := common.NewEventBus()
+	var events []common.Event
+	bus.Subscribe(func(e common.Event) {
+		events = append(events, e)
+	})
+
+	runner := createNewInterpRunner(t, Options{
+		RunnerOptions: common.RunnerOptions{Events: bus},
+		BaseDir:       t.TempDir(),
+	})
+
+	pipeline := common.CreateNewPipelineDescriptor(t, []string{"build"}, []parserCommon.PipelineJobDescriptor{
+		parserCommon.NewPipelineJobDescriptor("test", "build", []string{
+			"echo hello",
+			"echo oops >> /dev/stderr",
+			"printf partial",
+		}),
+	})
+
+	_, err := runner.RunPipeline(context.Background(), new(bytes.Buffer), new(bytes.Buffer), pipeline)
+	expectNoError(t, err)
+
+	var kinds []string
+	var lines []string
+	for _, e := range events {
+		kind := fmt.Sprintf("%T", e)
+		if len(kinds) == 0 || kinds[len(kinds)-1] != kind {
+			kinds = append(kinds, kind)
+		}
+		if line, ok := e.(common.LogLine); ok {
+			if plain := shell.PlainTrace(line.Line); plain != "" {
+				lines = append(lines, string(line.Stream)+":"+plain)
+			}
+		}
+	}
+
+	expectEqualString(t, strings.Join([]string{
+		"common.PipelineStarted",
+		"common.StageStarted",
+		"common.JobStarted",
+		"common.LogLine",
+		"common.JobFinished",
+		"common.PipelineFinished",
+	}, ","), strings.Join(kinds, ","))
+	expectEqualString(t, "stdout:hello,stderr:oops,stdout:partial", strings.Join(lines, ","))
+}
+
+func expectJobResult(t *testing.T, result common.JobResult, status common.JobStatus, exitCode int) {
+	t.Helper()
+	if result.Status != status || result.ExitCode != exitCode {
+		t.Fatalf("expected job to be %s with exit code %d, got %s with exit code %d (%s)",
+			status, exitCode,
+			result.Status, result.ExitCode, result.Reason,
+		)
+	}
+}
+
+func expectEqualString(t *testing.T, expected, actual string) {
+	t.Helper()
+	if expected != actual {
+		t.Fatalf("expected output %s (len %d), got %s (len %d)",
+			expected, len(expected),
+			actual, len(actual),
+		)
+	}
+}
+
+func expectPipelineStatus(t *testing.T, expected common.JobStatus, result common.PipelineResult) {
+	t.Helper()
+	if result.Status != expected {
+		t.Fatalf("expected pipeline status %s, got %s (jobs %+v)", expected, result.Status, result.Jobs)
+	}
+}
+
+func expectNoError(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("expected pipeline to run without issue but encountered %s", err)
+	}
+}
+
+func createNewInterpRunner(t testing.TB, options Options) common.PipelineRunner {
+	t.Helper()
+	res, err := NewInterpPipelineRunner(options)
+
+	if err != nil {
+		t.Fatalf("unexpected error during interp runner creation : %s", err.Error())
+	}
+
+	return res
+}
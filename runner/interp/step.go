@@ -0,0 +1,97 @@
+package interp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	parserCommon "github.com/powerpixel/pipelinefox/parser/common"
+	"github.com/powerpixel/pipelinefox/runner/common"
+	"mvdan.cc/sh/v3/interp"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// stepAnswers is the file stepped scripts read their answers from, served
+// by sandboxOpenHandler.
+const stepAnswers = "/dev/pipelinefox-step"
+
+// newStepWriter returns the writer the output of the stepped commands of job
+// goes through, its answers being sent to answers. Shells are opened in the
+// sandbox with the environment the job starts with.
+func (r interpPipelineRunner) newStepWriter(ctx context.Context, stdout io.Writer, job parserCommon.PipelineJobDescriptor, sandbox string, commands []string, answers chan<- string) *common.StepWriter {
+	answer := func(answer string) error {
+		select {
+		case answers <- answer:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	shell := func(ctx context.Context, t *common.Terminal) error {
+		return r.interactiveShell(ctx, t, job, sandbox)
+	}
+	return r.options.NewStepWriter(ctx, stdout, job, commands, answer, shell)
+}
+
+// answerFile returns the next answer to the stepped script as the content of
+// the file it reads.
+func answerFile(ctx context.Context, answers <-chan string) (io.ReadWriteCloser, error) {
+	select {
+	case answer := <-answers:
+		return readOnlyFile{strings.NewReader(answer + "\n")}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+type readOnlyFile struct {
+	io.Reader
+}
+
+func (readOnlyFile) Write([]byte) (int, error) {
+	return 0, errors.New("read-only file")
+}
+
+func (readOnlyFile) Close() error {
+	return nil
+}
+
+// interactiveShell interprets the lines typed on t until exit is run or the
+// input is closed. The caller holds the lock of t.
+func (r interpPipelineRunner) interactiveShell(ctx context.Context, t *common.Terminal, job parserCommon.PipelineJobDescriptor, sandbox string) error {
+	runner, err := r.newRunner(job, sandbox, t, t, nil)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(t, "Opening a shell in the sandbox of the job, exit it to go on.")
+	parser := syntax.NewParser()
+	for !runner.Exited() {
+		fmt.Fprint(t, "$ ")
+		line, err := t.ReadLine(ctx)
+		if err != nil {
+			fmt.Fprintln(t)
+			return nil
+		}
+
+		command, err := parser.Parse(strings.NewReader(line), "")
+		if err != nil {
+			fmt.Fprintln(t, err)
+			continue
+		}
+		// Run as a whole, the file would end the shell.
+		for _, stmt := range command.Stmts {
+			if err := runner.Run(ctx, stmt); err != nil {
+				if _, ok := interp.IsExitStatus(err); !ok {
+					fmt.Fprintln(t, err)
+				}
+			}
+			if runner.Exited() {
+				break
+			}
+		}
+	}
+	return nil
+}
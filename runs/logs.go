@@ -0,0 +1,148 @@
+package runs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/powerpixel/pipelinefox/runner/common"
+)
+
+const pollInterval = 200 * time.Millisecond
+
+// LogOptions selects what is written by WriteLogs.
+type LogOptions struct {
+	// Job is the job whose log is written, every job of the run when empty.
+	Job string
+	// Stream restricts the log to stdout or stderr, both when empty.
+	Stream common.Stream
+	// Follow keeps on writing the output of running jobs until they finish.
+	Follow bool
+}
+
+// WriteLogs writes the logs of the run id to w.
+func (s Store) WriteLogs(ctx context.Context, w io.Writer, id string, options LogOptions) error {
+	run, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+
+	if options.Job != "" {
+		if !options.Follow {
+			job, err := run.FindJob(options.Job)
+			if err != nil {
+				return err
+			}
+			if !hasLog(job) {
+				return fmt.Errorf("job %s has no log, it was %s", job.Name, job.Status)
+			}
+		}
+		return s.copyLog(ctx, w, id, options.Job, options)
+	}
+
+	// Jobs are recorded as they start, the run being read again once the
+	// known ones are written.
+	for written := 0; ; {
+		for ; written < len(run.Jobs); written++ {
+			job := run.Jobs[written]
+			if !hasLog(job) {
+				continue
+			}
+			fmt.Fprintf(w, "==> %s <==\n", job.Name)
+			if err := s.copyLog(ctx, w, id, job.Name, options); err != nil {
+				return err
+			}
+		}
+
+		if !options.Follow || run.Finished() {
+			return nil
+		}
+		if err := sleep(ctx); err != nil {
+			return err
+		}
+		if run, err = s.Get(id); err != nil {
+			return err
+		}
+	}
+}
+
+// hasLog reports whether job was started, skipped and manual jobs having no
+// output.
+func hasLog(job common.JobResult) bool {
+	return !job.StartedAt.IsZero()
+}
+
+// copyLog writes the log of job to w, following it until the job finishes
+// if asked to.
+func (s Store) copyLog(ctx context.Context, w io.Writer, id, job string, options LogOptions) error {
+	path := common.JobLogPath(s.Dir(id), job, options.Stream)
+	var offset int64
+
+	for {
+		n, err := copyFrom(w, path, offset)
+		if err != nil && !(options.Follow && errors.Is(err, os.ErrNotExist)) {
+			return err
+		}
+		offset = n
+
+		if !options.Follow {
+			return nil
+		}
+
+		run, err := s.Get(id)
+		if err != nil {
+			return err
+		}
+		result, found := run.GetJob(job)
+		finished := found && result.Status != common.JobStatusRunning
+		if finished || run.Finished() {
+			// The job may have written its last lines since the copy.
+			_, err := copyFrom(w, path, offset)
+			if errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("%w: %s in run %s", JobNotFoundErr, job, id)
+			}
+			return err
+		}
+
+		if err := sleep(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// copyFrom writes the content of the file at path from offset to w,
+// returning the offset reached. A file shorter than offset was truncated by
+// a retry of the job and is written from its start.
+func copyFrom(w io.Writer, path string, offset int64) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return offset, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return offset, err
+	}
+	if info.Size() < offset {
+		offset = 0
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return offset, err
+	}
+	n, err := io.Copy(w, file)
+	return offset + n, err
+}
+
+func sleep(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(pollInterval):
+		return nil
+	}
+}
@@ -0,0 +1,305 @@
+package runs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/powerpixel/pipelinefox/runner/common"
+)
+
+// Dir is the directory, relative to the project, where runs are persisted.
+const Dir = ".pipelinefox/runs"
+
+const (
+	metadataFile = "run.json"
+	idTimeFormat = "20060102-150405"
+)
+
+var (
+	RunNotFoundErr = errors.New("run not found")
+	JobNotFoundErr = errors.New("job not found")
+	NoRunErr       = errors.New("no run was recorded yet")
+)
+
+// Run is the metadata of a pipeline run, stored next to its job logs.
+type Run struct {
+	ID       string `json:"id"`
+	Path     string `json:"path"`
+	Executor string `json:"executor"`
+	common.PipelineResult
+}
+
+// Finished reports whether the pipeline is over, jobs retried from the
+// terminal UI being possibly still running.
+func (r Run) Finished() bool {
+	if r.FinishedAt.IsZero() {
+		return false
+	}
+	for _, job := range r.Jobs {
+		if job.Status == common.JobStatusRunning {
+			return false
+		}
+	}
+	return true
+}
+
+// FindJob returns the result of the job named name.
+func (r Run) FindJob(name string) (common.JobResult, error) {
+	job, found := r.GetJob(name)
+	if !found {
+		return common.JobResult{}, fmt.Errorf("%w: %s in run %s", JobNotFoundErr, name, r.ID)
+	}
+	return job, nil
+}
+
+// Store holds the runs of a project.
+type Store struct {
+	root string
+}
+
+// NewStore returns the store of the project in dir.
+func NewStore(dir string) Store {
+	return Store{root: filepath.Join(dir, Dir)}
+}
+
+// Dir returns the directory holding the logs of the run id.
+func (s Store) Dir(id string) string {
+	return filepath.Join(s.root, id)
+}
+
+// List returns the recorded runs, the most recent first.
+func (s Store) List() ([]Run, error) {
+	entries, err := os.ReadDir(s.root)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []Run
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		run, err := s.Get(entry.Name())
+		if errors.Is(err, RunNotFoundErr) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+
+	slices.SortFunc(runs, func(a, b Run) int {
+		return b.StartedAt.Compare(a.StartedAt)
+	})
+	return runs, nil
+}
+
+// Get returns the run id.
+func (s Store) Get(id string) (Run, error) {
+	content, err := os.ReadFile(filepath.Join(s.Dir(id), metadataFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return Run{}, fmt.Errorf("%w: %s", RunNotFoundErr, id)
+	}
+	if err != nil {
+		return Run{}, err
+	}
+
+	var run Run
+	if err := json.Unmarshal(content, &run); err != nil {
+		return Run{}, fmt.Errorf("could not read run %s: %w", id, err)
+	}
+	return run, nil
+}
+
+// Latest returns the most recent run.
+func (s Store) Latest() (Run, error) {
+	runs, err := s.List()
+	if err != nil {
+		return Run{}, err
+	}
+	if len(runs) == 0 {
+		return Run{}, NoRunErr
+	}
+	return runs[0], nil
+}
+
+// LatestSuccess returns the most recent run in which the job named name
+// succeeded, along with its result.
+func (s Store) LatestSuccess(name string) (Run, common.JobResult, error) {
+	runs, err := s.List()
+	if err != nil {
+		return Run{}, common.JobResult{}, err
+	}
+	for _, run := range runs {
+		if job, found := run.GetJob(name); found && job.Status == common.JobStatusSuccess {
+			return run, job, nil
+		}
+	}
+	return Run{}, common.JobResult{}, fmt.Errorf("%w: %s never succeeded", JobNotFoundErr, name)
+}
+
+// Create starts recording a new run of the project at path.
+func (s Store) Create(path, executor string) (*Recorder, error) {
+	id, err := newID(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Recorder{
+		store: s,
+		run: Run{
+			ID:       id,
+			Path:     path,
+			Executor: executor,
+			PipelineResult: common.PipelineResult{
+				Status:    common.JobStatusRunning,
+				StartedAt: time.Now(),
+			},
+		},
+	}
+	if err := os.MkdirAll(s.Dir(id), 0o755); err != nil {
+		return nil, err
+	}
+	if err := r.save(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func newID(now time.Time) (string, error) {
+	suffix := make([]byte, 2)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return now.Format(idTimeFormat) + "-" + hex.EncodeToString(suffix), nil
+}
+
+// Recorder keeps the metadata of a run up to date from the pipeline events.
+// Job logs are written by the runner itself, in the directory returned by
+// Dir.
+type Recorder struct {
+	store Store
+
+	mu  sync.Mutex
+	run Run
+	err error
+}
+
+// ID returns the identifier of the recorded run.
+func (r *Recorder) ID() string {
+	return r.run.ID
+}
+
+// Dir returns the directory where the job logs must be written.
+func (r *Recorder) Dir() string {
+	return r.store.Dir(r.run.ID)
+}
+
+// Err returns the first error met while saving the run metadata.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Handle updates the run from a pipeline event, it is meant to be subscribed
+// to the runner event bus.
+func (r *Recorder) Handle(event common.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch e := event.(type) {
+	case common.PipelineStarted:
+		r.run.StartedAt = e.Time
+	case common.JobStarted:
+		r.setJob(common.JobResult{
+			Name:      e.Job,
+			Stage:     e.Stage,
+			Status:    common.JobStatusRunning,
+			StartedAt: e.Time,
+		})
+	case common.JobFinished:
+		r.setJob(e.Result)
+		if !r.run.FinishedAt.IsZero() {
+			r.run.Status = r.status()
+		}
+	case common.PipelineFinished:
+		jobs := make([]common.JobResult, 0, len(e.Result.Jobs))
+		for _, job := range e.Result.Jobs {
+			// Jobs retried from the terminal UI may have finished since.
+			if i, found := r.job(job.Name); found && r.run.Jobs[i].FinishedAt.After(job.FinishedAt) {
+				job = r.run.Jobs[i]
+			}
+			jobs = append(jobs, job)
+		}
+		r.run.Jobs = jobs
+		r.run.Status = e.Result.Status
+		r.run.FinishedAt = e.Result.FinishedAt
+	default:
+		return
+	}
+
+	if err := r.save(); err != nil && r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *Recorder) job(name string) (int, bool) {
+	for i, job := range r.run.Jobs {
+		if job.Name == name {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+func (r *Recorder) setJob(result common.JobResult) {
+	if i, found := r.job(result.Name); found {
+		r.run.Jobs[i] = result
+		return
+	}
+	r.run.Jobs = append(r.run.Jobs, result)
+}
+
+// status derives the status of the run once jobs were retried after the
+// pipeline finished.
+func (r *Recorder) status() common.JobStatus {
+	status := common.JobStatusSuccess
+	for _, job := range r.run.Jobs {
+		switch job.Status {
+		case common.JobStatusFailed:
+			return common.JobStatusFailed
+		case common.JobStatusCanceled:
+			status = common.JobStatusCanceled
+		}
+	}
+	return status
+}
+
+// save writes the run metadata atomically, readers never seeing a partial
+// file.
+func (r *Recorder) save() error {
+	content, err := json.MarshalIndent(r.run, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(r.Dir(), metadataFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
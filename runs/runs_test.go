@@ -0,0 +1,181 @@
+package runs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	parserCommon "github.com/powerpixel/pipelinefox/parser/common"
+	"github.com/powerpixel/pipelinefox/runner/common"
+)
+
+func TestRecorderPersistsRunAndLogs(t *testing.T) {
+	store := NewStore(t.TempDir())
+	recorder, err := store.Create("/project", "interp")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	bus := common.NewEventBus()
+	bus.Subscribe(recorder.Handle)
+	options := common.RunnerOptions{Events: bus, LogDir: recorder.Dir()}
+
+	bus.Publish(common.PipelineStarted{Time: time.Now()})
+	job := parserCommon.NewPipelineJobDescriptor("build app", "build", nil)
+	result, _ := common.ObserveJob(context.Background(), options, job, io.Discard, io.Discard, func(ctx context.Context, stdout, stderr io.Writer) (common.JobResult, error) {
+		fmt.Fprintln(stdout, "compiling")
+		fmt.Fprintln(stderr, "warning: unused variable")
+		fmt.Fprint(stdout, "done")
+		return common.NewJobResult(job).Finish(ctx, 0, nil)
+	})
+	skipped := common.NewSkippedJobResult(parserCommon.NewPipelineJobDescriptor("deploy", "deploy", nil), common.JobStatusManual, "manual job")
+	bus.Publish(common.PipelineFinished{Time: time.Now(), Result: common.PipelineResult{
+		Status:     common.JobStatusSuccess,
+		FinishedAt: time.Now(),
+		Jobs:       []common.JobResult{result, skipped},
+	}})
+
+	if result.LogPath != common.JobLogPath(recorder.Dir(), "build app", "") {
+		t.Fatalf("unexpected log path %s", result.LogPath)
+	}
+	if err := recorder.Err(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	run, err := store.Latest()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if run.ID != recorder.ID() || run.Executor != "interp" || !run.Finished() {
+		t.Fatalf("unexpected run %+v", run)
+	}
+	if len(run.Jobs) != 2 || run.Jobs[0].LogPath != result.LogPath {
+		t.Fatalf("unexpected jobs %+v", run.Jobs)
+	}
+
+	cases := []struct {
+		options  LogOptions
+		expected string
+	}{
+		{LogOptions{Job: "build app"}, "compiling\nwarning: unused variable\ndone"},
+		{LogOptions{Job: "build app", Stream: common.Stderr}, "warning: unused variable\n"},
+		{LogOptions{Job: "build app", Stream: common.Stdout, Follow: true}, "compiling\ndone"},
+		{LogOptions{}, "==> build app <==\ncompiling\nwarning: unused variable\ndone"},
+	}
+	for _, c := range cases {
+		var out bytes.Buffer
+		if err := store.WriteLogs(context.Background(), &out, run.ID, c.options); err != nil {
+			t.Fatalf("unexpected error for %+v: %s", c.options, err)
+		}
+		if out.String() != c.expected {
+			t.Errorf("expected %q for %+v, got %q", c.expected, c.options, out.String())
+		}
+	}
+
+	if err := store.WriteLogs(context.Background(), io.Discard, run.ID, LogOptions{Job: "deploy"}); err == nil {
+		t.Errorf("expected an error for a job without log")
+	}
+	if err := store.WriteLogs(context.Background(), io.Discard, run.ID, LogOptions{Job: "unknown"}); !errors.Is(err, JobNotFoundErr) {
+		t.Errorf("expected JobNotFoundErr, got %v", err)
+	}
+	if _, err := store.Get("unknown"); !errors.Is(err, RunNotFoundErr) {
+		t.Errorf("expected RunNotFoundErr, got %v", err)
+	}
+}
+
+func TestLatestSuccess(t *testing.T) {
+	store := NewStore(t.TempDir())
+	statuses := []common.JobStatus{common.JobStatusSuccess, common.JobStatusSuccess, common.JobStatusFailed}
+
+	var ids []string
+	for _, status := range statuses {
+		recorder, err := store.Create("/project", "interp")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		bus := common.NewEventBus()
+		bus.Subscribe(recorder.Handle)
+		bus.Publish(common.PipelineStarted{Time: time.Now()})
+		bus.Publish(common.PipelineFinished{Time: time.Now(), Result: common.PipelineResult{
+			Status:     status,
+			FinishedAt: time.Now(),
+			Jobs:       []common.JobResult{{Name: "build", Stage: "build", Status: status}},
+		}})
+		if err := recorder.Err(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		ids = append(ids, recorder.ID())
+		time.Sleep(time.Millisecond)
+	}
+
+	run, job, err := store.LatestSuccess("build")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if run.ID != ids[1] || job.Status != common.JobStatusSuccess {
+		t.Fatalf("expected the job of run %s, got %+v in run %s", ids[1], job, run.ID)
+	}
+	if _, _, err := store.LatestSuccess("deploy"); !errors.Is(err, JobNotFoundErr) {
+		t.Errorf("expected JobNotFoundErr, got %v", err)
+	}
+}
+
+func TestFollowWaitsForRunningJob(t *testing.T) {
+	store := NewStore(t.TempDir())
+	recorder, err := store.Create("/project", "interp")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	bus := common.NewEventBus()
+	bus.Subscribe(recorder.Handle)
+	options := common.RunnerOptions{Events: bus, LogDir: recorder.Dir()}
+	job := parserCommon.NewPipelineJobDescriptor("build", "build", nil)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	go common.ObserveJob(context.Background(), options, job, io.Discard, io.Discard, func(ctx context.Context, stdout, stderr io.Writer) (common.JobResult, error) {
+		fmt.Fprintln(stdout, "first")
+		close(started)
+		<-release
+		fmt.Fprintln(stdout, "second")
+		return common.NewJobResult(job).Finish(ctx, 0, nil)
+	})
+
+	<-started
+	time.AfterFunc(2*pollInterval, func() { close(release) })
+
+	var out bytes.Buffer
+	if err := store.WriteLogs(context.Background(), &out, recorder.ID(), LogOptions{Job: "build", Follow: true}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if out.String() != "first\nsecond\n" {
+		t.Fatalf("unexpected log %q", out.String())
+	}
+}
+
+func TestJobLogPathSanitizesNames(t *testing.T) {
+	if path := common.JobLogPath("runs", "test: 1/2", common.Stderr); path != "runs/test%3A%201%2F2.stderr.log" {
+		t.Fatalf("unexpected path %s", path)
+	}
+
+	// Names differing by characters not allowed in file names, or ending
+	// like the log of a stream, do not share their logs.
+	paths := map[string]string{}
+	for _, name := range []string{"test 1", "test/1", "test_1", "test%201", "a.stderr"} {
+		for _, stream := range []common.Stream{"", common.Stdout, common.Stderr} {
+			path := common.JobLogPath("runs", name, stream)
+			if other, found := paths[path]; found {
+				t.Fatalf("%s and %s share the log %s", other, name, path)
+			}
+			paths[path] = name
+		}
+	}
+	if path := common.JobLogPath("runs", "a", common.Stderr); paths[path] != "" {
+		t.Fatalf("a and %s share the log %s", paths[path], path)
+	}
+}
@@ -0,0 +1,137 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/powerpixel/pipelinefox/runner/common"
+)
+
+// CommandTimeout bounds the time a secret command may take, so that a
+// provider waiting for a passphrase does not hang the run.
+const CommandTimeout = time.Minute
+
+var CommandErr = errors.New("secret command failed")
+
+// Sources tells where secrets are read from. Secrets of a later source
+// replace the ones of the same name of the earlier ones.
+type Sources struct {
+	// Files are dotenv files of KEY=value lines, missing ones being skipped.
+	Files []string
+	// Env holds the names of the environment variables given to jobs, or
+	// patterns matching them as path.Match does.
+	Env []string
+	// Commands are shell commands, such as `pass show deploy/token`, keyed
+	// by the name of the secret their output is the value of.
+	Commands map[string]string
+	// FileVariables holds the names of the secrets given to jobs as files.
+	FileVariables []string
+}
+
+// Load reads the secrets of sources, environ listing the environment as
+// os.Environ does. Every secret is masked, provided that its value can be.
+func Load(ctx context.Context, sources Sources, environ []string) ([]common.Secret, error) {
+	values := make(map[string]string)
+
+	for _, file := range sources.Files {
+		variables, err := readFile(file)
+		if err != nil {
+			return nil, err
+		}
+		maps.Copy(values, variables)
+	}
+
+	for _, entry := range environ {
+		name, value, _ := strings.Cut(entry, "=")
+		if matchesAny(sources.Env, name) {
+			values[name] = value
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(sources.Commands)) {
+		value, err := runCommand(ctx, sources.Commands[name])
+		if err != nil {
+			return nil, fmt.Errorf("secret %s: %w", name, err)
+		}
+		values[name] = value
+	}
+
+	secrets := make([]common.Secret, 0, len(values))
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		secrets = append(secrets, common.Secret{
+			Name:   name,
+			Value:  values[name],
+			Masked: true,
+			File:   slices.Contains(sources.FileVariables, name),
+		})
+	}
+	return secrets, nil
+}
+
+// Unmaskable returns the names of the secrets whose value cannot be masked,
+// and so may appear in the job logs.
+func Unmaskable(secrets []common.Secret) []string {
+	var names []string
+	for _, secret := range secrets {
+		if secret.Masked && !common.CanMask(secret.Value) {
+			names = append(names, secret.Name)
+		}
+	}
+	return names
+}
+
+func readFile(name string) (map[string]string, error) {
+	file, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	variables, err := common.ParseDotenv(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read secrets file %s: %w", name, err)
+	}
+	return variables, nil
+}
+
+func matchesAny(patterns []string, name string) bool {
+	return slices.ContainsFunc(patterns, func(pattern string) bool {
+		matched, _ := path.Match(pattern, name)
+		return matched
+	})
+}
+
+// runCommand returns the output of command without its final newline. The
+// command is run by sh with the standard input of pipelinefox, so that a
+// provider can prompt for a passphrase.
+func runCommand(ctx context.Context, command string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, CommandTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return "", fmt.Errorf("%w: %s: %s", CommandErr, command, message)
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(stdout.String(), "\n"), "\r"), nil
+}
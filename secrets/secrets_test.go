@@ -0,0 +1,60 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/powerpixel/pipelinefox/runner/common"
+)
+
+func TestLoad(t *testing.T) {
+	sources := Sources{
+		Files: []string{"testdata/secrets.env", "testdata/missing.env"},
+		Env:   []string{"AWS_*", "NPM_TOKEN"},
+		Commands: map[string]string{
+			"DEPLOY_TOKEN": "printf 'from-command-0123\\n'",
+		},
+		FileVariables: []string{"KUBECONFIG"},
+	}
+	environ := []string{"AWS_ACCESS_KEY_ID=AKIAEXAMPLE", "HOME=/home/fox", "NPM_TOKEN=npm_0123456789"}
+
+	got, err := Load(context.Background(), sources, environ)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []common.Secret{
+		{Name: "AWS_ACCESS_KEY_ID", Value: "AKIAEXAMPLE", Masked: true},
+		{Name: "DEPLOY_TOKEN", Value: "from-command-0123", Masked: true},
+		{Name: "KUBECONFIG", Value: "apiVersion: v1", Masked: true, File: true},
+		{Name: "NPM_TOKEN", Value: "npm_0123456789", Masked: true},
+	}
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestLoadFailingCommand(t *testing.T) {
+	sources := Sources{Commands: map[string]string{"TOKEN": "echo 'gpg: decryption failed' >&2; exit 2"}}
+
+	_, err := Load(context.Background(), sources, nil)
+	if !errors.Is(err, CommandErr) {
+		t.Fatalf("expected CommandErr, got %v", err)
+	}
+	if expected := "secret TOKEN: secret command failed: echo 'gpg: decryption failed' >&2; exit 2: gpg: decryption failed"; err.Error() != expected {
+		t.Errorf("expected %q, got %q", expected, err.Error())
+	}
+}
+
+func TestUnmaskable(t *testing.T) {
+	secrets := []common.Secret{
+		{Name: "TOKEN", Value: "0123456789", Masked: true},
+		{Name: "PIN", Value: "1234", Masked: true},
+		{Name: "PLAIN", Value: "1234"},
+	}
+	if got := Unmaskable(secrets); !reflect.DeepEqual([]string{"PIN"}, got) {
+		t.Errorf("expected PIN only, got %v", got)
+	}
+}
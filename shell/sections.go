@@ -0,0 +1,106 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sections emitted around the job steps, named as GitLab runner does.
+const (
+	StepScriptSection  = "step_script"
+	AfterScriptSection = "after_script"
+)
+
+const (
+	StepScriptHeader  = `Executing "step_script" stage of the job script`
+	AfterScriptHeader = "Running after_script"
+)
+
+const (
+	clearLine   = "\r\x1b[0K"
+	headerStyle = "\x1b[36;1m"
+	echoStyle   = "\x1b[32;1m$ "
+	resetStyle  = "\x1b[0;m"
+)
+
+var sectionMarkerRegexp = regexp.MustCompile(`section_(start|end):(\d+):([A-Za-z0-9_.-]+)(\[([^\]]*)\])?\r\x1b\[0K`)
+
+// SectionMarker is a section_start or section_end line of a GitLab job trace.
+type SectionMarker struct {
+	Start     bool
+	Name      string
+	Time      time.Time
+	Collapsed bool
+	// Header is the text displayed for the section, on start markers only.
+	Header string
+}
+
+// WriteSectionStart writes the marker opening a collapsible section.
+func WriteSectionStart(w io.Writer, name, header string, collapsed bool) error {
+	options := ""
+	if collapsed {
+		options = "[collapsed=true]"
+	}
+	_, err := fmt.Fprintf(w, "section_start:%d:%s%s%s\x1b[0K%s%s%s\n", time.Now().Unix(), name, options, clearLine, headerStyle, header, resetStyle)
+	return err
+}
+
+// WriteSectionEnd writes the marker closing the section name.
+func WriteSectionEnd(w io.Writer, name string) error {
+	_, err := fmt.Fprintf(w, "section_end:%d:%s%s\n", time.Now().Unix(), name, clearLine)
+	return err
+}
+
+// ParseSectionMarker finds a section marker in line, returning the text
+// written before it on the same line.
+func ParseSectionMarker(line string) (marker SectionMarker, before string, ok bool) {
+	match := sectionMarkerRegexp.FindStringSubmatchIndex(line)
+	if match == nil {
+		return SectionMarker{}, line, false
+	}
+
+	seconds, _ := strconv.ParseInt(line[match[4]:match[5]], 10, 64)
+	marker = SectionMarker{
+		Start: line[match[2]:match[3]] == "start",
+		Name:  line[match[6]:match[7]],
+		Time:  time.Unix(seconds, 0),
+	}
+	if match[10] >= 0 {
+		marker.Collapsed = strings.Contains(line[match[10]:match[11]], "collapsed=true")
+	}
+	if marker.Start {
+		marker.Header = strings.TrimPrefix(line[match[1]:], "\x1b[0K")
+	}
+
+	return marker, line[:match[0]], true
+}
+
+// IsCommandEcho reports whether line is the echo of a command printed before
+// running it.
+func IsCommandEcho(line string) bool {
+	return strings.HasPrefix(line, echoStyle)
+}
+
+// PlainTrace removes section markers and command echoes from a job trace,
+// keeping the output of the commands only.
+func PlainTrace(trace string) string {
+	lines := strings.SplitAfter(trace, "\n")
+	var builder strings.Builder
+
+	for _, line := range lines {
+		if _, before, ok := ParseSectionMarker(line); ok {
+			builder.WriteString(before)
+			continue
+		}
+		if IsCommandEcho(line) {
+			continue
+		}
+		builder.WriteString(line)
+	}
+
+	return builder.String()
+}
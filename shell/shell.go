@@ -1,27 +1,167 @@
 package shell
 
 import (
-	_ "embed"
+	"cmp"
+	"embed"
+	"errors"
+	"fmt"
 	"io"
+	"strings"
 	"text/template"
 )
 
-const templFile = "sh"
+// Names of the shells scripts are written for out of the box.
+const (
+	ShName   = "sh"
+	BashName = "bash"
+	PwshName = "pwsh"
+)
 
-//go:embed templates/sh.tmpl
-var shTempl string
+// commandsTempl is the template writing the commands of POSIX shell
+// scripts, which custom templates may use as well.
+const commandsTempl = "commands"
 
-func CreateShellScriptFromCommands(w io.Writer, script []string) error {
+//go:embed templates/*.tmpl
+var templates embed.FS
+
+var UnknownShellErr = errors.New("unknown shell")
+var InvalidShellErr = errors.New("invalid shell")
+var StepsUnsupportedErr = errors.New("the shell does not support steps")
+
+var templFuncs = template.FuncMap{
+	"echo":    echoLine,
+	"quote":   quote,
+	"psquote": psQuote,
+}
+
+// Shell writes the scripts of jobs for a shell and tells how to run them.
+type Shell struct {
+	Name string
+	// Command runs a script, its path being appended.
+	Command []string
+	// Extension is the one of script files, as some shells require it.
+	Extension string
+	// Steps reports whether the scripts can be stepped, see
+	// CreateSteppedScript.
+	Steps bool
+	tmpl  *template.Template
+}
+
+var (
+	Sh   = mustShell(ShName, []string{"sh"}, ".sh", true)
+	Bash = mustShell(BashName, []string{"bash"}, ".sh", true)
+	// Pwsh is PowerShell Core, whose scripts cannot be stepped.
+	Pwsh = mustShell(PwshName, []string{"pwsh", "-NoProfile", "-NonInteractive", "-File"}, ".ps1", false)
+)
 
-	tmpl, err := template.New(templFile).Parse(shTempl)
+func mustShell(name string, command []string, extension string, steps bool) Shell {
+	tmpl, err := newTemplate(name).ParseFS(templates, "templates/"+name+".tmpl")
 	if err != nil {
-		return err
+		panic(err)
 	}
+	return Shell{Name: name, Command: command, Extension: extension, Steps: steps, tmpl: tmpl.Lookup(name + ".tmpl")}
+}
 
-	err = tmpl.ExecuteTemplate(w, templFile, script)
+// newTemplate returns the template named name, which may use the commands
+// template of POSIX shell scripts.
+func newTemplate(name string) *template.Template {
+	return template.Must(template.New(name).Funcs(templFuncs).ParseFS(templates, "templates/posix.tmpl"))
+}
 
+// NewShell returns the shell named name whose scripts are written by text, a
+// text/template given the Commands of the script and, when stepped, the
+// Answers file. POSIX shells may write their commands with
+// {{ template "commands" . }}, which supports steps. command runs the
+// scripts, .sh being their extension when extension is empty.
+func NewShell(name, text string, command []string, extension string) (Shell, error) {
+	if len(command) == 0 {
+		return Shell{}, fmt.Errorf("%w %s: no command", InvalidShellErr, name)
+	}
+	tmpl, err := newTemplate(name).Parse(text)
 	if err != nil {
-		return err
+		return Shell{}, fmt.Errorf("%w %s: %w", InvalidShellErr, name, err)
+	}
+	return Shell{
+		Name:      name,
+		Command:   command,
+		Extension: cmp.Or(extension, ".sh"),
+		Steps:     strings.Contains(text, ".Answers") || strings.Contains(text, `template "`+commandsTempl+`"`),
+		tmpl:      tmpl,
+	}, nil
+}
+
+// Shells holds the shells jobs may select by name, along with Sh, Bash and
+// Pwsh.
+type Shells map[string]Shell
+
+// Lookup returns the shell named name.
+func (s Shells) Lookup(name string) (Shell, error) {
+	if shell, found := s[name]; found {
+		return shell, nil
+	}
+	switch name {
+	case ShName:
+		return Sh, nil
+	case BashName:
+		return Bash, nil
+	case PwshName:
+		return Pwsh, nil
+	}
+	return Shell{}, fmt.Errorf("%w %s", UnknownShellErr, name)
+}
+
+// scriptData is what the script template is executed with.
+type scriptData struct {
+	Commands []string
+	// Answers is the file stepped scripts read their answers from, empty
+	// when the script is not stepped.
+	Answers string
+}
+
+// CreateScript writes the script running commands. Like GitLab runner, each
+// command is echoed before being run.
+func (s Shell) CreateScript(w io.Writer, commands []string) error {
+	return s.tmpl.Execute(w, scriptData{Commands: commands})
+}
+
+// CreateSteppedScript writes a script running commands which, before each
+// of them, writes StepMarker followed by the index of the command on a line
+// of its own, then reads what to do from the answers file: StepRun,
+// StepSkip, StepAbort, or StepEdit followed by the command to run instead.
+func (s Shell) CreateSteppedScript(w io.Writer, commands []string, answers string) error {
+	if !s.Steps {
+		return fmt.Errorf("%w: %s", StepsUnsupportedErr, s.Name)
+	}
+	return s.tmpl.Execute(w, scriptData{Commands: commands, Answers: answers})
+}
+
+// CreateShellScriptFromCommands writes a POSIX shell script running script.
+// Like GitLab runner, each command is echoed before being run.
+func CreateShellScriptFromCommands(w io.Writer, script []string) error {
+	return Sh.CreateScript(w, script)
+}
+
+// CreateSteppedShellScript is CreateSteppedScript for a POSIX shell script.
+func CreateSteppedShellScript(w io.Writer, script []string, answers string) error {
+	return Sh.CreateSteppedScript(w, script, answers)
+}
+
+// echoLine returns the line displayed for command, multi-line commands being
+// shortened to their first line as GitLab does.
+func echoLine(command string) string {
+	command = strings.TrimSpace(command)
+	if first, _, multiline := strings.Cut(command, "\n"); multiline {
+		return first + " # collapsed multi-line command"
 	}
-	return nil
+	return command
+}
+
+// quote returns s as a single-quoted shell word.
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
+// psQuote returns s as a single-quoted PowerShell string.
+func psQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
 }
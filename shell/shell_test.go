@@ -1,7 +1,14 @@
 package shell
 
 import (
+	"bufio"
 	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -55,3 +62,229 @@ func assertOutputEquality(t *testing.T, expected, actual string) {
 func trimString(str string) string {
 	return strings.Trim(strings.Trim(str, " "), "\n")
 }
+
+func TestMultiLineCommandEcho(t *testing.T) {
+	var outputBuff bytes.Buffer
+
+	err := CreateShellScriptFromCommands(&outputBuff, []string{"if true; then\n  echo 'yes'\nfi"})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err.Error())
+	}
+
+	if !strings.Contains(outputBuff.String(), `'if true; then # collapsed multi-line command'`) {
+		t.Fatalf("expected multi-line command to be echoed on a single line, got\n%s", outputBuff.String())
+	}
+}
+
+func TestSectionMarkers(t *testing.T) {
+	var outputBuff bytes.Buffer
+
+	if err := WriteSectionStart(&outputBuff, "prepare", "Preparing", true); err != nil {
+		t.Fatalf("unexpected err: %s", err.Error())
+	}
+	outputBuff.WriteString("\x1b[32;1m$ echo hello\x1b[0;m\n")
+	outputBuff.WriteString("hello\n")
+	outputBuff.WriteString("partial")
+	if err := WriteSectionEnd(&outputBuff, "prepare"); err != nil {
+		t.Fatalf("unexpected err: %s", err.Error())
+	}
+
+	lines := strings.Split(outputBuff.String(), "\n")
+
+	start, _, ok := ParseSectionMarker(lines[0])
+	if !ok || !start.Start || start.Name != "prepare" || !start.Collapsed {
+		t.Fatalf("expected a collapsed prepare section start, got %+v", start)
+	}
+	if start.Header != "\x1b[36;1mPreparing\x1b[0;m" {
+		t.Fatalf("unexpected section header %q", start.Header)
+	}
+
+	end, before, ok := ParseSectionMarker(lines[3])
+	if !ok || end.Start || end.Name != "prepare" || before != "partial" {
+		t.Fatalf("expected a prepare section end after partial, got %+v (before %q)", end, before)
+	}
+
+	assertOutputEquality(t, "hello\npartial", PlainTrace(outputBuff.String()))
+}
+
+func TestSteppedShellScript(t *testing.T) {
+	dir := t.TempDir()
+	answers := filepath.Join(dir, "answers")
+	if err := exec.Command("mkfifo", answers).Run(); err != nil {
+		t.Skipf("cannot create a FIFO: %s", err)
+	}
+
+	var script bytes.Buffer
+	commands := []string{"echo run", "echo skipped", "echo edited", "echo aborted", "echo never"}
+	if err := CreateSteppedShellScript(&script, commands, answers); err != nil {
+		t.Fatalf("unexpected err: %s", err.Error())
+	}
+
+	cmd := exec.Command("sh", "-c", script.String())
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err.Error())
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("unexpected err: %s", err.Error())
+	}
+
+	// Each step is answered once the script asks for it.
+	replies := []string{StepRun, StepSkip, StepEdit + " echo instead", StepAbort}
+	var steps []int
+	var output []string
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line := scanner.Text()
+		index, found := strings.CutPrefix(line, StepMarker)
+		if !found {
+			output = append(output, line)
+			continue
+		}
+		step, err := strconv.Atoi(index)
+		if err != nil {
+			t.Fatalf("unexpected step marker %q", line)
+		}
+		steps = append(steps, step)
+		if err := os.WriteFile(answers, []byte(replies[step]+"\n"), 0600); err != nil {
+			t.Fatalf("unexpected err: %s", err.Error())
+		}
+	}
+
+	if err := cmd.Wait(); err == nil {
+		t.Fatal("expected the aborted script to fail")
+	}
+	if expected := []int{0, 1, 2, 3}; !slices.Equal(expected, steps) {
+		t.Fatalf("expected steps %v, got %v", expected, steps)
+	}
+	expected := "\x1b[32;1m$ echo run\x1b[0;m\nrun\n\x1b[32;1m$ echo instead\x1b[0;m\ninstead"
+	assertOutputEquality(t, expected, strings.Join(output, "\n"))
+}
+
+func TestBreakpoints(t *testing.T) {
+	if !IsBreakpoint("  " + BreakMarker + "\n") {
+		t.Fatal("expected a lone marker to be a breakpoint")
+	}
+	if IsBreakpoint("echo hello " + BreakMarker) {
+		t.Fatal("expected a command holding a marker not to be a breakpoint")
+	}
+	if !HasBreakpoint("make build\nmake test " + BreakMarker) {
+		t.Fatal("expected a marker ending a line to be found")
+	}
+	if HasBreakpoint("echo " + BreakMarker + " later") {
+		t.Fatal("expected a marker in the middle of a line to be ignored")
+	}
+}
+
+func TestBashScriptFailsOnPipelines(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not available")
+	}
+
+	var script bytes.Buffer
+	if err := Bash.CreateScript(&script, []string{"false | true", "echo after"}); err != nil {
+		t.Fatalf("unexpected err: %s", err.Error())
+	}
+	out, err := exec.Command("bash", "-c", script.String()).Output()
+	if err == nil {
+		t.Fatal("expected the failing pipeline to stop the script")
+	}
+	if strings.Contains(string(out), "after\n") {
+		t.Fatalf("expected the script to stop before the last command, got\n%s", out)
+	}
+}
+
+func TestPwshScript(t *testing.T) {
+	var script bytes.Buffer
+	if err := Pwsh.CreateScript(&script, []string{"Write-Output 'it''s'"}); err != nil {
+		t.Fatalf("unexpected err: %s", err.Error())
+	}
+
+	for _, expected := range []string{
+		"$ErrorActionPreference = 'Stop'",
+		"Write-Host (\"$([char]27)[32;1m`$ \" + 'Write-Output ''it''''s''' + \"$([char]27)[0;m\")",
+		"Write-Output 'it''s'\nif (!$?) { exit $(if ($LASTEXITCODE) { $LASTEXITCODE } else { 1 }) }",
+	} {
+		if !strings.Contains(script.String(), expected) {
+			t.Fatalf("expected the script to contain %q, got\n%s", expected, script.String())
+		}
+	}
+
+	if err := Pwsh.CreateSteppedScript(&script, nil, "answers"); !errors.Is(err, StepsUnsupportedErr) {
+		t.Fatalf("expected StepsUnsupportedErr, got %v", err)
+	}
+}
+
+func TestPwshScriptRuns(t *testing.T) {
+	if _, err := exec.LookPath("pwsh"); err != nil {
+		t.Skip("pwsh is not available")
+	}
+
+	run := func(commands []string) (string, error) {
+		t.Helper()
+		var script bytes.Buffer
+		if err := Pwsh.CreateScript(&script, commands); err != nil {
+			t.Fatalf("unexpected err: %s", err.Error())
+		}
+		path := filepath.Join(t.TempDir(), "script"+Pwsh.Extension)
+		if err := os.WriteFile(path, script.Bytes(), 0600); err != nil {
+			t.Fatalf("unexpected err: %s", err.Error())
+		}
+		out, err := exec.Command(Pwsh.Command[0], append(Pwsh.Command[1:], path)...).Output()
+		return string(out), err
+	}
+
+	out, err := run([]string{"Write-Output 'it''s'"})
+	if err != nil {
+		t.Fatalf("expected the script to succeed, got %v\n%s", err, out)
+	}
+	assertOutputEquality(t, "\x1b[32;1m$ Write-Output 'it''s'\x1b[0;m\nit's\n", out)
+
+	out, err = run([]string{"pwsh -NoProfile -Command 'exit 3'", "Write-Output after"})
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Fatalf("expected the script to exit with the status of the failed command, got %v", err)
+	}
+	if strings.Contains(out, "after\n") {
+		t.Fatalf("expected the script to stop after the failed command, got\n%s", out)
+	}
+}
+
+func TestCustomShell(t *testing.T) {
+	custom, err := NewShell("zsh", "#!/bin/zsh\nsetopt err_exit\n{{- template \"commands\" . }}\n", []string{"zsh"}, "")
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err.Error())
+	}
+	if !custom.Steps || custom.Extension != ".sh" {
+		t.Fatalf("expected a stepped shell with .sh scripts, got %+v", custom)
+	}
+
+	var script bytes.Buffer
+	if err := custom.CreateScript(&script, []string{"echo 'Hello World!'"}); err != nil {
+		t.Fatalf("unexpected err: %s", err.Error())
+	}
+	expected := strings.Replace(utils.ReadTestFile(t, "testdata/simple.sh"), "#!/bin/sh\n\nset -e", "#!/bin/zsh\nsetopt err_exit", 1)
+	assertOutputEquality(t, expected, script.String())
+
+	if _, err := NewShell("broken", "{{ .Commands", []string{"sh"}, ""); !errors.Is(err, InvalidShellErr) {
+		t.Fatalf("expected InvalidShellErr for an invalid template, got %v", err)
+	}
+	if _, err := NewShell("nothing", "", nil, ""); !errors.Is(err, InvalidShellErr) {
+		t.Fatalf("expected InvalidShellErr without command, got %v", err)
+	}
+}
+
+func TestLookupShell(t *testing.T) {
+	custom, _ := NewShell("sh", "{{ range .Commands }}{{ . }}\n{{ end }}", []string{"dash"}, "")
+	shells := Shells{"sh": custom}
+
+	if found, err := shells.Lookup(ShName); err != nil || found.Command[0] != "dash" {
+		t.Fatalf("expected the custom shell to replace the built-in one, got %+v, %v", found, err)
+	}
+	if found, err := shells.Lookup(PwshName); err != nil || found.Extension != ".ps1" {
+		t.Fatalf("expected the built-in pwsh, got %+v, %v", found, err)
+	}
+	if _, err := Shells(nil).Lookup("fish"); !errors.Is(err, UnknownShellErr) {
+		t.Fatalf("expected UnknownShellErr, got %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package shell
+
+import (
+	"strings"
+)
+
+// StepMarker starts the line a stepped script writes before each of its
+// commands, followed by the index of the command.
+const StepMarker = "\x1b]pipelinefox;step;"
+
+// Answers of stepped scripts, telling what to do with their next command.
+const (
+	StepRun   = "run"
+	StepSkip  = "skip"
+	StepAbort = "abort"
+	// StepEdit is followed by a space and the command run instead.
+	StepEdit = "edit"
+)
+
+// BreakMarker is the comment setting a breakpoint in a script, before the
+// command holding it, or before the next one when it is a command of its
+// own.
+const BreakMarker = "# pipelinefox:break"
+
+// IsBreakpoint reports whether command is nothing but a break marker.
+func IsBreakpoint(command string) bool {
+	return strings.TrimSpace(command) == BreakMarker
+}
+
+// HasBreakpoint reports whether a line of command ends with a break marker.
+func HasBreakpoint(command string) bool {
+	for _, line := range strings.Split(command, "\n") {
+		if strings.HasSuffix(strings.TrimSpace(line), BreakMarker) {
+			return true
+		}
+	}
+	return false
+}
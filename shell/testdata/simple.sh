@@ -1,4 +1,5 @@
 #!/bin/sh
 
 set -e
-echo 'Hello World!'
\ No newline at end of file
+printf '\033[32;1m$ %s\033[0;m\n' 'echo '"'"'Hello World!'"'"''
+echo 'Hello World!'
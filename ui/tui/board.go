@@ -0,0 +1,397 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	parserCommon "github.com/powerpixel/pipelinefox/parser/common"
+	"github.com/powerpixel/pipelinefox/runner/common"
+	"github.com/powerpixel/pipelinefox/shell"
+)
+
+const (
+	maxLogLines = 10000
+
+	colorReset  = "\x1b[0m"
+	colorBold   = "\x1b[1m"
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorBlue   = "\x1b[34m"
+	colorGray   = "\x1b[90m"
+	colorInvert = "\x1b[7m"
+)
+
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+type view int
+
+const (
+	boardView view = iota
+	logView
+)
+
+type jobState struct {
+	descriptor parserCommon.PipelineJobDescriptor
+	status     common.JobStatus
+	startedAt  time.Time
+	finishedAt time.Time
+	exitCode   int
+	reason     string
+	detail     string
+	logs       []string
+	result     common.JobResult
+}
+
+func (j *jobState) duration(now time.Time) time.Duration {
+	switch {
+	case j.startedAt.IsZero():
+		return 0
+	case j.finishedAt.IsZero():
+		return now.Sub(j.startedAt)
+	default:
+		return j.finishedAt.Sub(j.startedAt)
+	}
+}
+
+func (j *jobState) finished() bool {
+	switch j.status {
+	case common.JobStatusSuccess, common.JobStatusFailed, common.JobStatusCanceled:
+		return true
+	default:
+		return false
+	}
+}
+
+// board is the state of the pipeline as shown on screen, built from the
+// events published by the runner.
+type board struct {
+	stages     []string
+	jobs       []*jobState
+	byName     map[string]*jobState
+	pulls      map[string]*common.PullProgress
+	startedAt  time.Time
+	finishedAt time.Time
+	running    bool
+	message    string
+
+	view      view
+	selected  int
+	logScroll int
+}
+
+func newBoard(pipeline parserCommon.PipelineDescriptor) *board {
+	b := &board{
+		byName: make(map[string]*jobState),
+		pulls:  make(map[string]*common.PullProgress),
+	}
+
+	for _, stage := range pipeline.GetStageNames() {
+		jobs := pipeline.GetStages()[stage]
+		if len(jobs) == 0 {
+			continue
+		}
+		b.stages = append(b.stages, stage)
+		for _, job := range jobs {
+			state := &jobState{
+				descriptor: job,
+				status:     common.JobStatusCreated,
+			}
+			b.jobs = append(b.jobs, state)
+			b.byName[job.GetName()] = state
+		}
+	}
+
+	return b
+}
+
+func (b *board) handle(event common.Event) {
+	switch e := event.(type) {
+	case common.PipelineStarted:
+		b.startedAt = e.Time
+		b.running = true
+	case common.ImagePulling:
+		if job, ok := b.byName[e.Job]; ok {
+			pull, found := b.pulls[e.Image]
+			if !found {
+				pull = common.NewPullProgress()
+				b.pulls[e.Image] = pull
+			}
+			pull.Update(e)
+			done, layers := pull.Layers()
+			job.detail = fmt.Sprintf("pulling %s %d%% (%d/%d layers)", e.Image, pull.Percent(), done, layers)
+		}
+	case common.JobStarted:
+		if job, ok := b.byName[e.Job]; ok {
+			job.status = common.JobStatusRunning
+			job.startedAt = e.Time
+			job.finishedAt = time.Time{}
+			job.reason = ""
+			job.detail = ""
+			job.logs = nil
+		}
+	case common.LogLine:
+		if job, ok := b.byName[e.Job]; ok {
+			line := e.Line
+			if marker, before, isMarker := shell.ParseSectionMarker(line); isMarker {
+				line = before + marker.Header
+			}
+			job.logs = append(job.logs, line)
+			if len(job.logs) > maxLogLines {
+				job.logs = job.logs[len(job.logs)-maxLogLines:]
+			}
+		}
+	case common.JobFinished:
+		if job, ok := b.byName[e.Result.Name]; ok {
+			job.status = e.Result.Status
+			job.finishedAt = e.Result.FinishedAt
+			job.exitCode = e.Result.ExitCode
+			job.reason = e.Result.Reason
+			job.detail = ""
+			job.result = e.Result
+		}
+	case common.Warning:
+		b.message = fmt.Sprintf("%s: %s", e.Job, e.Message)
+	case common.PipelineFinished:
+		b.finishedAt = e.Time
+		b.running = false
+	}
+}
+
+// result returns the outcome of the pipeline, including the jobs retried or
+// triggered from the board.
+func (b *board) result() common.PipelineResult {
+	result := common.PipelineResult{
+		Status:     common.JobStatusSuccess,
+		StartedAt:  b.startedAt,
+		FinishedAt: b.finishedAt,
+	}
+
+	for _, job := range b.jobs {
+		jobResult := job.result
+		if jobResult.Name == "" {
+			jobResult = common.NewSkippedJobResult(job.descriptor, job.status, job.reason)
+		}
+		result.Jobs = append(result.Jobs, jobResult)
+
+		switch jobResult.Status {
+		case common.JobStatusFailed:
+			result.Status = common.JobStatusFailed
+		case common.JobStatusCanceled:
+			if result.Status != common.JobStatusFailed {
+				result.Status = common.JobStatusCanceled
+			}
+		}
+	}
+
+	return result
+}
+
+func (b *board) selectedJob() *jobState {
+	if len(b.jobs) == 0 {
+		return nil
+	}
+	return b.jobs[b.selected]
+}
+
+func (b *board) move(delta int) {
+	if b.view == logView {
+		b.scroll(-delta)
+		return
+	}
+	b.selected = max(0, min(len(b.jobs)-1, b.selected+delta))
+}
+
+// scroll moves the log view up by delta lines, a zero offset following the
+// end of the log.
+func (b *board) scroll(delta int) {
+	job := b.selectedJob()
+	if job == nil {
+		return
+	}
+	b.logScroll = max(0, min(len(job.logs), b.logScroll+delta))
+}
+
+func (b *board) openLog() {
+	b.view = logView
+	b.logScroll = 0
+}
+
+func (b *board) closeLog() {
+	b.view = boardView
+}
+
+// render draws the current view on a screen of width columns and height rows.
+func (b *board) render(width, height int, now time.Time) []string {
+	var lines []string
+	if b.view == logView {
+		lines = b.renderLog(height, now)
+	} else {
+		lines = b.renderBoard(now)
+	}
+
+	lines = append(lines, b.footer())
+	if len(lines) > height {
+		lines = append(lines[:height-1], lines[len(lines)-1])
+	}
+
+	for i, line := range lines {
+		lines[i] = truncate(line, width)
+	}
+	return lines
+}
+
+func (b *board) renderBoard(now time.Time) []string {
+	lines := []string{b.header(now), ""}
+
+	index := 0
+	for _, stage := range b.stages {
+		lines = append(lines, colorBold+stage+colorReset)
+		for _, job := range b.jobs {
+			if job.descriptor.GetStage() != stage {
+				continue
+			}
+
+			cursor := "  "
+			name := fmt.Sprintf("%-30s", job.descriptor.GetName())
+			if index == b.selected {
+				cursor = "> "
+				name = colorInvert + name + colorReset
+			}
+
+			lines = append(lines, fmt.Sprintf("  %s%s %s %8s  %s",
+				cursor,
+				statusIcon(job.status, now),
+				name,
+				formatDuration(job.duration(now)),
+				b.jobDetail(job),
+			))
+			index++
+		}
+	}
+
+	return lines
+}
+
+func (b *board) renderLog(height int, now time.Time) []string {
+	job := b.selectedJob()
+	if job == nil {
+		return nil
+	}
+
+	lines := []string{
+		fmt.Sprintf("%s %s%s%s  %s  %s",
+			statusIcon(job.status, now),
+			colorBold, job.descriptor.GetName(), colorReset,
+			job.status,
+			formatDuration(job.duration(now)),
+		),
+		"",
+	}
+
+	available := max(1, height-len(lines)-1)
+	end := len(job.logs) - b.logScroll
+	start := max(0, end-available)
+	lines = append(lines, job.logs[start:end]...)
+
+	return lines
+}
+
+func (b *board) header(now time.Time) string {
+	status := "running"
+	end := now
+	if !b.running && !b.finishedAt.IsZero() {
+		status = string(b.result().Status)
+		end = b.finishedAt
+	}
+
+	var elapsed time.Duration
+	if !b.startedAt.IsZero() {
+		elapsed = end.Sub(b.startedAt)
+	}
+
+	return fmt.Sprintf("%sPipeline %s%s  %s", colorBold, status, colorReset, formatDuration(elapsed))
+}
+
+func (b *board) footer() string {
+	keys := "[↑↓] select  [enter] logs  [c] cancel  [r] retry  [p] play  [q] quit"
+	if b.view == logView {
+		keys = "[↑↓/pgup/pgdn] scroll  [G] follow  [c] cancel  [r] retry  [p] play  [esc] back"
+	}
+	if b.message != "" {
+		return colorYellow + b.message + colorReset + "  " + colorGray + keys + colorReset
+	}
+	return colorGray + keys + colorReset
+}
+
+func (b *board) jobDetail(job *jobState) string {
+	switch {
+	case job.detail != "":
+		return colorGray + job.detail + colorReset
+	case job.status == common.JobStatusRunning && len(job.logs) > 0:
+		return colorGray + job.logs[len(job.logs)-1] + colorReset
+	case job.reason != "":
+		return colorGray + job.reason + colorReset
+	default:
+		return ""
+	}
+}
+
+func statusIcon(status common.JobStatus, now time.Time) string {
+	switch status {
+	case common.JobStatusRunning:
+		frame := now.UnixMilli() / 100 % int64(len(spinnerFrames))
+		return colorBlue + spinnerFrames[frame] + colorReset
+	case common.JobStatusSuccess:
+		return colorGreen + "✔" + colorReset
+	case common.JobStatusFailed:
+		return colorRed + "✘" + colorReset
+	case common.JobStatusCanceled:
+		return colorGray + "⊘" + colorReset
+	case common.JobStatusSkipped:
+		return colorGray + "»" + colorReset
+	case common.JobStatusManual:
+		return colorYellow + "▶" + colorReset
+	default:
+		return colorGray + "●" + colorReset
+	}
+}
+
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	if d < time.Minute {
+		return d.Round(100 * time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
+
+// truncate cuts line to width visible characters, ANSI sequences excluded.
+func truncate(line string, width int) string {
+	var builder strings.Builder
+	visible := 0
+	inEscape := false
+
+	for _, r := range line {
+		switch {
+		case inEscape:
+			builder.WriteRune(r)
+			if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+				inEscape = false
+			}
+		case r == '\x1b':
+			builder.WriteRune(r)
+			inEscape = true
+		case visible < width:
+			builder.WriteRune(r)
+			visible++
+		}
+	}
+
+	if visible >= width {
+		builder.WriteString(colorReset)
+	}
+	return builder.String()
+}
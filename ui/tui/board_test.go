@@ -0,0 +1,119 @@
+package tui
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	parserCommon "github.com/powerpixel/pipelinefox/parser/common"
+	"github.com/powerpixel/pipelinefox/runner/common"
+)
+
+var ansiRegexp = regexp.MustCompile("\x1b\\[[0-9;?]*[a-zA-Z]")
+
+func TestBoardRendersJobStatuses(t *testing.T) {
+	b := newTestBoard(t)
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	b.handle(common.PipelineStarted{Time: start})
+	b.handle(common.JobStarted{Time: start, Job: "build_app", Stage: "build"})
+	b.handle(common.LogLine{Time: start, Job: "build_app", Stream: common.Stdout, Line: "compiling"})
+	b.handle(common.JobFinished{Time: start, Result: common.JobResult{
+		Name:       "build_app",
+		Stage:      "build",
+		Status:     common.JobStatusSuccess,
+		StartedAt:  start,
+		FinishedAt: start.Add(2 * time.Second),
+	}})
+	b.handle(common.JobStarted{Time: start, Job: "test_app", Stage: "test"})
+	b.handle(common.LogLine{Time: start, Job: "test_app", Stream: common.Stdout, Line: "running tests"})
+	b.handle(common.JobFinished{Time: start, Result: common.NewSkippedJobResult(
+		parserCommon.NewPipelineJobDescriptor("deploy_app", "deploy", nil),
+		common.JobStatusManual,
+		"manual job waiting to be triggered",
+	)})
+
+	screen := renderPlain(b, start.Add(3*time.Second))
+
+	expectContains(t, screen, "Pipeline running  3s")
+	expectContains(t, screen, "> ✔ build_app")
+	expectContains(t, screen, "2s")
+	expectContains(t, screen, "running tests")
+	expectContains(t, screen, "▶ deploy_app")
+	expectContains(t, screen, "manual job waiting to be triggered")
+}
+
+func TestBoardLogViewScrolls(t *testing.T) {
+	b := newTestBoard(t)
+	now := time.Now()
+
+	b.handle(common.JobStarted{Time: now, Job: "build_app", Stage: "build"})
+	for _, line := range []string{"one", "two", "three", "four", "five"} {
+		b.handle(common.LogLine{Time: now, Job: "build_app", Stream: common.Stdout, Line: line})
+	}
+
+	b.openLog()
+	lines := b.render(80, 6, now)
+	screen := ansiRegexp.ReplaceAllString(strings.Join(lines, "\n"), "")
+	expectContains(t, screen, "four\nfive")
+
+	b.move(-2)
+	lines = b.render(80, 6, now)
+	screen = ansiRegexp.ReplaceAllString(strings.Join(lines, "\n"), "")
+	expectContains(t, screen, "two\nthree")
+	if strings.Contains(screen, "five") {
+		t.Fatalf("expected the log to be scrolled up, got\n%s", screen)
+	}
+
+	b.closeLog()
+	b.move(1)
+	if b.selectedJob().descriptor.GetName() != "test_app" {
+		t.Fatalf("expected test_app to be selected, got %s", b.selectedJob().descriptor.GetName())
+	}
+}
+
+func TestBoardResultKeepsLastRun(t *testing.T) {
+	b := newTestBoard(t)
+	now := time.Now()
+
+	b.handle(common.JobFinished{Time: now, Result: common.JobResult{Name: "build_app", Stage: "build", Status: common.JobStatusFailed}})
+	b.handle(common.JobFinished{Time: now, Result: common.JobResult{Name: "build_app", Stage: "build", Status: common.JobStatusSuccess}})
+
+	result := b.result()
+	job, _ := result.GetJob("build_app")
+	if job.Status != common.JobStatusSuccess {
+		t.Fatalf("expected the retried job to succeed, got %s", job.Status)
+	}
+	if result.Status != common.JobStatusSuccess {
+		t.Fatalf("expected the pipeline to succeed, got %s", result.Status)
+	}
+}
+
+func TestTruncateIgnoresEscapeSequences(t *testing.T) {
+	got := truncate(colorGreen+"abcdef"+colorReset, 3)
+	if plain := ansiRegexp.ReplaceAllString(got, ""); plain != "abc" {
+		t.Fatalf("expected abc, got %q", plain)
+	}
+}
+
+func newTestBoard(t testing.TB) *board {
+	t.Helper()
+	pipeline := common.CreateNewPipelineDescriptor(t, []string{"build", "test", "deploy"}, []parserCommon.PipelineJobDescriptor{
+		parserCommon.NewPipelineJobDescriptor("build_app", "build", []string{"make"}),
+		parserCommon.NewPipelineJobDescriptor("test_app", "test", []string{"make test"}),
+		parserCommon.NewPipelineJobDescriptor("deploy_app", "deploy", []string{"make deploy"}).WithWhen(parserCommon.WhenManual),
+	})
+	return newBoard(pipeline)
+}
+
+func renderPlain(b *board, now time.Time) string {
+	return ansiRegexp.ReplaceAllString(strings.Join(b.render(200, 50, now), "\n"), "")
+}
+
+func expectContains(t testing.TB, s, substr string) {
+	t.Helper()
+	if !strings.Contains(s, substr) {
+		t.Fatalf("expected %q to be found in\n%s", substr, s)
+	}
+}
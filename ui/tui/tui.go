@@ -0,0 +1,277 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	parserCommon "github.com/powerpixel/pipelinefox/parser/common"
+	"github.com/powerpixel/pipelinefox/runner/common"
+	"golang.org/x/term"
+)
+
+const refreshInterval = 100 * time.Millisecond
+
+const (
+	enterAltScreen = "\x1b[?1049h\x1b[?25l"
+	leaveAltScreen = "\x1b[?25h\x1b[?1049l"
+	clearScreen    = "\x1b[H\x1b[2J"
+)
+
+var NotATerminalErr = errors.New("the terminal UI needs an interactive terminal")
+
+type key int
+
+const (
+	keyUnknown key = iota
+	keyUp
+	keyDown
+	keyPageUp
+	keyPageDown
+	keyEnter
+	keyEscape
+	keyInterrupt
+	keyQuit
+	keyCancel
+	keyRetry
+	keyPlay
+	keyFollow
+)
+
+// Options configures the terminal UI.
+type Options struct {
+	Pipeline parserCommon.PipelineDescriptor
+	// Runner is used to retry jobs and trigger manual ones.
+	Runner common.PipelineRunner
+	// Controller must be the one given to Runner, to cancel running jobs.
+	Controller *common.JobController
+	// Interrupt stops the whole pipeline, a second call forcing it.
+	Interrupt func()
+	In        *os.File
+	Out       *os.File
+}
+
+// TUI draws a live board of the pipeline jobs and lets the user act on them.
+type TUI struct {
+	options Options
+
+	mu    sync.Mutex
+	board *board
+	jobs  sync.WaitGroup
+}
+
+func New(options Options) *TUI {
+	return &TUI{
+		options: options,
+		board:   newBoard(options.Pipeline),
+	}
+}
+
+// Supported reports whether the terminal UI can run on in and out.
+func Supported(in, out *os.File) bool {
+	return term.IsTerminal(int(in.Fd())) && term.IsTerminal(int(out.Fd()))
+}
+
+// Handle updates the board with a pipeline event, it is meant to be
+// subscribed to the runner event bus.
+func (t *TUI) Handle(event common.Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.board.handle(event)
+}
+
+// Run takes over the terminal until the user quits, once pipelineDone is
+// closed and no retried job is running. Jobs retried or triggered from the
+// board are run with ctx. The returned result reflects the last run of every
+// job.
+func (t *TUI) Run(ctx context.Context, pipelineDone <-chan struct{}) (common.PipelineResult, error) {
+	if !Supported(t.options.In, t.options.Out) {
+		return common.PipelineResult{}, NotATerminalErr
+	}
+	inFd, outFd := int(t.options.In.Fd()), int(t.options.Out.Fd())
+
+	state, err := term.MakeRaw(inFd)
+	if err != nil {
+		return common.PipelineResult{}, err
+	}
+	defer term.Restore(inFd, state)
+
+	fmt.Fprint(t.options.Out, enterAltScreen)
+	defer fmt.Fprint(t.options.Out, leaveAltScreen)
+
+	keys := make(chan key)
+	go readKeys(t.options.In, keys)
+
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+
+	quitting := false
+	for {
+		t.draw(outFd)
+
+		select {
+		case k := <-keys:
+			if t.handleKey(ctx, k, pipelineDone) {
+				quitting = true
+			}
+		case <-ticker.C:
+		}
+
+		if quitting && isClosed(pipelineDone) {
+			break
+		}
+	}
+
+	t.jobs.Wait()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.board.result(), nil
+}
+
+// handleKey applies k and reports whether the user asked to quit.
+func (t *TUI) handleKey(ctx context.Context, k key, pipelineDone <-chan struct{}) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	job := t.board.selectedJob()
+
+	switch k {
+	case keyUp:
+		t.board.move(-1)
+	case keyDown:
+		t.board.move(1)
+	case keyPageUp:
+		t.board.scroll(10)
+	case keyPageDown:
+		t.board.scroll(-10)
+	case keyFollow:
+		t.board.logScroll = 0
+	case keyEnter:
+		t.board.openLog()
+	case keyEscape:
+		t.board.closeLog()
+	case keyCancel:
+		if job != nil && !t.options.Controller.Cancel(job.descriptor.GetName()) {
+			t.board.message = job.descriptor.GetName() + " is not running"
+		}
+	case keyRetry:
+		if job != nil && job.finished() {
+			t.start(ctx, job)
+		}
+	case keyPlay:
+		if job != nil && job.status == common.JobStatusManual {
+			t.start(ctx, job)
+		}
+	case keyQuit:
+		if t.board.view == logView {
+			t.board.closeLog()
+			return false
+		}
+		if !isClosed(pipelineDone) {
+			t.board.message = "stopping the pipeline..."
+			t.options.Interrupt()
+		}
+		t.cancelStartedJobs()
+		return true
+	case keyInterrupt:
+		t.board.message = "stopping the pipeline, press Ctrl-C again to force"
+		t.options.Interrupt()
+		t.cancelStartedJobs()
+		return true
+	}
+	return false
+}
+
+// start runs job again outside of the pipeline flow, its progress being
+// reported through the runner events like any other job.
+func (t *TUI) start(ctx context.Context, job *jobState) {
+	job.status = common.JobStatusCreated
+	job.reason = ""
+
+	t.jobs.Add(1)
+	go func() {
+		defer t.jobs.Done()
+		_, err := t.options.Runner.RunPipelineJob(ctx, io.Discard, io.Discard, job.descriptor)
+		if err != nil {
+			t.Handle(common.Warning{Time: time.Now(), Job: job.descriptor.GetName(), Message: err.Error()})
+		}
+	}()
+}
+
+func (t *TUI) cancelStartedJobs() {
+	for _, job := range t.board.jobs {
+		if job.status == common.JobStatusRunning {
+			t.options.Controller.Cancel(job.descriptor.GetName())
+		}
+	}
+}
+
+func (t *TUI) draw(outFd int) {
+	width, height, err := term.GetSize(outFd)
+	if err != nil || width <= 0 || height <= 0 {
+		width, height = 80, 24
+	}
+
+	t.mu.Lock()
+	lines := t.board.render(width, height, time.Now())
+	t.mu.Unlock()
+
+	fmt.Fprint(t.options.Out, clearScreen+strings.Join(lines, "\r\n"))
+}
+
+func readKeys(in io.Reader, keys chan<- key) {
+	buf := make([]byte, 16)
+	for {
+		n, err := in.Read(buf)
+		if err != nil {
+			return
+		}
+		keys <- parseKey(buf[:n])
+	}
+}
+
+func parseKey(input []byte) key {
+	switch string(input) {
+	case "\x1b[A", "k":
+		return keyUp
+	case "\x1b[B", "j":
+		return keyDown
+	case "\x1b[5~":
+		return keyPageUp
+	case "\x1b[6~":
+		return keyPageDown
+	case "\r", "\n":
+		return keyEnter
+	case "\x1b", "\x7f":
+		return keyEscape
+	case "\x03":
+		return keyInterrupt
+	case "q":
+		return keyQuit
+	case "c":
+		return keyCancel
+	case "r":
+		return keyRetry
+	case "p":
+		return keyPlay
+	case "G":
+		return keyFollow
+	default:
+		return keyUnknown
+	}
+}
+
+func isClosed(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}